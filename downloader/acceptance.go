@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var (
+	// submissions caches the data.sec.gov submissions JSON of the filers looked up during the run, nil
+	// for ones whose fetch failed so they aren't retried for each of their filings
+	submissions   = map[string]*edgar.Submissions{}
+	submissionsMu sync.Mutex
+)
+
+// lookupSubmissions returns the submissions JSON of a filer, fetching it once per run, or nil if it
+// couldn't be fetched. With -redis it is shared with the other instances, and only fetched if none of
+// them has within -redis-ttl.
+func lookupSubmissions(ctx context.Context, cik string) *edgar.Submissions {
+	cik = edgar.PadCIK(cik)
+	submissionsMu.Lock()
+	defer submissionsMu.Unlock()
+	s, fetched := submissions[cik]
+	if !fetched {
+		if s = sharedSubmissions(cik); s == nil {
+			var err error
+			s, err = client.Submissions(ctx, cik)
+			// reparse goes without the lookups, which isn't worth logging
+			if err != nil && !errors.Is(err, edgar.ErrOffline) {
+				log.Printf("Failed to look up submissions of CIK %s, %s", cik, err)
+			} else if err == nil && sharedCache != nil {
+				if content, err := json.Marshal(s); err == nil {
+					sharedCache.set("submissions:"+cik, content)
+				}
+			}
+		}
+		submissions[cik] = s
+	}
+	return s
+}
+
+// sharedSubmissions returns the submissions JSON of a filer another instance put in -redis, nil if
+// there is none
+func sharedSubmissions(cik string) *edgar.Submissions {
+	if sharedCache == nil {
+		return nil
+	}
+	content, ok := sharedCache.get("submissions:" + cik)
+	if !ok {
+		return nil
+	}
+	var s edgar.Submissions
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil
+	}
+	return &s
+}
+
+// acceptanceDateTime returns when EDGAR accepted a filing, RFC 3339 in Eastern time so values sort in
+// the order filings were accepted, or "" if it isn't known. It is read from the submission's header,
+// falling back to the filer's submissions JSON with -lookup-acceptance.
+func acceptanceDateTime(ctx context.Context, filing *edgar.IndexEntry, content []byte) string {
+	if accepted, ok := edgar.AcceptanceDateTime(content); ok {
+		return accepted.Format(time.RFC3339)
+	}
+	if !*lookupAcceptance {
+		return ""
+	}
+	s := lookupSubmissions(ctx, filing.CIK)
+	if s == nil {
+		return ""
+	}
+	accepted, err := s.Filings.Recent.AcceptanceDateTimeOf(filing.AccessionNumber)
+	if err != nil {
+		log.Printf("No acceptance time for %s, %s", filing.AccessionNumber, err)
+		return ""
+	}
+	return accepted.Format(time.RFC3339)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var accessionsPath = flag.String("accessions", "", "download and parse only the filings listed in this file, - for stdin, one accession number or EDGAR URL a line, instead of the quarter's daily indexes")
+
+// filingURLPattern finds the CIK and accession number in the URL of a submission, its index page or
+// its folder, e.g. .../edgar/data/1000045/000100004522000005/0001000045-22-000005-index.htm
+var filingURLPattern = regexp.MustCompile(`edgar/data/(\d+)/(\d{18}|\d{10}-\d{2}-\d{6})`)
+
+// readAccessionList reads the filings -accessions lists, skipping blank lines, # comments and repeats
+func readAccessionList(path string) ([]*edgar.IndexEntry, error) {
+	var r io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+	return parseAccessionList(r)
+}
+
+func parseAccessionList(r io.Reader) ([]*edgar.IndexEntry, error) {
+	cached := cachedFilings()
+	filings := []*edgar.IndexEntry{}
+	seen := edgar.AccessionSet{}
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry, err := locateFilingReference(text, "", cached)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", line, err)
+		}
+		if seen.Add(entry.AccessionNumber) {
+			filings = append(filings, entry)
+		}
+	}
+	return filings, scanner.Err()
+}
+
+// locateFilingReference finds the submission of an accession number or EDGAR URL, see locateFiling.
+// A URL's CIK is used over cik.
+func locateFilingReference(reference, cik string, cached map[string]string) (*edgar.IndexEntry, error) {
+	accession := reference
+	if m := filingURLPattern.FindStringSubmatch(reference); m != nil {
+		cik, accession = m[1], m[2]
+	}
+	return locateFiling(accession, cik, cached)
+}
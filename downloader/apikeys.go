@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// API key scopes, admin can do everything read can
+const (
+	scopeRead  = "read"
+	scopeAdmin = "admin"
+)
+
+// APIKey is a key the serve command accepts. Only the key's SHA-256 is kept, it is shown once when
+// created.
+type APIKey struct {
+	Name    string    `json:"name"`
+	Scope   string    `json:"scope"`
+	SHA256  string    `json:"sha256"`
+	Created time.Time `json:"created"`
+	// Rate and DailyQuota override serve's -rate and -daily-quota for the key when set
+	Rate       float64 `json:"rate,omitempty"`
+	DailyQuota int     `json:"daily_quota,omitempty"`
+}
+
+// apiKeysPath is where the keys are kept, next to config.json
+func apiKeysPath() string {
+	return filepath.Join(*configDir, "api_keys.json")
+}
+
+// LoadAPIKeys reads the keys at path, none if it doesn't exist yet
+func LoadAPIKeys(path string) ([]APIKey, error) {
+	content, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	keys := []APIKey{}
+	if err := json.Unmarshal(content, &keys); err != nil {
+		return nil, fmt.Errorf("error parsing API keys %s: %w", path, err)
+	}
+	return keys, nil
+}
+
+// SaveAPIKeys writes the keys to path, readable only by the user
+func SaveAPIKeys(path string, keys []APIKey) error {
+	content, err := json.MarshalIndent(keys, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, append(content, '\n'), 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// authenticate returns the key a request's Authorization: Bearer or X-API-Key header carries, false
+// if it carries none or one that isn't in keys
+func authenticate(r *http.Request, keys []APIKey) (APIKey, bool) {
+	key := r.Header.Get("X-API-Key")
+	if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+		key = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+	}
+	if key == "" {
+		return APIKey{}, false
+	}
+	hash := hashAPIKey(key)
+	for _, k := range keys {
+		if subtle.ConstantTimeCompare([]byte(k.SHA256), []byte(hash)) == 1 {
+			return k, true
+		}
+	}
+	return APIKey{}, false
+}
+
+// isLoopback is whether a listen address only accepts connections from this machine
+func isLoopback(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+func runKeysCommand(args []string) {
+	if len(args) == 0 {
+		log.Println("Missing keys subcommand")
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	path := apiKeysPath()
+	keys, err := LoadAPIKeys(path)
+	if err != nil {
+		log.Fatal(err)
+	}
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ExitOnError)
+		scope := fs.String("scope", scopeRead, "what the key may do: read, or admin for everything")
+		rate := fs.Float64("rate", 0, "requests a second the key may make on average (default serve's -rate)")
+		dailyQuota := fs.Int("daily-quota", 0, "requests the key may make a UTC day (default serve's -daily-quota)")
+		fs.Parse(args[1:])
+		if fs.NArg() != 1 {
+			log.Fatal("Usage: keys create [-scope read|admin] [-rate n] [-daily-quota n] <name>")
+		}
+		name := fs.Arg(0)
+		if *scope != scopeRead && *scope != scopeAdmin {
+			log.Fatalf("Unknown scope %q, expected read or admin", *scope)
+		}
+		for _, k := range keys {
+			if k.Name == name {
+				log.Fatalf("There is already a key named %s, revoke it first", name)
+			}
+		}
+		secret := make([]byte, 24)
+		if _, err := rand.Read(secret); err != nil {
+			log.Fatal(err)
+		}
+		key := "sec4_" + hex.EncodeToString(secret)
+		keys = append(keys, APIKey{Name: name, Scope: *scope, SHA256: hashAPIKey(key), Created: time.Now().UTC().Truncate(time.Second),
+			Rate: *rate, DailyQuota: *dailyQuota})
+		if err = SaveAPIKeys(path, keys); err != nil {
+			log.Println("Failed to save API keys")
+			log.Fatal(err)
+		}
+		// The key itself is only ever printed here
+		fmt.Println(key)
+	case "list":
+		sort.Slice(keys, func(i, j int) bool { return keys[i].Name < keys[j].Name })
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tSCOPE\tCREATED\tRATE\tDAILY_QUOTA")
+		for _, k := range keys {
+			rate, quota := "default", "default"
+			if k.Rate > 0 {
+				rate = strconv.FormatFloat(k.Rate, 'f', -1, 64)
+			}
+			if k.DailyQuota > 0 {
+				quota = strconv.Itoa(k.DailyQuota)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", k.Name, k.Scope, k.Created.Format(time.RFC3339), rate, quota)
+		}
+		w.Flush()
+	case "revoke":
+		if len(args) != 2 {
+			log.Fatal("Usage: keys revoke <name>")
+		}
+		kept := keys[:0]
+		for _, k := range keys {
+			if k.Name != args[1] {
+				kept = append(kept, k)
+			}
+		}
+		if len(kept) == len(keys) {
+			log.Fatalf("No key is named %s", args[1])
+		}
+		if err = SaveAPIKeys(path, kept); err != nil {
+			log.Println("Failed to save API keys")
+			log.Fatal(err)
+		}
+		log.Printf("Revoked %s, it is refused once serve is restarted or reloaded", args[1])
+	default:
+		log.Printf("Unknown keys subcommand %q", args[0])
+		usage()
+		os.Exit(exitUsage)
+	}
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var jobName = flag.String("job", "", "claim the quarters of -period and their filings through -redis as part of this backfill job, so every worker running the same job downloads a share of them and no filing twice")
+
+const (
+	// jobLease is how long a worker's claim on a quarter lasts without being renewed, after which
+	// another worker may take the quarter over
+	jobLease = time.Minute
+	// jobRenewEvery is how often the claims held are renewed
+	jobRenewEvery = jobLease / 3
+)
+
+// backfillJob is the job of -job, nil without it
+var backfillJob *jobClaims
+
+// jobClaims is a worker's part in a backfill job shared through Redis. A quarter is claimed by
+// setting its key to the worker's ID if no other worker has, then held while the worker downloads it
+// and marked done once its manifest is written. Each filing of it is claimed for the quarter too, so
+// one listed in the daily indexes of two quarters is only written by the first to claim it.
+type jobClaims struct {
+	cache  *redisCache
+	name   string
+	worker string
+
+	mu   sync.Mutex
+	held map[period]bool
+	stop chan struct{}
+}
+
+// setupJob joins the -job backfill, if set
+func setupJob() error {
+	if *jobName == "" {
+		return nil
+	}
+	if sharedCache == nil {
+		return fmt.Errorf("-job needs -redis")
+	}
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	backfillJob = &jobClaims{cache: sharedCache, name: *jobName, worker: host + ":" + strconv.Itoa(os.Getpid()), held: map[period]bool{}, stop: make(chan struct{})}
+	go backfillJob.renew()
+	return nil
+}
+
+func (j *jobClaims) key(parts ...string) string {
+	key := "job:" + j.name
+	for _, part := range parts {
+		key += ":" + part
+	}
+	return key
+}
+
+// claimQuarter claims p for this worker, returning false if it is done or another worker holds it
+func (j *jobClaims) claimQuarter(p period) (bool, error) {
+	done, err := j.cache.do("EXISTS", *redisPrefix+j.key("done", p.String()))
+	if err != nil {
+		return false, err
+	}
+	if done != int64(0) {
+		return false, nil
+	}
+	claimed, err := j.cache.claim(j.key("quarter", p.String()), j.worker, jobLease)
+	if err != nil || !claimed {
+		return false, err
+	}
+	j.mu.Lock()
+	j.held[p] = true
+	j.mu.Unlock()
+	return true, nil
+}
+
+// renew extends the lease on the quarters held until close. A claim can only be lost to another
+// worker if this one couldn't renew it for a whole lease, which is logged.
+func (j *jobClaims) renew() {
+	ticker := time.NewTicker(jobRenewEvery)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+		j.mu.Lock()
+		for p := range j.held {
+			key := *redisPrefix + j.key("quarter", p.String())
+			owner, err := j.cache.do("GET", key)
+			if err == nil && owner != j.worker {
+				log.Printf("Lost the claim on %s to %v, another worker may be downloading it too", p, owner)
+				delete(j.held, p)
+				continue
+			}
+			if err == nil {
+				_, err = j.cache.do("PEXPIRE", key, strconv.FormatInt(jobLease.Milliseconds(), 10))
+			}
+			if err != nil {
+				log.Printf("Failed to renew the claim on %s, %s", p, err)
+			}
+		}
+		j.mu.Unlock()
+	}
+}
+
+// finish gives up the claim on p, marking it done for good if it was downloaded in full, so no other
+// worker downloads it again
+func (j *jobClaims) finish(p period, done bool) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	if !j.held[p] {
+		return
+	}
+	delete(j.held, p)
+	if done {
+		if _, err := j.cache.do("SET", *redisPrefix+j.key("done", p.String()), j.worker); err != nil {
+			log.Printf("Failed to mark %s done, %s", p, err)
+		}
+	}
+	if _, err := j.cache.do("DEL", *redisPrefix+j.key("quarter", p.String())); err != nil {
+		log.Printf("Failed to release the claim on %s, %s", p, err)
+	}
+}
+
+// close stops renewing claims
+func (j *jobClaims) close() {
+	close(j.stop)
+}
+
+// filter keeps the filings claimed for p, claiming those no quarter has. Claims don't expire, so a
+// quarter downloaded again, by a resumed or retried run, keeps its filings. Without -job every filing
+// is kept.
+func (j *jobClaims) filter(ctx context.Context, filings []*edgar.IndexEntry, p period) ([]*edgar.IndexEntry, error) {
+	if j == nil {
+		return filings, nil
+	}
+	kept := filings[:0]
+	for _, filing := range filings {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		key := j.key("accession", filing.AccessionNumber)
+		claimed, err := j.cache.claim(key, p.String(), 0)
+		if err != nil {
+			return nil, fmt.Errorf("error claiming %s: %w", filing.AccessionNumber, err)
+		}
+		if !claimed {
+			owner, err := j.cache.do("GET", *redisPrefix+key)
+			if err != nil {
+				return nil, fmt.Errorf("error claiming %s: %w", filing.AccessionNumber, err)
+			}
+			if owner != p.String() {
+				infof("Skipping %s, it was claimed for %v", filing.AccessionNumber, owner)
+				continue
+			}
+		}
+		kept = append(kept, filing)
+	}
+	return kept, nil
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+)
+
+var (
+	batchRows   = flag.Int("batch-rows", 0, "rows the database sinks send at once, per insert, staged file or append (default 10000 for snowflake, 100000 for redshift and 500 for bigquery, whose appends are limited to 10MB)")
+	commitRows  = flag.Int("commit-rows", 0, "commit the rows a database sink has loaded to its table in a transaction every this many rows, rather than all at once when the run finishes, so an interrupted backfill keeps what it committed")
+	sinkRetries = flag.Int("sink-retries", 3, "times a database sink retries a batch or commit that failed, with exponential backoff")
+)
+
+// sinkBatchRows is -batch-rows, or a sink's own default when it isn't set
+func sinkBatchRows(defaultRows int) int {
+	if *batchRows > 0 {
+		return *batchRows
+	}
+	return defaultRows
+}
+
+// retrySink runs fn, a batch or commit of a database sink, retrying it with exponential backoff up
+// to -sink-retries times. fn must be safe to run again after failing, the batches and commits of
+// the sinks are single statements or transactions.
+func retrySink(ctx context.Context, what string, fn func() error) error {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	return backoff.RetryNotify(fn, backoff.WithContext(backoff.WithMaxRetries(b, uint64(*sinkRetries)), ctx), func(err error, d time.Duration) {
+		log.Printf("%s failed, retrying in %s: %s", what, d.Round(time.Millisecond), err)
+	})
+}
+
+// commitPoint tells a database sink when to commit with -commit-rows: once that many rows are loaded
+// and the next row starts another filing, so a filing's rows are never split across commits
+type commitPoint struct {
+	loaded    int
+	accession string
+}
+
+// add counts a row about to be loaded, returning whether the rows loaded before it are to be
+// committed first
+func (c *commitPoint) add(row *Row) bool {
+	accession := row.Get("ACCESSION_NUMBER")
+	due := *commitRows > 0 && c.loaded >= *commitRows && accession != c.accession
+	if due {
+		c.loaded = 0
+	}
+	c.loaded++
+	c.accession = accession
+	return due
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cloud.google.com/go/bigquery"
+	"cloud.google.com/go/bigquery/storage/managedwriter"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"google.golang.org/api/googleapi"
+	"google.golang.org/api/iterator"
+	storagepb "google.golang.org/genproto/googleapis/cloud/bigquery/storage/v1"
+	"google.golang.org/protobuf/encoding/protowire"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+func init() {
+	RegisterSink("bigquery", openBigQuery)
+	migrationDBs["bigquery"] = openBigQueryMigrations
+}
+
+// bigQueryBatchRows is how many rows go in one AppendRows request unless -batch-rows says otherwise,
+// well under its 10MB limit
+const bigQueryBatchRows = 500
+
+// bigQueryWriter streams rows into a load table of the run's own through the Storage Write API,
+// and merges them into the BigQuery table when it closes, or every -commit-rows, updating the rows
+// already in it in place. Each commit's rows show up in the table all at once, and a run that fails
+// leaves the table as it was at its last commit.
+type bigQueryWriter struct {
+	bq     *bigquery.Client
+	client *managedwriter.Client
+	// stream is the pending stream rows are appended to, opened by the first row after each commit
+	stream *managedwriter.ManagedStream
+	// table and load are the table and the run's load table, in dataset
+	dataset string
+	table   string
+	load    string
+	header  []string
+
+	batchRows int
+	commits   commitPoint
+	batch     [][]byte
+	results   []*managedwriter.AppendResult
+}
+
+// openBigQuery is the bigquery sink. -output names the table as project.dataset.table, or
+// dataset.table in the project of the application default credentials. The dataset and table are
+// created if they don't exist, the table partitioned by day on DATE_FILED.
+func openBigQuery(ctx context.Context, opts SinkOptions) (RowWriter, error) {
+	for _, name := range []string{"partition", "columns", "format", "compress", "max-rows", "max-bytes"} {
+		if flagIsSet(flag.CommandLine, name) {
+			return nil, fmt.Errorf("-%s does not apply to the bigquery sink", name)
+		}
+	}
+
+	bq, dataset, table, err := openBigQueryDataset(ctx, opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	err = checkTableSchema(ctx, &bigQueryMigrationDB{bq: bq, dialect: bigQueryDialect(bq.Project(), dataset, table)}, func() error {
+		return createBigQueryTable(ctx, bq, dataset, table, opts.Header)
+	})
+	if err != nil {
+		bq.Close()
+		return nil, err
+	}
+	// The load table expires on its own, so one left by a run that failed goes away
+	load := table + "_sec4_load_" + gonanoid.MustGenerate("abcdefghijklmnopqrstuvwxyz0123456789", 12)
+	err = bq.Dataset(dataset).Table(load).Create(ctx, &bigquery.TableMetadata{
+		Schema:         bigQuerySchema(opts.Header),
+		ExpirationTime: time.Now().Add(24 * time.Hour),
+	})
+	if err != nil {
+		bq.Close()
+		return nil, fmt.Errorf("creating %s.%s: %w", dataset, load, err)
+	}
+
+	client, err := managedwriter.NewClient(ctx, bq.Project())
+	if err != nil {
+		bq.Close()
+		return nil, err
+	}
+	return &bigQueryWriter{
+		bq:        bq,
+		client:    client,
+		dataset:   dataset,
+		table:     table,
+		load:      load,
+		header:    opts.Header,
+		batchRows: sinkBatchRows(bigQueryBatchRows),
+	}, nil
+}
+
+// parseTableName splits a project.dataset.table or dataset.table name
+func parseTableName(name string) (project, dataset, table string, err error) {
+	parts := strings.Split(name, ".")
+	for _, p := range parts {
+		if p == "" {
+			parts = nil
+		}
+	}
+	switch len(parts) {
+	case 2:
+		return "", parts[0], parts[1], nil
+	case 3:
+		return parts[0], parts[1], parts[2], nil
+	}
+	return "", "", "", fmt.Errorf("expected -output to name a table as project.dataset.table or dataset.table, got %q", name)
+}
+
+// openBigQueryDataset connects to the project of a project.dataset.table or dataset.table -output,
+// creating the dataset if it doesn't exist
+func openBigQueryDataset(ctx context.Context, target string) (bq *bigquery.Client, dataset, table string, err error) {
+	project, dataset, table, err := parseTableName(target)
+	if err != nil {
+		return nil, "", "", err
+	}
+	if project == "" {
+		project = bigquery.DetectProjectID
+	}
+	bq, err = bigquery.NewClient(ctx, project)
+	if err != nil {
+		return nil, "", "", err
+	}
+
+	ds := bq.Dataset(dataset)
+	if _, err = ds.Metadata(ctx); hasStatus(err, http.StatusNotFound) {
+		if err = ds.Create(ctx, nil); hasStatus(err, http.StatusConflict) {
+			err = nil
+		}
+	}
+	if err != nil {
+		bq.Close()
+		return nil, "", "", fmt.Errorf("creating dataset %s: %w", dataset, err)
+	}
+	return bq, dataset, table, nil
+}
+
+func createBigQueryTable(ctx context.Context, bq *bigquery.Client, dataset, table string, header []string) error {
+	err := bq.Dataset(dataset).Table(table).Create(ctx, &bigquery.TableMetadata{
+		Schema:           bigQuerySchema(header),
+		TimePartitioning: &bigquery.TimePartitioning{Type: bigquery.DayPartitioningType, Field: "date_filed"},
+	})
+	if hasStatus(err, http.StatusConflict) {
+		return nil
+	}
+	return err
+}
+
+// bigQuerySchema has every column as a string, as the flat output writes them, but the filing date
+// the table is partitioned on
+func bigQuerySchema(header []string) bigquery.Schema {
+	schema := bigquery.Schema{}
+	for _, column := range header {
+		schema = append(schema, &bigquery.FieldSchema{Name: bigQueryColumn(column), Type: bigquery.StringFieldType, Description: columnDocs[column].Description})
+	}
+	return append(schema, &bigquery.FieldSchema{Name: "date_filed", Type: bigquery.DateFieldType, Description: "Date the filing was filed"})
+}
+
+// openBigQueryMigrations opens the -output table's dataset for db migrate
+func openBigQueryMigrations(ctx context.Context, target string) (migrationDB, error) {
+	bq, dataset, table, err := openBigQueryDataset(ctx, target)
+	if err != nil {
+		return nil, err
+	}
+	return &bigQueryMigrationDB{bq: bq, dialect: bigQueryDialect(bq.Project(), dataset, table)}, nil
+}
+
+func bigQueryDialect(project, dataset, table string) migrationDialect {
+	return migrationDialect{
+		Table:        fmt.Sprintf("`%s.%s.%s`", project, dataset, table),
+		Migrations:   fmt.Sprintf("`%s.%s.%s`", project, dataset, migrationsTable),
+		Name:         bigQueryColumn,
+		Quote:        bigQueryQuote,
+		Text:         "STRING",
+		Int:          "INT64",
+		Bool:         "BOOL",
+		Timestamp:    "TIMESTAMP",
+		ColumnsQuery: fmt.Sprintf("SELECT column_name FROM `%s.%s.INFORMATION_SCHEMA.COLUMNS` WHERE table_name = '%s'", project, dataset, sqlString(table)),
+	}
+}
+
+// bigQueryMigrationDB runs the statements of migrations as query jobs
+type bigQueryMigrationDB struct {
+	bq      *bigquery.Client
+	dialect migrationDialect
+}
+
+func (m *bigQueryMigrationDB) Dialect() migrationDialect {
+	return m.dialect
+}
+
+func (m *bigQueryMigrationDB) Exec(ctx context.Context, statement string) error {
+	job, err := m.bq.Query(statement).Run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+func (m *bigQueryMigrationDB) Query(ctx context.Context, query string) ([][]string, error) {
+	it, err := m.bq.Query(query).Read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	values := [][]string{}
+	for {
+		var row []bigquery.Value
+		err = it.Next(&row)
+		if err == iterator.Done {
+			return values, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		strs := make([]string, len(row))
+		for i, v := range row {
+			if v != nil {
+				strs[i] = fmt.Sprint(v)
+			}
+		}
+		values = append(values, strs)
+	}
+}
+
+func (m *bigQueryMigrationDB) Close() error {
+	return m.bq.Close()
+}
+
+func hasStatus(err error, code int) bool {
+	var apiErr *googleapi.Error
+	return errors.As(err, &apiErr) && apiErr.Code == code
+}
+
+// bigQueryColumn is a column's name in BigQuery and the row message, lower cased with anything but
+// letters, digits and underscores replaced so extractor columns make valid names too
+func bigQueryColumn(column string) string {
+	name := []byte(strings.ToLower(column))
+	for i, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			name[i] = '_'
+		}
+	}
+	if len(name) == 0 || name[0] >= '0' && name[0] <= '9' {
+		name = append([]byte("_"), name...)
+	}
+	return string(name)
+}
+
+// bigQueryDescriptor describes the message each row is appended as: the header's columns as string
+// fields numbered from 1 in order, then date_filed as days since the epoch, which is how the Storage
+// Write API takes a DATE
+func bigQueryDescriptor(header []string) *descriptorpb.DescriptorProto {
+	field := func(number int, name string, kind descriptorpb.FieldDescriptorProto_Type) *descriptorpb.FieldDescriptorProto {
+		return &descriptorpb.FieldDescriptorProto{
+			Name:   proto.String(name),
+			Number: proto.Int32(int32(number)),
+			Label:  descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+			Type:   kind.Enum(),
+		}
+	}
+	dp := &descriptorpb.DescriptorProto{Name: proto.String("Row")}
+	for i, column := range header {
+		dp.Field = append(dp.Field, field(i+1, bigQueryColumn(column), descriptorpb.FieldDescriptorProto_TYPE_STRING))
+	}
+	dp.Field = append(dp.Field, field(len(header)+1, "date_filed", descriptorpb.FieldDescriptorProto_TYPE_INT32))
+	return dp
+}
+
+func (w *bigQueryWriter) Write(ctx context.Context, row *Row) error {
+	filed, err := time.Parse("20060102", row.Filing.DateFiled)
+	if err != nil {
+		return fmt.Errorf("filing %s has date filed %q: %w", row.Filing.AccessionNumber, row.Filing.DateFiled, err)
+	}
+	if w.commits.add(row) {
+		if err = w.commit(ctx); err != nil {
+			return err
+		}
+	}
+	if w.stream == nil {
+		// Appends that fail on a transient error are retried, which may load a row twice, the merge
+		// only takes one of each
+		w.stream, err = w.client.NewManagedStream(ctx,
+			managedwriter.WithDestinationTable(managedwriter.TableParentFromParts(w.bq.Project(), w.dataset, w.load)),
+			managedwriter.WithType(managedwriter.PendingStream),
+			managedwriter.WithSchemaDescriptor(bigQueryDescriptor(w.header)),
+			managedwriter.EnableWriteRetries(true),
+		)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Every value is written, empty ones too, so they load as "" like in the file outputs rather than NULL
+	var msg []byte
+	for i := range w.header {
+		msg = protowire.AppendTag(msg, protowire.Number(i+1), protowire.BytesType)
+		msg = protowire.AppendString(msg, row.value(i))
+	}
+	msg = protowire.AppendTag(msg, protowire.Number(len(w.header)+1), protowire.VarintType)
+	msg = protowire.AppendVarint(msg, uint64(filed.Unix()/86400))
+
+	w.batch = append(w.batch, msg)
+	if len(w.batch) >= w.batchRows {
+		return w.flush(ctx)
+	}
+	return nil
+}
+
+// flush appends the batched rows. The result is only checked on commit, the stream keeps a bounded
+// number of appends in flight and blocks further ones until they are acknowledged.
+func (w *bigQueryWriter) flush(ctx context.Context) error {
+	if len(w.batch) == 0 {
+		return nil
+	}
+	result, err := w.stream.AppendRows(ctx, w.batch)
+	if err != nil {
+		return err
+	}
+	w.results = append(w.results, result)
+	w.batch = nil
+	return nil
+}
+
+// commit commits the stream to the load table and merges that into the table
+func (w *bigQueryWriter) commit(ctx context.Context) error {
+	if w.stream == nil {
+		return nil
+	}
+	stream := w.stream
+	w.stream = nil
+	if err := w.flush(ctx); err != nil {
+		stream.Close()
+		return err
+	}
+	for _, result := range w.results {
+		if _, err := result.GetResult(ctx); err != nil {
+			stream.Close()
+			return fmt.Errorf("appending rows: %w", err)
+		}
+	}
+	w.results = nil
+	if _, err := stream.Finalize(ctx); err != nil {
+		stream.Close()
+		return err
+	}
+
+	resp, err := w.client.BatchCommitWriteStreams(ctx, &storagepb.BatchCommitWriteStreamsRequest{
+		Parent:       managedwriter.TableParentFromStreamName(stream.StreamName()),
+		WriteStreams: []string{stream.StreamName()},
+	})
+	if err != nil {
+		stream.Close()
+		return err
+	}
+	if len(resp.GetStreamErrors()) > 0 {
+		stream.Close()
+		return fmt.Errorf("committing rows: %s", resp.GetStreamErrors()[0].GetErrorMessage())
+	}
+	if err = stream.Close(); err != nil {
+		return err
+	}
+	err = retrySink(ctx, fmt.Sprintf("Merging into %s.%s", w.dataset, w.table), func() error {
+		return w.merge(ctx)
+	})
+	if err != nil {
+		return fmt.Errorf("merging %s.%s into %s.%s: %w", w.dataset, w.load, w.dataset, w.table, err)
+	}
+	return nil
+}
+
+// merge merges the load table into the table on upsertKey in one transaction, updating the rows
+// already in it and inserting the rest, then deletes the rows of the loaded filings that weren't
+// loaded and empties the load table
+func (w *bigQueryWriter) merge(ctx context.Context) error {
+	columns, updates, values, key := []string{}, []string{}, []string{}, []string{}
+	for _, column := range append(append([]string{}, w.header...), "date_filed") {
+		quoted := bigQueryQuote(column)
+		columns = append(columns, quoted)
+		updates = append(updates, fmt.Sprintf("%s = l.%s", quoted, quoted))
+		values = append(values, "l."+quoted)
+	}
+	for _, column := range upsertKey {
+		key = append(key, bigQueryQuote(column))
+	}
+	table, load := fmt.Sprintf("`%s.%s`", w.dataset, w.table), fmt.Sprintf("`%s.%s`", w.dataset, w.load)
+	source := fmt.Sprintf("(SELECT * FROM %s WHERE TRUE QUALIFY ROW_NUMBER() OVER (PARTITION BY %s) = 1)", load, strings.Join(key, ", "))
+	script := strings.Join([]string{
+		"BEGIN TRANSACTION",
+		fmt.Sprintf("MERGE %s t USING %s l ON %s WHEN MATCHED THEN UPDATE SET %s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+			table, source, keyMatches("t", "l", bigQueryQuote), strings.Join(updates, ", "), strings.Join(columns, ", "), strings.Join(values, ", ")),
+		deleteStaleRows(table+" t", "t", load, bigQueryQuote),
+		fmt.Sprintf("DELETE FROM %s WHERE TRUE", load),
+		"COMMIT TRANSACTION",
+	}, ";\n") + ";"
+
+	job, err := w.bq.Query(script).Run(ctx)
+	if err != nil {
+		return err
+	}
+	status, err := job.Wait(ctx)
+	if err != nil {
+		return err
+	}
+	return status.Err()
+}
+
+// Close commits the rows appended since the last commit and drops the load table
+func (w *bigQueryWriter) Close() error {
+	defer w.bq.Close()
+	defer w.client.Close()
+	ctx := context.Background()
+	if err := w.commit(ctx); err != nil {
+		return err
+	}
+	return w.bq.Dataset(w.dataset).Table(w.load).Delete(ctx)
+}
+
+// bigQueryQuote quotes a column as bigQueryColumn names it
+func bigQueryQuote(column string) string {
+	return "`" + bigQueryColumn(column) + "`"
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"archive/tar"
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+const bundleManifestName = "index.jsonl"
+
+// ExportBundle writes every indexed object plus the index itself to a tar.zst bundle at bundlePath
+func ExportBundle(s *edgar.Store, bundlePath string) (objects int, err error) {
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		return 0, err
+	}
+	tw := tar.NewWriter(zw)
+
+	entries := s.Entries()
+	manifest := []byte{}
+	written := map[string]bool{}
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return objects, err
+		}
+		manifest = append(append(manifest, line...), '\n')
+
+		if written[entry.SHA256] {
+			continue
+		}
+		if err := addObjectToBundle(s, tw, entry.SHA256); err != nil {
+			return objects, fmt.Errorf("error adding object %s: %w", entry.SHA256, err)
+		}
+		written[entry.SHA256] = true
+		objects++
+	}
+
+	// The manifest goes last so that an importer never sees index entries for objects it has not read yet
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    bundleManifestName,
+		Mode:    0666,
+		Size:    int64(len(manifest)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return objects, err
+	}
+	if _, err := tw.Write(manifest); err != nil {
+		return objects, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return objects, err
+	}
+	if err := zw.Close(); err != nil {
+		return objects, err
+	}
+	return objects, f.Close()
+}
+
+func addObjectToBundle(s *edgar.Store, tw *tar.Writer, hash string) error {
+	// Objects are bundled decrypted, so the bundle imports into a cache with any key or none
+	content, err := s.ReadObject(hash)
+	if err != nil {
+		return err
+	}
+	if err := tw.WriteHeader(&tar.Header{
+		Name:    path.Join("objects", hash[:2], hash),
+		Mode:    0666,
+		Size:    int64(len(content)),
+		ModTime: time.Now(),
+	}); err != nil {
+		return err
+	}
+	_, err = tw.Write(content)
+	return err
+}
+
+// ImportBundle loads the objects and index entries of a bundle into the store. Objects are checked
+// against their hash before they are written, and URLs already in the store keep their local entry.
+func ImportBundle(s *edgar.Store, bundlePath string) (objects, entries int, err error) {
+	f, err := os.Open(bundlePath)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+
+	zr, err := zstd.NewReader(f)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer zr.Close()
+
+	tr := tar.NewReader(zr)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return objects, entries, err
+		}
+
+		switch {
+		case hdr.Name == bundleManifestName:
+			n, err := importBundleManifest(s, tr)
+			entries += n
+			if err != nil {
+				return objects, entries, err
+			}
+		case strings.HasPrefix(hdr.Name, "objects/"):
+			hash := path.Base(hdr.Name)
+			if err := s.PutObject(hash, tr); err != nil {
+				return objects, entries, fmt.Errorf("error importing object %s: %w", hash, err)
+			}
+			objects++
+		default:
+			return objects, entries, fmt.Errorf("unexpected file %s in bundle", hdr.Name)
+		}
+	}
+
+	return objects, entries, nil
+}
+
+func importBundleManifest(s *edgar.Store, r io.Reader) (int, error) {
+	added := 0
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var entry edgar.StoreEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return added, fmt.Errorf("invalid manifest line: %w", err)
+		}
+		ok, err := s.AddEntry(&entry)
+		if err != nil {
+			return added, err
+		}
+		if ok {
+			added++
+		}
+	}
+	return added, scanner.Err()
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/klauspost/compress/zstd"
+)
+
+// writeBundle writes a bundle holding files, in order, as an exporter would
+func writeBundle(t *testing.T, files [][2]string) string {
+	t.Helper()
+	bundlePath := filepath.Join(t.TempDir(), "bad.tar.zst")
+	f, err := os.Create(bundlePath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	zw, err := zstd.NewWriter(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tw := tar.NewWriter(zw)
+	for _, file := range files {
+		if err := tw.WriteHeader(&tar.Header{Name: file[0], Mode: 0666, Size: int64(len(file[1]))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(file[1])); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return bundlePath
+}
+
+func TestImportBadBundle(t *testing.T) {
+	for name, files := range map[string][][2]string{
+		"short object name":   {{"objects/a", "content"}},
+		"object directory":    {{"objects/", ""}},
+		"upper case hash":     {{"objects/AB/AB12", "content"}},
+		"empty manifest hash": {{bundleManifestName, `{"url":"https://www.sec.gov/Archives/edgar/data/1/0000000001-22-000001.txt","sha256":"","size":7}` + "\n"}},
+		"manifest path hash":  {{bundleManifestName, `{"url":"https://www.sec.gov/x","sha256":"../../../../etc/passwd","size":7}` + "\n"}},
+	} {
+		files := files
+		t.Run(name, func(t *testing.T) {
+			s, err := edgar.OpenStore(t.TempDir(), edgar.StoreOptions{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer s.Close()
+			_, _, err = ImportBundle(s, writeBundle(t, files))
+			if !errors.Is(err, edgar.ErrInvalidHash) {
+				t.Fatalf("ImportBundle() = %v, want ErrInvalidHash", err)
+			}
+			if entries := s.Entries(); len(entries) != 0 {
+				t.Errorf("ImportBundle() indexed %d entries from a bad bundle", len(entries))
+			}
+		})
+	}
+}
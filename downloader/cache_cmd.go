@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"time"
+)
+
+func runCacheCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		log.Println("Missing cache subcommand")
+		usage()
+		os.Exit(exitUsage)
+	}
+
+	switch args[0] {
+	case "verify":
+		runCacheVerify(ctx, args[1:])
+	case "status":
+		runCacheStatus(args[1:])
+	case "export":
+		runCacheExport(args[1:])
+	case "import":
+		runCacheImport(args[1:])
+	default:
+		log.Printf("Unknown cache subcommand %q", args[0])
+		usage()
+		os.Exit(exitUsage)
+	}
+}
+
+func runCacheVerify(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("cache verify", flag.ExitOnError)
+	redownload := fs.Bool("redownload", false, "re-download every URL that points at a corrupt object")
+	fs.Parse(args)
+
+	checked, corrupt, err := store.Verify()
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("Checked %d objects, %d corrupt", checked, len(corrupt))
+
+	for _, obj := range corrupt {
+		log.Printf("Corrupt object %s (%s), referenced by %d urls", obj.SHA256, obj.Reason, len(obj.URLs))
+		if !*redownload {
+			continue
+		}
+
+		if err := store.RemoveObject(obj.SHA256); err != nil {
+			log.Println("Failed to remove corrupt object", obj.SHA256)
+			log.Fatal(err)
+		}
+		for _, url := range obj.URLs {
+			content, err := client.Get(ctx, url)
+			if err != nil {
+				log.Printf("Error re-downloading %s: %s", url, err)
+				continue
+			}
+			if _, err = store.Put(url, content); err != nil {
+				log.Println("Failed to write file to store", url)
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if len(corrupt) > 0 && !*redownload {
+		os.Exit(exitPartial)
+	}
+}
+
+func runCacheExport(args []string) {
+	fs := flag.NewFlagSet("cache export", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: cache export <bundle.tar.zst>")
+	}
+
+	s := time.Now()
+	objects, err := ExportBundle(store, fs.Arg(0))
+	if err != nil {
+		log.Println("Failed to export bundle", fs.Arg(0))
+		log.Fatal(err)
+	}
+	log.Printf("Exported %d objects to %s in %s", objects, fs.Arg(0), time.Since(s))
+}
+
+func runCacheImport(args []string) {
+	fs := flag.NewFlagSet("cache import", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: cache import <bundle.tar.zst>")
+	}
+
+	s := time.Now()
+	objects, entries, err := ImportBundle(store, fs.Arg(0))
+	if err != nil {
+		log.Println("Failed to import bundle", fs.Arg(0))
+		log.Fatal(err)
+	}
+	log.Printf("Imported %d objects and %d new index entries from %s in %s", objects, entries, fs.Arg(0), time.Since(s))
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// masterFileURL picks the quarter and date out of a daily master file's URL
+var masterFileURL = regexp.MustCompile(`/edgar/daily-index/(\d{4})/QTR(\d)/master\.(\d{8})\.idx$`)
+
+// quarterCoverage is the daily master files cached for a quarter, by their dates
+type quarterCoverage struct {
+	days          int
+	first, latest string
+}
+
+// runCacheStatus prints what the cache holds and where its index and the disk disagree, exiting 1 if
+// they do, and with -fix reconciles them
+func runCacheStatus(args []string) {
+	fs := flag.NewFlagSet("cache status", flag.ExitOnError)
+	fix := fs.Bool("fix", false, "delete the orphaned files and drop the entries whose object is missing from the index")
+	fs.Parse(args)
+
+	status, err := store.Status()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	filings, quarterlies, others := 0, 0, 0
+	quarters := map[string]*quarterCoverage{}
+	var firstFetched, lastFetched time.Time
+	for _, entry := range status.Entries {
+		if firstFetched.IsZero() || entry.FetchedAt.Before(firstFetched) {
+			firstFetched = entry.FetchedAt
+		}
+		if entry.FetchedAt.After(lastFetched) {
+			lastFetched = entry.FetchedAt
+		}
+		if m := masterFileURL.FindStringSubmatch(entry.URL); m != nil {
+			name, day := m[1]+"Q"+m[2], isoDate(m[3])
+			q := quarters[name]
+			if q == nil {
+				q = &quarterCoverage{first: day, latest: day}
+				quarters[name] = q
+			}
+			q.days++
+			if day < q.first {
+				q.first = day
+			}
+			if day > q.latest {
+				q.latest = day
+			}
+			continue
+		}
+		switch {
+		case strings.Contains(entry.URL, "/edgar/full-index/"):
+			quarterlies++
+		case strings.Contains(entry.URL, "/edgar/data/"):
+			filings++
+		default:
+			others++
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Entries\t%d URLs, %d with their object missing\n", len(status.Entries), len(status.Missing))
+	fmt.Fprintf(w, "Objects\t%d, %s on disk\n", status.Objects, formatBytes(status.Bytes))
+	fmt.Fprintf(w, "Orphaned files\t%d, %s on disk\n", len(status.Orphaned), formatBytes(status.OrphanedBytes))
+	fmt.Fprintf(w, "Filings\t%d\n", filings)
+	fmt.Fprintf(w, "Quarterly indexes\t%d\n", quarterlies)
+	fmt.Fprintf(w, "Other documents\t%d\n", others)
+	if !firstFetched.IsZero() {
+		fmt.Fprintf(w, "Fetched\t%s to %s\n", firstFetched.Format("2006-01-02"), lastFetched.Format("2006-01-02"))
+	}
+	names := make([]string, 0, len(quarters))
+	for name := range quarters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for i, name := range names {
+		label := ""
+		if i == 0 {
+			label = "Daily indexes"
+		}
+		q := quarters[name]
+		fmt.Fprintf(w, "%s\t%s: %d days, %s to %s\n", label, name, q.days, q.first, q.latest)
+	}
+	w.Flush()
+
+	// Identical documents share an object, so a missing one is reported once
+	missing, hashes := map[string][]string{}, []string{}
+	for _, entry := range status.Missing {
+		if missing[entry.SHA256] == nil {
+			hashes = append(hashes, entry.SHA256)
+		}
+		missing[entry.SHA256] = append(missing[entry.SHA256], entry.URL)
+	}
+	for _, hash := range hashes {
+		log.Printf("Missing object %s, referenced by %d urls, e.g. %s", hash, len(missing[hash]), missing[hash][0])
+	}
+	for _, path := range status.Orphaned {
+		log.Printf("Orphaned file %s", path)
+	}
+	if len(status.Missing) == 0 && len(status.Orphaned) == 0 {
+		return
+	}
+	if !*fix {
+		os.Exit(exitPartial)
+	}
+	if err := store.Reconcile(status); err != nil {
+		log.Println("Failed to reconcile the cache index")
+		log.Fatal(err)
+	}
+	log.Printf("Removed %d orphaned files and dropped %d missing entries from the index", len(status.Orphaned), len(status.Missing))
+}
+
+// formatBytes is a size in bytes for people, e.g. 1.5 GB
+func formatBytes(n int64) string {
+	const unit = 1000
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "kMGTPE"[exp])
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+const appDirName = "sec4"
+
+// Config is read from config.json in the config directory. Flags that are explicitly set on the
+// command line take precedence over it.
+type Config struct {
+	DataDir string `json:"data_dir"`
+	// Columns picks and orders the output columns, see -columns
+	Columns []string `json:"columns"`
+	// Extract adds output columns pulled out of each document by XPath, after the built in ones
+	Extract []ExtractRule `json:"extract"`
+	// Extractors are registered extractors to run, see -extractors
+	Extractors []string `json:"extractors"`
+	// FormTypes are the form types to download, see -form-types
+	FormTypes []string `json:"form_types"`
+	// Sink is the registered sink rows are written to, see -sink
+	Sink string `json:"sink"`
+	// Redis is the Redis lookups are shared through, see -redis
+	Redis string `json:"redis"`
+	// EncryptionKeyFile encrypts the cache and history files, see -encryption-key-file
+	EncryptionKeyFile string `json:"encryption_key_file"`
+}
+
+// defaultDir returns the app's subdirectory of base, falling back to the working directory when
+// the OS does not define one (e.g. $HOME is unset)
+func defaultDir(base func() (string, error)) string {
+	dir, err := base()
+	if err != nil {
+		return "."
+	}
+	return filepath.Join(dir, appDirName)
+}
+
+// LoadConfig reads config.json from configDir, returning an empty config if there is none
+func LoadConfig(configDir string) (*Config, error) {
+	cfg := &Config{}
+	content, err := ioutil.ReadFile(filepath.Join(configDir, "config.json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return cfg, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading config: %w", err)
+	}
+	if err := json.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("error parsing config %s: %w", filepath.Join(configDir, "config.json"), err)
+	}
+	return cfg, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"log"
+	"math/rand"
+	"os"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+func runDaemon(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("daemon", flag.ExitOnError)
+	var schedules []*Schedule
+	fs.Func("schedule", "cron expression to run a download at, e.g. \"15 22 * * 1-5\", can be repeated", func(spec string) error {
+		s, err := ParseSchedule(spec)
+		if err != nil {
+			return err
+		}
+		schedules = append(schedules, s)
+		return nil
+	})
+	timezone := fs.String("timezone", "America/New_York", "time zone the schedules are in")
+	jitter := fs.Duration("jitter", 0, "wait a random time up to this long before each run, e.g. 30s")
+	fs.Parse(args)
+	if len(schedules) == 0 {
+		log.Fatal("Usage: daemon -schedule \"<minute> <hour> <day> <month> <weekday>\" [-schedule ...] [-timezone tz] [-jitter d]")
+	}
+	loc := edgar.Eastern
+	if *timezone != loc.String() {
+		var err error
+		if loc, err = time.LoadLocation(*timezone); err != nil {
+			log.Fatalf("Unknown -timezone %q: %s", *timezone, err)
+		}
+	}
+
+	// Each run is this binary's download command with the same global flags, in its own process so a
+	// failed run is logged and the daemon carries on. Its log goes through the daemon's, so it is the
+	// daemon that writes and rotates -log-file.
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	runArgs := append(append([]string{}, os.Args[1:len(os.Args)-len(flag.Args())]...), "-log-file=", "download")
+
+	jitterSource := rand.New(rand.NewSource(time.Now().UnixNano()))
+	var (
+		mu      sync.Mutex
+		running bool
+		wg      sync.WaitGroup
+	)
+	for {
+		now := time.Now().In(loc)
+		var next time.Time
+		var due *Schedule
+		for _, s := range schedules {
+			if t := s.Next(now); !t.IsZero() && (next.IsZero() || t.Before(next)) {
+				next, due = t, s
+			}
+		}
+		if due == nil {
+			log.Fatal("None of the schedules fire in the next 5 years")
+		}
+		infof("Next download at %s (%s)", next.Format(time.RFC3339), due)
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			log.Println("Stopping, waiting for the running download to exit")
+			wg.Wait()
+			return
+		case <-timer.C:
+		}
+
+		// A run that takes longer than the gap between schedules must not overlap the next one
+		mu.Lock()
+		if running {
+			mu.Unlock()
+			log.Printf("Skipping the %s download, the previous one is still running", next.Format(time.RFC3339))
+			continue
+		}
+		running = true
+		mu.Unlock()
+
+		// Spread runs out so many daemons on the same schedule don't all hit EDGAR at once
+		var delay time.Duration
+		if *jitter > 0 {
+			delay = time.Duration(jitterSource.Int63n(int64(*jitter)))
+		}
+		wg.Add(1)
+		go func() {
+			defer func() {
+				mu.Lock()
+				running = false
+				mu.Unlock()
+				wg.Done()
+			}()
+			if delay > 0 {
+				select {
+				case <-ctx.Done():
+					return
+				case <-time.After(delay):
+				}
+			}
+			runScheduled(ctx, executable, runArgs)
+		}()
+	}
+}
+
+// runScheduled runs one download, interrupting it when ctx is done so it closes its output cleanly
+func runScheduled(ctx context.Context, executable string, args []string) {
+	cmd := exec.Command(executable, args...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, log.Writer()
+	started := time.Now()
+	if err := cmd.Start(); err != nil {
+		log.Printf("Failed to start download: %s", err)
+		return
+	}
+	done := make(chan error, 1)
+	go func() { done <- cmd.Wait() }()
+
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		cmd.Process.Signal(os.Interrupt)
+		err = <-done
+	}
+	if err != nil {
+		log.Printf("Download failed after %s: %s", time.Since(started).Round(time.Second), err)
+		return
+	}
+	infof("Download finished in %s", time.Since(started).Round(time.Second))
+}
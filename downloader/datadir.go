@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// dataDirVersion is the layout version of the data directory this build reads and writes.
+// Bump it and append to dataDirMigrations whenever the layout changes.
+const dataDirVersion = 1
+
+// dataDirMigrations[i] upgrades a data directory from version i to version i+1
+var dataDirMigrations = []func(root string) error{
+	migrateLegacyLayout,
+}
+
+// OpenDataDir creates the data directory at root if needed, migrates it to the current layout
+// version, and returns the path of the document cache inside it
+func OpenDataDir(root string) (string, error) {
+	if err := os.MkdirAll(root, 0777); err != nil {
+		return "", fmt.Errorf("error creating data dir: %w", err)
+	}
+
+	version, err := readDataDirVersion(root)
+	if err != nil {
+		return "", err
+	}
+	if version > dataDirVersion {
+		return "", fmt.Errorf("data dir %s has layout version %d, this build only supports up to %d", root, version, dataDirVersion)
+	}
+
+	for ; version < dataDirVersion; version++ {
+		log.Printf("Migrating data dir %s from version %d to %d", root, version, version+1)
+		if err := dataDirMigrations[version](root); err != nil {
+			return "", fmt.Errorf("error migrating data dir to version %d: %w", version+1, err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, "VERSION"), []byte(strconv.Itoa(version+1)+"\n"), 0666); err != nil {
+			return "", fmt.Errorf("error writing data dir version: %w", err)
+		}
+	}
+
+	return filepath.Join(root, "cache"), nil
+}
+
+func readDataDirVersion(root string) (int, error) {
+	content, err := ioutil.ReadFile(filepath.Join(root, "VERSION"))
+	if errors.Is(err, os.ErrNotExist) {
+		// Either brand new or from before the layout was versioned
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("error reading data dir version: %w", err)
+	}
+	version, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid data dir version %q", content)
+	}
+	return version, nil
+}
+
+var (
+	legacyFilingName = regexp.MustCompile(`^(\d+)_(\d{10})(\d{2})(\d{6})\.xml$`)
+	legacyMasterName = regexp.MustCompile(`^master\.(\d{4})(\d{2})\d{2}\.idx$`)
+)
+
+// migrateLegacyLayout moves the pre-store form4_xml/ and masterfiles/ directories into the content
+// addressed cache, reconstructing the URL each file was downloaded from out of its name. The old
+// directories are left in place so nothing is lost if the migration is interrupted.
+func migrateLegacyLayout(root string) error {
+	legacyDirs := map[string]func(name string) (string, bool){
+		"form4_xml": func(name string) (string, bool) {
+			m := legacyFilingName.FindStringSubmatch(name)
+			if m == nil {
+				return "", false
+			}
+			return fmt.Sprintf("%s/edgar/data/%s/%s-%s-%s.txt", edgar.DefaultArchivesURL, m[1], m[2], m[3], m[4]), true
+		},
+		"masterfiles": func(name string) (string, bool) {
+			m := legacyMasterName.FindStringSubmatch(name)
+			if m == nil {
+				return "", false
+			}
+			y, _ := strconv.Atoi(m[1])
+			month, _ := strconv.Atoi(m[2])
+			return fmt.Sprintf("%s/edgar/daily-index/%d/QTR%d/%s", edgar.DefaultArchivesURL, y, (month-1)/3+1, name), true
+		},
+	}
+
+	var s *edgar.Store
+	for dir, toURL := range legacyDirs {
+		files, err := ioutil.ReadDir(filepath.Join(root, dir))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		if s == nil {
+			s, err = edgar.OpenStore(filepath.Join(root, "cache"), edgar.StoreOptions{})
+			if err != nil {
+				return err
+			}
+			defer s.Close()
+		}
+
+		migrated := 0
+		for _, file := range files {
+			url, ok := toURL(file.Name())
+			if !ok || file.IsDir() {
+				log.Printf("Skipping unrecognized legacy file %s/%s", dir, file.Name())
+				continue
+			}
+			content, err := ioutil.ReadFile(filepath.Join(root, dir, file.Name()))
+			if err != nil {
+				return err
+			}
+			if _, err := s.PutAt(url, content, file.ModTime()); err != nil {
+				return err
+			}
+			migrated++
+		}
+		log.Printf("Migrated %d files from %s, it can be deleted once you have checked the cache with cache verify", migrated, filepath.Join(root, dir))
+	}
+
+	return nil
+}
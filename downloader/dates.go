@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+// Warning codes for transaction dates that are valid dates but can't be right. The dates are kept,
+// and flagged in the DATA_QUALITY_FLAGS column.
+const (
+	// WarnDateAfterFiling is a transaction dated after the filing that reports it
+	WarnDateAfterFiling = "DATE_AFTER_FILING"
+	// WarnDateLongBeforeFiling is a transaction dated more than maxReportingLag before its filing,
+	// usually a typo in the year
+	WarnDateLongBeforeFiling = "DATE_LONG_BEFORE_FILING"
+)
+
+// maxReportingLag is how long before its filing a transaction can plausibly have happened. Form 4 is
+// due two business days after a transaction, but late filings years after the fact do happen.
+const maxReportingLag = 10 * 365 * 24 * time.Hour
+
+// isoDate turns a YYYYMMDD date from the EDGAR index into YYYY-MM-DD, the form every output date takes
+func isoDate(yyyymmdd string) string {
+	t, err := time.Parse("20060102", yyyymmdd)
+	if err != nil {
+		return yyyymmdd
+	}
+	return t.Format("2006-01-02")
+}
+
+// transactionDateWarning returns the warning code of a normalized transaction date that is out of
+// range for the date it was filed, or "" if it is fine
+func transactionDateWarning(filing *edgar.IndexEntry, transactionDate string) string {
+	filed, err := time.Parse("20060102", filing.DateFiled)
+	if err != nil {
+		return ""
+	}
+	date, err := time.Parse("2006-01-02", transactionDate)
+	switch {
+	case err != nil:
+		return ""
+	case date.After(filed):
+		return WarnDateAfterFiling
+	case filed.Sub(date) > maxReportingLag:
+		return WarnDateLongBeforeFiling
+	}
+	return ""
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func init() {
+	RegisterSink("delta", openDelta)
+}
+
+// deltaFileRows is how many rows go in each data file before another is started
+const deltaFileRows = 1000000
+
+// deltaPeriodTag tags the data files a run adds with the quarter they hold
+const deltaPeriodTag = "sec4.period"
+
+// deltaSchemaVersionTag tags them with the output schema version they were written with
+const deltaSchemaVersionTag = "sec4.schemaVersion"
+
+// deltaWriter writes rows as Parquet data files in a Delta Lake table directory and commits them to
+// the table's transaction log when closed, so readers see all of a run's rows or none of them.
+// Files committed by an earlier run of the same quarter are removed in the same commit, which makes
+// re-running a quarter replace its rows rather than add them again. A table partitioned by -partition
+// keys has its files in key=value directories, the keys being string columns of the table.
+type deltaWriter struct {
+	root   string
+	header []string
+	keys   []string
+	// period is the quarter written, e.g. 2024Q1, whose earlier files the commit removes
+	period string
+
+	// files are the data files being written, by the directory of their partition
+	files map[string]*deltaFile
+	added []deltaAdd
+}
+
+// deltaFile is a data file being written
+type deltaFile struct {
+	file *os.File
+	// path is relative to the table root, as the log has it
+	path       string
+	partitions map[string]string
+	parquet    *parquetWriter
+}
+
+// The actions of the Delta transaction log that the sink reads and writes, see
+// https://github.com/delta-io/delta/blob/master/PROTOCOL.md. Actions it doesn't use are ignored.
+type deltaAction struct {
+	Protocol   *deltaProtocol         `json:"protocol,omitempty"`
+	MetaData   *deltaMetaData         `json:"metaData,omitempty"`
+	Add        *deltaAdd              `json:"add,omitempty"`
+	Remove     *deltaRemove           `json:"remove,omitempty"`
+	CommitInfo map[string]interface{} `json:"commitInfo,omitempty"`
+}
+
+type deltaProtocol struct {
+	MinReaderVersion int `json:"minReaderVersion"`
+	MinWriterVersion int `json:"minWriterVersion"`
+}
+
+type deltaMetaData struct {
+	ID               string            `json:"id"`
+	Format           deltaFormat       `json:"format"`
+	SchemaString     string            `json:"schemaString"`
+	PartitionColumns []string          `json:"partitionColumns"`
+	Configuration    map[string]string `json:"configuration"`
+	CreatedTime      int64             `json:"createdTime"`
+}
+
+type deltaFormat struct {
+	Provider string            `json:"provider"`
+	Options  map[string]string `json:"options"`
+}
+
+type deltaAdd struct {
+	Path             string            `json:"path"`
+	PartitionValues  map[string]string `json:"partitionValues"`
+	Size             int64             `json:"size"`
+	ModificationTime int64             `json:"modificationTime"`
+	DataChange       bool              `json:"dataChange"`
+	Stats            string            `json:"stats,omitempty"`
+	Tags             map[string]string `json:"tags,omitempty"`
+}
+
+type deltaRemove struct {
+	Path              string `json:"path"`
+	DeletionTimestamp int64  `json:"deletionTimestamp"`
+	DataChange        bool   `json:"dataChange"`
+}
+
+// deltaSchema is the table's schema in the log's struct type JSON, every column a nullable string
+// with its description as the comment engines show, followed by the partition keys
+func deltaSchema(header, keys []string) (string, error) {
+	type field struct {
+		Name     string            `json:"name"`
+		Type     string            `json:"type"`
+		Nullable bool              `json:"nullable"`
+		Metadata map[string]string `json:"metadata"`
+	}
+	fields := []field{}
+	for _, column := range header {
+		metadata := map[string]string{}
+		if doc, ok := columnDocs[column]; ok {
+			metadata["comment"] = doc.Description
+		}
+		fields = append(fields, field{Name: column, Type: "string", Nullable: true, Metadata: metadata})
+	}
+	for _, key := range keys {
+		metadata := map[string]string{"comment": "Partition by " + key}
+		fields = append(fields, field{Name: key, Type: "string", Nullable: true, Metadata: metadata})
+	}
+	schema, err := json.Marshal(struct {
+		Type   string  `json:"type"`
+		Fields []field `json:"fields"`
+	}{"struct", fields})
+	return string(schema), err
+}
+
+// openDelta is the delta sink, writing the table in the -output directory (default delta/), which
+// is created with the first commit
+func openDelta(ctx context.Context, opts SinkOptions) (RowWriter, error) {
+	for _, name := range []string{"columns", "format", "compress", "max-rows", "max-bytes"} {
+		if flagIsSet(flag.CommandLine, name) {
+			return nil, fmt.Errorf("-%s does not apply to the delta sink", name)
+		}
+	}
+	if *partitionStyle != "hive" && flagIsSet(flag.CommandLine, "partition-style") {
+		return nil, fmt.Errorf("delta tables are always partitioned in the hive style")
+	}
+	if err := checkParquetOptions(); err != nil {
+		return nil, err
+	}
+	keys, err := ParsePartitionKeys(*partition)
+	if err != nil {
+		return nil, err
+	}
+	root := opts.Target
+	if root == "" {
+		root = "delta"
+	}
+	// Fail before downloading anything if the table can't be committed to
+	_, state, err := readDeltaLog(root)
+	if err != nil {
+		return nil, err
+	}
+	if state.metaData != nil && strings.Join(state.metaData.PartitionColumns, ",") != strings.Join(keys, ",") {
+		if len(state.metaData.PartitionColumns) == 0 {
+			return nil, fmt.Errorf("the delta table in %s isn't partitioned, write it without -partition", root)
+		}
+		return nil, fmt.Errorf("the delta table in %s is partitioned by %s, pass the same -partition", root, strings.Join(state.metaData.PartitionColumns, ","))
+	}
+	return &deltaWriter{root: root, header: opts.Header, keys: keys, period: fmt.Sprintf("%dQ%d", opts.Year, opts.Quarter), files: map[string]*deltaFile{}}, nil
+}
+
+func (w *deltaWriter) Write(ctx context.Context, row *Row) error {
+	// The partition values go in the log rather than the files, an empty one being read as NULL
+	dir, partitions := "", map[string]string{}
+	for _, key := range w.keys {
+		dir = path.Join(dir, hiveSegment(key, row))
+		partitions[key] = partitionKeys[key](row)
+	}
+	f, ok := w.files[dir]
+	if !ok {
+		// Like the partitioned file sink, bound the files open at once by finishing them all
+		if len(w.files) >= maxOpenPartitions {
+			if err := w.finishFiles(); err != nil {
+				return err
+			}
+		}
+		f = &deltaFile{
+			path:       path.Join(dir, fmt.Sprintf("part-%05d-%s-c000%s", len(w.added)+len(w.files), uuid.New(), parquetExtension())),
+			partitions: partitions,
+		}
+		name := filepath.Join(w.root, filepath.FromSlash(f.path))
+		if err := os.MkdirAll(filepath.Dir(name), 0777); err != nil {
+			return err
+		}
+		var err error
+		if f.file, err = os.Create(name); err != nil {
+			return err
+		}
+		if f.parquet, err = newParquetWriter(f.file, w.header); err != nil {
+			f.file.Close()
+			return err
+		}
+		w.files[dir] = f
+	}
+	if err := f.parquet.Write(row.Values); err != nil {
+		return err
+	}
+	if f.parquet.rows >= deltaFileRows {
+		delete(w.files, dir)
+		return w.finishFile(f)
+	}
+	return nil
+}
+
+// finishFiles finishes every data file being written
+func (w *deltaWriter) finishFiles() error {
+	dirs := make([]string, 0, len(w.files))
+	for dir := range w.files {
+		dirs = append(dirs, dir)
+	}
+	sort.Strings(dirs)
+	for _, dir := range dirs {
+		f := w.files[dir]
+		delete(w.files, dir)
+		if err := w.finishFile(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finishFile closes a data file and queues its add action
+func (w *deltaWriter) finishFile(f *deltaFile) error {
+	rows := f.parquet.rows
+	if err := f.parquet.Close(); err != nil {
+		return err
+	}
+	info, err := os.Stat(f.file.Name())
+	if err != nil {
+		return err
+	}
+	w.added = append(w.added, deltaAdd{
+		Path:             f.path,
+		PartitionValues:  f.partitions,
+		Size:             info.Size(),
+		ModificationTime: info.ModTime().UnixMilli(),
+		DataChange:       true,
+		Stats:            fmt.Sprintf(`{"numRecords":%d}`, rows),
+		Tags:             map[string]string{deltaPeriodTag: w.period, deltaSchemaVersionTag: strconv.Itoa(outputSchemaVersion)},
+	})
+	return nil
+}
+
+func (w *deltaWriter) Close() error {
+	if err := w.finishFiles(); err != nil {
+		return err
+	}
+	if len(w.added) == 0 {
+		return nil
+	}
+
+	version, state, err := readDeltaLog(w.root)
+	if err != nil {
+		return err
+	}
+	schema, err := deltaSchema(w.header, w.keys)
+	if err != nil {
+		return err
+	}
+	now := time.Now().UnixMilli()
+
+	actions := []deltaAction{}
+	if state.metaData == nil {
+		actions = append(actions,
+			deltaAction{Protocol: &deltaProtocol{MinReaderVersion: 1, MinWriterVersion: 2}},
+			deltaAction{MetaData: &deltaMetaData{
+				ID:               uuid.New().String(),
+				Format:           deltaFormat{Provider: "parquet", Options: map[string]string{}},
+				SchemaString:     schema,
+				PartitionColumns: append([]string{}, w.keys...),
+				Configuration:    map[string]string{},
+				CreatedTime:      now,
+			}},
+		)
+	} else if state.metaData.SchemaString != schema {
+		return fmt.Errorf("the columns of the delta table in %s differ from the output's, write to a new table", w.root)
+	}
+
+	mode := "Append"
+	for _, path := range state.sortedFiles() {
+		if state.files[path].Tags[deltaPeriodTag] == w.period {
+			actions = append(actions, deltaAction{Remove: &deltaRemove{Path: path, DeletionTimestamp: now, DataChange: true}})
+			mode = "Overwrite"
+		}
+	}
+	for i := range w.added {
+		actions = append(actions, deltaAction{Add: &w.added[i]})
+	}
+	actions = append(actions, deltaAction{CommitInfo: map[string]interface{}{
+		"timestamp":           now,
+		"operation":           "WRITE",
+		"operationParameters": map[string]string{"mode": mode, deltaPeriodTag: w.period},
+		"engineInfo":          "sec4",
+	}})
+
+	var commit bytes.Buffer
+	for _, action := range actions {
+		line, err := json.Marshal(action)
+		if err != nil {
+			return err
+		}
+		commit.Write(line)
+		commit.WriteByte('\n')
+	}
+	return writeDeltaCommit(w.root, version, commit.Bytes())
+}
+
+// deltaState is what the sink needs from replaying a table's log: its metadata and live files
+type deltaState struct {
+	metaData *deltaMetaData
+	files    map[string]deltaAdd
+}
+
+func (s deltaState) sortedFiles() []string {
+	paths := make([]string, 0, len(s.files))
+	for path := range s.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// readDeltaLog replays the JSON commits in root's _delta_log, returning the version the next commit
+// takes and the table's state. A missing log is a table to create at version 0. Checkpoints aren't
+// read, so a table whose early commits were cleaned up after one can't be written to.
+func readDeltaLog(root string) (int64, deltaState, error) {
+	state := deltaState{files: map[string]deltaAdd{}}
+	entries, err := ioutil.ReadDir(filepath.Join(root, "_delta_log"))
+	if errors.Is(err, os.ErrNotExist) {
+		return 0, state, nil
+	} else if err != nil {
+		return 0, state, err
+	}
+
+	versions := []int64{}
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".json")
+		if v, err := strconv.ParseInt(name, 10, 64); err == nil && len(name) == 20 && name != entry.Name() {
+			versions = append(versions, v)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+
+	for i, v := range versions {
+		if v != int64(i) {
+			return 0, state, fmt.Errorf("the delta log in %s is missing version %d, it may have been checkpointed", root, i)
+		}
+		content, err := ioutil.ReadFile(deltaCommitPath(root, v))
+		if err != nil {
+			return 0, state, err
+		}
+		for _, line := range bytes.Split(content, []byte("\n")) {
+			if len(bytes.TrimSpace(line)) == 0 {
+				continue
+			}
+			var action deltaAction
+			if err = json.Unmarshal(line, &action); err != nil {
+				return 0, state, fmt.Errorf("reading version %d of the delta log in %s: %w", v, root, err)
+			}
+			switch {
+			case action.Protocol != nil && (action.Protocol.MinWriterVersion > 2 || action.Protocol.MinReaderVersion > 1):
+				return 0, state, fmt.Errorf("the delta table in %s needs writer version %d, only 2 is supported", root, action.Protocol.MinWriterVersion)
+			case action.MetaData != nil:
+				state.metaData = action.MetaData
+			case action.Add != nil:
+				state.files[action.Add.Path] = *action.Add
+			case action.Remove != nil:
+				delete(state.files, action.Remove.Path)
+			}
+		}
+	}
+	return int64(len(versions)), state, nil
+}
+
+func deltaCommitPath(root string, version int64) string {
+	return filepath.Join(root, "_delta_log", fmt.Sprintf("%020d.json", version))
+}
+
+// writeDeltaCommit writes the commit as the given version, failing if another writer already has.
+// It is written aside and hard linked into place, which fails rather than replaces if the version
+// exists and never leaves a partly written commit for readers to see.
+func writeDeltaCommit(root string, version int64, commit []byte) error {
+	path := deltaCommitPath(root, version)
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".commit-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(commit); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	if err = os.Link(tmp.Name(), path); errors.Is(err, os.ErrExist) {
+		return fmt.Errorf("another writer committed version %d of the delta table in %s first", version, root)
+	}
+	return err
+}
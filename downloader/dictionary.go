@@ -0,0 +1,251 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+// ColumnDoc describes an output column in the data dictionary written next to exports
+type ColumnDoc struct {
+	Description string
+	// Type is how the value should be loaded: string, integer, decimal, date, timestamp or flag. Every value is
+	// written as a string, this is what it holds.
+	Type string
+	// Values are the values the column can hold, with what they mean, when it is an enumeration
+	Values []EnumValue
+}
+
+type EnumValue struct {
+	Value       string
+	Description string
+}
+
+var (
+	// flagValues are the normalized values, -raw-flags writes 1 and 0 as filed too
+	flagValues      = []EnumValue{{"true", "Yes"}, {"false", "No, or not reported"}}
+	ownershipValues = []EnumValue{{"D", "Direct"}, {"I", "Indirect"}}
+)
+
+// columnDocs documents every built in column, of the flat output and the normalized tables
+var columnDocs = map[string]ColumnDoc{
+	"ISSUER_CIK":                      {Description: "CIK of the company whose securities were traded, zero padded to 10 digits as filed", Type: "string"},
+	"REPORTER_CIK":                    {Description: "CIK of the reporting owner (the insider)", Type: "string"},
+	"ACCESSION_NUMBER":                {Description: "EDGAR accession number of the filing, without dashes", Type: "string"},
+	"NAME_OF_REPORTING_PERSON":        {Description: "Name of the reporting owner as filed, usually last name first", Type: "string"},
+	"A_OR_D":                          {Description: "Whether the securities were acquired or disposed of", Type: "string", Values: []EnumValue{{"A", "Acquired"}, {"D", "Disposed"}}},
+	"AMOUNT":                          {Description: "Number of securities acquired or disposed of, a plain decimal without thousands separators or exponent", Type: "decimal"},
+	"PRICE":                           {Description: "Price per security, a plain decimal without thousands separators or exponent", Type: "decimal"},
+	"TRANSACTION_DATE":                {Description: "Date of the transaction, YYYY-MM-DD", Type: "date"},
+	"TITLE_OF_SECURITY":               {Description: "Title of the security, e.g. Common Stock", Type: "string"},
+	"ISSUER_NAME":                     {Description: "Name of the issuer as filed", Type: "string"},
+	"ISSUER_TICKER":                   {Description: "Trading symbol of the issuer as filed", Type: "string"},
+	"IS_DIRECTOR":                     {Description: "Whether the reporting owner is a director of the issuer", Type: "flag", Values: flagValues},
+	"IS_OFFICER":                      {Description: "Whether the reporting owner is an officer of the issuer", Type: "flag", Values: flagValues},
+	"IS_TEN_PERCENT_OWNER":            {Description: "Whether the reporting owner holds more than 10% of a class of the issuer's securities", Type: "flag", Values: flagValues},
+	"IS_OTHER_RELATIONSHIP":           {Description: "Whether the reporting owner has some other relationship to the issuer", Type: "flag", Values: flagValues},
+	"NEW_AMOUNT_OWNED":                {Description: "Securities owned following the transaction (or held, for holdings), a plain decimal", Type: "decimal"},
+	"DIRECT_OR_INDIRECT_OWNERSHIP":    {Description: "Whether the securities are owned directly or indirectly", Type: "string", Values: ownershipValues},
+	"TRANSACTION_CODE":                {Description: "Form 4 transaction code", Type: "string", Values: transactionCodeValues()},
+	"DATA_QUALITY_FLAGS":              {Description: "Semicolon separated warning codes for values of the row that can't be right, e.g. INVALID_A_OR_D;DATE_AFTER_FILING, empty when it passed validation", Type: "string"},
+	"NATURE_OF_OWNERSHIP":             {Description: "How indirectly owned securities are held as filed, e.g. By Trust, empty for direct ownership", Type: "string"},
+	"INDIRECT_OWNERSHIP_TYPE":         {Description: "NATURE_OF_OWNERSHIP classified by its wording, empty when there is none", Type: "string", Values: indirectOwnershipTypeValues()},
+	"DEEMED_EXECUTION_DATE":           {Description: "Deemed execution date of the transaction, YYYY-MM-DD, for transactions under a 10b5-1 plan or similar arrangement where it rather than TRANSACTION_DATE starts the reporting deadline, usually empty", Type: "date"},
+	"ACCEPTANCE_DATETIME":             {Description: "When EDGAR accepted the filing, RFC 3339 in Eastern time, e.g. 2022-04-01T16:05:12-04:00, empty when the submission's header doesn't say", Type: "timestamp"},
+	"REPORTER_CITY":                   {Description: "City of the reporting owner's address as filed", Type: "string"},
+	"REPORTER_STATE":                  {Description: "Two letter state code of the reporting owner's address as filed", Type: "string"},
+	"OFFICER_TITLE":                   {Description: "Officer title of the reporting owner as filed, e.g. EVP, Chief Financial Officer", Type: "string"},
+	"OFFICER_ROLE":                    {Description: "OFFICER_TITLE normalized by its wording, empty when there is none", Type: "string", Values: officerRoleValues()},
+	"SPLIT_ADJUSTED_AMOUNT":           {Description: "AMOUNT adjusted to today's share basis for every split since the transaction, empty without -corporate-actions", Type: "decimal"},
+	"SPLIT_ADJUSTED_PRICE":            {Description: "PRICE adjusted to today's share basis for every split since the transaction, to 6 decimal places, empty without -corporate-actions", Type: "decimal"},
+	"SPLIT_ADJUSTED_NEW_AMOUNT_OWNED": {Description: "NEW_AMOUNT_OWNED adjusted to today's share basis for every split since the transaction, empty without -corporate-actions", Type: "decimal"},
+	"VALUE_PERCENTILE":                {Description: "Percentage of the transactions of the trailing -percentile-months with a dollar value (AMOUNT times PRICE) at or below this one's, empty without it or a price", Type: "decimal"},
+	"ISSUER_VALUE_PERCENTILE":         {Description: "VALUE_PERCENTILE among the issuer's own transactions", Type: "decimal"},
+	"SOURCE_SHA256":                   {Description: "Hex SHA-256 of the submission text file the row was parsed from, e.g. to tell whether EDGAR's copy changed", Type: "string"},
+	"SOURCE_URL":                      {Description: "URL of the submission text file the row was parsed from", Type: "string"},
+	"DOWNLOADED_AT":                   {Description: "When that file was downloaded from EDGAR, RFC 3339 in UTC, the first download for one read from the cache", Type: "timestamp"},
+	"PARSER_VERSION":                  {Description: "Version of the parser that wrote the row, bumped whenever the same document would parse to different values", Type: "string"},
+	"ROW_TYPE":                        {Description: "What the row is, with ACCESSION_NUMBER, REPORTER_CIK and TRANSACTION_INDEX the key the database sinks merge rows on", Type: "string", Values: []EnumValue{{rowTypeNonDerivativeTransaction, "A transaction of the filing's non-derivative table"}}},
+	"DIRECTION":                       {Description: "Which way the transaction went, classified from TRANSACTION_CODE and A_OR_D", Type: "string", Values: directionValues()},
+
+	"STATE_OF_INCORPORATION": {Description: "Two letter code of the state or country the issuer is incorporated in, e.g. DE", Type: "string"},
+	"FISCAL_YEAR_END":        {Description: "Last day of the issuer's fiscal year, MMDD, e.g. 1231", Type: "string"},
+	"BUSINESS_STREET_1":      {Description: "First street line of the issuer's business address", Type: "string"},
+	"BUSINESS_STREET_2":      {Description: "Second street line of the issuer's business address", Type: "string"},
+	"BUSINESS_CITY":          {Description: "City of the issuer's business address", Type: "string"},
+	"BUSINESS_STATE":         {Description: "Two letter state or country code of the issuer's business address", Type: "string"},
+	"BUSINESS_ZIP":           {Description: "Postal code of the issuer's business address", Type: "string"},
+	"BUSINESS_PHONE":         {Description: "Business phone number of the issuer as filed", Type: "string"},
+
+	"FORM_TYPE":              {Description: "Form type from the EDGAR index, 4 and 4/A unless -form-types selects others", Type: "string", Values: []EnumValue{{"3", "Initial statement of beneficial ownership"}, {"3/A", "Amendment to a form 3"}, {"4", "Statement of changes in beneficial ownership"}, {"4/A", "Amendment to a form 4"}, {"5", "Annual statement of changes in beneficial ownership"}, {"5/A", "Amendment to a form 5"}}},
+	"DATE_FILED":             {Description: "Date the filing was filed, YYYY-MM-DD", Type: "date"},
+	"SCHEMA_VERSION":         {Description: "Version of the ownership XML schema the document was filed with, e.g. X0306", Type: "string"},
+	"DOCUMENT_TYPE":          {Description: "Document type stated in the ownership document", Type: "string"},
+	"PERIOD_OF_REPORT":       {Description: "Date of the earliest transaction reported, YYYY-MM-DD", Type: "date"},
+	"FILE_NAME":              {Description: "Path of the submission text file under the EDGAR archives", Type: "string"},
+	"TRANSACTION_INDEX":      {Description: "Position of the transaction in the filing's non-derivative table, from 0", Type: "integer"},
+	"HOLDING_INDEX":          {Description: "Position of the holding in the filing's non-derivative table, from 0", Type: "integer"},
+	"COUNT":                  {Description: "Reporting owners seen with the officer title in the run, one per filing", Type: "integer"},
+	"PERIOD":                 {Description: "Quarter the rollup covers, e.g. 2024Q1", Type: "string"},
+	"SECTOR":                 {Description: "Division of the SIC manual the industry is in, e.g. Manufacturing, empty when the SIC isn't known", Type: "string"},
+	"SIC":                    {Description: "Four digit standard industrial classification code of the issuer, empty when it isn't known", Type: "string"},
+	"INDUSTRY":               {Description: "Industry the SIC code names, as the SEC writes it, e.g. SERVICES-PREPACKAGED SOFTWARE", Type: "string"},
+	"ISSUERS":                {Description: "Issuers with open market purchases or sales by insiders in the period", Type: "integer"},
+	"PURCHASES":              {Description: "Open market purchases (code P) with a price", Type: "integer"},
+	"SALES":                  {Description: "Open market sales (code S) with a price", Type: "integer"},
+	"PURCHASE_VALUE":         {Description: "Dollars of the purchases, the amount times the price", Type: "decimal"},
+	"SALE_VALUE":             {Description: "Dollars of the sales, the amount times the price", Type: "decimal"},
+	"NET_VALUE":              {Description: "Net insider buying, PURCHASE_VALUE less SALE_VALUE", Type: "decimal"},
+	"OWNER_ROLES":            {Description: "Roles of the reporting owner separated by ;, any of director, officer, ten-percent-owner and other", Type: "string"},
+	"TRANSACTIONS":           {Description: "Transactions written, those the filters keep", Type: "integer"},
+	"TOTAL_SHARES":           {Description: "Shares of the transactions, acquired and disposed of", Type: "decimal"},
+	"NET_SHARES":             {Description: "Shares acquired less shares disposed of", Type: "decimal"},
+	"WEIGHTED_AVERAGE_PRICE": {Description: "Price per share averaged over the transactions with a price, weighted by their shares, empty when none had one", Type: "decimal"},
+	"TOTAL_VALUE":            {Description: "Dollars of the transactions with a price, the amount times the price", Type: "decimal"},
+	"DOMINANT_DIRECTION":     {Description: "DIRECTION with the most shares among the transactions", Type: "string", Values: directionValues()},
+	"MONTH":                  {Description: "Month the filings were filed in, YYYY-MM", Type: "string"},
+	"FILINGS":                {Description: "Filings with transactions the filters keep", Type: "integer"},
+	"ISSUERS_TRADED":         {Description: "Issuers whose securities the insider had transactions in", Type: "integer"},
+	"NET_DOLLARS":            {Description: "Dollars of the transactions with a price acquiring shares less those disposing of them, the amount times the price", Type: "decimal"},
+	"BUYERS":                 {Description: "Insiders with open market purchases (code P) with a price that day", Type: "integer"},
+	"SELLERS":                {Description: "Insiders with open market sales (code S) with a price that day", Type: "integer"},
+	"FOOTNOTE_ID":            {Description: "Footnote ID referenced from values in the filing, e.g. F1", Type: "string"},
+	"TEXT":                   {Description: "Footnote text", Type: "string"},
+}
+
+func officerRoleValues() []EnumValue {
+	values := make([]EnumValue, len(form4.OfficerRoles))
+	for i, r := range form4.OfficerRoles {
+		values[i] = EnumValue{r.Role, r.Description}
+	}
+	return values
+}
+
+func indirectOwnershipTypeValues() []EnumValue {
+	values := make([]EnumValue, len(form4.IndirectOwnershipTypes))
+	for i, t := range form4.IndirectOwnershipTypes {
+		values[i] = EnumValue{t.Type, t.Description}
+	}
+	return values
+}
+
+func directionValues() []EnumValue {
+	values := make([]EnumValue, len(form4.Directions))
+	for i, d := range form4.Directions {
+		values[i] = EnumValue{d.Direction, d.Description}
+	}
+	return values
+}
+
+func transactionCodeValues() []EnumValue {
+	values := make([]EnumValue, len(form4.TransactionCodes))
+	for i, c := range form4.TransactionCodes {
+		values[i] = EnumValue{c.Code, c.Description}
+	}
+	return values
+}
+
+// schemaPath is where the data dictionary of an output file goes, its name with the extension swapped
+func schemaPath(path string, format OutputFormat) string {
+	if strings.HasSuffix(strings.ToLower(path), format.Ext()) {
+		path = path[:len(path)-len(format.Ext())]
+	}
+	return path + ".schema.json"
+}
+
+// WriteSchema writes a JSON Schema for the rows of an output, as the objects its jsonl encoding
+// holds, with each column's description, load type and position in the csv encoding. Enumerations
+// list their values and meanings as oneOf consts, and also accept an empty value for unreported ones.
+func WriteSchema(path, title string, format OutputFormat) error {
+	header := format.header()
+	properties := orderedObject{}
+	required := []string{}
+	for position, column := range format.columnIndexes() {
+		name := header[column]
+		doc, ok := columnDocs[name]
+		if !ok {
+			doc = ColumnDoc{Description: "Added by the extract rule or extractor that defines " + name, Type: "string"}
+		}
+
+		property := orderedObject{
+			{"type", "string"},
+			{"description", doc.Description},
+			{"x-column", name},
+			{"x-position", position},
+			{"x-type", doc.Type},
+		}
+		if len(doc.Values) > 0 {
+			oneOf := []orderedObject{}
+			for _, v := range doc.Values {
+				oneOf = append(oneOf, orderedObject{{"const", v.Value}, {"description", v.Description}})
+			}
+			oneOf = append(oneOf, orderedObject{{"const", ""}, {"description", "Not reported"}})
+			property = append(property, keyValue{"oneOf", oneOf})
+		}
+
+		key := strings.ToLower(name)
+		properties = append(properties, keyValue{key, property})
+		required = append(required, key)
+	}
+
+	schema := orderedObject{
+		{"$schema", "https://json-schema.org/draft/2020-12/schema"},
+		{"title", title},
+	}
+	if format.Header == nil {
+		// The flat output's columns are versioned, see outputSchema
+		schema = append(schema, keyValue{"x-schema-version", outputSchemaVersion})
+	}
+	schema = append(schema, orderedObject{
+		{"type", "object"},
+		{"x-encoding", format.Encoding},
+		{"x-compression", format.Compression},
+		{"properties", properties},
+		{"required", required},
+		{"additionalProperties", false},
+	}...)
+	content, err := json.MarshalIndent(schema, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(content, '\n'), 0666)
+}
+
+type keyValue struct {
+	Key   string
+	Value interface{}
+}
+
+// orderedObject marshals as a JSON object keeping its keys in order, so columns read in output order
+type orderedObject []keyValue
+
+func (o orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, kv := range o {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, err := json.Marshal(kv.Key)
+		if err != nil {
+			return nil, err
+		}
+		value, err := json.Marshal(kv.Value)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(value)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
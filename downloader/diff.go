@@ -0,0 +1,350 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+func runDiff(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	cik := fs.String("cik", "", "CIK of the issuer or an owner, to find filings that aren't cached under it")
+	period := fs.String("period", "", "diff every 4/A filed in this quarter, e.g. 2024Q1, against the form 4 it amends")
+	fs.Parse(args)
+
+	if *period != "" {
+		if fs.NArg() != 0 {
+			log.Fatal("Usage: diff -period 2024Q1")
+		}
+		y, q, err := parsePeriod(*period)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if err = diffQuarter(ctx, os.Stdout, y, q); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	if fs.NArg() != 2 {
+		log.Fatal("Usage: diff [-cik n] <original-accession> <amendment-accession>, or diff -period 2024Q1")
+	}
+	cached := cachedFilings()
+	amendment, err := locateFiling(fs.Arg(1), *cik, cached)
+	if err != nil {
+		log.Fatal(err)
+	}
+	amended, err := fetchDocument(ctx, amendment)
+	if err != nil {
+		log.Printf("Failed to read %s", client.FilingURL(amendment))
+		if *cik == "" {
+			log.Println("Filings that aren't cached are looked for under their filer agent, pass the issuer's CIK with -cik")
+		}
+		log.Fatal(err)
+	}
+	// The original is filed under the same issuer, so it can be found from the amendment
+	originalCIK := *cik
+	if originalCIK == "" {
+		originalCIK = amended.Issuer.CIK
+	}
+	original, err := locateFiling(fs.Arg(0), originalCIK, cached)
+	if err != nil {
+		log.Fatal(err)
+	}
+	od, err := fetchDocument(ctx, original)
+	if err != nil {
+		log.Printf("Failed to read %s", client.FilingURL(original))
+		log.Fatal(err)
+	}
+	printDiff(os.Stdout, original, od, amendment, amended)
+}
+
+var accessionPattern = regexp.MustCompile(`^(\d{10})-?(\d{2})-?(\d{6})$`)
+
+// locateFiling finds the submission of an accession number, with or without dashes. Filings that were
+// downloaded before are found in cached, from cachedFilings, others are fetched from the archives
+// directory of cik, which can be any party to the filing, or of the filer agent the accession number
+// was issued to.
+func locateFiling(accession, cik string, cached map[string]string) (*edgar.IndexEntry, error) {
+	m := accessionPattern.FindStringSubmatch(strings.TrimSpace(accession))
+	if m == nil {
+		return nil, fmt.Errorf("invalid accession number %q, expected e.g. 0001184237-22-000123", accession)
+	}
+	name := m[1] + "-" + m[2] + "-" + m[3] + ".txt"
+	entry := &edgar.IndexEntry{AccessionNumber: m[1] + m[2] + m[3]}
+
+	if cik == "" {
+		if path, ok := cached[name]; ok {
+			entry.FileName = path
+			return entry, nil
+		}
+		cik = m[1]
+	}
+	cik = strings.TrimLeft(cik, "0")
+	if _, err := strconv.Atoi(cik); err != nil {
+		return nil, fmt.Errorf("invalid CIK %q", cik)
+	}
+	entry.FileName = "edgar/data/" + cik + "/" + name
+	return entry, nil
+}
+
+// cachedFilings maps the file name of every cached submission, e.g. 0001000045-22-000005.txt, to its
+// path under the archives root
+func cachedFilings() map[string]string {
+	paths := map[string]string{}
+	for _, cached := range store.Entries() {
+		if i := strings.Index(cached.URL, "edgar/data/"); i >= 0 && strings.HasSuffix(cached.URL, ".txt") {
+			paths[cached.URL[strings.LastIndexByte(cached.URL, '/')+1:]] = cached.URL[i:]
+		}
+	}
+	return paths
+}
+
+// fetchDocument downloads and parses the ownership document of a filing
+func fetchDocument(ctx context.Context, entry *edgar.IndexEntry) (*form4.OwnershipDocument, error) {
+	content, err := client.FetchFiling(ctx, entry)
+	if err != nil {
+		return nil, err
+	}
+	xmlContent, err := extractOwnershipXML(ctx, entry, content)
+	if err != nil {
+		return nil, err
+	}
+	return form4.Parse(bytes.NewReader(xmlContent))
+}
+
+// diffQuarter diffs each 4/A filed in the quarter against the form 4 it amends. The original is the
+// form 4 filed under the issuer on the amendment's date of original submission by the same reporting
+// owners.
+func diffQuarter(ctx context.Context, out io.Writer, y, q int) error {
+	originals := map[string]*quarterFilings{}
+	seen := edgar.AccessionSet{}
+	return client.ForEachFiling(ctx, y, q, edgar.FilingFilter{FormTypes: []string{"4/A"}}, func(amendment *edgar.IndexEntry) error {
+		if !seen.Add(amendment.AccessionNumber) {
+			return nil
+		}
+
+		amended, err := fetchDocument(ctx, amendment)
+		if err != nil {
+			log.Printf("Skipping %s, %s", client.FilingURL(amendment), err)
+			return nil
+		}
+		originalDate := strings.ReplaceAll(amended.DateOfOriginalSubmission, "-", "")
+		if len(originalDate) != 8 {
+			fmt.Fprintf(out, "%s: no date of original submission, skipping\n\n", amendment.AccessionNumber)
+			return nil
+		}
+		month, _ := strconv.Atoi(originalDate[4:6])
+		originalYear, _ := strconv.Atoi(originalDate[:4])
+		key := fmt.Sprintf("%dQ%d", originalYear, (month-1)/3+1)
+		if originals[key] == nil {
+			if originals[key], err = loadQuarterFilings(ctx, originalYear, (month-1)/3+1); err != nil {
+				return err
+			}
+		}
+
+		original, od, err := originals[key].findOriginal(ctx, originalDate, amended)
+		if err != nil {
+			return err
+		}
+		if original == nil {
+			fmt.Fprintf(out, "%s: no form 4 filed %s by the same owners, skipping\n\n", amendment.AccessionNumber, amended.DateOfOriginalSubmission)
+			return nil
+		}
+		printDiff(out, original, od, amendment, amended)
+		fmt.Fprintln(out)
+		return nil
+	})
+}
+
+// quarterFilings are the form 4 filings of a quarter, by date filed and the CIK they are listed under
+type quarterFilings struct {
+	byDateAndCIK map[string][]*edgar.IndexEntry
+}
+
+func loadQuarterFilings(ctx context.Context, y, q int) (*quarterFilings, error) {
+	filings := &quarterFilings{byDateAndCIK: map[string][]*edgar.IndexEntry{}}
+	err := client.ForEachFiling(ctx, y, q, edgar.FilingFilter{FormTypes: []string{"4"}}, func(entry *edgar.IndexEntry) error {
+		key := entry.DateFiled + "/" + strings.TrimLeft(entry.CIK, "0")
+		filings.byDateAndCIK[key] = append(filings.byDateAndCIK[key], entry)
+		return nil
+	})
+	return filings, err
+}
+
+// findOriginal returns the form 4 filed on date under the amendment's issuer with the same reporting
+// owners, the earliest accession number when there are several
+func (f *quarterFilings) findOriginal(ctx context.Context, date string, amended *form4.OwnershipDocument) (*edgar.IndexEntry, *form4.OwnershipDocument, error) {
+	candidates := f.byDateAndCIK[date+"/"+strings.TrimLeft(amended.Issuer.CIK, "0")]
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i].AccessionNumber < candidates[j].AccessionNumber })
+	for _, candidate := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		od, err := fetchDocument(ctx, candidate)
+		if err != nil {
+			log.Printf("Skipping %s, %s", client.FilingURL(candidate), err)
+			continue
+		}
+		if ownerCIKs(od) == ownerCIKs(amended) {
+			return candidate, od, nil
+		}
+	}
+	return nil, nil, nil
+}
+
+func ownerCIKs(od *form4.OwnershipDocument) string {
+	ciks := make([]string, len(od.ReportingOwners))
+	for i, o := range od.ReportingOwners {
+		ciks[i] = strings.TrimLeft(o.CIK, "0")
+	}
+	sort.Strings(ciks)
+	return strings.Join(ciks, ",")
+}
+
+// fieldDiff is a value that differs between the original and the amendment, either of which is empty
+// when the element was added or removed
+type fieldDiff struct {
+	field    string
+	original string
+	amended  string
+}
+
+func printDiff(out io.Writer, original *edgar.IndexEntry, od *form4.OwnershipDocument, amendment *edgar.IndexEntry, amended *form4.OwnershipDocument) {
+	fmt.Fprintf(out, "%s (%s) -> %s (%s) %s %s\n", original.AccessionNumber, od.DocumentType,
+		amendment.AccessionNumber, amended.DocumentType, amended.Issuer.TradingSymbol, amended.Issuer.Name)
+	diffs := diffDocuments(od, amended)
+	if len(diffs) == 0 {
+		fmt.Fprintln(out, "  no differences")
+	}
+	for _, d := range diffs {
+		switch {
+		case d.original == "":
+			fmt.Fprintf(out, "  %s: added %q\n", d.field, d.amended)
+		case d.amended == "":
+			fmt.Fprintf(out, "  %s: removed %q\n", d.field, d.original)
+		default:
+			fmt.Fprintf(out, "  %s: %q -> %q\n", d.field, d.original, d.amended)
+		}
+	}
+}
+
+// diffDocuments compares two ownership documents field by field. Owners, transactions and holdings are
+// matched up by their position in the document and footnotes by their ID.
+func diffDocuments(a, b *form4.OwnershipDocument) []fieldDiff {
+	diffs := []fieldDiff{}
+	compare := func(field, x, y string) {
+		if x != y {
+			diffs = append(diffs, fieldDiff{field, x, y})
+		}
+	}
+
+	compare("period of report", a.PeriodOfReport, b.PeriodOfReport)
+	compare("issuer CIK", a.Issuer.CIK, b.Issuer.CIK)
+	compare("issuer name", a.Issuer.Name, b.Issuer.Name)
+	compare("issuer ticker", a.Issuer.TradingSymbol, b.Issuer.TradingSymbol)
+
+	for i := 0; i < len(a.ReportingOwners) || i < len(b.ReportingOwners); i++ {
+		prefix := fmt.Sprintf("owner %d", i+1)
+		if i >= len(a.ReportingOwners) {
+			compare(prefix, "", ownerSummary(b.ReportingOwners[i]))
+			continue
+		} else if i >= len(b.ReportingOwners) {
+			compare(prefix, ownerSummary(a.ReportingOwners[i]), "")
+			continue
+		}
+		x, y := a.ReportingOwners[i], b.ReportingOwners[i]
+		prefix += " "
+		compare(prefix+"CIK", x.CIK, y.CIK)
+		compare(prefix+"name", x.Name, y.Name)
+		compare(prefix+"city", x.City, y.City)
+		compare(prefix+"state", x.State, y.State)
+		compare(prefix+"director", x.IsDirector, y.IsDirector)
+		compare(prefix+"officer", x.IsOfficer, y.IsOfficer)
+		compare(prefix+"10% owner", x.IsTenPercentOwner, y.IsTenPercentOwner)
+		compare(prefix+"other", x.IsOther, y.IsOther)
+	}
+
+	for i := 0; i < len(a.NonDerivativeTransactions) || i < len(b.NonDerivativeTransactions); i++ {
+		prefix := fmt.Sprintf("transaction %d", i+1)
+		if i >= len(a.NonDerivativeTransactions) {
+			compare(prefix, "", transactionSummary(b.NonDerivativeTransactions[i]))
+			continue
+		} else if i >= len(b.NonDerivativeTransactions) {
+			compare(prefix, transactionSummary(a.NonDerivativeTransactions[i]), "")
+			continue
+		}
+		x, y := a.NonDerivativeTransactions[i], b.NonDerivativeTransactions[i]
+		prefix += " "
+		compare(prefix+"security", x.SecurityTitle, y.SecurityTitle)
+		compare(prefix+"date", x.TransactionDate, y.TransactionDate)
+		compare(prefix+"deemed execution date", x.DeemedExecutionDate, y.DeemedExecutionDate)
+		compare(prefix+"code", x.TransactionCode, y.TransactionCode)
+		compare(prefix+"shares", x.Shares, y.Shares)
+		compare(prefix+"price", x.PricePerShare, y.PricePerShare)
+		compare(prefix+"acquired or disposed", x.AcquiredDisposedCode, y.AcquiredDisposedCode)
+		compare(prefix+"owned after", x.SharesOwnedFollowingTransaction, y.SharesOwnedFollowingTransaction)
+		compare(prefix+"ownership", x.DirectOrIndirectOwnership, y.DirectOrIndirectOwnership)
+	}
+
+	for i := 0; i < len(a.NonDerivativeHoldings) || i < len(b.NonDerivativeHoldings); i++ {
+		prefix := fmt.Sprintf("holding %d", i+1)
+		if i >= len(a.NonDerivativeHoldings) {
+			compare(prefix, "", holdingSummary(b.NonDerivativeHoldings[i]))
+			continue
+		} else if i >= len(b.NonDerivativeHoldings) {
+			compare(prefix, holdingSummary(a.NonDerivativeHoldings[i]), "")
+			continue
+		}
+		x, y := a.NonDerivativeHoldings[i], b.NonDerivativeHoldings[i]
+		prefix += " "
+		compare(prefix+"security", x.SecurityTitle, y.SecurityTitle)
+		compare(prefix+"owned", x.SharesOwnedFollowingTransaction, y.SharesOwnedFollowingTransaction)
+		compare(prefix+"ownership", x.DirectOrIndirectOwnership, y.DirectOrIndirectOwnership)
+	}
+
+	footnotes := map[string]string{}
+	for _, f := range a.Footnotes {
+		footnotes[f.ID] = f.Text
+	}
+	for _, f := range b.Footnotes {
+		compare("footnote "+f.ID, footnotes[f.ID], f.Text)
+		delete(footnotes, f.ID)
+	}
+	removed := make([]string, 0, len(footnotes))
+	for id := range footnotes {
+		removed = append(removed, id)
+	}
+	sort.Strings(removed)
+	for _, id := range removed {
+		compare("footnote "+id, footnotes[id], "")
+	}
+
+	compare("remarks", a.Remarks, b.Remarks)
+	return diffs
+}
+
+// The summaries describe an owner, transaction or holding that only one of the documents has
+
+func ownerSummary(o form4.ReportingOwner) string {
+	return fmt.Sprintf("%s (CIK %s)", o.Name, o.CIK)
+}
+
+func transactionSummary(t form4.NonDerivativeTransaction) string {
+	return fmt.Sprintf("%s %s %s %s at %s on %s", t.TransactionCode, t.AcquiredDisposedCode, t.Shares, t.SecurityTitle, t.PricePerShare, t.TransactionDate)
+}
+
+func holdingSummary(h form4.NonDerivativeHolding) string {
+	return fmt.Sprintf("%s %s (%s)", h.SharesOwnedFollowingTransaction, h.SecurityTitle, h.DirectOrIndirectOwnership)
+}
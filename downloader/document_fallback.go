@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+var documentIndexFallback = flag.Bool("document-index-fallback", true, "when a submission has no usable ownership XML block, look the document up in the filing's index and download it on its own")
+
+// extractOwnershipXML returns the ownership XML of a filing's submission. A submission without a
+// usable <XML> block, e.g. one filed with the form as a separate document or only as a PDF, or whose
+// only block is some other XML document, e.g. an exhibit, falls back to the filing's index, taking the
+// XML document listed as the form. The submission's own block, or error, is kept when the index
+// doesn't list one, or can't be fetched because it isn't there.
+func extractOwnershipXML(ctx context.Context, filing *edgar.IndexEntry, content []byte) ([]byte, error) {
+	xmlContent, err := form4.ExtractXML(content)
+	if !*documentIndexFallback {
+		return xmlContent, err
+	}
+	// A lone block is returned whatever its root, and would be skipped as not an ownership document
+	if err == nil && bytes.Contains(xmlContent, ownershipDocumentTag) {
+		return xmlContent, nil
+	} else if err != nil && !errors.Is(err, form4.ErrNoXMLDocument) {
+		return nil, err
+	}
+
+	recovered, fetchErr := ownershipXMLFromIndex(ctx, filing, content)
+	if fetchErr != nil {
+		return nil, fetchErr
+	} else if recovered == nil {
+		return xmlContent, err
+	}
+	return recovered, nil
+}
+
+var ownershipDocumentTag = []byte("<ownershipDocument")
+
+// ownershipXMLFromIndex downloads the XML document the filing's index lists as the form, nil if it
+// lists none, the index or the document isn't there, or it isn't an ownership document either
+func ownershipXMLFromIndex(ctx context.Context, filing *edgar.IndexEntry, content []byte) ([]byte, error) {
+	formType := filing.FormType
+	if formType == "" {
+		formType = edgar.ParseHeader(content).SubmissionType
+	}
+
+	docs, err := client.FilingDocuments(ctx, filing)
+	if missingDocument(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	doc := edgar.OwnershipXMLDocument(docs, formType)
+	if doc == nil {
+		return nil, nil
+	}
+	recovered, err := client.GetCached(ctx, doc.URL)
+	if missingDocument(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	if !bytes.Contains(recovered, ownershipDocumentTag) {
+		return nil, nil
+	}
+	infof("Recovered the ownership document of %s from its index, %s", client.FilingURL(filing), doc.URL)
+	return recovered, nil
+}
+
+// missingDocument is whether err is a document that isn't on EDGAR, or in the cache when offline
+func missingDocument(err error) bool {
+	return errors.Is(err, edgar.ErrNotFound) || errors.Is(err, edgar.ErrDoesNotExist) || errors.Is(err, edgar.ErrOffline)
+}
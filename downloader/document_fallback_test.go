@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/secfake"
+)
+
+const (
+	exhibitOnlyIndexPath = "/Archives/edgar/data/1775157/000177515722000011/0001775157-22-000011-index.htm"
+	exhibitOnlyFormPath  = "/Archives/edgar/data/1775157/000177515722000011/form4.xml"
+)
+
+var exhibitOnlyIndex = []byte(`<html><body><table class="tableFile">
+<tr><th>Seq</th><th>Description</th><th>Document</th><th>Type</th><th>Size</th></tr>
+<tr><td>1</td><td>FORM 4</td><td><a href="/Archives/edgar/data/1775157/000177515722000011/xslF345X03/form4.xml">form4.html</a></td><td>4</td><td>2 KB</td></tr>
+<tr><td>1</td><td>FORM 4</td><td><a href="` + exhibitOnlyFormPath + `">form4.xml</a></td><td>4</td><td>2 KB</td></tr>
+<tr><td>2</td><td>POWER OF ATTORNEY</td><td><a href="/Archives/edgar/data/1775157/000177515722000011/poa.xml">poa.xml</a></td><td>EX-24</td><td>1 KB</td></tr>
+</table></body></html>`)
+
+var exhibitOnlyForm = []byte(`<?xml version="1.0"?>
+<ownershipDocument>
+    <schemaVersion>X0306</schemaVersion>
+    <documentType>4</documentType>
+</ownershipDocument>`)
+
+// useFake points the downloader's client at a secfake server for the test
+func useFake(t *testing.T) *secfake.Server {
+	t.Helper()
+	fake := secfake.NewServer()
+	t.Cleanup(fake.Close)
+	saved := client
+	client = edgar.NewClient(fake.Options())
+	t.Cleanup(func() { client = saved })
+	return fake
+}
+
+func TestExtractOwnershipXMLExhibitOnly(t *testing.T) {
+	// The submission's only XML block is the power of attorney, the form was filed on its own
+	content, err := os.ReadFile("../pkg/form4/testdata/exhibit_only.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	filing := &edgar.IndexEntry{FormType: "4", AccessionNumber: "000177515722000011", FileName: "edgar/data/1775157/0001775157-22-000011.txt"}
+
+	fake := useFake(t)
+	fake.Add(exhibitOnlyIndexPath, exhibitOnlyIndex)
+	fake.Add(exhibitOnlyFormPath, exhibitOnlyForm)
+	xmlContent, err := extractOwnershipXML(context.Background(), filing, content)
+	if err != nil {
+		t.Fatalf("extractOwnershipXML() = %v", err)
+	}
+	if !bytes.Equal(xmlContent, exhibitOnlyForm) {
+		t.Errorf("extractOwnershipXML() = %q, want the form from the index", xmlContent)
+	}
+
+	// Without the form in the index the exhibit is kept, and skipped when parsed
+	useFake(t)
+	xmlContent, err = extractOwnershipXML(context.Background(), filing, content)
+	if err != nil {
+		t.Fatalf("extractOwnershipXML() without an index = %v", err)
+	}
+	if _, err := form4.Parse(bytes.NewReader(xmlContent)); !errors.Is(err, form4.ErrNotOwnershipDocument) {
+		t.Errorf("Parse() of the kept block = %v, want ErrNotOwnershipDocument", err)
+	}
+}
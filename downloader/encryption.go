@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var encryptionKeyFile = flag.String("encryption-key-file", "", "file holding a hex AES-256 key, e.g. from openssl rand -hex 32, to encrypt the document cache and the history files in -data-dir with")
+
+// stateCipher encrypts the document cache and the history files with -encryption-key-file, nil
+// when they aren't encrypted
+var stateCipher *edgar.Cipher
+
+// loadStateCipher reads -encryption-key-file, or encryption_key_file from config.json
+func loadStateCipher() (*edgar.Cipher, error) {
+	path := *encryptionKeyFile
+	if path == "" {
+		path = cfg.EncryptionKeyFile
+	}
+	if path == "" {
+		return nil, nil
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading the encryption key: %w", err)
+	}
+	key, err := hex.DecodeString(strings.TrimSpace(string(content)))
+	if err != nil {
+		return nil, fmt.Errorf("the encryption key in %s isn't hex: %w", path, err)
+	}
+	return edgar.NewCipher(key)
+}
+
+// stateFiles are the history files and the -parse-cache documents kept in -data-dir, which are
+// encrypted with the cache
+func stateFiles() []string {
+	parsed, _ := filepath.Glob(filepath.Join(*dataDir, "parsed", "*", "*.json.gz"))
+	return append([]string{valueHistoryPath(), netBuyingPath(), rollingPath(), tickerHistoryPath()}, parsed...)
+}
+
+// readStateFile reads a history file, decrypting it if it is encrypted. One written before
+// encryption was turned on is read as it is and encrypted when next written.
+func readStateFile(path string) ([]byte, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil || !edgar.IsSealed(content) {
+		return content, err
+	}
+	if stateCipher == nil {
+		return nil, fmt.Errorf("%s is encrypted, pass its key with -encryption-key-file", path)
+	}
+	content, err = stateCipher.Open(content, filepath.Base(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s can't be decrypted with -encryption-key-file, it was encrypted with another key or is corrupt", path)
+	}
+	return content, nil
+}
+
+// writeStateFile writes a history file, encrypted with -encryption-key-file if set, replacing it only
+// once it is fully written
+func writeStateFile(path string, content []byte) error {
+	if stateCipher != nil {
+		content = stateCipher.Seal(content, filepath.Base(path))
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err = tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// readCSVFile reads a history file's records, none if it doesn't exist yet
+func readCSVFile(path string) ([][]string, error) {
+	content, err := readStateFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return csv.NewReader(bytes.NewReader(content)).ReadAll()
+}
+
+// writeCSVFile writes records to a history file, replacing it only once they are all written
+func writeCSVFile(path string, records [][]string) error {
+	var b bytes.Buffer
+	w := csv.NewWriter(&b)
+	w.WriteAll(records)
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeStateFile(path, b.Bytes())
+}
+
+// plainStateFile is a history file for DuckDB to read, itself or if encrypted, a decrypted copy in
+// the temp directory that done removes
+func plainStateFile(path string) (plain string, done func(), err error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil || !edgar.IsSealed(content) {
+		return path, func() {}, err
+	}
+	if content, err = readStateFile(path); err != nil {
+		return "", nil, err
+	}
+	dir, err := ioutil.TempDir("", "sec4-")
+	if err != nil {
+		return "", nil, err
+	}
+	plain = filepath.Join(dir, filepath.Base(path))
+	if err = ioutil.WriteFile(plain, content, 0600); err != nil {
+		os.RemoveAll(dir)
+		return "", nil, err
+	}
+	return plain, func() { os.RemoveAll(dir) }, nil
+}
+
+// openStoreError explains why the document cache couldn't be opened with -encryption-key-file
+func openStoreError(cachePath string, err error) error {
+	switch {
+	case errors.Is(err, edgar.ErrStoreEncrypted):
+		return fmt.Errorf("the cache in %s is encrypted, pass its key with -encryption-key-file", cachePath)
+	case errors.Is(err, edgar.ErrWrongKey):
+		return fmt.Errorf("the cache in %s was encrypted with another key than -encryption-key-file", cachePath)
+	case errors.Is(err, edgar.ErrStoreNotEncrypted):
+		return fmt.Errorf("the cache in %s isn't encrypted, run cache encrypt with -encryption-key-file to encrypt it first", cachePath)
+	}
+	return err
+}
+
+// runCacheEncrypt encrypts the document cache and history files with -encryption-key-file. It runs
+// before the cache is opened, which needs it encrypted once there's a key.
+func runCacheEncrypt(cachePath string) {
+	if stateCipher == nil {
+		fatal(exitUsage, "cache encrypt needs the key to encrypt with as -encryption-key-file")
+	}
+	objects, err := edgar.EncryptStore(cachePath, stateCipher)
+	if err != nil {
+		log.Printf("Failed to encrypt the cache in %s", cachePath)
+		fatal(exitConfig, openStoreError(cachePath, err))
+	}
+	files := 0
+	for _, path := range stateFiles() {
+		content, err := ioutil.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) || edgar.IsSealed(content) {
+			continue
+		} else if err != nil {
+			log.Fatal(err)
+		}
+		if err = writeStateFile(path, content); err != nil {
+			log.Printf("Failed to encrypt %s", path)
+			log.Fatal(err)
+		}
+		files++
+	}
+	infof("Encrypted %d documents and %d history files in %s", objects, files, *dataDir)
+}
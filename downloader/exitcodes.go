@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+// Exit codes, so a script wrapping the downloader can tell what went wrong without reading the log
+const (
+	exitOK = 0
+	// exitError is anything not covered below, it is what log.Fatal exits with
+	exitError = 1
+	// exitUsage is an unknown command or flag, as the flag package exits
+	exitUsage = 2
+	// exitPartial is a run that finished with some filings failing to download or parse, fewer than
+	// the failure budget allows
+	exitPartial = 3
+	// exitThrottled is a run stopped by EDGAR refusing requests with a 429 or 403
+	exitThrottled = 4
+	// exitConfig is an invalid config.json or flag value
+	exitConfig = 5
+	// exitSink is an output or sink that couldn't be opened, written to or closed
+	exitSink = 6
+	// exitAborted is a run that spent its failure budget on anything but throttling
+	exitAborted = 7
+	// exitInterrupted is a run stopped by SIGINT or SIGTERM, 128 plus SIGINT's number like a shell
+	exitInterrupted = 130
+)
+
+// fatal logs v like log.Fatal, exiting with code
+func fatal(code int, v ...interface{}) {
+	log.Output(2, fmt.Sprint(v...))
+	os.Exit(code)
+}
+
+// fatalf logs like log.Fatalf, exiting with code
+func fatalf(code int, format string, v ...interface{}) {
+	log.Output(2, fmt.Sprintf(format, v...))
+	os.Exit(code)
+}
+
+// isThrottled is whether err is EDGAR refusing a request for going over its fair access limits
+func isThrottled(err error) bool {
+	return errors.Is(err, edgar.ErrRateLimited) || errors.Is(err, edgar.ErrDoesNotExist)
+}
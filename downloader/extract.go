@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+// ExtractRule adds an output column whose value is an XPath expression evaluated against the
+// ownership document, for pulling fields the parser does not know about
+type ExtractRule struct {
+	Column string `json:"column"`
+	XPath  string `json:"xpath"`
+}
+
+type compiledRule struct {
+	column string
+	// exprs holds copies of the compiled expression, which keeps state while evaluating scalar results
+	// and so can't be shared between workers
+	exprs *sync.Pool
+}
+
+var columnNamePattern = regexp.MustCompile(`^[A-Z][A-Z0-9_]*$`)
+
+// CompileExtractRules validates the rules and compiles their expressions once up front
+func CompileExtractRules(rules []ExtractRule) ([]compiledRule, error) {
+	compiled := []compiledRule{}
+	seen := map[string]bool{}
+	for _, column := range csvHeader {
+		seen[column] = true
+	}
+
+	for _, rule := range rules {
+		column := strings.ToUpper(strings.TrimSpace(rule.Column))
+		if !columnNamePattern.MatchString(column) {
+			return nil, fmt.Errorf("invalid extract column name %q, use letters, digits and underscores", rule.Column)
+		}
+		if seen[column] {
+			return nil, fmt.Errorf("extract column %s is already defined", column)
+		}
+		seen[column] = true
+
+		expr, err := xpath.Compile(rule.XPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid xpath for extract column %s: %w", column, err)
+		}
+		source := rule.XPath
+		exprs := &sync.Pool{New: func() interface{} { return xpath.MustCompile(source) }}
+		exprs.Put(expr)
+		compiled = append(compiled, compiledRule{column: column, exprs: exprs})
+	}
+	return compiled, nil
+}
+
+// Eval returns the rule's value for doc. Node sets yield the text of their first node, missing
+// nodes yield an empty string.
+func (r compiledRule) Eval(doc *xmlquery.Node) string {
+	expr := r.exprs.Get().(*xpath.Expr)
+	defer r.exprs.Put(expr)
+	switch v := expr.Evaluate(xmlquery.CreateXPathNavigator(doc)).(type) {
+	case *xpath.NodeIterator:
+		if !v.MoveNext() {
+			return ""
+		}
+		return strings.TrimSpace(v.Current().Value())
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// xpathExtractor adapts the config's extract rules to the Extractor interface
+type xpathExtractor []compiledRule
+
+func (x xpathExtractor) Columns() []string {
+	columns := make([]string, len(x))
+	for i, rule := range x {
+		columns[i] = rule.column
+	}
+	return columns
+}
+
+func (x xpathExtractor) Extract(ctx context.Context, filing *edgar.IndexEntry, doc *xmlquery.Node) ([]string, error) {
+	values := make([]string, len(x))
+	for i, rule := range x {
+		values[i] = rule.Eval(doc)
+	}
+	return values, nil
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+)
+
+var (
+	maxFailureRate         = flag.Float64("max-failure-rate", 2, "abort the run once more than this percent of filings failed to download or parse, checked after the first 100, 0 for no limit")
+	maxConsecutiveFailures = flag.Int("max-consecutive-failures", 5, "abort the run after this many downloads in a row fail, e.g. while EDGAR is down or blocking us, 0 for no limit")
+)
+
+// failureSample is how many filings are attempted before the failure rate is checked, so a failure
+// among the first few doesn't abort the run
+const failureSample = 100
+
+// FailureBudget counts the filings of a run that failed to download or parse, and decides when there
+// are too many to carry on. Filings skipped for not being ownership documents aren't failures.
+type FailureBudget struct {
+	// MaxRate is the most failures as a percent of the filings attempted, 0 for no limit
+	MaxRate float64
+	// MaxConsecutive is the most downloads in a row that may fail, 0 for no limit
+	MaxConsecutive int
+
+	attempted, failed, consecutive int
+	last                           error
+}
+
+// errFailureBudget is wrapped by the error returned once a run has more failures than its
+// FailureBudget allows
+var errFailureBudget = errors.New("ErrFailureBudget")
+
+// Record counts a filing, a failure if err is set, returning an error wrapping errFailureBudget once
+// the budget is spent. downloadFailed is whether it failed to download, as opposed to parse, only those count
+// towards MaxConsecutive since they are what an outage looks like.
+func (b *FailureBudget) Record(err error, downloadFailed bool) error {
+	b.attempted++
+	if err == nil {
+		b.consecutive = 0
+		return nil
+	}
+	b.failed++
+	b.last = err
+	if downloadFailed {
+		b.consecutive++
+	} else {
+		b.consecutive = 0
+	}
+	if b.MaxConsecutive > 0 && b.consecutive >= b.MaxConsecutive {
+		return fmt.Errorf("%w: %d downloads in a row failed, the last with: %s", errFailureBudget, b.consecutive, err)
+	}
+	if b.MaxRate > 0 && b.attempted >= failureSample && b.Rate() > b.MaxRate {
+		return fmt.Errorf("%w: %d of %d filings (%.1f%%) failed, more than -max-failure-rate %g%%", errFailureBudget, b.failed, b.attempted, b.Rate(), b.MaxRate)
+	}
+	return nil
+}
+
+// Rate is the percent of the filings attempted that failed
+func (b *FailureBudget) Rate() float64 {
+	if b.attempted == 0 {
+		return 0
+	}
+	return float64(b.failed) / float64(b.attempted) * 100
+}
+
+// Failed is how many filings failed out of how many were attempted
+func (b *FailureBudget) Failed() (failed, attempted int) {
+	return b.failed, b.attempted
+}
+
+// Last is the error of the last filing that failed, nil if none has
+func (b *FailureBudget) Last() error {
+	return b.last
+}
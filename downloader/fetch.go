@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func runFetch(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("fetch", flag.ExitOnError)
+	output := fs.String("o", "", "write the document to this file instead of stdout")
+	cached := fs.Bool("cache", false, "read the document from the cache and cache it once downloaded, only for documents that never change like filings, not listings or the submissions JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: fetch [-o file] [-cache] <sec.gov URL or path>")
+	}
+	target := fs.Arg(0)
+	if strings.HasPrefix(target, "/") {
+		// A path is on www.sec.gov, or the -edgar-url server standing in for it
+		base := "https://www.sec.gov"
+		if *edgarURL != "" {
+			base = strings.TrimSuffix(*edgarURL, "/")
+		}
+		target = base + target
+	}
+	if err := checkFetchURL(target); err != nil {
+		fatal(exitUsage, err)
+	}
+
+	var content []byte
+	var err error
+	if *cached {
+		content, err = client.GetCached(ctx, target)
+	} else {
+		content, err = client.Get(ctx, target)
+	}
+	if err != nil {
+		if isThrottled(err) {
+			fatal(exitThrottled, err)
+		}
+		log.Fatal(err)
+	}
+
+	if *output == "" {
+		_, err = os.Stdout.Write(content)
+	} else {
+		err = ioutil.WriteFile(*output, content, 0644)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	infof("Fetched %s, %d bytes", target, len(content))
+}
+
+// checkFetchURL only lets fetch request SEC hosts, or the -edgar-url server, so the client's user
+// agent and rate limit aren't spent on other sites
+func checkFetchURL(target string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "https" && u.Scheme != "http" {
+		return fmt.Errorf("%s is not an http(s) URL", target)
+	}
+	host := strings.ToLower(u.Hostname())
+	if host == "sec.gov" || strings.HasSuffix(host, ".sec.gov") {
+		return nil
+	}
+	if *edgarURL != "" {
+		if base, err := url.Parse(*edgarURL); err == nil && strings.EqualFold(base.Host, u.Host) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s is not on sec.gov", target)
+}
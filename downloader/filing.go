@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+func runFiling(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("filing", flag.ExitOnError)
+	cik := fs.String("cik", "", "CIK of the issuer or an owner, to find a filing that isn't cached under it")
+	asJSON := fs.Bool("json", false, "print the filing, its parsed document and its rows as JSON")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: filing [-cik n] [-json] <accession number or EDGAR URL>")
+	}
+
+	filing, err := locateFilingReference(fs.Arg(0), *cik, cachedFilings())
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+	activeExtractors, err := setupExtractors()
+	if err != nil {
+		fatal(exitConfig, err)
+	}
+	if err = setupCorporateActions(ctx); err != nil {
+		fatal(exitConfig, err)
+	}
+	content, err := downloadFiling(ctx, filing)
+	if err != nil {
+		if *cik == "" {
+			log.Println("Filings that aren't cached are looked for under their filer agent, pass the issuer's CIK with -cik")
+		}
+		os.Exit(exitError)
+	}
+	parsed, err := parseFiling(ctx, filing, content, activeExtractors)
+	if err != nil {
+		os.Exit(exitError)
+	}
+
+	if *asJSON {
+		if err = printFilingJSON(os.Stdout, parsed); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	printFiling(os.Stdout, parsed)
+}
+
+// printFiling writes a parsed filing for reading: what it is, who filed it, and each of its rows with
+// every column as the flat output writes it
+func printFiling(out io.Writer, parsed *ParsedFiling) {
+	f, od := parsed.Filing, parsed.Document
+	fmt.Fprintf(out, "%s  form %s  %s\n", f.AccessionNumber, f.FormType, client.FilingURL(f))
+	if f.DateFiled != "" {
+		fmt.Fprintf(out, "filed %s\n", isoDate(f.DateFiled))
+	}
+	if f.AcceptanceDateTime != "" {
+		fmt.Fprintf(out, "accepted %s\n", f.AcceptanceDateTime)
+	}
+	if od.DateOfOriginalSubmission != "" {
+		fmt.Fprintf(out, "amends the filing of %s\n", od.DateOfOriginalSubmission)
+	}
+	fmt.Fprintf(out, "\nissuer   %s (%s), CIK %s\n", od.Issuer.Name, od.Issuer.TradingSymbol, od.Issuer.CIK)
+	for _, o := range od.ReportingOwners {
+		fmt.Fprintf(out, "owner    %s, %s\n", ownerSummary(o), ownerRelationships(o))
+	}
+
+	if len(od.NonDerivativeTransactions) > 0 {
+		fmt.Fprintln(out, "\ntransactions")
+		for i, t := range od.NonDerivativeTransactions {
+			fmt.Fprintf(out, "  %d  %s\n", i+1, transactionSummary(t))
+		}
+	}
+	if len(od.NonDerivativeHoldings) > 0 {
+		fmt.Fprintln(out, "\nholdings")
+		for i, h := range od.NonDerivativeHoldings {
+			fmt.Fprintf(out, "  %d  %s\n", i+1, holdingSummary(h))
+		}
+	}
+
+	fmt.Fprintf(out, "\n%d rows written", len(parsed.Rows))
+	if len(od.ReportingOwners) > 1 {
+		fmt.Fprintf(out, ", one per transaction for each of the %d reporting owners", len(od.ReportingOwners))
+	}
+	if len(parsed.Rows) < len(form4.FlattenOwners(od)) {
+		fmt.Fprint(out, ", transactions missing a required field or left out by the filters aren't written")
+	}
+	fmt.Fprintln(out)
+	for i, row := range parsed.Rows {
+		fmt.Fprintf(out, "\nrow %d\n", i+1)
+		w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for column, name := range csvHeader {
+			if v := row.value(column); v != "" {
+				fmt.Fprintf(w, "  %s\t%s\n", name, v)
+			}
+		}
+		w.Flush()
+	}
+
+	if len(od.Footnotes) > 0 {
+		fmt.Fprintln(out, "\nfootnotes")
+		for _, fn := range od.Footnotes {
+			fmt.Fprintf(out, "  %s  %s\n", fn.ID, strings.Join(strings.Fields(fn.Text), " "))
+		}
+	}
+	if od.Remarks != "" {
+		fmt.Fprintf(out, "\nremarks  %s\n", strings.Join(strings.Fields(od.Remarks), " "))
+	}
+}
+
+// printFilingJSON writes a parsed filing as one JSON object: the index entry, the ownership document
+// as parsed and normalized, and the rows keyed as the jsonl encoding writes them
+func printFilingJSON(out io.Writer, parsed *ParsedFiling) error {
+	rows := []json.RawMessage{}
+	columns := make([]int, len(csvHeader))
+	for i := range columns {
+		columns[i] = i
+	}
+	for _, row := range parsed.Rows {
+		line, err := marshalRowJSON(row, csvHeader, columns)
+		if err != nil {
+			return err
+		}
+		rows = append(rows, line)
+	}
+	enc := json.NewEncoder(out)
+	enc.SetIndent("", "  ")
+	return enc.Encode(orderedObject{
+		{"filing", parsed.Filing},
+		{"document", parsed.Document},
+		{"rows", rows},
+	})
+}
+
+// ownerRelationships is a reporting owner's relationships to the issuer and title, e.g. "director,
+// officer, Chief Financial Officer"
+func ownerRelationships(o form4.ReportingOwner) string {
+	relationships := []string{}
+	for _, r := range []struct{ flag, name string }{
+		{o.IsDirector, "director"},
+		{o.IsOfficer, "officer"},
+		{o.IsTenPercentOwner, "10% owner"},
+		{o.IsOther, "other"},
+	} {
+		if r.flag == "true" || r.flag == "1" {
+			relationships = append(relationships, r.name)
+		}
+	}
+	if o.OfficerTitle != "" {
+		relationships = append(relationships, o.OfficerTitle)
+	}
+	if len(relationships) == 0 {
+		return "no relationship given"
+	}
+	return strings.Join(relationships, ", ")
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"flag"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/shopspring/decimal"
+)
+
+var filingRollupPath = flag.String("filing-rollup", "", "write one row per filing to this file, with its transactions' total shares, weighted average price, total value, dominant direction and the owner's roles")
+
+var filingRollupHeader = []string{"ACCESSION_NUMBER", "FORM_TYPE", "DATE_FILED", "ISSUER_CIK", "ISSUER_NAME", "ISSUER_TICKER", "REPORTER_CIK", "NAME_OF_REPORTING_PERSON", "OWNER_ROLES", "TRANSACTIONS", "TOTAL_SHARES", "NET_SHARES", "WEIGHTED_AVERAGE_PRICE", "TOTAL_VALUE", "DOMINANT_DIRECTION"}
+
+// ownerRoleOrder is the order OWNER_ROLES lists the roles of ownerRoles in
+var ownerRoleOrder = []string{"director", "officer", "ten-percent-owner", "other"}
+
+// filingRollup writes a row per filing as the filings are written, totalling the transactions the
+// filters keep, so it lines up with the rows of the export
+type filingRollup struct {
+	out *fileWriter
+	// err is the first write that failed, the rows after it are dropped
+	err error
+}
+
+// openFilingRollup creates the rollup at path with a data dictionary next to it, or appends to it when
+// resuming an export, since the filings it already has aren't downloaded again
+func openFilingRollup(path string, resuming bool) (*filingRollup, error) {
+	f, err := DetectOutputFormat(path, "", "")
+	if err != nil {
+		return nil, err
+	}
+	f.Header = filingRollupHeader
+	if err := WriteSchema(schemaPath(path, f), "filing_rollup", f); err != nil {
+		return nil, err
+	}
+	appendOnly := false
+	if resuming {
+		_, err := os.Stat(path)
+		appendOnly = err == nil
+	}
+	out, err := openOutputFile(path, f, appendOnly)
+	if err != nil {
+		return nil, err
+	}
+	return &filingRollup{out: out}, nil
+}
+
+func (r *filingRollup) add(parsed *ParsedFiling) {
+	if r.err != nil {
+		return
+	}
+	if values := filingRollupValues(parsed); values != nil {
+		r.err = r.out.Write(&Row{Filing: parsed.Filing, Values: values})
+	}
+}
+
+// close closes the rollup, returning the first write that failed if any did
+func (r *filingRollup) close() error {
+	if err := r.out.Close(); r.err == nil {
+		r.err = err
+	}
+	return r.err
+}
+
+// filingRollupValues totals a filing's transactions, nil if none of them would be written. Shares
+// acquired add to NET_SHARES and shares disposed of subtract from it. The price is averaged over the
+// transactions with one, weighted by their shares, and the dominant direction is the one with the
+// most shares, the first of form4.Directions on a tie.
+func filingRollupValues(parsed *ParsedFiling) []string {
+	transactions := 0
+	var total, net, priced, value decimal.Decimal
+	byDirection := map[string]decimal.Decimal{}
+	var owner form4.TransactionRow
+	for _, t := range selectedTransactions(parsed.Document) {
+		if !hasRequiredFields(t) {
+			continue
+		}
+		owner = t
+		transactions++
+		shares, err := form4.ParseDecimal(t.Shares)
+		if err != nil {
+			continue
+		}
+		total = total.Add(shares)
+		switch strings.ToUpper(t.AcquiredDisposedCode) {
+		case "A":
+			net = net.Add(shares)
+		case "D":
+			net = net.Sub(shares)
+		}
+		direction := form4.ClassifyDirection(t.TransactionCode, t.AcquiredDisposedCode)
+		byDirection[direction] = byDirection[direction].Add(shares)
+		if v, ok := transactionDecimalValue(t); ok {
+			priced = priced.Add(shares)
+			value = value.Add(v)
+		}
+	}
+	if transactions == 0 {
+		return nil
+	}
+
+	roles := []string{}
+	for _, role := range ownerRoleOrder {
+		if hasAnyRole(owner, []string{role}) {
+			roles = append(roles, role)
+		}
+	}
+	var averagePrice string
+	if priced.IsPositive() {
+		averagePrice = value.DivRound(priced, 4).String()
+	}
+	dominant := ""
+	for _, d := range form4.Directions {
+		if shares, ok := byDirection[d.Direction]; ok && (dominant == "" || shares.GreaterThan(byDirection[dominant])) {
+			dominant = d.Direction
+		}
+	}
+
+	filing := parsed.Filing
+	return []string{filing.AccessionNumber, filing.FormType, isoDate(filing.DateFiled), owner.IssuerCIK, owner.IssuerName, owner.IssuerTicker, owner.ReporterCIK, owner.ReporterName,
+		strings.Join(roles, dataQualityFlagsSeparator), strconv.Itoa(transactions), total.String(), net.String(), averagePrice, value.StringFixed(2), dominant}
+}
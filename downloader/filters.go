@@ -0,0 +1,177 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+var (
+	includeCodes = flag.String("codes", "", "comma separated transaction codes to write, e.g. P,S for open market trades only (default every code)")
+	excludeCodes = flag.String("exclude-codes", "", "comma separated transaction codes not to write, e.g. F,G,M,A to drop compensation related transactions")
+	ownership    = flag.String("ownership", "", "write only the transactions of securities owned directly or indirectly: direct or indirect (default both)")
+	includeRoles = flag.String("roles", "", "comma separated roles of the reporting owner to write the transactions of, any of director, officer, ten-percent-owner and other (default every owner)")
+	excludeRoles = flag.String("exclude-roles", "", "comma separated roles of the reporting owner not to write the transactions of, e.g. ten-percent-owner")
+	excludePlans = flag.Bool("exclude-10b5-1", false, "leave out the transactions of filings whose footnotes or remarks say they were made under a Rule 10b5-1 trading plan")
+)
+
+// ownerRoles are the relationships a reporting owner can have to the issuer, by the name -roles uses
+var ownerRoles = map[string]func(t form4.TransactionRow) string{
+	"director":          func(t form4.TransactionRow) string { return t.IsDirector },
+	"officer":           func(t form4.TransactionRow) string { return t.IsOfficer },
+	"ten-percent-owner": func(t form4.TransactionRow) string { return t.IsTenPercentOwner },
+	"other":             func(t form4.TransactionRow) string { return t.IsOther },
+}
+
+// transactionFilter picks the transactions of a filing that are written, set up by setupFilters
+type transactionFilter struct {
+	// codes are the transaction codes written, nil for every code, and excluded those left out
+	codes, excluded map[string]bool
+	// ownership is the D or I of the securities written, empty for both
+	ownership string
+	// roles are those of the owners whose transactions are written, nil for every owner, and
+	// excludedRoles those of the owners left out
+	roles, excludedRoles []string
+	// excludePlans leaves out the filings made under a Rule 10b5-1 plan
+	excludePlans bool
+}
+
+var selection transactionFilter
+
+// setupFilters reads the transaction filters from their flags
+func setupFilters() error {
+	if *includeCodes != "" && *excludeCodes != "" {
+		return fmt.Errorf("-codes and -exclude-codes can't be used together")
+	}
+	var err error
+	if selection.codes, err = parseCodes("-codes", *includeCodes); err != nil {
+		return err
+	}
+	if selection.excluded, err = parseCodes("-exclude-codes", *excludeCodes); err != nil {
+		return err
+	}
+	selection.excludePlans = *excludePlans
+
+	switch strings.ToLower(*ownership) {
+	case "":
+	case "direct":
+		selection.ownership = "D"
+	case "indirect":
+		selection.ownership = "I"
+	default:
+		return fmt.Errorf("-ownership must be direct or indirect, not %q", *ownership)
+	}
+	if selection.roles, err = parseRoles("-roles", *includeRoles); err != nil {
+		return err
+	}
+	selection.excludedRoles, err = parseRoles("-exclude-roles", *excludeRoles)
+	return err
+}
+
+// parseRoles reads a comma separated list of owner roles, nil if it is empty
+func parseRoles(name, list string) ([]string, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	roles := []string{}
+	for _, role := range strings.Split(list, ",") {
+		role = strings.ToLower(strings.TrimSpace(role))
+		if ownerRoles[role] == nil {
+			return nil, fmt.Errorf("%s: unknown role %q, expected director, officer, ten-percent-owner or other", name, role)
+		}
+		roles = append(roles, role)
+	}
+	return roles, nil
+}
+
+// hasAnyRole is whether the reporting owner of a transaction has any of roles
+func hasAnyRole(t form4.TransactionRow, roles []string) bool {
+	for _, role := range roles {
+		if form4.NormalizeFlag(ownerRoles[role](t)) == "true" {
+			return true
+		}
+	}
+	return false
+}
+
+// parseCodes reads a comma separated list of transaction codes, nil if it is empty
+func parseCodes(name, list string) (map[string]bool, error) {
+	if strings.TrimSpace(list) == "" {
+		return nil, nil
+	}
+	known := map[string]bool{}
+	for _, c := range form4.TransactionCodes {
+		known[c.Code] = true
+	}
+	codes := map[string]bool{}
+	for _, code := range strings.Split(list, ",") {
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if !known[code] {
+			return nil, fmt.Errorf("%s: unknown transaction code %q", name, code)
+		}
+		codes[code] = true
+	}
+	return codes, nil
+}
+
+// keep is whether a transaction is written
+func (f transactionFilter) keep(t form4.TransactionRow) bool {
+	if f.codes != nil && !f.codes[t.TransactionCode] {
+		return false
+	}
+	if f.excluded[t.TransactionCode] {
+		return false
+	}
+	if f.ownership != "" && !strings.EqualFold(t.DirectOrIndirectOwnership, f.ownership) {
+		return false
+	}
+	if f.roles != nil && !hasAnyRole(t, f.roles) {
+		return false
+	}
+	return !hasAnyRole(t, f.excludedRoles)
+}
+
+// selectedTransactions are the transactions of a filing the sinks write, those the filters keep, once
+// each for the outputs with a row per transaction. A transaction of a joint filing is kept if the row
+// of any of its owners is, and comes as the first such row. The histories see every transaction, so
+// the filters don't change what is computed from them.
+func selectedTransactions(od *form4.OwnershipDocument) []form4.TransactionRow {
+	rows := selectedOwnerTransactions(od)
+	seen := map[int]bool{}
+	selected := rows[:0]
+	for _, t := range rows {
+		if !seen[t.TransactionIndex] {
+			seen[t.TransactionIndex] = true
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
+
+// selectedOwnerTransactions are the selected transactions with a row for each reporting owner of a
+// joint filing, rather than only the first owner's, for the outputs with a row per owner. The role
+// filters apply to each owner's rows on their own.
+func selectedOwnerTransactions(od *form4.OwnershipDocument) []form4.TransactionRow {
+	return selectRows(od, form4.FlattenOwners(od))
+}
+
+func selectRows(od *form4.OwnershipDocument, rows []form4.TransactionRow) []form4.TransactionRow {
+	if selection.excludePlans && od.MentionsRule10b51Plan() {
+		return nil
+	}
+	selected := rows[:0]
+	for _, t := range rows {
+		if selection.keep(t) {
+			selected = append(selected, t)
+		}
+	}
+	return selected
+}
+
+// isFirstOwner is whether a row is the first listed reporting owner's, whose rows of a joint filing
+// keep the IDs a single owner's would have
+func isFirstOwner(od *form4.OwnershipDocument, t form4.TransactionRow) bool {
+	return len(od.ReportingOwners) == 0 || t.ReporterCIK == od.ReportingOwners[0].CIK
+}
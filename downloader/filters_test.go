@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+func TestSelectedTransactionsJointFiling(t *testing.T) {
+	defer func(saved transactionFilter) { selection = saved }(selection)
+	selection = transactionFilter{roles: []string{"director"}}
+
+	// Only the second owner is a director
+	od := &form4.OwnershipDocument{
+		ReportingOwners: []form4.ReportingOwner{
+			{CIK: "0001611111", IsDirector: "false", IsTenPercentOwner: "true"},
+			{CIK: "0001622222", IsDirector: "true"},
+		},
+		NonDerivativeTransactions: []form4.NonDerivativeTransaction{{TransactionCode: "P"}, {TransactionCode: "S"}},
+	}
+
+	owners := selectedOwnerTransactions(od)
+	if len(owners) != 2 || owners[0].ReporterCIK != "0001622222" || owners[1].ReporterCIK != "0001622222" {
+		t.Fatalf("selectedOwnerTransactions() = %+v, want the director's two rows", owners)
+	}
+	transactions := selectedTransactions(od)
+	if len(transactions) != 2 {
+		t.Fatalf("selectedTransactions() kept %d transactions, want both, the director's rows pass", len(transactions))
+	}
+	for i, tx := range transactions {
+		if tx.TransactionIndex != i || tx.ReporterCIK != "0001622222" {
+			t.Errorf("transaction %d is %d of %s, want %d of the director", i, tx.TransactionIndex, tx.ReporterCIK, i)
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var formTypesFlag = flag.String("form-types", "", "comma separated form types to download from the daily indexes, or /regexp/ matched against the whole form type, e.g. 3,3/A,5,5/A or /[345](/A)?/ (default 4,4/A)")
+
+// defaultFormTypes are the forms downloaded without -form-types or form_types
+var defaultFormTypes = []string{"4", "4/A"}
+
+// formTypes is the filter the daily index entries are selected with, set up by setupFormTypes
+var formTypes = edgar.FilingFilter{FormTypes: defaultFormTypes}
+
+// setupFormTypes reads the form types to download from -form-types, else from the config
+func setupFormTypes() error {
+	types := cfg.FormTypes
+	if flagIsSet(flag.CommandLine, "form-types") {
+		types = strings.Split(*formTypesFlag, ",")
+	}
+	if len(types) == 0 {
+		return nil
+	}
+	filter, err := parseFormTypes(types)
+	if err != nil {
+		return err
+	}
+	formTypes = filter
+	return nil
+}
+
+// parseFormTypes reads a list of form types, each an exact type like 4/A or a regular expression
+// between slashes like /[345]/, which has to match the whole type
+func parseFormTypes(types []string) (edgar.FilingFilter, error) {
+	filter := edgar.FilingFilter{}
+	for _, t := range types {
+		t = strings.TrimSpace(t)
+		switch {
+		case t == "":
+			continue
+		case len(t) > 1 && strings.HasPrefix(t, "/") && strings.HasSuffix(t, "/"):
+			pattern, err := regexp.Compile(`^(?:` + t[1:len(t)-1] + `)$`)
+			if err != nil {
+				return filter, fmt.Errorf("invalid form type pattern %s: %w", t, err)
+			}
+			filter.FormTypePatterns = append(filter.FormTypePatterns, pattern)
+		default:
+			filter.FormTypes = append(filter.FormTypes, strings.ToUpper(t))
+		}
+	}
+	if len(filter.FormTypes) == 0 && len(filter.FormTypePatterns) == 0 {
+		return filter, fmt.Errorf("no form types to download")
+	}
+	return filter, nil
+}
+
+// describeFormTypes names the form types of filter for the log, e.g. "4 and 4/A"
+func describeFormTypes(filter edgar.FilingFilter) string {
+	names := append([]string{}, filter.FormTypes...)
+	for _, pattern := range filter.FormTypePatterns {
+		names = append(names, "/"+strings.TrimSuffix(strings.TrimPrefix(pattern.String(), "^(?:"), ")$")+"/")
+	}
+	if len(names) == 1 {
+		return names[0]
+	}
+	return strings.Join(names[:len(names)-1], ", ") + " and " + names[len(names)-1]
+}
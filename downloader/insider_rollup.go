@@ -0,0 +1,107 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/shopspring/decimal"
+)
+
+var insiderRollupPath = flag.String("insider-rollup", "", "write each insider's filings, net shares, net dollars and issuers traded by month over the run to this file")
+
+var insiderRollupHeader = []string{"MONTH", "REPORTER_CIK", "NAME_OF_REPORTING_PERSON", "FILINGS", "TRANSACTIONS", "ISSUERS_TRADED", "NET_SHARES", "NET_DOLLARS"}
+
+// insiderMonth is what an insider filed in one month
+type insiderMonth struct {
+	month, cik, name      string
+	filings, transactions int
+	issuers               map[string]bool
+	shares, dollars       decimal.Decimal
+}
+
+// insiderRollup totals the transactions the filters keep by reporting owner and the month they were
+// filed in, keyed by month then CIK. Filing months keep each quarter's rollup to its own three months.
+// A joint filing counts for each of its owners.
+type insiderRollup map[string]*insiderMonth
+
+func (r insiderRollup) add(parsed *ParsedFiling) {
+	owners := map[string]*insiderMonth{}
+	for _, t := range selectedOwnerTransactions(parsed.Document) {
+		if !hasRequiredFields(t) {
+			continue
+		}
+		month, cik := isoDate(parsed.Filing.DateFiled), edgar.PadCIK(t.ReporterCIK)
+		totals := owners[cik]
+		if totals == nil {
+			if len(month) > 7 {
+				month = month[:7]
+			}
+			key := month + "/" + cik
+			if totals = r[key]; totals == nil {
+				totals = &insiderMonth{month: month, cik: cik, issuers: map[string]bool{}}
+				r[key] = totals
+			}
+			totals.name = t.ReporterName
+			totals.filings++
+			owners[cik] = totals
+		}
+		totals.transactions++
+		totals.issuers[edgar.PadCIK(t.IssuerCIK)] = true
+
+		shares, err := form4.ParseDecimal(t.Shares)
+		if err != nil {
+			continue
+		}
+		value, priced := transactionDecimalValue(t)
+		switch strings.ToUpper(t.AcquiredDisposedCode) {
+		case "A":
+			totals.shares = totals.shares.Add(shares)
+			if priced {
+				totals.dollars = totals.dollars.Add(value)
+			}
+		case "D":
+			totals.shares = totals.shares.Sub(shares)
+			if priced {
+				totals.dollars = totals.dollars.Sub(value)
+			}
+		}
+	}
+}
+
+// write writes one row per insider and month, ordered by month then CIK, with a data dictionary next
+// to it like any export
+func (r insiderRollup) write(path string) error {
+	f, err := DetectOutputFormat(path, "", "")
+	if err != nil {
+		return err
+	}
+	f.Header = insiderRollupHeader
+	if err := WriteSchema(schemaPath(path, f), "insider_rollup", f); err != nil {
+		return err
+	}
+
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out, err := openOutputFile(path, f, false)
+	if err != nil {
+		return err
+	}
+	for _, key := range keys {
+		t := r[key]
+		values := []string{t.month, t.cik, t.name, strconv.Itoa(t.filings), strconv.Itoa(t.transactions), strconv.Itoa(len(t.issuers)),
+			t.shares.String(), t.dollars.StringFixed(2)}
+		if err := out.Write(&Row{Values: values}); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
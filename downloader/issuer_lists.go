@@ -0,0 +1,102 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var (
+	issuerAllowlist = flag.String("issuer-allowlist", "", "file of issuer CIKs, one per line, to download the filings of, leaving out every other issuer")
+	issuerDenylist  = flag.String("issuer-denylist", "", "file of issuer CIKs, one per line, not to download the filings of, e.g. ETFs and blank-check companies")
+)
+
+// errIssuerExcluded is returned for a filing of an issuer the allow or deny list leaves out, it is
+// skipped rather than failed
+var errIssuerExcluded = errors.New("the issuer isn't selected")
+
+// issuerLists are the issuers whose filings are downloaded, set up by setupIssuerLists
+type issuerLists struct {
+	// allow is nil for every issuer
+	allow, deny map[string]bool
+}
+
+var selectedIssuers issuerLists
+
+// setupIssuerLists reads -issuer-allowlist and -issuer-denylist
+func setupIssuerLists() error {
+	var err error
+	if *issuerAllowlist != "" {
+		if selectedIssuers.allow, err = readCIKList(*issuerAllowlist); err != nil {
+			return fmt.Errorf("-issuer-allowlist: %w", err)
+		}
+	}
+	if *issuerDenylist != "" {
+		if selectedIssuers.deny, err = readCIKList(*issuerDenylist); err != nil {
+			return fmt.Errorf("-issuer-denylist: %w", err)
+		}
+	}
+	return nil
+}
+
+// readCIKList reads a file of CIKs, each at the start of a line and optionally followed by a name or
+// a note, skipping blank lines and # comments
+func readCIKList(path string) (map[string]bool, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	ciks := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		cik := strings.TrimSuffix(fields[0], ",")
+		if strings.Trim(cik, "0123456789") != "" {
+			return nil, fmt.Errorf("line %d: invalid CIK %q", line, cik)
+		}
+		ciks[edgar.PadCIK(cik)] = true
+	}
+	return ciks, scanner.Err()
+}
+
+// allows is whether the filings of the issuer with cik are downloaded
+func (l issuerLists) allows(cik string) bool {
+	cik = edgar.PadCIK(cik)
+	return (l.allow == nil || l.allow[cik]) && !l.deny[cik]
+}
+
+// filter drops the index entries of filings of issuers the lists leave out. The index lists a filing
+// under its issuer and each reporting owner without saying which is which, so a filing is kept if any
+// CIK it is listed under is allowed and dropped if any is denied. parseFiling checks the issuer again
+// once it is known.
+func (l issuerLists) filter(entries []*edgar.IndexEntry) []*edgar.IndexEntry {
+	if l.allow == nil && l.deny == nil {
+		return entries
+	}
+	allowed, denied := map[string]bool{}, map[string]bool{}
+	for _, e := range entries {
+		cik := edgar.PadCIK(e.CIK)
+		if l.allow == nil || l.allow[cik] {
+			allowed[e.AccessionNumber] = true
+		}
+		if l.deny[cik] {
+			denied[e.AccessionNumber] = true
+		}
+	}
+	kept := []*edgar.IndexEntry{}
+	for _, e := range entries {
+		if allowed[e.AccessionNumber] && !denied[e.AccessionNumber] {
+			kept = append(kept, e)
+		}
+	}
+	return kept
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/shopspring/decimal"
+)
+
+var issuerRollupPath = flag.String("issuer-rollup", "", "write each issuer's net insider buying by trading day over the run to this file, to join against daily prices")
+
+var issuerRollupHeader = []string{"TRANSACTION_DATE", "ISSUER_CIK", "ISSUER_TICKER", "ISSUER_NAME", "BUYERS", "SELLERS", "PURCHASES", "SALES", "PURCHASE_VALUE", "SALE_VALUE", "NET_VALUE"}
+
+// issuerDay is the open market buying and selling by the insiders of an issuer on one day
+type issuerDay struct {
+	date, cik, ticker, name string
+	buyers, sellers         map[string]bool
+	purchases, sales        int
+	bought, sold            decimal.Decimal
+}
+
+// issuerRollup totals the open market purchases (code P) and sales (code S) with a price the filters
+// keep by issuer and transaction date, keyed by date then CIK
+type issuerRollup map[string]*issuerDay
+
+func (r issuerRollup) add(parsed *ParsedFiling) {
+	r.addOn(parsed, "")
+}
+
+// addOn totals a filing's transactions under date instead of their transaction dates, unless it is
+// empty
+func (r issuerRollup) addOn(parsed *ParsedFiling, date string) {
+	totalled := map[int]bool{}
+	for _, t := range selectedOwnerTransactions(parsed.Document) {
+		if (t.TransactionCode != "P" && t.TransactionCode != "S") || !hasRequiredFields(t) {
+			continue
+		}
+		value, ok := transactionDecimalValue(t)
+		if !ok {
+			continue
+		}
+		day, cik := date, edgar.PadCIK(t.IssuerCIK)
+		if day == "" {
+			day = t.TransactionDate
+		}
+		totals := r[day+"/"+cik]
+		if totals == nil {
+			totals = &issuerDay{date: day, cik: cik, buyers: map[string]bool{}, sellers: map[string]bool{}}
+			r[day+"/"+cik] = totals
+		}
+		// Tickers are filed in any case, price series have them in upper case
+		totals.ticker, totals.name = strings.ToUpper(strings.TrimSpace(t.IssuerTicker)), t.IssuerName
+		// Every owner of a joint filing is a buyer or seller, but the transaction is only totalled once
+		counted := !totalled[t.TransactionIndex]
+		totalled[t.TransactionIndex] = true
+		if t.TransactionCode == "P" {
+			totals.buyers[edgar.PadCIK(t.ReporterCIK)] = true
+			if counted {
+				totals.purchases++
+				totals.bought = totals.bought.Add(value)
+			}
+		} else {
+			totals.sellers[edgar.PadCIK(t.ReporterCIK)] = true
+			if counted {
+				totals.sales++
+				totals.sold = totals.sold.Add(value)
+			}
+		}
+	}
+}
+
+// write writes one row per issuer and day with any purchases or sales, ordered by date then CIK, with
+// a data dictionary next to it like any export
+func (r issuerRollup) write(path string) error {
+	f, err := DetectOutputFormat(path, "", "")
+	if err != nil {
+		return err
+	}
+	f.Header = issuerRollupHeader
+	if err := WriteSchema(schemaPath(path, f), "issuer_rollup", f); err != nil {
+		return err
+	}
+
+	out, err := openOutputFile(path, f, false)
+	if err != nil {
+		return err
+	}
+	for _, d := range r.days() {
+		values := []string{d.date, d.cik, d.ticker, d.name, strconv.Itoa(len(d.buyers)), strconv.Itoa(len(d.sellers)), strconv.Itoa(d.purchases), strconv.Itoa(d.sales),
+			d.bought.StringFixed(2), d.sold.StringFixed(2), d.bought.Sub(d.sold).StringFixed(2)}
+		if err := out.Write(&Row{Values: values}); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
+
+// days are the issuers' days ordered by date then CIK
+func (r issuerRollup) days() []*issuerDay {
+	keys := make([]string, 0, len(r))
+	for key := range r {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	days := make([]*issuerDay, len(keys))
+	for i, key := range keys {
+		days[i] = r[key]
+	}
+	return days
+}
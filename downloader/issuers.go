@@ -0,0 +1,26 @@
+package main
+
+import (
+	"context"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+// issuerCompany returns the issuer's address, state of incorporation and fiscal year end as the
+// submission's SEC header gives them, falling back to the issuer's submissions JSON with
+// -lookup-issuers. It is nil when neither had them.
+func issuerCompany(ctx context.Context, header *edgar.Header, od *form4.OwnershipDocument) *edgar.Company {
+	if header.Issuer != nil {
+		return header.Issuer
+	}
+	if !*lookupIssuers || od.Issuer.CIK == "" {
+		return nil
+	}
+	s := lookupSubmissions(ctx, od.Issuer.CIK)
+	if s == nil {
+		return nil
+	}
+	c := s.Company()
+	return &c
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sync"
+)
+
+var (
+	quiet       = flag.Bool("quiet", false, "only log warnings and errors, not progress")
+	verbose     = flag.Bool("verbose", false, "also log every request made to EDGAR, with timestamps to the microsecond")
+	logFile     = flag.String("log-file", "", "also append the log to this file, rotated once it reaches -log-max-size")
+	logMaxSize  = flag.Int64("log-max-size", 100, "megabytes -log-file grows to before it is rotated to <file>.1, the one before to <file>.2 and so on")
+	logMaxFiles = flag.Int("log-max-files", 5, "rotated log files to keep besides -log-file")
+)
+
+// setupLogging applies -quiet, -verbose and -log-file, returning the log file to close on exit, if any
+func setupLogging() (io.Closer, error) {
+	if *quiet && *verbose {
+		return nil, fmt.Errorf("-quiet and -verbose can't both be set")
+	}
+	if *verbose {
+		log.SetFlags(log.LstdFlags | log.Lmicroseconds)
+	}
+	if *logFile == "" {
+		return nil, nil
+	}
+	w, err := openRotatingFile(*logFile, *logMaxSize*1024*1024, *logMaxFiles)
+	if err != nil {
+		return nil, fmt.Errorf("error opening log file: %w", err)
+	}
+	log.SetOutput(io.MultiWriter(os.Stderr, w))
+	return w, nil
+}
+
+// infof logs progress, which -quiet leaves out
+func infof(format string, v ...interface{}) {
+	if !*quiet {
+		log.Printf(format, v...)
+	}
+}
+
+// debugf logs detail only wanted with -verbose
+func debugf(format string, v ...interface{}) {
+	if *verbose {
+		log.Printf(format, v...)
+	}
+}
+
+// rotatingFile appends to a file, renaming it to path.1 (and path.1 to path.2, ...) and starting a new
+// one once it would grow past maxSize, keeping at most maxFiles of the old ones
+type rotatingFile struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64
+	maxFiles int
+	f        *os.File
+	size     int64
+}
+
+func openRotatingFile(path string, maxSize int64, maxFiles int) (*rotatingFile, error) {
+	r := &rotatingFile{path: path, maxSize: maxSize, maxFiles: maxFiles}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	r.f, r.size = f, info.Size()
+	return nil
+}
+
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	if r.maxFiles < 1 {
+		os.Remove(r.path)
+	} else {
+		os.Remove(fmt.Sprintf("%s.%d", r.path, r.maxFiles))
+		for i := r.maxFiles - 1; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", r.path, i), fmt.Sprintf("%s.%d", r.path, i+1))
+		}
+		if err := os.Rename(r.path, r.path+".1"); err != nil {
+			return err
+		}
+	}
+	return r.open()
+}
+
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.f.Close()
+}
@@ -2,462 +2,872 @@ package main
 
 import (
 	"bytes"
-	"compress/gzip"
 	"context"
-	"encoding/csv"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
+	"flag"
 	"fmt"
-	"io/ioutil"
 	"log"
-	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sort"
 	"strings"
-	"time"
+	"sync"
+	"syscall"
 
-	"github.com/PuerkitoBio/goquery"
 	"github.com/antchfx/xmlquery"
-	"github.com/cenkalti/backoff/v4"
-	"github.com/davecgh/go-spew/spew"
-	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
 	"github.com/samber/lo"
-	"go.uber.org/ratelimit"
 )
 
 var (
-	secRL = ratelimit.New(9)
-
-	indexURL = "https://www.sec.gov/Archives/edgar/daily-index/%d/QTR%d/"
-	year     = 2022
-	quarter  = 2
+	store  *edgar.Store
+	client *edgar.Client
+	cfg    *Config
+
+	dataDir          = flag.String("data-dir", defaultDir(os.UserCacheDir), "directory the document cache is kept in, created and migrated as needed")
+	outputPath       = flag.String("output", "", "file to write rows to, - to stream them to stdout as jsonl, or the root directory when partitioning, {year} and {quarter} are filled in with each quarter's (default form4_<year>_q<quarter>.<format>, or out/)")
+	partition        = flag.String("partition", "", "comma separated keys to partition output by: year, month, day (filing date), ticker, form")
+	partitionStyle   = flag.String("partition-style", "plain", "directory layout of partitions: plain (out/2024/05/ABC.csv) or hive (out/year=2024/month=05/ticker=ABC/data.csv)")
+	format           = flag.String("format", "", "output encoding, csv or jsonl (default from the -output extension, else csv)")
+	maxRows          = flag.Int64("max-rows", 0, "start a new part file (name-part-00001.csv, ...) after this many rows, 0 for no limit")
+	maxBytes         = flag.Int64("max-bytes", 0, "start a new part file once the current one reaches this many bytes, 0 for no limit")
+	sink             = flag.String("sink", "file", "registered sink to write rows to")
+	extractorNames   = flag.String("extractors", "", "comma separated registered extractors to add columns from")
+	columns          = flag.String("columns", "", "comma separated output columns in the order to write them (default all)")
+	compress         = flag.String("compress", "", "output compression, none, gzip or zstd (default from the -output extension, e.g. .csv.gz)")
+	edgarURL         = flag.String("edgar-url", "", "serve every EDGAR request from this base URL instead, e.g. a pkg/secfake server")
+	configDir        = flag.String("config-dir", defaultDir(os.UserConfigDir), "directory config.json is read from")
+	downloaders      = flag.Int("download-workers", 4, "filings to download concurrently, all sharing the rate limit")
+	parsers          = flag.Int("parse-workers", runtime.NumCPU(), "downloaded filings to parse concurrently")
+	maxInFlight      = flag.Int("max-in-flight", 64, "most filings to hold in memory waiting to be written in order, bounds memory use")
+	cpuProfile       = flag.String("cpuprofile", "", "write a CPU profile of the run to this file, for go tool pprof")
+	table            = flag.String("table", "form4_transactions", "table the snowflake and redshift sinks load rows into, optionally qualified by schema")
+	rawFlags         = flag.Bool("raw-flags", false, "write relationship flags as filed (1, 0, true or false) rather than true/false, for debugging")
+	lookupIssuers    = flag.Bool("lookup-issuers", false, "look up the address, state of incorporation and fiscal year end of issuers missing from a submission's header in their data.sec.gov submissions JSON")
+	lookupAcceptance = flag.Bool("lookup-acceptance", false, "look up the acceptance time of submissions without one in their header in the filer's data.sec.gov submissions JSON")
+
+	// defaultYear and defaultQuarter are the quarter downloaded without -period
+	defaultYear    = 2022
+	defaultQuarter = 2
 )
 
-type DailyFilingsRow struct {
-	CIK             string
-	CompanyName     string
-	FormType        string
-	DateFiled       string
-	FileName        string
-	AccessionNumber string
-}
-
 func main() {
-	// Get the master files
-	filings, err := GetFilingsForYearQuarter(year, quarter)
+	flag.Usage = usage
+	flag.Parse()
+	logCloser, err := setupLogging()
 	if err != nil {
-		log.Fatal(err)
+		fatal(exitConfig, err)
+	}
+	if logCloser != nil {
+		defer logCloser.Close()
 	}
-	log.Printf("Fetched %d filings", len(filings))
-	spew.Dump("Filtering down filings")
-
-	filings = lo.Filter(filings, func(v *DailyFilingsRow, i int) bool {
-		return v.FormType == "4" || v.FormType == "4/A"
-	})
-	log.Printf("Filtered down to %d 4 and 4/A filings", len(filings))
 
-	csvData := [][]string{
-		{"ISSUER_CIK", "REPORTER_CIK", "ACCESSION_NUMBER", "NAME_OF_REPORTING_PERSON", "A_OR_D", "AMOUNT", "PRICE", "TRANSACTION_DATE", "TITLE_OF_SECURITY", "ISSUER_NAME", "ISSUER_TICKER", "IS_DIRECTOR", "IS_OFFICER", "IS_TEN_PERCENT_OWNER", "IS_OTHER_RELATIONSHIP", "NEW_AMOUNT_OWNED", "DIRECT_OR_INDIRECT_OWNERSHIP"},
+	cmd := "download"
+	args := flag.Args()
+	if len(args) > 0 {
+		cmd, args = args[0], args[1:]
 	}
 
-	for i, filing := range filings {
-		// Check if exists
-		// log.Printf("Downloading %+v", filing)
-		var content []byte
-		var err error
-		filePath := "form4_xml/" + fmt.Sprintf("%s_%s.xml", filing.CIK, filing.AccessionNumber)
-		if _, err = os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
-			// path/to/whatever does not exist
-			content, err = DownloadSECFile("https://www.sec.gov/Archives/" + filing.FileName)
-			if err != nil {
-				log.Printf("Error downloading file %s", filePath)
-				log.Println(err)
-				continue
-			}
+	cfg, err = LoadConfig(*configDir)
+	if err != nil {
+		fatal(exitConfig, err)
+	}
+	if cfg.DataDir != "" && !flagIsSet(flag.CommandLine, "data-dir") {
+		*dataDir = cfg.DataDir
+	}
 
-			// Write file to disk
-			err = ioutil.WriteFile(filePath, content, 0777)
-			if err != nil {
-				log.Println("Failed to write file to disk", filePath)
-				log.Fatal(err)
-			}
-		} else {
-			// Read from disk
-			content, err = ioutil.ReadFile(filePath)
-			if err != nil {
-				log.Println("Error reading file on disk", filePath)
-				log.Fatal(err)
-			}
-		}
+	cachePath, err := OpenDataDir(*dataDir)
+	if err != nil {
+		fatal(exitConfig, err)
+	}
+	if stateCipher, err = loadStateCipher(); err != nil {
+		fatal(exitConfig, err)
+	}
+	if cmd == "cache" && len(args) > 0 && args[0] == "encrypt" {
+		runCacheEncrypt(cachePath)
+		return
+	}
+	store, err = edgar.OpenStore(cachePath, edgar.StoreOptions{Cipher: stateCipher})
+	if err != nil {
+		fatal(exitConfig, openStoreError(cachePath, err))
+	}
+	defer store.Close()
+	if err = setupRedis(); err != nil {
+		fatal(exitConfig, err)
+	}
+	limiter, err := newClientLimiter()
+	if err != nil {
+		fatal(exitConfig, err)
+	}
+	// reparse is a download that never leaves the cache
+	clientOpts := edgar.Options{Cache: store, Limiter: limiter, Logf: debugf, Offline: cmd == "reparse"}
+	if *edgarURL != "" {
+		clientOpts.ArchivesURL = *edgarURL + "/Archives"
+		clientOpts.DataURL = *edgarURL
+		clientOpts.FilesURL = *edgarURL + "/files"
+	}
+	client = edgar.NewClient(clientOpts)
 
-		// Extract the XML portion, some files use form4.xml while others use primarydocument.xml or primary_doc.xml
-		// https://www.sec.gov/Archives/edgar/data/0001184237/000156218022003904/xslF345X03/primarydocument.xml
-		// https://www.sec.gov/Archives/edgar/data/1000623/000106299322009210/xslF345X03/form4.xml
-		// https://www.sec.gov/Archives/edgar/data/1775157/000154161722000010/primary_doc.xml
-		// https://www.sec.gov/Archives/edgar/data/0001452857/000092189522001052/xslF345X03/form404197004_04012022.xml
-		parts := strings.Split(string(content), "<XML>")
-		if len(parts) != 2 {
-			log.Printf("Skipping %s, invalid parts 1", filePath)
-			continue
+	if *cpuProfile != "" {
+		f, err := os.Create(*cpuProfile)
+		if err != nil {
+			log.Fatal(err)
 		}
-		parts = strings.Split(parts[1], "</XML>")
-		if len(parts) != 2 {
-			log.Printf("Skipping %s, invalid parts 2", filePath)
-			continue
+		if err = pprof.StartCPUProfile(f); err != nil {
+			log.Fatal(err)
 		}
+		defer pprof.StopCPUProfile()
+	}
 
-		content = []byte(parts[0])
+	// Interrupting a long backfill cancels in flight requests, and the output is still closed cleanly
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch cmd {
+	case "download", "reparse":
+		runDownload(ctx)
+	case "cache":
+		runCacheCommand(ctx, args)
+	case "search":
+		runSearch(args)
+	case "query":
+		runQuery(args)
+	case "stats":
+		runStats(args)
+	case "diff":
+		runDiff(ctx, args)
+	case "tickers":
+		runTickers(args)
+	case "serve":
+		runServe(ctx, args)
+	case "keys":
+		runKeysCommand(args)
+	case "daemon":
+		runDaemon(ctx, args)
+	case "filing":
+		runFiling(ctx, args)
+	case "fetch":
+		runFetch(ctx, args)
+	case "convert":
+		runConvert(args)
+	case "db":
+		runDBCommand(ctx, args)
+	case "manifest":
+		runManifestCommand(args)
+	case "queue":
+		runQueueCommand(ctx, args)
+	default:
+		log.Printf("Unknown command %q", cmd)
+		usage()
+		os.Exit(exitUsage)
+	}
+}
 
-		doc, err := xmlquery.Parse(bytes.NewReader(content))
-		if err != nil {
-			log.Println("Failed to parse file", filePath)
-			log.Fatal(err)
-		}
+func usage() {
+	fmt.Fprintf(flag.CommandLine.Output(), `Usage: %s [flags] [command]
+
+Commands:
+  download       download and parse the form 4 filings of the quarters of -period (default)
+  reparse        parse and export the quarters of -period again from the cache, without the network
+  cache verify   re-hash every cached document and report corrupt entries
+  cache status   print what the cache holds, with -fix reconcile its index with the disk
+  cache export   pack the cache and its index into a tar.zst bundle
+  cache import   load a bundle produced by cache export into the cache
+  cache encrypt  encrypt the cache and history files with -encryption-key-file
+  search <query> search the footnotes and remarks indexed by -sink search
+  query <SQL>    run SQL over the local outputs with DuckDB, the form4 view reads them
+  stats          print leaderboards of insider buying and selling for a quarter's output
+  diff <a> <b>   show what a 4/A changed from the form 4 it amends, or every 4/A of -period
+  filing <a>     fetch and parse one filing by accession number or URL and print the result
+  fetch <url>    download a sec.gov URL with the rate limited client, to stdout or -o file
+  convert <file> upgrade an export written by an older version to the current output schema
+  db migrate     upgrade the -sink table at -output to the current output schema
+  manifest merge merge the manifests of the quarters of a backfill into one
+  tickers <t>    show every ticker the issuers that filed under ticker or CIK t have used
+  serve          serve the transactions of the outputs over a REST API
+  keys create    create an API key for serve, with -scope read or admin
+  keys list      list the API keys
+  keys revoke    revoke an API key by name
+  daemon         run downloads on cron schedules, e.g. -schedule "15 22 * * 1-5"
+  queue add      add a download or reparse run to a queue in -redis, e.g. queue add -- -period 2024Q1 reparse
+  queue work     run the jobs on the queues in -redis, highest priority first, retrying failed ones
+  queue list     list the queued, active and dead jobs
+  queue retry    put the dead jobs back on their queues
+
+Flags:
+`, os.Args[0])
+	flag.PrintDefaults()
+}
 
-		issuerCIK, err := xmlquery.Query(doc, "//ownershipDocument/issuer/issuerCik")
-		if err != nil {
-			log.Println("Error getting issuer cik")
-			log.Println(err)
-			continue
-		} else if issuerCIK == nil {
-			// log.Println("Issuer CIK was nil for", filePath)
-			continue
+// flagIsSet returns whether the named flag was passed explicitly, as opposed to holding its default
+func flagIsSet(fs *flag.FlagSet, name string) bool {
+	set := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
 		}
+	})
+	return set
+}
 
-		reportingPersonCIK, err := xmlquery.Query(doc, "//ownershipDocument/reportingOwner/reportingOwnerId/rptOwnerCik")
-		if err != nil {
-			log.Println("Error getting reporting cik")
-			log.Println(err)
-			continue
-		} else if reportingPersonCIK == nil {
-			// log.Println("Reporting CIK was nil for", filePath)
-			continue
-		}
+func init() {
+	RegisterSink("file", openOutput)
+}
 
-		reportingPersonName, err := xmlquery.Query(doc, "//ownershipDocument/reportingOwner/reportingOwnerId/rptOwnerName")
-		if err != nil {
-			log.Println("Error getting reportingPerson name")
-			log.Println(err)
-			continue
-		} else if reportingPersonName == nil {
-			// log.Println("reportingPerson Name was nil for", filePath)
-			continue
-		}
+// setupExtractors compiles the config's extract rules and looks up the registered extractors picked
+// by -extractors, adding their columns to the header
+func setupExtractors() ([]Extractor, error) {
+	rules, err := CompileExtractRules(cfg.Extract)
+	if err != nil {
+		return nil, err
+	}
 
-		aOrD, err := xmlquery.Query(doc, "//ownershipDocument/nonDerivativeTable/nonDerivativeTransaction/transactionAmounts/transactionAcquiredDisposedCode/value")
-		if err != nil {
-			log.Println("Error getting a or d")
-			log.Println(err)
-			continue
-		} else if aOrD == nil {
-			// log.Println("a or d was nil for", filePath)
-			continue
-		}
+	names := cfg.Extractors
+	if flagIsSet(flag.CommandLine, "extractors") {
+		names = strings.Split(*extractorNames, ",")
+	}
+	registered, err := LookupExtractors(names)
+	if err != nil {
+		return nil, err
+	}
 
-		amount, err := xmlquery.Query(doc, "//ownershipDocument/nonDerivativeTable/nonDerivativeTransaction/transactionAmounts/transactionShares/value")
-		if err != nil {
-			log.Println("Error getting amount")
-			log.Println(err)
-			continue
-		} else if amount == nil {
-			// log.Println("amount was nil for", filePath)
-			continue
-		}
+	active := []Extractor{}
+	if len(rules) > 0 {
+		active = append(active, xpathExtractor(rules))
+	}
+	active = append(active, registered...)
 
-		price, err := xmlquery.Query(doc, "//ownershipDocument/nonDerivativeTable/nonDerivativeTransaction/transactionAmounts/transactionPricePerShare/value")
-		if err != nil {
-			log.Println("Error getting price")
-			log.Println(err)
-			continue
-		} else if price == nil {
-			// log.Println("price was nil for", filePath)
-			continue
+	seen := map[string]bool{}
+	for _, column := range csvHeader {
+		seen[column] = true
+	}
+	for _, e := range active {
+		for _, column := range e.Columns() {
+			if seen[column] {
+				return nil, fmt.Errorf("extractor column %s is already defined", column)
+			}
+			seen[column] = true
+			csvHeader = append(csvHeader, column)
 		}
+	}
+	return active, nil
+}
 
-		transactionDate, err := xmlquery.Query(doc, "//ownershipDocument/nonDerivativeTable/nonDerivativeTransaction/transactionDate/value")
-		if err != nil {
-			log.Println("Error getting transaction date")
-			log.Println(err)
-			continue
-		} else if transactionDate == nil {
-			// log.Println("transaction date was nil for", filePath)
-			continue
-		}
+// openOutput is the file sink, writing to -output and partitioned if -partition is set
+func openOutput(ctx context.Context, opts SinkOptions) (RowWriter, error) {
+	keys, err := ParsePartitionKeys(*partition)
+	if err != nil {
+		return nil, err
+	}
+	hive, err := parsePartitionStyle(*partitionStyle)
+	if err != nil {
+		return nil, err
+	}
+	limits := RollLimits{MaxRows: *maxRows, MaxBytes: *maxBytes}
 
-		titleOfSecurity, err := xmlquery.Query(doc, "//ownershipDocument/nonDerivativeTable/nonDerivativeTransaction/securityTitle/value")
-		if err != nil {
-			log.Println("Error getting security title")
-			log.Println(err)
-			continue
-		} else if titleOfSecurity == nil {
-			// log.Println("security title was nil for", filePath)
-			continue
-		}
+	columnNames := cfg.Columns
+	if flagIsSet(flag.CommandLine, "columns") {
+		columnNames = strings.Split(*columns, ",")
+	}
+	selected, err := ResolveColumns(columnNames)
+	if err != nil {
+		return nil, err
+	}
 
-		issuerName, err := xmlquery.Query(doc, "//ownershipDocument/issuer/issuerName")
-		if err != nil {
-			log.Println("Error getting issuer name")
-			log.Println(err)
-			continue
-		} else if issuerName == nil {
-			// log.Println("Issuer Name was nil for", filePath)
-			continue
+	if opts.Target == stdoutPath {
+		if len(keys) > 0 || limits.enabled() {
+			return nil, fmt.Errorf("-output - can't be partitioned or split into parts")
 		}
-
-		issuerTicker, err := xmlquery.Query(doc, "//ownershipDocument/issuer/issuerTradingSymbol")
+		f, err := DetectOutputFormat(stdoutPath, *format, *compress)
 		if err != nil {
-			log.Println("Error getting issuer ticker")
-			log.Println(err)
-			continue
-		} else if issuerTicker == nil {
-			// log.Println("issuer ticker was nil for", filePath)
-			continue
+			return nil, err
 		}
-
-		isDirectorText := "0"
-		isDirector, err := xmlquery.Query(doc, "//ownershipDocument/reportingOwner/reportingOwnerRelationship/isDirector")
+		f.Columns = selected
+		return newOutputFile(stdoutPath, f, limits), nil
+	}
+	if len(keys) > 0 {
+		root := opts.Target
+		if root == "" {
+			root = "out"
+		}
+		f, err := DetectOutputFormat("", *format, *compress)
 		if err != nil {
-			log.Println("Error getting isDirector")
-			log.Println(err)
-			continue
-		} else if isDirector == nil {
-			// log.Println("isDirector was nil for", filePath)
-		} else {
-			isDirectorText = isDirector.InnerText()
+			return nil, err
+		}
+		f.Columns = selected
+		// Engines reading a Hive layout skip files starting with _, rather than reading the schema as rows
+		prefix := ""
+		if hive {
+			prefix = "_"
 		}
+		if err = WriteSchema(filepath.Join(root, prefix+"schema.json"), "form4 transactions", f); err != nil {
+			return nil, err
+		}
+		p := NewPartitionedWriter(root, keys, hive, f, limits)
+		p.manifest = filepath.Join(root, prefix+"manifest.json")
+		return p, nil
+	}
 
-		isOfficerText := "0"
-		isOfficer, err := xmlquery.Query(doc, "//ownershipDocument/reportingOwner/reportingOwnerRelationship/isOfficer")
-		if err != nil {
-			log.Println("Error getting isOfficer")
-			log.Println(err)
-			continue
-		} else if isOfficer == nil {
-			// log.Println("isOfficer was nil for", filePath)
-		} else {
-			isOfficerText = isOfficer.InnerText()
+	path := opts.Target
+	f, err := DetectOutputFormat(path, *format, *compress)
+	if err != nil {
+		return nil, err
+	}
+	f.Columns = selected
+	if path == "" {
+		path = fmt.Sprintf("form4_%d_q%d", opts.Year, opts.Quarter) + f.Ext()
+	}
+	if err = WriteSchema(schemaPath(path, f), "form4 transactions", f); err != nil {
+		return nil, err
+	}
+	o := newOutputFile(path, f, limits)
+	o.manifest = manifestPath(path, f)
+	return o, nil
+}
+
+func runDownload(ctx context.Context) {
+	activeExtractors, err := setupExtractors()
+	if err != nil {
+		fatal(exitConfig, err)
+	}
+	if err = setupCorporateActions(ctx); err != nil {
+		fatal(exitConfig, err)
+	}
+	if err = setupFormTypes(); err != nil {
+		fatal(exitConfig, err)
+	}
+	if err = setupFilters(); err != nil {
+		fatal(exitConfig, err)
+	}
+	if err = setupIssuerLists(); err != nil {
+		fatal(exitConfig, err)
+	}
+	if err = setupResume(); err != nil {
+		fatal(exitConfig, err)
+	}
+
+	sinkName := cfg.Sink
+	if sinkName == "" || flagIsSet(flag.CommandLine, "sink") {
+		sinkName = *sink
+	}
+	periods, err := parsePeriods(*periodSpec)
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+	if err = checkQuarterTargets(sinkName, periods); err != nil {
+		fatal(exitUsage, err)
+	}
+	extraColumns := []string{}
+	for _, e := range activeExtractors {
+		extraColumns = append(extraColumns, e.Columns()...)
+	}
+
+	// The history kept in the data directory is loaded once and shared by the quarters, which observe
+	// their filings into it one at a time
+	history := &downloadHistory{titles: officerTitleCounts{}}
+	if history.tickers, err = LoadTickerHistory(tickerHistoryPath()); err != nil {
+		log.Fatal(err)
+	}
+	if *percentileMonths > 0 {
+		if history.values, err = LoadValueHistory(valueHistoryPath(), *percentileMonths); err != nil {
+			log.Fatal(err)
 		}
+	}
+	if history.rolling, err = LoadRollingNetBuying(netBuyingPath()); err != nil {
+		log.Fatal(err)
+	}
 
-		isTenPercentOwnerText := "0"
-		isTenPercentOwner, err := xmlquery.Query(doc, "//ownershipDocument/reportingOwner/reportingOwnerRelationship/isTenPercentOwner")
-		if err != nil {
-			log.Println("Error getting isTenPercentOwner")
-			log.Println(err)
-			continue
-		} else if isTenPercentOwner == nil {
-			// log.Println("isTenPercentOwner was nil for", filePath)
-		} else {
-			isTenPercentOwnerText = isTenPercentOwner.InnerText()
+	if err = setupJob(); err != nil {
+		fatal(exitConfig, err)
+	}
+	if err = setupSharedDedupe(); err != nil {
+		fatal(exitConfig, err)
+	}
+
+	runs := make([]*quarterRun, len(periods))
+	claimed := make([]bool, len(periods))
+	forEachPeriod(ctx, periods, *maxInflightQuarters, func(i int, p period) {
+		if backfillJob != nil {
+			var err error
+			if claimed[i], err = backfillJob.claimQuarter(p); err != nil {
+				log.Printf("Failed to claim %s", p)
+				log.Fatal(err)
+			} else if !claimed[i] {
+				infof("%s is done or claimed by another worker of job %s, skipping it", p, *jobName)
+				return
+			}
 		}
+		opts := SinkOptions{Target: periodTarget(*outputPath, p), Header: csvHeader, Extra: extraColumns, Year: p.Year, Quarter: p.Quarter}
+		runs[i] = runQuarter(ctx, p, len(periods) > 1, sinkName, opts, activeExtractors, history)
+	})
 
-		isOtherText := "0"
-		isOther, err := xmlquery.Query(doc, "//ownershipDocument/reportingOwner/reportingOwnerRelationship/isOther")
-		if err != nil {
-			log.Println("Error getting isOther")
-			log.Println(err)
-			continue
-		} else if isOther == nil {
-			// log.Println("isOther was nil for", filePath)
-		} else {
-			isOtherText = isOther.InnerText()
+	if *officerTitlesPath != "" {
+		if err = history.titles.write(*officerTitlesPath); err != nil {
+			log.Println("Failed to write officer titles")
+			log.Fatal(err)
 		}
+	}
+	if err = history.tickers.Save(tickerHistoryPath()); err != nil {
+		log.Println("Failed to save ticker history")
+		log.Fatal(err)
+	}
+	if err = history.rolling.Save(netBuyingPath(), rollingPath()); err != nil {
+		log.Println("Failed to save rolling net buying")
+		log.Fatal(err)
+	}
+	if history.values != nil {
+		if err = history.values.Save(valueHistoryPath()); err != nil {
+			log.Println("Failed to save transaction values")
+			log.Fatal(err)
+		}
+	}
 
-		newAmountOwned, err := xmlquery.Query(doc, "//ownershipDocument/nonDerivativeTable/nonDerivativeTransaction/postTransactionAmounts/sharesOwnedFollowingTransaction/value")
-		if err != nil {
-			log.Println("Error getting price")
-			log.Println(err)
-			continue
-		} else if newAmountOwned == nil {
-			// log.Println("price was nil for", filePath)
+	// The manifests and summaries are written last, once everything they describe is written
+	for _, run := range runs {
+		if run == nil {
 			continue
 		}
+		if m, ok := run.out.(ManifestWriter); ok && *writeManifest {
+			if path, _ := m.Manifest(); path != "" {
+				if path, err = saveManifest(m, run.summary); err != nil {
+					log.Printf("Failed to write the manifest %s", path)
+					fatal(exitSink, err)
+				}
+				infof("Wrote the manifest %s", path)
+			}
+		}
+		if err = run.summary.Save(runSummaryPath(run.period, len(periods) > 1)); err != nil {
+			log.Println("Failed to write run summary")
+			log.Fatal(err)
+		}
+		// The filings of a quarter that stopped early are only shared if -resume carries on after them,
+		// otherwise the export is run again in full and needs them
+		if (!run.interrupted && !run.aborted) || canResume(run.out) {
+			sharedDedupe.add(run.written)
+		}
+	}
+	if backfillJob != nil {
+		// The quarters are marked done once their manifests are written, for the workers to merge
+		for i, p := range periods {
+			if claimed[i] {
+				run := runs[i]
+				backfillJob.finish(p, run == nil || (!run.interrupted && !run.aborted))
+			}
+		}
+		backfillJob.close()
+	}
 
-		directOrIndirectOwnership, err := xmlquery.Query(doc, "//ownershipDocument/nonDerivativeTable/nonDerivativeTransaction/ownershipNature/directOrIndirectOwnership/value")
-		if err != nil {
-			log.Println("Error getting directOrIndirectOwnership")
-			log.Println(err)
-			continue
-		} else if directOrIndirectOwnership == nil {
-			// log.Println("ownershipForm was nil for", filePath)
-			continue
+	// The exit code is that of the worst quarter
+	failed := 0
+	for _, run := range runs {
+		if run != nil && run.aborted && isThrottled(run.failures.Last()) {
+			fatalf(exitThrottled, "%s: %s, output is incomplete", run.period, run.err)
+		}
+	}
+	for _, run := range runs {
+		if run != nil && run.aborted {
+			fatalf(exitAborted, "%s: %s, output is incomplete", run.period, run.err)
+		}
+	}
+	for _, run := range runs {
+		if run != nil && run.interrupted {
+			fatal(exitInterrupted, "Interrupted, output is incomplete")
 		}
+		if run != nil {
+			n, _ := run.failures.Failed()
+			failed += n
+		}
+	}
+	if ctx.Err() != nil {
+		// Quarters yet to start when interrupted were skipped
+		fatal(exitInterrupted, "Interrupted, output is incomplete")
+	}
+	if failed > 0 {
+		fatalf(exitPartial, "Done, but %d filings failed, see the log", failed)
+	}
+	infof("Done")
+}
 
-		csvData = append(csvData, []string{issuerCIK.InnerText(), reportingPersonCIK.InnerText(), filing.AccessionNumber, reportingPersonName.InnerText(), aOrD.InnerText(), amount.InnerText(), price.InnerText(), transactionDate.InnerText(), titleOfSecurity.InnerText(), issuerName.InnerText(), issuerTicker.InnerText(), isDirectorText, isOfficerText, isTenPercentOwnerText, isOtherText, newAmountOwned.InnerText(), directOrIndirectOwnership.InnerText()})
+// downloadHistory is what download runs keep in the data directory, and the officer titles they
+// count, shared by the quarters of a run
+type downloadHistory struct {
+	mu      sync.Mutex
+	tickers *TickerHistory
+	values  *ValueHistory
+	rolling *RollingNetBuying
+	titles  officerTitleCounts
+}
 
-		log.Printf("Processed %d/%d", i, len(filings))
-	}
+// quarterRun is how the download of a quarter went
+type quarterRun struct {
+	period  period
+	out     RowWriter
+	summary *RunSummary
+	// failures counts the quarter's failed filings, and err is why it stopped early if it did
+	failures             *FailureBudget
+	err                  error
+	interrupted, aborted bool
+	// written are the filings written, shared with -redis-dedupe once the manifest is
+	written []string
+}
 
-	f, err := os.Create(fmt.Sprintf("form4_%d_q%d.csv", year, quarter))
+// runQuarter downloads a quarter's filings to its own sink, returning nil if -resume found its export
+// already complete. several is whether other quarters are downloaded by the same run.
+func runQuarter(ctx context.Context, p period, several bool, sinkName string, opts SinkOptions, activeExtractors []Extractor, history *downloadHistory) *quarterRun {
+	out, err := OpenSink(ctx, sinkName, opts)
 	if err != nil {
-		log.Println("Failed to create form4.csv")
-		log.Fatal(err)
+		log.Printf("Failed to create output for %s", p)
+		fatal(exitSink, err)
+	}
+	var resumed *exportResume
+	if *resume {
+		if resumed, err = resumeExport(out, sinkName, p); err != nil {
+			log.Printf("Failed to resume the export of %s", p)
+			fatal(exitSink, err)
+		} else if resumed == nil {
+			out.Close()
+			infof("The export of %s is already complete, nothing to resume", p)
+			return nil
+		}
 	}
-	defer f.Close()
-	w := csv.NewWriter(f)
-	defer w.Flush()
 
-	for _, line := range csvData {
-		if err = w.Write(line); err != nil {
-			log.Printf("Failed to write line %+v", line)
+	sectors, insiders, issuerDays := sectorRollup{}, insiderRollup{}, issuerRollup{}
+	written := []string{}
+	var perFiling *filingRollup
+	if *filingRollupPath != "" {
+		if perFiling, err = openFilingRollup(periodTarget(*filingRollupPath, p), resumed != nil); err != nil {
+			log.Println("Failed to create filing rollup")
 			log.Fatal(err)
 		}
 	}
+	failures := &FailureBudget{MaxRate: *maxFailureRate, MaxConsecutive: *maxConsecutiveFailures}
+	summary := newRunSummary(p)
+	if resumed != nil && !resumed.found {
+		summary.resumeAfter = &edgar.IndexEntry{AccessionNumber: resumed.after.AccessionNumber, DateFiled: resumed.after.DateFiled}
+	}
+	pipeline := PipelineOptions{
+		DownloadWorkers: *downloaders,
+		ParseWorkers:    *parsers,
+		MaxInFlight:     *maxInFlight,
+		Failures:        failures,
+		Summary:         summary,
+		Observe: func(parsed *ParsedFiling) {
+			history.mu.Lock()
+			defer history.mu.Unlock()
+			if history.values != nil {
+				// The ranks depend on the filings before this one, so its rows are laid out again with them
+				history.values.Rank(parsed)
+				parsed.Rows = flattenRows(parsed)
+			}
+			history.tickers.Observe(parsed)
+			history.rolling.Observe(parsed)
+			history.titles.add(parsed)
+			sectors.add(parsed)
+			insiders.add(parsed)
+			issuerDays.add(parsed)
+			if perFiling != nil {
+				perFiling.add(parsed)
+			}
+			if sharedDedupe != nil {
+				written = append(written, parsed.Filing.AccessionNumber)
+			}
+		},
+	}
 
-	log.Println("Done")
-}
-
-func DownloadSECFile(url string) ([]byte, error) {
-
-	s := time.Now()
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	defer cancel()
-	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
-	if err != nil {
-		log.Printf("Error creating request")
-		return nil, err
+	processed := 0
+	var runErr error
+	if *accessionsPath != "" {
+		// Exactly the filings listed, in the order listed
+		filings, err := readAccessionList(*accessionsPath)
+		if err != nil {
+			log.Println("Failed to read -accessions")
+			fatal(exitConfig, err)
+		}
+		infof("Read %d filings from %s", len(filings), *accessionsPath)
+		summary.FilingsScanned, summary.FilingsSelected = len(filings), len(filings)
+		listed := len(filings)
+		if filings, err = resumed.filter(filings, false); err != nil {
+			fatal(exitSink, err)
+		}
+		summary.Skipped[skipResumed] += listed - len(filings)
+		listed = len(filings)
+		if filings, err = backfillJob.filter(ctx, filings, p); err != nil {
+			log.Fatal(err)
+		}
+		if filings, err = sharedDedupe.filter(ctx, filings); err != nil {
+			log.Fatal(err)
+		}
+		summary.Skipped[skipDuplicate] += listed - len(filings)
+		if err = processFilings(ctx, filings, out, activeExtractors, pipeline); err == nil {
+			processed = len(filings)
+		}
+		runErr = err
+	} else {
+		runErr = forEachQuarterFiling(ctx, summary, func(filings []*edgar.IndexEntry) error {
+			listed := len(filings)
+			filings, err := resumed.filter(filings, true)
+			if err != nil {
+				fatal(exitSink, err)
+			}
+			summary.Skipped[skipResumed] += listed - len(filings)
+			// After resuming, the filings this export wrote before it was interrupted were shared too
+			listed = len(filings)
+			if filings, err = sharedDedupe.filter(ctx, filings); err != nil {
+				return err
+			}
+			summary.Skipped[skipDuplicate] += listed - len(filings)
+			if len(filings) == 0 {
+				return nil
+			}
+			if err := processFilings(ctx, filings, out, activeExtractors, pipeline); err != nil {
+				return err
+			}
+			processed += len(filings)
+			return nil
+		})
+	}
+	// Either way the filings written so far are kept, the output is closed cleanly before exiting
+	interrupted, aborted := errors.Is(runErr, context.Canceled), errors.Is(runErr, errFailureBudget)
+	if runErr != nil && !interrupted && !aborted {
+		if isThrottled(runErr) {
+			fatal(exitThrottled, runErr)
+		}
+		log.Fatal(runErr)
+	}
+	failed, attempted := failures.Failed()
+	if several {
+		infof("Processed %d filings of %s, %d of %d failed", processed, p, failed, attempted)
+	} else {
+		infof("Processed %d filings, %d of %d failed", processed, failed, attempted)
 	}
 
-	req.Header.Add("accept-language", "en-US,en;q=0.9")
-	req.Header.Add("accept-encoding", "gzip,deflate")
-	req.Header.Add("User-Agent", fmt.Sprintf("Sample Company Name %s@sampledomain.com", gonanoid.Must()))
+	if err = out.Close(); err != nil {
+		log.Println("Failed to close output")
+		fatal(exitSink, err)
+	}
+	if perFiling != nil {
+		if err = perFiling.close(); err != nil {
+			log.Println("Failed to write filing rollup")
+			log.Fatal(err)
+		}
+	}
+	if *sectorRollupPath != "" {
+		if err = sectors.write(periodTarget(*sectorRollupPath, p), p.String()); err != nil {
+			log.Println("Failed to write sector rollup")
+			log.Fatal(err)
+		}
+	}
+	if *insiderRollupPath != "" {
+		if err = insiders.write(periodTarget(*insiderRollupPath, p)); err != nil {
+			log.Println("Failed to write insider rollup")
+			log.Fatal(err)
+		}
+	}
+	if *issuerRollupPath != "" {
+		if err = issuerDays.write(periodTarget(*issuerRollupPath, p)); err != nil {
+			log.Println("Failed to write issuer rollup")
+			log.Fatal(err)
+		}
+	}
+	summary.finish(runErr, client.Stats())
+	return &quarterRun{period: p, out: out, summary: summary, failures: failures, err: runErr, interrupted: interrupted, aborted: aborted, written: written}
+}
 
-	var resp *http.Response
-	err = backoff.RetryNotify(func() error {
-		secRL.Take()
-		resp, err = http.DefaultClient.Do(req)
+// forEachQuarterFiling calls fn with the filings of the selected form types of each of the quarter's daily master
+// files in turn, so memory stays bounded by the busiest day, counting what it leaves out in summary
+func forEachQuarterFiling(ctx context.Context, summary *RunSummary, fn func(filings []*edgar.IndexEntry) error) error {
+	seen := edgar.AccessionSet{}
+	return client.ForEachDailyIndex(ctx, summary.Year, summary.Quarter, func(masterFile string, filings []*edgar.IndexEntry) error {
+		infof("Fetched %d filings from %s", len(filings), masterFile)
+		scanned := len(filings)
+		summary.FilingsScanned += scanned
+		filings = lo.Filter(filings, func(v *edgar.IndexEntry, i int) bool {
+			return formTypes.Match(v)
+		})
+		infof("Filtered down to %d %s filings", len(filings), describeFormTypes(formTypes))
+		summary.Skipped[skipFormType] += scanned - len(filings)
+		selected := len(filings)
+		filings = selectedIssuers.filter(filings)
+		summary.Skipped[skipIssuer] += selected - len(filings)
+
+		// Days are visited in order and rows are written in filing order, so sorting each day keeps
+		// the output byte-identical between runs
+		SortFilings(filings)
+		// Only the first entry of each filing is kept, sorting makes that the lowest CIK of a joint filing
+		listed := len(filings)
+		filings = seen.Filter(filings)
+		if listed > len(filings) {
+			infof("Dropped %d repeated entries of joint or already listed filings", listed-len(filings))
+		}
+		summary.Skipped[skipDuplicate] += listed - len(filings)
+		// A backfill job only writes each filing once, in the quarter that claimed it first
+		listed = len(filings)
+		filings, err := backfillJob.filter(ctx, filings, period{summary.Year, summary.Quarter})
 		if err != nil {
-			log.Printf("Error making request")
 			return err
 		}
-		return nil
-	}, backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Millisecond*100), 5), func(err error, d time.Duration) {
-		log.Printf("Failed to make request after %s: %s", d, err.Error())
+		summary.Skipped[skipDuplicate] += listed - len(filings)
+		summary.FilingsSelected += len(filings)
+		return fn(filings)
 	})
+}
 
-	if resp.StatusCode == 404 {
-		log.Printf("File not found %s", url)
-		return nil, fmt.Errorf("ErrNotFound")
-	} else if resp.StatusCode == 429 {
-		log.Printf("Getting rate limited at url %s", url)
-		return nil, fmt.Errorf("ErrRateLimited")
-	} else if resp.StatusCode == 403 {
-		// Does not exist
-		return nil, fmt.Errorf("ErrDoesNotExist")
-	} else if resp.StatusCode > 299 {
-		log.Printf("Got status code %d for url %s", resp.StatusCode, url)
-		return nil, fmt.Errorf("ErrHighStatusCode")
-	}
+var readerPool = sync.Pool{New: func() interface{} { return new(bytes.Reader) }}
 
-	if err != nil {
-		log.Printf("Error getting %s", url)
+// downloadFiling fetches a filing's submission, logging and returning the error if it can't be
+// downloaded
+func downloadFiling(ctx context.Context, filing *edgar.IndexEntry) ([]byte, error) {
+	content, err := client.FetchFiling(ctx, filing)
+	if errors.Is(err, edgar.ErrOffline) {
+		infof("Skipping %s, it isn't cached", client.FilingURL(filing))
 		return nil, err
 	}
-
-	gReader, err := gzip.NewReader(resp.Body)
 	if err != nil {
-		log.Printf("error creating new reader")
+		log.Printf("Error downloading file %s", client.FilingURL(filing))
+		log.Println(err)
 		return nil, err
 	}
-
-	content, err := ioutil.ReadAll(gReader)
-	if err != nil {
-		log.Printf("Error reading file content")
-		return nil, err
-	}
-
-	log.Printf("Downloaded SEC file %s in %s", url, time.Since(s))
 	return content, nil
 }
 
-func parseDailyMasterFile(fileContent []byte) []*DailyFilingsRow {
-	s := string(fileContent)
-	rows := strings.Split(s, "\n")
-	// Get rid of first 7 lines
-	rows = rows[7:]
-
-	resp := []*DailyFilingsRow{}
-
-	for _, row := range rows {
-		if row == "" {
-			continue
+// parseFiling parses a downloaded submission, logging and returning the error if it can't. For one
+// that isn't an ownership document the error wraps form4.ErrNoXMLDocument or
+// form4.ErrNotOwnershipDocument, and for one of an issuer -issuer-allowlist or -issuer-denylist leaves
+// out it is errIssuerExcluded, it is skipped rather than failed.
+func parseFiling(ctx context.Context, filing *edgar.IndexEntry, content []byte, activeExtractors []Extractor) (*ParsedFiling, error) {
+	fileURL := client.FilingURL(filing)
+	hash := sourceSHA256(content)
+	var doc *xmlquery.Node
+	var od *form4.OwnershipDocument
+	cached := false
+	// Extractors need the DOM, so their filings are always parsed
+	if *parseCache && len(activeExtractors) == 0 {
+		od, cached = loadParsed(hash)
+	}
+	if !cached {
+		var err error
+		if doc, od, err = parseDocument(ctx, filing, content, len(activeExtractors) > 0); err != nil {
+			return nil, err
 		}
-		parts := strings.Split(row, "|")
-		if len(parts) != 5 {
-			log.Printf("Row did not have correct amount of parts: %+v", row)
-			continue
+		if *parseCache {
+			saveParsed(hash, od)
 		}
+	}
+	if !selectedIssuers.allows(od.Issuer.CIK) {
+		infof("Skipping %s, issuer %s isn't selected", fileURL, od.Issuer.CIK)
+		return nil, errIssuerExcluded
+	}
+	filing.AcceptanceDateTime = acceptanceDateTime(ctx, filing, content)
 
-		accessionNumber := strings.Split(parts[4], ".txt")[0]
-		split := strings.Split(accessionNumber, "/")
-		accessionNumber = split[len(split)-1]
-		accessionNumber = strings.ReplaceAll(accessionNumber, "-", "")
-
-		d := &DailyFilingsRow{
-			CIK:             parts[0],
-			CompanyName:     parts[1],
-			FormType:        parts[2],
-			DateFiled:       parts[3],
-			FileName:        parts[4],
-			AccessionNumber: accessionNumber,
+	// Extractors run once per filing, their values are shared by every row of it
+	extra := []string{}
+	for _, e := range activeExtractors {
+		values, err := e.Extract(ctx, filing, doc)
+		if err != nil {
+			log.Printf("Error running extractor on %s: %s", fileURL, err)
+			return nil, fmt.Errorf("%w: %s", errExtractorFailed, err)
 		}
-		resp = append(resp, d)
+		extra = append(extra, values...)
 	}
 
-	return resp
-}
-
-func GetFilingsForYearQuarter(year, quarter int) ([]*DailyFilingsRow, error) {
-	qtr, err := DownloadSECFile(fmt.Sprintf(indexURL, year, quarter))
-	if err != nil {
-		log.Println("failed to get master file")
-		return nil, err
+	header := edgar.ParseHeader(content)
+	// A filing listed by -accessions rather than an index only has its file name until now
+	if filing.FormType == "" {
+		filing.FormType, filing.DateFiled = header.SubmissionType, header.FiledAsOfDate
+		filing.CIK, filing.CompanyName = od.Issuer.CIK, od.Issuer.Name
 	}
 
-	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(qtr))
-	if err != nil {
-		log.Println("Error reading the master link HTML")
-		return nil, err
+	parsed := &ParsedFiling{Filing: filing, Document: od, SourceURL: fileURL, SourceSHA256: hash, DownloadedAt: downloadedAt(fileURL), Extra: extra, Issuer: issuerCompany(ctx, header, od), Splits: issuerSplits(ctx, od.Issuer.CIK)}
+	parsed.Rows = flattenRows(parsed)
+	return parsed, nil
+}
+
+// parseDocument parses and normalizes the ownership document of a submission, building its DOM too
+// when withDOM is set
+func parseDocument(ctx context.Context, filing *edgar.IndexEntry, content []byte, withDOM bool) (doc *xmlquery.Node, od *form4.OwnershipDocument, err error) {
+	fileURL := client.FilingURL(filing)
+	xmlContent, err := extractOwnershipXML(ctx, filing, content)
+	if errors.Is(err, form4.ErrNoXMLDocument) {
+		infof("Skipping %s, %s", fileURL, err)
+		return nil, nil, err
+	} else if err != nil {
+		log.Printf("Failed to look up the ownership document of %s in its index", fileURL)
+		log.Println(err)
+		return nil, nil, err
 	}
 
-	masterFiles := []string{}
-	doc.Find("a").Each(func(i int, s *goquery.Selection) {
-		if href, ok := s.Attr("href"); ok && strings.HasPrefix(strings.TrimSpace(s.Text()), "master.") {
-			masterFiles = append(masterFiles, fmt.Sprintf(indexURL, year, quarter)+href)
+	// The DOM is only built for extractors, otherwise the document is decoded as a stream
+	r := readerPool.Get().(*bytes.Reader)
+	r.Reset(xmlContent)
+	if withDOM {
+		doc, err = xmlquery.Parse(r)
+		if err == nil {
+			od, err = form4.FromNode(doc)
 		}
-	})
-
-	log.Printf("Got %d master files", len(masterFiles))
-
-	filings := []*DailyFilingsRow{}
+	} else {
+		od, err = form4.Parse(r)
+	}
+	r.Reset(nil)
+	readerPool.Put(r)
+	if errors.Is(err, form4.ErrNotOwnershipDocument) {
+		infof("Skipping %s, %s", fileURL, err)
+		return nil, nil, err
+	} else if err != nil {
+		log.Println("Failed to parse file", fileURL)
+		log.Println(err)
+		return nil, nil, err
+	}
+	// Share counts, prices, dates and flags are written in canonical form, values that can't be read
+	// are dropped
+	for _, err := range od.NormalizeNumbers() {
+		log.Printf("Invalid number in %s, %s", fileURL, err)
+	}
+	for _, err := range od.NormalizeDates() {
+		log.Printf("Invalid date in %s, %s", fileURL, err)
+	}
+	if !*rawFlags {
+		od.NormalizeFlags()
+	}
+	return doc, od, nil
+}
 
-	for _, masterFile := range masterFiles {
-		// Check if the file already exists on disk
-		var mf []byte
-		var err error
-		filePath := "masterfiles/" + strings.Split(masterFile, fmt.Sprintf("QTR%d/", quarter))[1]
-		if _, err = os.Stat(filePath); errors.Is(err, os.ErrNotExist) {
-			// path/to/whatever does not exist
-			mf, err = DownloadSECFile(masterFile)
-			if err != nil {
-				log.Printf("Error downloading master file %s", masterFile)
-				return nil, err
-			}
+// sourceSHA256 is the hex SHA-256 of a downloaded submission, to tell which version of a filing rows
+// came from and whether it changed since
+func sourceSHA256(content []byte) string {
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
 
-			// Write file to disk
-			err = ioutil.WriteFile(filePath, mf, 0777)
-			if err != nil {
-				log.Println("Failed to write file to disk", filePath)
-				return nil, err
-			}
-		} else {
-			// Read from disk
-			mf, err = ioutil.ReadFile(filePath)
-			if err != nil {
-				log.Println("Error reading file on disk", filePath)
-				return nil, err
-			}
+// flattenRows lays out the selected transactions of a parsed filing that have every required field as
+// rows, one for each reporting owner of a joint filing
+func flattenRows(parsed *ParsedFiling) []*Row {
+	rows := []*Row{}
+	for _, t := range selectedOwnerTransactions(parsed.Document) {
+		if !hasRequiredFields(t) {
+			continue
 		}
-		dfs := parseDailyMasterFile(mf)
-		filings = append(filings, dfs...)
+		rows = append(rows, &Row{Filing: parsed.Filing, Values: append(transactionValues(parsed, t), parsed.Extra...)})
 	}
+	return rows
+}
 
-	return filings, nil
+// SortFilings orders filings by date filed then accession number, breaking ties between the filers of
+// a joint filing by CIK, so output order never depends on the order the index listed them in
+func SortFilings(filings []*edgar.IndexEntry) {
+	sort.SliceStable(filings, func(i, j int) bool {
+		a, b := filings[i], filings[j]
+		if a.DateFiled != b.DateFiled {
+			return a.DateFiled < b.DateFiled
+		}
+		if a.AccessionNumber != b.AccessionNumber {
+			return a.AccessionNumber < b.AccessionNumber
+		}
+		return a.CIK < b.CIK
+	})
 }
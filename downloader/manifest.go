@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var writeManifest = flag.Bool("manifest", true, "write a manifest of the files each export wrote, with their rows, bytes, filing dates and checksums, for loaders to verify")
+
+// ManifestWriter is implemented by sinks that write files, which are listed in a manifest once the
+// sink is closed
+type ManifestWriter interface {
+	RowWriter
+	// Manifest returns where the manifest goes and the files written, with their rows and filing
+	// dates. It is called once the sink is closed, the sizes and checksums are filled in from disk.
+	Manifest() (path string, files []ManifestFile)
+}
+
+// ExportManifest lists what an export wrote, so a loader can check every file is there and intact
+// before ingesting any of them
+type ExportManifest struct {
+	Created time.Time `json:"created"`
+	Year    int       `json:"year"`
+	Quarter int       `json:"quarter"`
+	// Status is the run summary's, anything but done means the files are incomplete
+	Status        string         `json:"status"`
+	SchemaVersion int            `json:"schema_version"`
+	ParserVersion string         `json:"parser_version"`
+	Rows          int64          `json:"rows"`
+	Bytes         int64          `json:"bytes"`
+	Files         []ManifestFile `json:"files"`
+	// LastFiling is the last filing the run finished with, in the order filings are processed, which
+	// -resume carries on after. Empty if it finished with none.
+	LastFiling *ManifestFiling `json:"last_filing,omitempty"`
+}
+
+// ManifestFiling identifies a filing of the index
+type ManifestFiling struct {
+	AccessionNumber string `json:"accession_number"`
+	// DateFiled is YYYY-MM-DD
+	DateFiled string `json:"date_filed"`
+}
+
+// ManifestFile is a file of an export
+type ManifestFile struct {
+	// Path is relative to the manifest, with forward slashes
+	Path   string `json:"path"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+	// MinDateFiled and MaxDateFiled are the range of filing dates of its rows, YYYY-MM-DD
+	MinDateFiled string `json:"min_date_filed,omitempty"`
+	MaxDateFiled string `json:"max_date_filed,omitempty"`
+}
+
+// add counts a row of the file
+func (f *ManifestFile) add(row *Row) {
+	f.Rows++
+	if row.Filing == nil || row.Filing.DateFiled == "" {
+		return
+	}
+	date := isoDate(row.Filing.DateFiled)
+	if f.MinDateFiled == "" || date < f.MinDateFiled {
+		f.MinDateFiled = date
+	}
+	if date > f.MaxDateFiled {
+		f.MaxDateFiled = date
+	}
+}
+
+// manifestPath is the manifest of the export at path, e.g. form4_2022_q2.manifest.json for
+// form4_2022_q2.csv
+func manifestPath(path string, format OutputFormat) string {
+	return strings.TrimSuffix(schemaPath(path, format), ".schema.json") + ".manifest.json"
+}
+
+// saveManifest writes the manifest of a closed sink that wrote files, with each file's size and
+// checksum. It is replaced at once and written last, so a loader finding it finds every file it lists.
+func saveManifest(w ManifestWriter, summary *RunSummary) (string, error) {
+	path, files := w.Manifest()
+	m := ExportManifest{
+		Created:       time.Now().UTC(),
+		Year:          summary.Year,
+		Quarter:       summary.Quarter,
+		Status:        summary.Status,
+		SchemaVersion: outputSchemaVersion,
+		ParserVersion: parserVersion,
+		Files:         []ManifestFile{},
+	}
+	if f := summary.resumeAfter; f != nil {
+		m.LastFiling = &ManifestFiling{AccessionNumber: f.AccessionNumber, DateFiled: isoDate(f.DateFiled)}
+	}
+	for _, f := range files {
+		size, sum, err := fileChecksum(f.Path)
+		if err != nil {
+			return path, err
+		}
+		f.Bytes, f.SHA256 = size, sum
+		if rel, err := filepath.Rel(filepath.Dir(path), f.Path); err == nil {
+			f.Path = rel
+		}
+		f.Path = filepath.ToSlash(f.Path)
+		m.Rows += f.Rows
+		m.Bytes += f.Bytes
+		m.Files = append(m.Files, f)
+	}
+
+	content, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return path, err
+	}
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return path, err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(content, '\n'), 0644); err != nil {
+		return path, err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return path, err
+	}
+	return path, nil
+}
+
+// fileChecksum is the size and hex SHA-256 of the file at path
+func fileChecksum(path string) (int64, string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	size, err := io.Copy(h, f)
+	if err != nil {
+		return 0, "", err
+	}
+	return size, hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// MergedManifest is the manifests of the quarters of a backfill merged into one, so a loader can check
+// the work of every worker of a -job at once
+type MergedManifest struct {
+	Created time.Time `json:"created"`
+	// Status is done if every quarter's is, else the first other status
+	Status        string   `json:"status"`
+	SchemaVersion int      `json:"schema_version"`
+	ParserVersion string   `json:"parser_version"`
+	Quarters      []string `json:"quarters"`
+	Rows          int64    `json:"rows"`
+	Bytes         int64    `json:"bytes"`
+	// Files are the files of every quarter, with their paths relative to the merged manifest
+	Files []ManifestFile `json:"files"`
+}
+
+func runManifestCommand(args []string) {
+	if len(args) == 0 || args[0] != "merge" {
+		log.Println("Missing or unknown manifest subcommand, only merge is supported")
+		usage()
+		os.Exit(exitUsage)
+	}
+	fs := flag.NewFlagSet("manifest merge", flag.ExitOnError)
+	output := fs.String("o", "backfill.manifest.json", "file to write the merged manifest to")
+	fs.Parse(args[1:])
+	if fs.NArg() == 0 {
+		log.Fatal("Usage: manifest merge [-o file] <manifest>...")
+	}
+
+	merged, err := mergeManifests(fs.Args(), *output)
+	if err != nil {
+		log.Println("Failed to merge the manifests")
+		log.Fatal(err)
+	}
+	content, err := json.MarshalIndent(merged, "", "  ")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err = ioutil.WriteFile(*output, append(content, '\n'), 0644); err != nil {
+		log.Printf("Failed to write %s", *output)
+		log.Fatal(err)
+	}
+	infof("Merged the manifests of %d quarters, %d rows in %d files, into %s", len(merged.Quarters), merged.Rows, len(merged.Files), *output)
+	if merged.Status != runStatusDone {
+		fatalf(exitPartial, "Not every quarter is done, the backfill is %s", merged.Status)
+	}
+}
+
+// mergeManifests merges the manifests at paths into one to be written to output. The quarters must
+// have been written by the same schema and parser versions, each once, and their files must still be
+// the size their manifests say.
+func mergeManifests(paths []string, output string) (*MergedManifest, error) {
+	merged := &MergedManifest{Created: time.Now().UTC(), Status: runStatusDone, Quarters: []string{}, Files: []ManifestFile{}}
+	quarters := map[string]string{}
+	for _, path := range paths {
+		content, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		var m ExportManifest
+		if err = json.Unmarshal(content, &m); err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+		quarter := period{m.Year, m.Quarter}.String()
+		if other, ok := quarters[quarter]; ok {
+			return nil, fmt.Errorf("%s is in both %s and %s", quarter, other, path)
+		}
+		quarters[quarter] = path
+		if len(merged.Quarters) == 0 {
+			merged.SchemaVersion, merged.ParserVersion = m.SchemaVersion, m.ParserVersion
+		} else if m.SchemaVersion != merged.SchemaVersion || m.ParserVersion != merged.ParserVersion {
+			return nil, fmt.Errorf("%s was written with schema %d and parser %s, the others with schema %d and parser %s", path, m.SchemaVersion, m.ParserVersion, merged.SchemaVersion, merged.ParserVersion)
+		}
+		if m.Status != runStatusDone && merged.Status == runStatusDone {
+			log.Printf("%s of %s is %s", quarter, path, m.Status)
+			merged.Status = m.Status
+		}
+		merged.Quarters = append(merged.Quarters, quarter)
+
+		for _, f := range m.Files {
+			filePath := filepath.Join(filepath.Dir(path), filepath.FromSlash(f.Path))
+			info, err := os.Stat(filePath)
+			if err != nil {
+				return nil, err
+			}
+			if info.Size() != f.Bytes {
+				return nil, fmt.Errorf("%s is %d bytes, %s says %d", filePath, info.Size(), path, f.Bytes)
+			}
+			if rel, err := filepath.Rel(filepath.Dir(output), filePath); err == nil {
+				filePath = rel
+			}
+			f.Path = filepath.ToSlash(filePath)
+			merged.Rows += f.Rows
+			merged.Bytes += f.Bytes
+			merged.Files = append(merged.Files, f)
+		}
+	}
+	sort.Strings(merged.Quarters)
+	return merged, nil
+}
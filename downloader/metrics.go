@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// acceptedValue is the dollar value of a transaction and when its filing was accepted by EDGAR
+type acceptedValue struct {
+	at    time.Time
+	value float64
+}
+
+// tickerActivity is the open market buying and selling in the outputs of an issuer
+type tickerActivity struct {
+	purchases, sales int
+	net              float64
+}
+
+// datasetMetrics are what /metrics reports about the transactions loaded, worked out once per load.
+// Those relative to the time of the scrape are kept by time and picked out when scraped.
+type datasetMetrics struct {
+	filings int
+	// downloaded are the filings by the UTC day they were first downloaded, YYYY-MM-DD
+	downloaded map[string]int
+	// accepted are the transactions with a value, newest first
+	accepted []acceptedValue
+	tickers  map[string]*tickerActivity
+}
+
+// metricsLabelEscaper escapes label values in the Prometheus text format
+var metricsLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func newDatasetMetrics(rows []servedRow) *datasetMetrics {
+	m := &datasetMetrics{downloaded: map[string]int{}, tickers: map[string]*tickerActivity{}}
+	seen := map[string]bool{}
+	for i := range rows {
+		row := &rows[i]
+		if accession := row.values["ACCESSION_NUMBER"]; !seen[accession] {
+			seen[accession] = true
+			m.filings++
+			if at, err := time.Parse(time.RFC3339, row.values["DOWNLOADED_AT"]); err == nil {
+				m.downloaded[at.UTC().Format("2006-01-02")]++
+			}
+		}
+		if row.value < 0 {
+			continue
+		}
+		// Outputs from before ACCEPTANCE_DATETIME was added go by when they were downloaded
+		accepted := row.values["ACCEPTANCE_DATETIME"]
+		if accepted == "" {
+			accepted = row.values["DOWNLOADED_AT"]
+		}
+		if at, err := time.Parse(time.RFC3339, accepted); err == nil {
+			m.accepted = append(m.accepted, acceptedValue{at: at, value: row.value})
+		}
+
+		code := row.values["TRANSACTION_CODE"]
+		ticker := strings.ToUpper(strings.TrimSpace(row.values["ISSUER_TICKER"]))
+		if (code != "P" && code != "S") || ticker == "" {
+			continue
+		}
+		t := m.tickers[ticker]
+		if t == nil {
+			t = &tickerActivity{}
+			m.tickers[ticker] = t
+		}
+		if code == "P" {
+			t.purchases++
+			t.net += row.value
+		} else {
+			t.sales++
+			t.net -= row.value
+		}
+	}
+	sort.SliceStable(m.accepted, func(i, j int) bool { return m.accepted[i].at.After(m.accepted[j].at) })
+	return m
+}
+
+// largestSince is the largest value of the transactions accepted since t, 0 if there were none
+func (m *datasetMetrics) largestSince(t time.Time) float64 {
+	largest := 0.0
+	for _, a := range m.accepted {
+		if a.at.Before(t) {
+			break
+		}
+		if a.value > largest {
+			largest = a.value
+		}
+	}
+	return largest
+}
+
+// metrics serves GET /metrics, gauges of the transactions loaded in the Prometheus text format, so
+// alerts on new filings can be set up in Grafana on top of the reloads
+func (s *apiServer) metrics(w http.ResponseWriter, r *http.Request) {
+	store, _ := s.current()
+	m, now := store.metrics, time.Now()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	b := bufio.NewWriter(w)
+	gauge := func(name, help string, value interface{}) {
+		fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s gauge\n%s %v\n", name, help, name, name, value)
+	}
+	gauge("form4_transactions", "Transactions loaded from the outputs.", len(store.rows))
+	gauge("form4_filings", "Filings loaded from the outputs.", m.filings)
+	gauge("form4_output_age_seconds", "Seconds since the newest output was written.", int64(now.Sub(store.modified).Seconds()))
+	gauge("form4_filings_ingested_today", "Filings in the outputs first downloaded since midnight UTC.", m.downloaded[now.UTC().Format("2006-01-02")])
+	gauge("form4_largest_transaction_value_last_hour_dollars", "Largest dollar value of a transaction accepted by EDGAR in the last hour, 0 if there were none.", fmt.Sprintf("%.2f", m.largestSince(now.Add(-time.Hour))))
+
+	tickers := make([]string, 0, len(m.tickers))
+	for ticker := range m.tickers {
+		tickers = append(tickers, ticker)
+	}
+	sort.Strings(tickers)
+	fmt.Fprintf(b, "# HELP form4_ticker_net_buys Open market purchases (code P) less sales (code S) with a price in the outputs, by issuer ticker.\n# TYPE form4_ticker_net_buys gauge\n")
+	for _, ticker := range tickers {
+		t := m.tickers[ticker]
+		fmt.Fprintf(b, "form4_ticker_net_buys{ticker=\"%s\"} %d\n", metricsLabelEscaper.Replace(ticker), t.purchases-t.sales)
+	}
+	fmt.Fprintf(b, "# HELP form4_ticker_net_buy_value_dollars Dollars of the open market purchases less the sales in the outputs, by issuer ticker.\n# TYPE form4_ticker_net_buy_value_dollars gauge\n")
+	for _, ticker := range tickers {
+		fmt.Fprintf(b, "form4_ticker_net_buy_value_dollars{ticker=\"%s\"} %.2f\n", metricsLabelEscaper.Replace(ticker), m.tickers[ticker].net)
+	}
+	b.Flush()
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// migrationFiles bring the tables of the database sinks from one output schema version to the next.
+// 0013_row_type.sql brings a table to version 13, the number being the version and the rest of the
+// name a description. Each is a text/template of statements ending with semicolons, with .Table the
+// table, {{column "NAME"}} the definition of a new output column and {{name "NAME"}} an existing one
+// as the database has it, so the same file migrates every sink. A new output schema version needs one.
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// firstMigratedVersion is the output schema version the database sinks were added at, which their
+// tables are at least
+const firstMigratedVersion = 2
+
+// migrationsTable is the table next to a sink's table recording the schema version of each
+const migrationsTable = "sec4_schema_migrations"
+
+type migration struct {
+	Version int
+	Name    string
+	sql     *template.Template
+}
+
+var migrations = mustLoadMigrations()
+
+func mustLoadMigrations() []migration {
+	entries, err := migrationFiles.ReadDir("migrations")
+	if err != nil {
+		panic(err)
+	}
+	loaded := []migration{}
+	for _, entry := range entries {
+		file := path.Join("migrations", entry.Name())
+		name := strings.TrimSuffix(entry.Name(), ".sql")
+		number, _, _ := strings.Cut(name, "_")
+		version, err := strconv.Atoi(number)
+		if err != nil {
+			panic("migration without a version: " + file)
+		}
+		content, err := migrationFiles.ReadFile(file)
+		if err != nil {
+			panic(err)
+		}
+		t := template.Must(template.New(name).Funcs(template.FuncMap{
+			// Placeholders, the dialect's are set when rendering
+			"column": func(string) string { return "" },
+			"name":   func(string) string { return "" },
+			"list":   func(values ...string) []string { return values },
+		}).Parse(string(content)))
+		loaded = append(loaded, migration{Version: version, Name: name, sql: t})
+	}
+	for i, m := range loaded {
+		if m.Version != firstMigratedVersion+i+1 {
+			panic(fmt.Sprintf("expected migration %d, found %s", firstMigratedVersion+i+1, m.Name))
+		}
+	}
+	if len(loaded) != outputSchemaVersion-firstMigratedVersion {
+		panic(fmt.Sprintf("output schema version %d has no migration", outputSchemaVersion))
+	}
+	return loaded
+}
+
+// migrationDialect is how a database sink's database writes the statements of migrations
+type migrationDialect struct {
+	// Table is the sink's table, and Migrations migrationsTable, as statements name them
+	Table      string
+	Migrations string
+	// Name is an output column's name in the database, and Quote that quoted for statements
+	Name  func(column string) string
+	Quote func(column string) string
+	// Text is the type of output columns, and Int, Bool and Timestamp the other types migrationsTable has
+	Text      string
+	Int       string
+	Bool      string
+	Timestamp string
+	// ColumnsQuery lists the names of the table's columns, none if it doesn't exist
+	ColumnsQuery string
+}
+
+// key is the table as migrationsTable records it
+func (d migrationDialect) key() string {
+	return sqlString(strings.ReplaceAll(d.Table, "`", ""))
+}
+
+// statements renders a migration for the dialect
+func (d migrationDialect) statements(m migration) ([]string, error) {
+	var b bytes.Buffer
+	t, err := m.sql.Clone()
+	if err != nil {
+		return nil, err
+	}
+	t.Funcs(template.FuncMap{
+		"column": func(column string) string { return d.Quote(column) + " " + d.Text },
+		"name":   d.Quote,
+	})
+	err = t.Execute(&b, struct {
+		Table    string
+		RawFlags bool
+	}{d.Table, *rawFlags})
+	if err != nil {
+		return nil, fmt.Errorf("rendering migration %s: %w", m.Name, err)
+	}
+	return splitStatements(b.String()), nil
+}
+
+// splitStatements splits SQL on the semicolons ending statements, dropping -- comment lines. It
+// doesn't parse string literals, the migrations have no semicolons in theirs.
+func splitStatements(sql string) []string {
+	lines := []string{}
+	for _, line := range strings.Split(sql, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+	statements := []string{}
+	for _, statement := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if statement = strings.TrimSpace(statement); statement != "" {
+			statements = append(statements, statement)
+		}
+	}
+	return statements
+}
+
+// migrationDB runs the statements of migrations on a database sink's database
+type migrationDB interface {
+	Dialect() migrationDialect
+	Exec(ctx context.Context, statement string) error
+	// Query returns the values of the result's rows as strings, empty for NULL
+	Query(ctx context.Context, query string) ([][]string, error)
+	Close() error
+}
+
+// migrationDBFactory opens a sink's database for db migrate from the -output value
+type migrationDBFactory func(ctx context.Context, target string) (migrationDB, error)
+
+var migrationDBs = map[string]migrationDBFactory{}
+
+// tableSchema is what migrationsTable has on a table
+type tableSchema struct {
+	Version int
+	// Dirty is whether the migration to Version failed part way
+	Dirty bool
+	// Recorded is whether migrationsTable has the table at all. If not, Version is guessed from its
+	// columns, and is 0 if it doesn't exist.
+	Recorded bool
+}
+
+func readTableSchema(ctx context.Context, db migrationDB) (tableSchema, error) {
+	d := db.Dialect()
+	err := db.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (table_name %s, version %s, dirty %s, applied_at %s)",
+		d.Migrations, d.Text, d.Int, d.Bool, d.Timestamp))
+	if err != nil {
+		return tableSchema{}, fmt.Errorf("creating %s: %w", d.Migrations, err)
+	}
+	rows, err := db.Query(ctx, fmt.Sprintf("SELECT version, dirty FROM %s WHERE table_name = '%s'", d.Migrations, d.key()))
+	if err != nil {
+		return tableSchema{}, err
+	}
+	if len(rows) > 0 {
+		version, err := strconv.Atoi(rows[0][0])
+		if err != nil {
+			return tableSchema{}, fmt.Errorf("%s has version %q for %s", d.Migrations, rows[0][0], d.Table)
+		}
+		dirty, _ := strconv.ParseBool(rows[0][1])
+		return tableSchema{Version: version, Dirty: dirty, Recorded: true}, nil
+	}
+
+	rows, err = db.Query(ctx, d.ColumnsQuery)
+	if err != nil {
+		return tableSchema{}, err
+	}
+	columns := map[string]bool{}
+	for _, row := range rows {
+		columns[row[0]] = true
+	}
+	version := 0
+	if len(columns) > 0 {
+		version = firstMigratedVersion
+	}
+	for i, v := range outputSchema {
+		for _, column := range v.Added {
+			if columns[d.Name(column)] && i+1 > version {
+				version = i + 1
+			}
+		}
+	}
+	return tableSchema{Version: version}, nil
+}
+
+func writeTableSchema(ctx context.Context, db migrationDB, schema tableSchema) error {
+	d := db.Dialect()
+	err := db.Exec(ctx, fmt.Sprintf("DELETE FROM %s WHERE table_name = '%s'", d.Migrations, d.key()))
+	if err != nil {
+		return err
+	}
+	return db.Exec(ctx, fmt.Sprintf("INSERT INTO %s (table_name, version, dirty, applied_at) VALUES ('%s', %d, %t, TIMESTAMP '%s')",
+		d.Migrations, d.key(), schema.Version, schema.Dirty, time.Now().UTC().Format("2006-01-02 15:04:05")))
+}
+
+// checkTableSchema is run by a database sink when it opens, creating its table with create if it
+// doesn't exist and failing if the table is at another schema version than the output
+func checkTableSchema(ctx context.Context, db migrationDB, create func() error) error {
+	d := db.Dialect()
+	schema, err := readTableSchema(ctx, db)
+	if err != nil {
+		return err
+	}
+	if schema.Version == 0 {
+		if err = create(); err != nil {
+			return err
+		}
+		return writeTableSchema(ctx, db, tableSchema{Version: outputSchemaVersion})
+	}
+	switch {
+	case schema.Dirty:
+		return fmt.Errorf("the migration of %s to schema version %d failed part way, fix the table by hand and run db migrate -force %d", d.Table, schema.Version, schema.Version)
+	case schema.Version < outputSchemaVersion:
+		return fmt.Errorf("%s is at schema version %d, run db migrate with the same -sink and -output to upgrade it to %d", d.Table, schema.Version, outputSchemaVersion)
+	case schema.Version > outputSchemaVersion:
+		return fmt.Errorf("%s is at schema version %d, newer than the %d this build writes", d.Table, schema.Version, outputSchemaVersion)
+	}
+	return nil
+}
+
+func runDBCommand(ctx context.Context, args []string) {
+	if len(args) == 0 || args[0] != "migrate" {
+		log.Println("Missing or unknown db subcommand")
+		usage()
+		os.Exit(exitUsage)
+	}
+	fs := flag.NewFlagSet("db migrate", flag.ExitOnError)
+	dryRun := fs.Bool("dry-run", false, "print the statements the migrations would run instead of running them")
+	force := fs.Int("force", 0, "record the table as at this schema version without running anything, after fixing a failed migration by hand")
+	fs.Parse(args[1:])
+	if *force != 0 && (*force < firstMigratedVersion || *force > outputSchemaVersion) {
+		fatalf(exitUsage, "-force takes a schema version from %d to %d", firstMigratedVersion, outputSchemaVersion)
+	}
+
+	open, ok := migrationDBs[*sink]
+	if !ok {
+		fatalf(exitUsage, "The %s sink has no migrations, db migrate supports -sink %s", *sink, strings.Join(registeredNames(migrationDBs), ", "))
+	}
+	db, err := open(ctx, *outputPath)
+	if err != nil {
+		fatal(exitSink, err)
+	}
+	defer db.Close()
+	table := db.Dialect().Table
+
+	if *force > 0 {
+		if err = writeTableSchema(ctx, db, tableSchema{Version: *force}); err != nil {
+			fatal(exitSink, err)
+		}
+		infof("Recorded %s as at schema version %d", table, *force)
+		return
+	}
+
+	schema, err := readTableSchema(ctx, db)
+	if err != nil {
+		fatal(exitSink, err)
+	}
+	switch {
+	case schema.Version == 0:
+		infof("%s doesn't exist, the %s sink creates it at schema version %d", table, *sink, outputSchemaVersion)
+		return
+	case schema.Dirty:
+		fatalf(exitSink, "The migration of %s to schema version %d failed part way, fix the table by hand and run db migrate -force %d", table, schema.Version, schema.Version)
+	case schema.Version > outputSchemaVersion:
+		fatalf(exitSink, "%s is at schema version %d, newer than the %d this build writes", table, schema.Version, outputSchemaVersion)
+	}
+	if !schema.Recorded && !*dryRun {
+		// A table made before migrations were recorded, its version guessed from its columns
+		if err = writeTableSchema(ctx, db, schema); err != nil {
+			fatal(exitSink, err)
+		}
+	}
+
+	for _, m := range migrations {
+		if m.Version <= schema.Version {
+			continue
+		}
+		statements, err := db.Dialect().statements(m)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if *dryRun {
+			fmt.Printf("-- %s\n%s;\n", m.Name, strings.Join(statements, ";\n"))
+			continue
+		}
+		infof("Migrating %s to schema version %d with %s", table, m.Version, m.Name)
+		if err = writeTableSchema(ctx, db, tableSchema{Version: m.Version, Dirty: true}); err != nil {
+			fatal(exitSink, err)
+		}
+		for _, statement := range statements {
+			if err = db.Exec(ctx, statement); err != nil {
+				log.Printf("Failed to run %s", statement)
+				fatal(exitSink, err)
+			}
+		}
+		if err = writeTableSchema(ctx, db, tableSchema{Version: m.Version}); err != nil {
+			fatal(exitSink, err)
+		}
+	}
+	if !*dryRun {
+		infof("%s is at schema version %d", table, outputSchemaVersion)
+	}
+}
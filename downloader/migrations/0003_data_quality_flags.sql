@@ -0,0 +1,3 @@
+-- Amounts, prices and dates were loaded as filed before. They aren't rewritten here, reload the
+-- quarters to normalize them.
+ALTER TABLE {{.Table}} ADD COLUMN {{column "DATA_QUALITY_FLAGS"}};
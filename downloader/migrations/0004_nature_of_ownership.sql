@@ -0,0 +1,8 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "NATURE_OF_OWNERSHIP"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "INDIRECT_OWNERSHIP_TYPE"}};
+{{- if not .RawFlags}}
+-- Relationship flags were loaded as filed before, 1 or 0 as often as true or false
+{{- range list "IS_DIRECTOR" "IS_OFFICER" "IS_TEN_PERCENT_OWNER" "IS_OTHER_RELATIONSHIP"}}
+UPDATE {{$.Table}} SET {{name .}} = CASE WHEN LOWER(TRIM({{name .}})) IN ('1', 'true') THEN 'true' ELSE 'false' END WHERE TRUE;
+{{- end}}
+{{- end}}
@@ -0,0 +1 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "DEEMED_EXECUTION_DATE"}};
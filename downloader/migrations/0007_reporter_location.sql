@@ -0,0 +1,2 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "REPORTER_CITY"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "REPORTER_STATE"}};
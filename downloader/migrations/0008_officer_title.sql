@@ -0,0 +1,2 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "OFFICER_TITLE"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "OFFICER_ROLE"}};
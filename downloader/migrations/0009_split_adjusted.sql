@@ -0,0 +1,3 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "SPLIT_ADJUSTED_AMOUNT"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "SPLIT_ADJUSTED_PRICE"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "SPLIT_ADJUSTED_NEW_AMOUNT_OWNED"}};
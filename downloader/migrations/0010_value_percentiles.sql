@@ -0,0 +1,2 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "VALUE_PERCENTILE"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "ISSUER_VALUE_PERCENTILE"}};
@@ -0,0 +1 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "SOURCE_SHA256"}};
@@ -0,0 +1,3 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "SOURCE_URL"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "DOWNLOADED_AT"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "PARSER_VERSION"}};
@@ -0,0 +1,5 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "ROW_TYPE"}};
+ALTER TABLE {{.Table}} ADD COLUMN {{column "TRANSACTION_INDEX"}};
+-- Every row was a non-derivative transaction before. Their TRANSACTION_INDEX is left empty, so the
+-- first reload of a filing replaces its rows rather than merging into them.
+UPDATE {{.Table}} SET {{name "ROW_TYPE"}} = 'NON_DERIVATIVE_TRANSACTION' WHERE TRUE;
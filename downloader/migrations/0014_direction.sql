@@ -0,0 +1,15 @@
+ALTER TABLE {{.Table}} ADD COLUMN {{column "DIRECTION"}};
+-- DIRECTION is derived from columns every version has, so existing rows are classified in place as
+-- form4.ClassifyDirection would
+UPDATE {{.Table}} SET {{name "DIRECTION"}} = CASE
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'P' THEN 'BUY'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'S' THEN 'SELL'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'I' AND UPPER({{name "A_OR_D"}}) = 'A' THEN 'BUY'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'I' AND UPPER({{name "A_OR_D"}}) = 'D' THEN 'SELL'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'U' AND UPPER({{name "A_OR_D"}}) = 'D' THEN 'SELL'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'A' AND UPPER({{name "A_OR_D"}}) = 'A' THEN 'GRANT'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) IN ('M', 'X', 'O', 'C') THEN 'EXERCISE'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'F' THEN 'TAX'
+  WHEN UPPER({{name "TRANSACTION_CODE"}}) = 'G' THEN 'GIFT'
+  ELSE 'OTHER'
+END WHERE TRUE;
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+var officerTitlesPath = flag.String("officer-titles", "", "write every distinct officer title of the run, its OFFICER_ROLE and how often it was seen to this file, to audit the taxonomy")
+
+var officerTitlesHeader = []string{"OFFICER_TITLE", "OFFICER_ROLE", "COUNT"}
+
+// officerTitleCounts counts the reporting owners seen with each officer title, as filed
+type officerTitleCounts map[string]int
+
+func (c officerTitleCounts) add(parsed *ParsedFiling) {
+	for _, o := range parsed.Document.ReportingOwners {
+		if title := strings.TrimSpace(o.OfficerTitle); title != "" {
+			c[title]++
+		}
+	}
+}
+
+// write writes the titles most seen first, with a data dictionary next to them like any export
+func (c officerTitleCounts) write(path string) error {
+	f, err := DetectOutputFormat(path, "", "")
+	if err != nil {
+		return err
+	}
+	f.Header = officerTitlesHeader
+	if err := WriteSchema(schemaPath(path, f), "officer_titles", f); err != nil {
+		return err
+	}
+
+	titles := make([]string, 0, len(c))
+	for title := range c {
+		titles = append(titles, title)
+	}
+	sort.Slice(titles, func(i, j int) bool {
+		if c[titles[i]] != c[titles[j]] {
+			return c[titles[i]] > c[titles[j]]
+		}
+		return titles[i] < titles[j]
+	})
+
+	out, err := openOutputFile(path, f, false)
+	if err != nil {
+		return err
+	}
+	for _, title := range titles {
+		if err := out.Write(&Row{Values: []string{title, form4.NormalizeOfficerTitle(title), strconv.Itoa(c[title])}}); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
@@ -0,0 +1,657 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/klauspost/compress/zstd"
+)
+
+// csvHeader is the columns of the flat output, those of the current schema version and then the
+// extractors'
+var csvHeader = schemaColumns(outputSchemaVersion)
+
+// transactionValues lays a transaction of a parsed filing out in csvHeader order
+func transactionValues(parsed *ParsedFiling, t form4.TransactionRow) []string {
+	filing := parsed.Filing
+	adjustedShares, adjustedPrice, adjustedOwned := splitAdjusted(parsed.Splits, t)
+	rank := parsed.Ranks[t.TransactionIndex]
+	return []string{t.IssuerCIK, t.ReporterCIK, filing.AccessionNumber, t.ReporterName, t.AcquiredDisposedCode, t.Shares, t.PricePerShare, t.TransactionDate, t.SecurityTitle, t.IssuerName, t.IssuerTicker, t.IsDirector, t.IsOfficer, t.IsTenPercentOwner, t.IsOther, t.SharesOwnedFollowingTransaction, t.DirectOrIndirectOwnership, t.TransactionCode, strings.Join(validateTransaction(filing, t), dataQualityFlagsSeparator), t.NatureOfOwnership, form4.ClassifyNatureOfOwnership(t.NatureOfOwnership), t.DeemedExecutionDate, filing.AcceptanceDateTime, t.ReporterCity, t.ReporterState, t.OfficerTitle, form4.NormalizeOfficerTitle(t.OfficerTitle), adjustedShares, adjustedPrice, adjustedOwned, rank.Overall, rank.Issuer, parsed.SourceSHA256, parsed.SourceURL, parsed.DownloadedAt, parserVersion, rowTypeNonDerivativeTransaction, strconv.Itoa(t.TransactionIndex), form4.ClassifyDirection(t.TransactionCode, t.AcquiredDisposedCode)}
+}
+
+// hasRequiredFields is whether a transaction has every value the output has always required, rows
+// missing any of them are skipped
+func hasRequiredFields(t form4.TransactionRow) bool {
+	for _, v := range []string{t.IssuerCIK, t.ReporterCIK, t.ReporterName, t.AcquiredDisposedCode, t.Shares, t.PricePerShare, t.TransactionDate, t.SecurityTitle, t.IssuerName, t.IssuerTicker, t.SharesOwnedFollowingTransaction, t.DirectOrIndirectOwnership} {
+		if v == "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Row is a single output line along with the filing it was parsed from
+type Row struct {
+	Filing *edgar.IndexEntry
+	// Values line up with csvHeader
+	Values []string
+}
+
+// Get returns the value of the named column, or "" if there is no such column
+func (r *Row) Get(column string) string {
+	for i, name := range csvHeader {
+		if name == column && i < len(r.Values) {
+			return r.Values[i]
+		}
+	}
+	return ""
+}
+
+func (r *Row) value(column int) string {
+	if column < len(r.Values) {
+		return r.Values[column]
+	}
+	return ""
+}
+
+// RowWriter is anything parsed rows can be written to
+type RowWriter interface {
+	// Write should give up and return ctx.Err() once ctx is done, if it blocks on anything
+	Write(ctx context.Context, row *Row) error
+	Close() error
+}
+
+// OutputFormat is how rows are encoded and compressed on disk
+type OutputFormat struct {
+	// Encoding is csv or jsonl
+	Encoding string
+	// Compression is gzip, zstd, or empty for none
+	Compression string
+	// Columns are indexes into the header in the order they are written, nil for all of them
+	Columns []int
+	// Header names the values of the rows written, csvHeader when nil
+	Header []string
+}
+
+func (o OutputFormat) header() []string {
+	if o.Header != nil {
+		return o.Header
+	}
+	return csvHeader
+}
+
+// ResolveColumns maps column names (case insensitive, so the jsonl keys work too) to their index in
+// csvHeader, keeping the order given
+func ResolveColumns(names []string) ([]int, error) {
+	columns := []int{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		found := false
+		for i, column := range csvHeader {
+			if strings.EqualFold(column, name) {
+				columns = append(columns, i)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown column %q, expected any of %s", name, strings.Join(csvHeader, ", "))
+		}
+	}
+	if len(columns) == 0 {
+		return nil, nil
+	}
+	return columns, nil
+}
+
+// columnIndexes returns the selected columns, defaulting to every column in header order
+func (o OutputFormat) columnIndexes() []int {
+	if o.Columns != nil {
+		return o.Columns
+	}
+	all := make([]int, len(o.header()))
+	for i := range all {
+		all[i] = i
+	}
+	return all
+}
+
+// Ext is the file extension for the format, e.g. .csv.gz
+func (o OutputFormat) Ext() string {
+	ext := "." + o.Encoding
+	switch o.Compression {
+	case "gzip":
+		ext += ".gz"
+	case "zstd":
+		ext += ".zst"
+	}
+	return ext
+}
+
+// DetectOutputFormat fills in whatever of encoding and compression was not given explicitly from the
+// extension of path, defaulting to uncompressed csv
+func DetectOutputFormat(path, encoding, compression string) (OutputFormat, error) {
+	base := strings.ToLower(path)
+	detectedCompression := ""
+	switch {
+	case strings.HasSuffix(base, ".gz"):
+		detectedCompression = "gzip"
+		base = strings.TrimSuffix(base, ".gz")
+	case strings.HasSuffix(base, ".zst"):
+		detectedCompression = "zstd"
+		base = strings.TrimSuffix(base, ".zst")
+	}
+	detectedEncoding := "csv"
+	switch {
+	case strings.HasSuffix(base, ".jsonl"), strings.HasSuffix(base, ".ndjson"), path == stdoutPath:
+		detectedEncoding = "jsonl"
+	}
+
+	f := OutputFormat{Encoding: encoding, Compression: compression}
+	if f.Encoding == "" {
+		f.Encoding = detectedEncoding
+	}
+	if f.Compression == "" {
+		f.Compression = detectedCompression
+	} else if f.Compression == "none" {
+		f.Compression = ""
+	}
+
+	if f.Encoding != "csv" && f.Encoding != "jsonl" {
+		return f, fmt.Errorf("unknown output format %q, expected csv or jsonl", f.Encoding)
+	}
+	if f.Compression != "" && f.Compression != "gzip" && f.Compression != "zstd" {
+		return f, fmt.Errorf("unknown compression %q, expected none, gzip or zstd", f.Compression)
+	}
+	return f, nil
+}
+
+// stdoutPath as -output streams rows to stdout, as jsonl unless -format says otherwise
+const stdoutPath = "-"
+
+type fileWriter struct {
+	f *os.File
+	// counter tracks bytes that have reached the file, including any it held before we appended
+	counter *countingWriter
+	// comp is the compressor between the encoder and the file, if any
+	comp io.WriteCloser
+	buf  *bufio.Writer
+
+	encoding string
+	header   []string
+	columns  []int
+	csv      *csv.Writer
+	// stream flushes every row, for stdout where the reader wants rows as they are parsed
+	stream bool
+}
+
+// openOutputFile opens path for writing rows in format, or stdout for stdoutPath. When appending, no
+// header is written, and compressed output starts a new gzip member/zstd frame, which readers treat
+// as one continuous stream.
+func openOutputFile(path string, format OutputFormat, appendOnly bool) (*fileWriter, error) {
+	f, size := os.Stdout, int64(0)
+	if path != stdoutPath {
+		if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+			return nil, err
+		}
+		flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+		if appendOnly {
+			flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+		}
+		var err error
+		if f, err = os.OpenFile(path, flags, 0666); err != nil {
+			return nil, err
+		}
+		info, err := f.Stat()
+		if err != nil {
+			f.Close()
+			return nil, err
+		}
+		size = info.Size()
+	}
+
+	w := &fileWriter{
+		f:        f,
+		counter:  &countingWriter{w: f, n: size},
+		encoding: format.Encoding,
+		header:   format.header(),
+		columns:  format.columnIndexes(),
+		stream:   path == stdoutPath,
+	}
+	var err error
+	var dst io.Writer = w.counter
+	w.comp, err = newCompressor(w.counter, format.Compression)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	if w.comp != nil {
+		dst = w.comp
+	}
+	w.buf = bufio.NewWriter(dst)
+
+	if format.Encoding == "csv" {
+		w.csv = csv.NewWriter(w.buf)
+		if !appendOnly {
+			header := make([]string, len(w.columns))
+			for i, column := range w.columns {
+				header[i] = w.header[column]
+			}
+			if err := w.csv.Write(header); err != nil {
+				f.Close()
+				return nil, err
+			}
+		}
+	}
+	return w, nil
+}
+
+// newCompressor wraps w in the named compression, returning nil for none
+func newCompressor(w io.Writer, compression string) (io.WriteCloser, error) {
+	switch compression {
+	case "gzip":
+		return gzip.NewWriter(w), nil
+	case "zstd":
+		return zstd.NewWriter(w)
+	}
+	return nil, nil
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func (w *fileWriter) Write(row *Row) error {
+	if w.encoding == "csv" {
+		record := make([]string, len(w.columns))
+		for i, column := range w.columns {
+			record[i] = row.value(column)
+		}
+		if err := w.csv.Write(record); err != nil {
+			return err
+		}
+		if w.stream {
+			w.csv.Flush()
+			return w.flush()
+		}
+		return nil
+	}
+
+	line, err := marshalRowJSON(row, w.header, w.columns)
+	if err != nil {
+		return err
+	}
+	if _, err = w.buf.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if w.stream {
+		return w.flush()
+	}
+	return nil
+}
+
+// flush pushes what has been written through the buffer and any compressor to the file
+func (w *fileWriter) flush() error {
+	if err := w.buf.Flush(); err != nil {
+		return err
+	}
+	if f, ok := w.comp.(interface{ Flush() error }); ok {
+		return f.Flush()
+	}
+	return nil
+}
+
+// marshalRowJSON encodes the given columns of a row as a JSON object with lower cased column names
+// from header as keys, keeping the column order
+func marshalRowJSON(row *Row, header []string, columns []int) ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, column := range columns {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(strings.ToLower(header[column]))
+		val, err := json.Marshal(row.value(column))
+		if err != nil {
+			return nil, err
+		}
+		b.Write(key)
+		b.WriteByte(':')
+		b.Write(val)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
+
+func (w *fileWriter) Close() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		if err := w.csv.Error(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	if err := w.buf.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if w.comp != nil {
+		if err := w.comp.Close(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	return w.f.Close()
+}
+
+// partitionKeys are the supported -partition keys, each mapping a row to one path segment
+var partitionKeys = map[string]func(row *Row) string{
+	"year": func(row *Row) string {
+		return sliceDate(row.Filing.DateFiled, 0, 4)
+	},
+	"month": func(row *Row) string {
+		return sliceDate(row.Filing.DateFiled, 4, 6)
+	},
+	"day": func(row *Row) string {
+		return sliceDate(row.Filing.DateFiled, 6, 8)
+	},
+	"ticker": func(row *Row) string {
+		return strings.ToUpper(strings.TrimSpace(row.Get("ISSUER_TICKER")))
+	},
+	"form": func(row *Row) string {
+		return row.Filing.FormType
+	},
+}
+
+// sliceDate pulls part of a YYYYMMDD date, as found in the master files
+func sliceDate(d string, from, to int) string {
+	if len(d) < to {
+		return ""
+	}
+	return d[from:to]
+}
+
+// hivePartitionDefault is the Hive layout's directory for rows without a value for a key, which Hive,
+// Spark, Trino and Athena read as NULL
+const hivePartitionDefault = "__HIVE_DEFAULT_PARTITION__"
+
+// hiveSegment is the key=value directory of the Hive layout a row goes in for a partition key
+func hiveSegment(key string, row *Row) string {
+	value := partitionKeys[key](row)
+	if value == "" {
+		return key + "=" + hivePartitionDefault
+	}
+	return key + "=" + sanitizePathSegment(value)
+}
+
+// parsePartitionStyle validates -partition-style, returning whether it is the Hive layout
+func parsePartitionStyle(style string) (bool, error) {
+	switch style {
+	case "plain":
+		return false, nil
+	case "hive":
+		return true, nil
+	}
+	return false, fmt.Errorf("unknown partition style %q, expected plain or hive", style)
+}
+
+var unsafePathChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+func sanitizePathSegment(s string) string {
+	s = unsafePathChars.ReplaceAllString(s, "-")
+	s = strings.Trim(s, ".-")
+	if s == "" {
+		return "UNKNOWN"
+	}
+	return s
+}
+
+// RollLimits split an output into numbered part files once a part reaches either limit. Zero means
+// no limit. Bytes are counted as they reach the disk, so a part can overshoot by a buffer's worth.
+type RollLimits struct {
+	MaxRows  int64
+	MaxBytes int64
+}
+
+func (l RollLimits) enabled() bool {
+	return l.MaxRows > 0 || l.MaxBytes > 0
+}
+
+// outputFile is one logical output, written as part files (name-part-00001.csv, ...) when roll limits
+// are set. It can be closed and reopened without losing its place, which the partitioned writer relies on.
+type outputFile struct {
+	path   string
+	format OutputFormat
+	limits RollLimits
+
+	// w is nil while the file is closed
+	w     *fileWriter
+	part  int
+	rows  int64
+	bytes int64
+	// created is whether this run has already truncated the current part, so reopening appends instead
+	created bool
+	// written are the parts written so far, and manifest where their manifest goes, none if empty
+	written  []ManifestFile
+	manifest string
+}
+
+func newOutputFile(path string, format OutputFormat, limits RollLimits) *outputFile {
+	o := &outputFile{path: path, format: format, limits: limits}
+	if limits.enabled() {
+		o.part = 1
+	}
+	return o
+}
+
+func (o *outputFile) partPath() string {
+	if o.part == 0 {
+		return o.path
+	}
+	base, ext := o.path, ""
+	if strings.HasSuffix(strings.ToLower(o.path), o.format.Ext()) {
+		base, ext = o.path[:len(o.path)-len(o.format.Ext())], o.path[len(o.path)-len(o.format.Ext()):]
+	}
+	return fmt.Sprintf("%s-part-%05d%s", base, o.part, ext)
+}
+
+func (o *outputFile) isOpen() bool {
+	return o.w != nil
+}
+
+func (o *outputFile) Write(ctx context.Context, row *Row) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if o.full() {
+		if err := o.Close(); err != nil {
+			return err
+		}
+		o.part++
+		o.rows = 0
+		o.bytes = 0
+		o.created = false
+	}
+
+	if o.w == nil {
+		w, err := openOutputFile(o.partPath(), o.format, o.created)
+		if err != nil {
+			return fmt.Errorf("error opening %s: %w", o.partPath(), err)
+		}
+		if !o.created && o.path != stdoutPath {
+			o.written = append(o.written, ManifestFile{Path: o.partPath()})
+		}
+		o.w = w
+		o.created = true
+	}
+
+	if err := o.w.Write(row); err != nil {
+		return err
+	}
+	o.rows++
+	if len(o.written) > 0 {
+		o.written[len(o.written)-1].add(row)
+	}
+	return nil
+}
+
+func (o *outputFile) Manifest() (string, []ManifestFile) {
+	return o.manifest, o.written
+}
+
+func (o *outputFile) full() bool {
+	if o.w != nil {
+		o.bytes = o.w.counter.n
+	}
+	return (o.limits.MaxRows > 0 && o.rows >= o.limits.MaxRows) ||
+		(o.limits.MaxBytes > 0 && o.bytes >= o.limits.MaxBytes)
+}
+
+// Close closes the current part, a later Write reopens it
+func (o *outputFile) Close() error {
+	if o.w == nil {
+		return nil
+	}
+	err := o.w.Close()
+	o.bytes = o.w.counter.n
+	o.w = nil
+	if err != nil {
+		return fmt.Errorf("error closing %s: %w", o.partPath(), err)
+	}
+	return nil
+}
+
+// maxOpenPartitions bounds open file handles, partitioning by ticker can produce thousands of files
+const maxOpenPartitions = 128
+
+// PartitionedWriter spreads rows across files under root, one path segment per partition key with the
+// last key naming the file, e.g. year,month,ticker writes out/2024/05/ABC.csv. In the Hive layout
+// every key is a key=value directory, and the files in them are named data, e.g.
+// out/year=2024/month=05/ticker=ABC/data.csv, which query engines read the keys from as columns.
+type PartitionedWriter struct {
+	root   string
+	keys   []string
+	hive   bool
+	format OutputFormat
+	limits RollLimits
+
+	files map[string]*outputFile
+	open  int
+	// manifest is where the manifest of the partitions goes
+	manifest string
+}
+
+// ParsePartitionKeys validates a comma separated -partition value
+func ParsePartitionKeys(spec string) ([]string, error) {
+	keys := []string{}
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if _, ok := partitionKeys[key]; !ok {
+			return nil, fmt.Errorf("unknown partition key %q, expected one of year, month, day, ticker, form", key)
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+func NewPartitionedWriter(root string, keys []string, hive bool, format OutputFormat, limits RollLimits) *PartitionedWriter {
+	return &PartitionedWriter{
+		root:   root,
+		keys:   keys,
+		hive:   hive,
+		format: format,
+		limits: limits,
+		files:  map[string]*outputFile{},
+	}
+}
+
+func (p *PartitionedWriter) pathFor(row *Row) string {
+	segments := []string{p.root}
+	for _, key := range p.keys {
+		if p.hive {
+			segments = append(segments, hiveSegment(key, row))
+		} else {
+			segments = append(segments, sanitizePathSegment(partitionKeys[key](row)))
+		}
+	}
+	if p.hive {
+		segments = append(segments, "data")
+	}
+	return filepath.Join(segments...) + p.format.Ext()
+}
+
+func (p *PartitionedWriter) Write(ctx context.Context, row *Row) error {
+	path := p.pathFor(row)
+	f, ok := p.files[path]
+	if !ok {
+		f = newOutputFile(path, p.format, p.limits)
+		p.files[path] = f
+	}
+
+	if !f.isOpen() && p.open >= maxOpenPartitions {
+		if err := p.Close(); err != nil {
+			return err
+		}
+	}
+
+	wasOpen := f.isOpen()
+	if err := f.Write(ctx, row); err != nil {
+		return err
+	}
+	if !wasOpen {
+		p.open++
+	}
+	return nil
+}
+
+func (p *PartitionedWriter) Manifest() (string, []ManifestFile) {
+	paths := make([]string, 0, len(p.files))
+	for path := range p.files {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	files := []ManifestFile{}
+	for _, path := range paths {
+		files = append(files, p.files[path].written...)
+	}
+	return p.manifest, files
+}
+
+// Close closes every open partition, writing more rows reopens them
+func (p *PartitionedWriter) Close() error {
+	for _, f := range p.files {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	p.open = 0
+	return nil
+}
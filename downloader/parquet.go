@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+
+	"github.com/apache/arrow/go/v12/arrow"
+	"github.com/apache/arrow/go/v12/arrow/array"
+	"github.com/apache/arrow/go/v12/arrow/memory"
+	"github.com/apache/arrow/go/v12/parquet"
+	parquetcompress "github.com/apache/arrow/go/v12/parquet/compress"
+	"github.com/apache/arrow/go/v12/parquet/pqarrow"
+)
+
+var (
+	parquetCodecName    = flag.String("parquet-codec", "snappy", "compression of Parquet files, snappy, zstd, gzip or none")
+	parquetRowGroupRows = flag.Int("parquet-row-group-rows", 64*1024, "rows buffered and written as each row group of a Parquet file")
+	parquetDictionary   = flag.Bool("parquet-dictionary", true, "dictionary encode the columns of Parquet files")
+)
+
+// parquetCodecs are the -parquet-codec values, with the extension Spark names files of each with
+var parquetCodecs = map[string]struct {
+	codec     parquetcompress.Compression
+	extension string
+}{
+	"snappy": {parquetcompress.Codecs.Snappy, ".snappy"},
+	"zstd":   {parquetcompress.Codecs.Zstd, ".zstd"},
+	"gzip":   {parquetcompress.Codecs.Gzip, ".gz"},
+	"none":   {parquetcompress.Codecs.Uncompressed, ""},
+}
+
+// checkParquetOptions fails on -parquet-codec and -parquet-row-group-rows values that can't be written
+func checkParquetOptions() error {
+	if _, ok := parquetCodecs[*parquetCodecName]; !ok {
+		return fmt.Errorf("unknown -parquet-codec %q, expected snappy, zstd, gzip or none", *parquetCodecName)
+	}
+	if *parquetRowGroupRows < 1 {
+		return fmt.Errorf("-parquet-row-group-rows must be at least 1")
+	}
+	return nil
+}
+
+// parquetExtension is the extension of Parquet files written with -parquet-codec, e.g. .snappy.parquet
+func parquetExtension() string {
+	return parquetCodecs[*parquetCodecName].extension + ".parquet"
+}
+
+// parquetWriter writes rows of string columns to a Parquet file, by default snappy compressed and
+// dictionary encoded, which suits the many repeated values (tickers, codes, flags) of the output.
+// -parquet-codec, -parquet-row-group-rows and -parquet-dictionary tune it for the engine reading it.
+type parquetWriter struct {
+	fw      *pqarrow.FileWriter
+	builder *array.RecordBuilder
+	pending int
+	// rowGroupRows is how many rows are buffered and written as each row group
+	rowGroupRows int
+	// rows is how many rows have been written
+	rows int64
+}
+
+// newParquetWriter writes a Parquet file with a nullable string column per header column to w,
+// closing w once the writer is closed
+func newParquetWriter(w io.Writer, header []string) (*parquetWriter, error) {
+	fields := make([]arrow.Field, len(header))
+	for i, column := range header {
+		fields[i] = arrow.Field{Name: column, Type: arrow.BinaryTypes.String, Nullable: true}
+	}
+	schema := arrow.NewSchema(fields, nil)
+
+	if err := checkParquetOptions(); err != nil {
+		return nil, err
+	}
+	props := parquet.NewWriterProperties(
+		parquet.WithCompression(parquetCodecs[*parquetCodecName].codec),
+		parquet.WithDictionaryDefault(*parquetDictionary),
+		parquet.WithMaxRowGroupLength(int64(*parquetRowGroupRows)),
+		parquet.WithCreatedBy("sec4"),
+	)
+	fw, err := pqarrow.NewFileWriter(schema, w, props, pqarrow.DefaultWriterProps())
+	if err != nil {
+		return nil, err
+	}
+	return &parquetWriter{
+		fw:           fw,
+		builder:      array.NewRecordBuilder(memory.DefaultAllocator, schema),
+		rowGroupRows: *parquetRowGroupRows,
+	}, nil
+}
+
+// Write adds a row, its values lining up with the header
+func (p *parquetWriter) Write(values []string) error {
+	for i := range p.builder.Fields() {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		p.builder.Field(i).(*array.StringBuilder).Append(value)
+	}
+	p.pending++
+	p.rows++
+	if p.pending >= p.rowGroupRows {
+		return p.flush()
+	}
+	return nil
+}
+
+func (p *parquetWriter) flush() error {
+	record := p.builder.NewRecord()
+	defer record.Release()
+	p.pending = 0
+	return p.fw.Write(record)
+}
+
+func (p *parquetWriter) Close() error {
+	defer p.builder.Release()
+	if p.pending > 0 {
+		if err := p.flush(); err != nil {
+			p.fw.Close()
+			return err
+		}
+	}
+	return p.fw.Close()
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+var parseCache = flag.Bool("parse-cache", false, "keep each parsed document in -data-dir keyed by the submission's SHA-256 and the parser version, so exports re-run over the same filings skip parsing")
+
+// parsedPath is where the document parsed from the submission with SHA-256 hash is kept. Documents
+// parsed by another parser version, or with -raw-flags, are kept apart, so they are never mixed up.
+func parsedPath(hash string) string {
+	name := hash + "-v" + parserVersion
+	if *rawFlags {
+		name += "-raw"
+	}
+	return filepath.Join(*dataDir, "parsed", hash[:2], name+".json.gz")
+}
+
+// loadParsed returns the normalized document parsed from a submission before, false if it wasn't
+// kept or can't be read, which is logged so it is parsed again
+func loadParsed(hash string) (*form4.OwnershipDocument, bool) {
+	path := parsedPath(hash)
+	content, err := readStateFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, false
+	}
+	if err == nil {
+		var zr *gzip.Reader
+		if zr, err = gzip.NewReader(bytes.NewReader(content)); err == nil {
+			content, err = ioutil.ReadAll(zr)
+		}
+	}
+	od := &form4.OwnershipDocument{}
+	if err == nil {
+		err = json.Unmarshal(content, od)
+	}
+	if err != nil {
+		log.Printf("Failed to read the parsed document %s, parsing it again: %s", path, err)
+		return nil, false
+	}
+	return od, true
+}
+
+// saveParsed keeps the normalized document parsed from a submission, logging if it can't be written
+func saveParsed(hash string, od *form4.OwnershipDocument) {
+	path := parsedPath(hash)
+	content, err := json.Marshal(od)
+	if err != nil {
+		log.Printf("Failed to encode the parsed document %s: %s", path, err)
+		return
+	}
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(content)
+	zw.Close()
+	if err = os.MkdirAll(filepath.Dir(path), 0777); err == nil {
+		err = writeStateFile(path, buf.Bytes())
+	}
+	if err != nil {
+		log.Printf("Failed to keep the parsed document %s: %s", path, err)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+var percentileMonths = flag.Int("percentile-months", 0, "rank each transaction's dollar value against those of the trailing months, of all issuers and of its own, in VALUE_PERCENTILE and ISSUER_VALUE_PERCENTILE (default 0, leaving them empty)")
+
+var valueHistoryHeader = []string{"ACCESSION_NUMBER", "TRANSACTION_INDEX", "ISSUER_CIK", "TRANSACTION_DATE", "VALUE"}
+
+// valueRank is a transaction's dollar value percentile among every issuer's transactions and among
+// its issuer's, both empty when it has no dollar value
+type valueRank struct {
+	Overall, Issuer string
+}
+
+// valueEntry is a transaction's dollar value, the shares times the price
+type valueEntry struct {
+	accession string
+	index     int
+	issuerCIK string
+	date      string
+	value     float64
+}
+
+// ValueHistory is the dollar value of every transaction with a price seen, kept in the data directory
+// so transactions are ranked against earlier runs' too. The values of each month, of all issuers and
+// of each issuer, are kept sorted for ranking.
+type ValueHistory struct {
+	months  int
+	entries []valueEntry
+	seen    map[string]bool
+	overall map[string][]float64
+	issuers map[string]map[string][]float64
+}
+
+// valueHistoryPath is where the history is kept, next to the document cache
+func valueHistoryPath() string {
+	return filepath.Join(*dataDir, "transaction_values.csv")
+}
+
+// LoadValueHistory reads the history at path for ranking against the trailing months given, an empty
+// one if it doesn't exist yet
+func LoadValueHistory(path string, months int) (*ValueHistory, error) {
+	h := &ValueHistory{months: months, seen: map[string]bool{}, overall: map[string][]float64{}, issuers: map[string]map[string][]float64{}}
+	records, err := readCSVFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading transaction values %s: %w", path, err)
+	}
+	for i, r := range records {
+		if i == 0 || len(r) != len(valueHistoryHeader) {
+			continue
+		}
+		index, err := strconv.Atoi(r[1])
+		if err != nil {
+			continue
+		}
+		value, err := strconv.ParseFloat(r[4], 64)
+		if err != nil {
+			continue
+		}
+		h.add(valueEntry{accession: r[0], index: index, issuerCIK: r[2], date: r[3], value: value})
+	}
+	return h, nil
+}
+
+func (h *ValueHistory) add(e valueEntry) {
+	key := e.accession + "/" + strconv.Itoa(e.index)
+	if h.seen[key] || len(e.date) < len("2006-01") {
+		return
+	}
+	h.seen[key] = true
+	h.entries = append(h.entries, e)
+
+	month := e.date[:len("2006-01")]
+	h.overall[month] = insertSorted(h.overall[month], e.value)
+	months := h.issuers[e.issuerCIK]
+	if months == nil {
+		months = map[string][]float64{}
+		h.issuers[e.issuerCIK] = months
+	}
+	months[month] = insertSorted(months[month], e.value)
+}
+
+func insertSorted(values []float64, v float64) []float64 {
+	i := sort.SearchFloat64s(values, v)
+	values = append(values, 0)
+	copy(values[i+1:], values[i:])
+	values[i] = v
+	return values
+}
+
+// transactionValue is a transaction's shares times its price, false when either isn't known or the
+// price is zero, as it is for gifts and grants
+func transactionValue(t form4.TransactionRow) (float64, bool) {
+	shares, ok := parseDecimal(t.Shares)
+	price, priced := parseDecimal(t.PricePerShare)
+	if !ok || !priced || price <= 0 {
+		return 0, false
+	}
+	return shares * price, true
+}
+
+// Rank adds the values of a parsed filing's transactions to the history, then ranks each against the
+// transactions dated in its month and the months before it, up to the history's months in all. Those
+// are the transactions seen so far, this and earlier runs', so a transaction is only ranked against
+// the ones filed after it if they were seen in an earlier run.
+func (h *ValueHistory) Rank(parsed *ParsedFiling) {
+	issuerCIK := edgar.PadCIK(parsed.Document.Issuer.CIK)
+	rows := form4.Flatten(parsed.Document)
+	for _, t := range rows {
+		if value, ok := transactionValue(t); ok {
+			h.add(valueEntry{accession: parsed.Filing.AccessionNumber, index: t.TransactionIndex, issuerCIK: issuerCIK, date: t.TransactionDate, value: value})
+		}
+	}
+
+	parsed.Ranks = map[int]valueRank{}
+	for _, t := range rows {
+		value, ok := transactionValue(t)
+		if !ok {
+			continue
+		}
+		window := h.window(t.TransactionDate)
+		if window == nil {
+			continue
+		}
+		parsed.Ranks[t.TransactionIndex] = valueRank{
+			Overall: percentile(h.overall, window, value),
+			Issuer:  percentile(h.issuers[issuerCIK], window, value),
+		}
+	}
+}
+
+// window returns the months (YYYY-MM) a transaction on date is ranked against, nil if the date isn't valid
+func (h *ValueHistory) window(date string) []string {
+	t, err := time.Parse("2006-01-02", date)
+	if err != nil {
+		return nil
+	}
+	first := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	months := make([]string, h.months)
+	for i := range months {
+		months[i] = first.AddDate(0, -i, 0).Format("2006-01")
+	}
+	return months
+}
+
+// percentile is the percentage of the values of the months given at or below v, to 2 decimal places
+func percentile(values map[string][]float64, months []string, v float64) string {
+	below, total := 0, 0
+	for _, month := range months {
+		sorted := values[month]
+		below += sort.Search(len(sorted), func(i int) bool { return sorted[i] > v })
+		total += len(sorted)
+	}
+	if total == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(100*float64(below)/float64(total), 'f', 2, 64)
+}
+
+// Save writes the history to path, leaving out transactions dated before the trailing months of the
+// latest one, and replaces it only once it is fully written
+func (h *ValueHistory) Save(path string) error {
+	// Dates mistyped into the future are kept but don't count as the latest
+	latest, today := "", time.Now().Format("2006-01-02")
+	for _, e := range h.entries {
+		if e.date > latest && e.date <= today {
+			latest = e.date
+		}
+	}
+	oldest := ""
+	if window := h.window(latest); window != nil {
+		oldest = window[len(window)-1]
+	}
+	sort.Slice(h.entries, func(i, j int) bool {
+		a, b := h.entries[i], h.entries[j]
+		if a.accession != b.accession {
+			return a.accession < b.accession
+		}
+		return a.index < b.index
+	})
+
+	records := [][]string{valueHistoryHeader}
+	for _, e := range h.entries {
+		if e.date < oldest {
+			continue
+		}
+		records = append(records, []string{e.accession, strconv.Itoa(e.index), e.issuerCIK, e.date, strconv.FormatFloat(e.value, 'f', -1, 64)})
+	}
+	return writeCSVFile(path, records)
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+// PipelineOptions bound how much work processFilings does at once
+type PipelineOptions struct {
+	// DownloadWorkers is how many filings are downloaded concurrently. Downloads are IO bound and
+	// paced by the client's rate limit, so a few are enough to hide request latency.
+	DownloadWorkers int
+	// ParseWorkers is how many downloaded filings are parsed concurrently. Parsing is CPU bound,
+	// around one per core keeps it from starving or being starved by the downloads.
+	ParseWorkers int
+	// MaxInFlight caps the filings dispatched but not yet written. Rows are written in filing order,
+	// so one slow download holds back everything after it, this keeps those finished filings and
+	// their documents from piling up in memory.
+	MaxInFlight int
+	// Observe, if set, is called with each parsed filing just before it is written, all from one
+	// goroutine in filing order, so it may fill in values that depend on the filings before it
+	Observe func(parsed *ParsedFiling)
+	// Failures, if set, counts the filings that failed to download or parse, in filing order, and
+	// stops the run once it is spent
+	Failures *FailureBudget
+	// Summary, if set, counts the filings downloaded, parsed and skipped and the rows written
+	Summary *RunSummary
+}
+
+type filingJob struct {
+	filing  *edgar.IndexEntry
+	content []byte
+	result  chan filingResult
+}
+
+// filingResult is a parsed filing, nil if it was skipped or failed, and why
+type filingResult struct {
+	parsed         *ParsedFiling
+	err            error
+	downloadFailed bool
+}
+
+// failure is the result's error if the filing failed, nil if it was parsed, isn't an ownership
+// document to parse, is of an issuer left out or isn't cached for reparse
+func (r filingResult) failure() error {
+	if errors.Is(r.err, form4.ErrNoXMLDocument) || errors.Is(r.err, form4.ErrNotOwnershipDocument) || errors.Is(r.err, errIssuerExcluded) || errors.Is(r.err, edgar.ErrOffline) {
+		return nil
+	}
+	return r.err
+}
+
+// processFilings downloads filings on opts.DownloadWorkers goroutines, parses them on
+// opts.ParseWorkers goroutines and writes their rows to out in the order of filings, so output does
+// not depend on which filing finished first. It returns ctx's error if it was cancelled, or the
+// failure budget's once it is spent, after writing the filings before that. Those already dispatched
+// are dropped, so the rows written end with a whole filing a resumed export can carry on after.
+func processFilings(ctx context.Context, filings []*edgar.IndexEntry, out RowWriter, activeExtractors []Extractor, opts PipelineOptions) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	downloadWorkers, parseWorkers, maxInFlight := opts.DownloadWorkers, opts.ParseWorkers, opts.MaxInFlight
+	if downloadWorkers < 1 {
+		downloadWorkers = 1
+	}
+	if parseWorkers < 1 {
+		parseWorkers = 1
+	}
+	if maxInFlight < downloadWorkers+parseWorkers {
+		maxInFlight = downloadWorkers + parseWorkers
+	}
+
+	downloads := make(chan filingJob)
+	parses := make(chan filingJob)
+	// pending is the write order, its buffer plus the filing being waited on bound the filings in flight
+	pending := make(chan filingJob, maxInFlight-1)
+
+	var downloading, parsing sync.WaitGroup
+	for i := 0; i < downloadWorkers; i++ {
+		downloading.Add(1)
+		go func() {
+			defer downloading.Done()
+			for job := range downloads {
+				var err error
+				if job.content, err = downloadFiling(ctx, job.filing); err != nil {
+					job.result <- filingResult{err: err, downloadFailed: true}
+					continue
+				}
+				parses <- job
+			}
+		}()
+	}
+	for i := 0; i < parseWorkers; i++ {
+		parsing.Add(1)
+		go func() {
+			defer parsing.Done()
+			for job := range parses {
+				parsed, err := parseFiling(ctx, job.filing, job.content, activeExtractors)
+				job.result <- filingResult{parsed: parsed, err: err}
+			}
+		}()
+	}
+	go func() {
+		downloading.Wait()
+		close(parses)
+	}()
+
+	go func() {
+		defer close(pending)
+		defer close(downloads)
+		for _, filing := range filings {
+			if ctx.Err() != nil {
+				return
+			}
+			job := filingJob{filing: filing, result: make(chan filingResult, 1)}
+			select {
+			case pending <- job:
+			case <-ctx.Done():
+				return
+			}
+			downloads <- job
+		}
+	}()
+
+	filingWriter, wantsFilings := out.(FilingWriter)
+	written := 0
+	var budgetErr error
+	for job := range pending {
+		result := <-job.result
+		if budgetErr != nil {
+			// The filings already dispatched are drained without being written, their downloads cancelled
+			continue
+		}
+		if ctx.Err() != nil {
+			// So are they once the run is interrupted, which sinks would refuse to write anyway
+			if opts.Summary != nil {
+				opts.Summary.interrupted()
+			}
+			continue
+		}
+		// Filings that failed because the run was interrupted aren't counted
+		interrupted := result.err != nil && ctx.Err() != nil
+		if opts.Failures != nil && !interrupted {
+			if budgetErr = opts.Failures.Record(result.failure(), result.downloadFailed); budgetErr != nil {
+				cancel()
+				continue
+			}
+		}
+		if opts.Summary != nil && interrupted {
+			opts.Summary.interrupted()
+		} else if opts.Summary != nil {
+			opts.Summary.record(job.filing, result)
+		}
+		parsed := result.parsed
+		if parsed != nil && opts.Observe != nil {
+			opts.Observe(parsed)
+		}
+		if parsed != nil && wantsFilings {
+			if err := filingWriter.WriteFiling(ctx, parsed); err != nil {
+				log.Printf("Failed to write filing %s", parsed.Filing.AccessionNumber)
+				fatal(exitSink, err)
+			}
+		} else if parsed != nil {
+			for _, row := range parsed.Rows {
+				if err := out.Write(ctx, row); err != nil {
+					log.Printf("Failed to write row %+v", row.Values)
+					fatal(exitSink, err)
+				}
+			}
+		}
+		written++
+		infof("Processed %d/%d", written, len(filings))
+	}
+	parsing.Wait()
+	if budgetErr != nil {
+		return budgetErr
+	}
+	return ctx.Err()
+}
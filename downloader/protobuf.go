@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"google.golang.org/protobuf/encoding/protowire"
+)
+
+func init() {
+	RegisterSink("protobuf", openProtobuf)
+}
+
+// protobufWriter writes each filing as a length delimited sec4.form4.v1.Filing message, encoded by
+// hand against proto/sec4/form4/v1/form4.proto so the downloader needs no generated code. Keep the
+// field numbers here in step with it.
+type protobufWriter struct {
+	f     *os.File
+	comp  io.WriteCloser
+	buf   *bufio.Writer
+	extra []string
+	// written counts the filings written, and manifest is where it is listed
+	written  ManifestFile
+	manifest string
+
+	// size and msg are reused between filings
+	size, msg []byte
+}
+
+// openProtobuf is the protobuf sink, writing to -output (default form4_<year>_q<quarter>.binpb)
+// compressed per -compress or the extension
+func openProtobuf(ctx context.Context, opts SinkOptions) (RowWriter, error) {
+	for _, name := range []string{"partition", "columns", "max-rows", "max-bytes", "resume"} {
+		if flagIsSet(flag.CommandLine, name) {
+			return nil, fmt.Errorf("-%s does not apply to the protobuf sink", name)
+		}
+	}
+
+	path := opts.Target
+	compression := *compress
+	if compression == "" {
+		if f, err := DetectOutputFormat(path, "csv", ""); err == nil {
+			compression = f.Compression
+		}
+	} else if compression == "none" {
+		compression = ""
+	}
+	format := OutputFormat{Encoding: "binpb", Compression: compression}
+	if path == "" {
+		path = fmt.Sprintf("form4_%d_q%d", opts.Year, opts.Quarter) + format.Ext()
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &protobufWriter{f: f, extra: opts.Extra, written: ManifestFile{Path: path}, manifest: manifestPath(path, format)}
+	var dst io.Writer = f
+	if w.comp, err = newCompressor(f, compression); err != nil {
+		f.Close()
+		return nil, err
+	} else if w.comp != nil {
+		dst = w.comp
+	}
+	w.buf = bufio.NewWriter(dst)
+	return w, nil
+}
+
+func (w *protobufWriter) Write(ctx context.Context, row *Row) error {
+	return errors.New("the protobuf sink only accepts whole filings")
+}
+
+func (w *protobufWriter) WriteFiling(ctx context.Context, parsed *ParsedFiling) error {
+	w.msg = appendFiling(w.msg[:0], parsed, w.extra)
+	w.size = protowire.AppendVarint(w.size[:0], uint64(len(w.msg)))
+	if _, err := w.buf.Write(w.size); err != nil {
+		return err
+	}
+	if _, err := w.buf.Write(w.msg); err != nil {
+		return err
+	}
+	w.written.add(&Row{Filing: parsed.Filing})
+	return nil
+}
+
+// Manifest lists the file with a row per filing
+func (w *protobufWriter) Manifest() (string, []ManifestFile) {
+	return w.manifest, []ManifestFile{w.written}
+}
+
+func (w *protobufWriter) Close() error {
+	if err := w.buf.Flush(); err != nil {
+		w.f.Close()
+		return err
+	}
+	if w.comp != nil {
+		if err := w.comp.Close(); err != nil {
+			w.f.Close()
+			return err
+		}
+	}
+	return w.f.Close()
+}
+
+func appendFiling(b []byte, parsed *ParsedFiling, extra []string) []byte {
+	filing, od := parsed.Filing, parsed.Document
+	b = appendString(b, 1, filing.AccessionNumber)
+	b = appendString(b, 2, filing.FormType)
+	b = appendString(b, 3, isoDate(filing.DateFiled))
+	b = appendString(b, 4, filing.FileName)
+	b = appendString(b, 5, od.SchemaVersion)
+	b = appendString(b, 6, od.DocumentType)
+	b = appendString(b, 7, od.PeriodOfReport)
+
+	var issuer []byte
+	issuer = appendString(issuer, 1, od.Issuer.CIK)
+	issuer = appendString(issuer, 2, od.Issuer.Name)
+	issuer = appendString(issuer, 3, od.Issuer.TradingSymbol)
+	if c := parsed.Issuer; c != nil {
+		issuer = appendString(issuer, 4, c.StateOfIncorporation)
+		issuer = appendString(issuer, 5, c.FiscalYearEnd)
+		var address []byte
+		address = appendString(address, 1, c.BusinessAddress.Street1)
+		address = appendString(address, 2, c.BusinessAddress.Street2)
+		address = appendString(address, 3, c.BusinessAddress.City)
+		address = appendString(address, 4, c.BusinessAddress.StateOrCountry)
+		address = appendString(address, 5, c.BusinessAddress.ZipCode)
+		if len(address) > 0 {
+			issuer = appendMessage(issuer, 6, address)
+		}
+	}
+	b = appendMessage(b, 8, issuer)
+
+	for _, o := range od.ReportingOwners {
+		b = appendMessage(b, 9, appendOwner(nil, o))
+	}
+	for _, t := range selectedTransactions(od) {
+		b = appendMessage(b, 10, appendTransaction(nil, t, parsed.Splits, parsed.Ranks[t.TransactionIndex]))
+	}
+	for i, h := range od.NonDerivativeHoldings {
+		var m []byte
+		m = appendInt32(m, 1, int32(i))
+		m = appendString(m, 2, h.SecurityTitle)
+		m = appendString(m, 3, h.SharesOwnedFollowingTransaction)
+		m = appendString(m, 4, h.DirectOrIndirectOwnership)
+		m = appendString(m, 5, h.NatureOfOwnership)
+		m = appendString(m, 6, form4.ClassifyNatureOfOwnership(h.NatureOfOwnership))
+		b = appendMessage(b, 11, m)
+	}
+	for _, f := range od.Footnotes {
+		var m []byte
+		m = appendString(m, 1, f.ID)
+		m = appendString(m, 2, f.Text)
+		b = appendMessage(b, 12, m)
+	}
+	for i, column := range extra {
+		if i >= len(parsed.Extra) {
+			break
+		}
+		var entry []byte
+		entry = appendString(entry, 1, column)
+		entry = appendString(entry, 2, parsed.Extra[i])
+		b = appendMessage(b, 13, entry)
+	}
+	b = appendString(b, 14, filing.AcceptanceDateTime)
+	b = appendString(b, 15, parsed.SourceSHA256)
+	b = appendString(b, 16, parsed.SourceURL)
+	b = appendString(b, 17, parsed.DownloadedAt)
+	b = appendString(b, 18, parserVersion)
+	return b
+}
+
+func appendOwner(b []byte, o form4.ReportingOwner) []byte {
+	b = appendString(b, 1, o.CIK)
+	b = appendString(b, 2, o.Name)
+	b = appendBool(b, 3, isSet(o.IsDirector))
+	b = appendBool(b, 4, isSet(o.IsOfficer))
+	b = appendBool(b, 5, isSet(o.IsTenPercentOwner))
+	b = appendBool(b, 6, isSet(o.IsOther))
+	b = appendString(b, 7, o.City)
+	b = appendString(b, 8, o.State)
+	b = appendString(b, 9, o.OfficerTitle)
+	b = appendString(b, 10, form4.NormalizeOfficerTitle(o.OfficerTitle))
+	return b
+}
+
+func appendTransaction(b []byte, t form4.TransactionRow, splits []Split, rank valueRank) []byte {
+	b = appendInt32(b, 1, int32(t.TransactionIndex))
+	b = appendString(b, 2, t.SecurityTitle)
+	b = appendString(b, 3, t.TransactionDate)
+	b = appendString(b, 4, t.TransactionCode)
+	b = appendString(b, 5, t.Shares)
+	b = appendString(b, 6, t.PricePerShare)
+	b = appendString(b, 7, t.AcquiredDisposedCode)
+	b = appendString(b, 8, t.SharesOwnedFollowingTransaction)
+	b = appendString(b, 9, t.DirectOrIndirectOwnership)
+	b = appendString(b, 10, t.NatureOfOwnership)
+	b = appendString(b, 11, form4.ClassifyNatureOfOwnership(t.NatureOfOwnership))
+	b = appendString(b, 12, t.DeemedExecutionDate)
+	shares, price, owned := splitAdjusted(splits, t)
+	b = appendString(b, 13, shares)
+	b = appendString(b, 14, price)
+	b = appendString(b, 15, owned)
+	b = appendString(b, 16, rank.Overall)
+	b = appendString(b, 17, rank.Issuer)
+	b = appendString(b, 18, form4.ClassifyDirection(t.TransactionCode, t.AcquiredDisposedCode))
+	return b
+}
+
+// isSet reads a relationship flag, which filers write as 1/0 or true/false
+func isSet(flag string) bool {
+	return flag == "1" || strings.EqualFold(flag, "true")
+}
+
+// The append helpers leave out zero values, as proto3 encoders do
+
+func appendString(b []byte, num protowire.Number, v string) []byte {
+	if v == "" {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendString(b, v)
+}
+
+func appendBool(b []byte, num protowire.Number, v bool) []byte {
+	if !v {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, 1)
+}
+
+func appendInt32(b []byte, num protowire.Number, v int32) []byte {
+	if v == 0 {
+		return b
+	}
+	b = protowire.AppendTag(b, num, protowire.VarintType)
+	return protowire.AppendVarint(b, uint64(v))
+}
+
+func appendMessage(b []byte, num protowire.Number, m []byte) []byte {
+	b = protowire.AppendTag(b, num, protowire.BytesType)
+	return protowire.AppendBytes(b, m)
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"time"
+)
+
+// parserVersion is written with every row as PARSER_VERSION. Bump it whenever a change to parsing or
+// normalization changes the values written for the same document, so rows from before and after can
+// be told apart and the older ones reparsed.
+const parserVersion = "2"
+
+// downloadedAt is when a document was downloaded from EDGAR, as RFC 3339 in UTC. A document read
+// from the cache keeps the time it was first fetched, a re-download the time of the latest.
+func downloadedAt(url string) string {
+	fetched := time.Now()
+	if entry, ok := store.Lookup(url); ok {
+		fetched = entry.FetchedAt
+	}
+	return fetched.UTC().Format(time.RFC3339)
+}
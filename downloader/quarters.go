@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var (
+	periodSpec          = flag.String("period", fmt.Sprintf("%dQ%d", defaultYear, defaultQuarter), "quarters to download: a quarter like 2024Q1, a range like 2015Q1-2024Q4, or a comma separated list of either")
+	maxInflightQuarters = flag.Int("max-inflight-quarters", 1, "quarters downloaded at once, each with its own pipeline and sink, sharing the rate limit and the document cache")
+)
+
+// period is a quarter of a year
+type period struct {
+	Year, Quarter int
+}
+
+func (p period) String() string {
+	return fmt.Sprintf("%dQ%d", p.Year, p.Quarter)
+}
+
+// next is the quarter after p
+func (p period) next() period {
+	if p.Quarter == 4 {
+		return period{p.Year + 1, 1}
+	}
+	return period{p.Year, p.Quarter + 1}
+}
+
+func (p period) before(o period) bool {
+	return p.Year < o.Year || (p.Year == o.Year && p.Quarter < o.Quarter)
+}
+
+// parsePeriods reads -period, quarters and ranges of them separated by commas, e.g.
+// 2015Q1-2019Q4,2022Q2, in the order given
+func parsePeriods(spec string) ([]period, error) {
+	periods := []period{}
+	seen := map[period]bool{}
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		from, to, isRange := strings.Cut(item, "-")
+		if !isRange {
+			to = from
+		}
+		y, q, err := parsePeriod(strings.TrimSpace(from))
+		if err != nil {
+			return nil, fmt.Errorf("-period: %w", err)
+		}
+		first := period{y, q}
+		if y, q, err = parsePeriod(strings.TrimSpace(to)); err != nil {
+			return nil, fmt.Errorf("-period: %w", err)
+		}
+		last := period{y, q}
+		if last.before(first) {
+			return nil, fmt.Errorf("-period: %s ends before it starts", item)
+		}
+		for p := first; !last.before(p); p = p.next() {
+			if seen[p] {
+				return nil, fmt.Errorf("-period: %s is listed more than once", p)
+			}
+			seen[p] = true
+			periods = append(periods, p)
+		}
+	}
+	return periods, nil
+}
+
+// hasPeriodPlaceholder is whether path has a {year} or {quarter} placeholder, which periodTarget
+// fills in so each quarter gets its own
+func hasPeriodPlaceholder(path string) bool {
+	return strings.Contains(path, "{year}") || strings.Contains(path, "{quarter}")
+}
+
+// periodTarget fills in the {year} and {quarter} placeholders of path with p's
+func periodTarget(path string, p period) string {
+	return strings.NewReplacer("{year}", strconv.Itoa(p.Year), "{quarter}", strconv.Itoa(p.Quarter)).Replace(path)
+}
+
+// checkQuarterTargets fails if the quarters of a run would write over each other's output, because
+// they would go to the same files without a {year} or {quarter} placeholder to tell them apart
+func checkQuarterTargets(sinkName string, periods []period) error {
+	if *maxInflightQuarters < 1 {
+		return fmt.Errorf("-max-inflight-quarters must be at least 1")
+	}
+	if *maxInflightQuarters > 1 && *percentileMonths > 0 {
+		return fmt.Errorf("-percentile-months ranks filings by those before them, which needs -max-inflight-quarters 1")
+	}
+	if len(periods) < 2 {
+		return nil
+	}
+	if *accessionsPath != "" {
+		return fmt.Errorf("-accessions lists the filings to download, it can't be used with several quarters")
+	}
+	if *sectorRollupPath != "" && !hasPeriodPlaceholder(*sectorRollupPath) {
+		return fmt.Errorf("-sector-rollup needs a {year} or {quarter} placeholder to download several quarters")
+	}
+	if *filingRollupPath != "" && !hasPeriodPlaceholder(*filingRollupPath) {
+		return fmt.Errorf("-filing-rollup needs a {year} or {quarter} placeholder to download several quarters")
+	}
+	if *insiderRollupPath != "" && !hasPeriodPlaceholder(*insiderRollupPath) {
+		return fmt.Errorf("-insider-rollup needs a {year} or {quarter} placeholder to download several quarters")
+	}
+	if *issuerRollupPath != "" && !hasPeriodPlaceholder(*issuerRollupPath) {
+		return fmt.Errorf("-issuer-rollup needs a {year} or {quarter} placeholder to download several quarters")
+	}
+
+	output, placeholder := *outputPath, hasPeriodPlaceholder(*outputPath)
+	switch sinkName {
+	case "file":
+		switch {
+		case output == "-":
+			if *maxInflightQuarters > 1 {
+				return fmt.Errorf("-output - streams one quarter at a time, it needs -max-inflight-quarters 1")
+			}
+			return nil
+		case output == "" && *partition == "":
+			// Each quarter has its own default file
+			return nil
+		}
+	case "protobuf":
+		if output == "" {
+			return nil
+		}
+	case "influxdb":
+		if output == "" || isHTTPURL(output) {
+			return nil
+		}
+	case "tables":
+	case "delta", "search":
+		// Quarters can share a table or an index, but only one can write to it at once
+		if *maxInflightQuarters == 1 {
+			return nil
+		}
+		if !placeholder {
+			return fmt.Errorf("quarters can't write to the same %s sink at once, pass -max-inflight-quarters 1 or an -output with a {year} or {quarter} placeholder", sinkName)
+		}
+	default:
+		return nil
+	}
+	if !placeholder {
+		return fmt.Errorf("-output needs a {year} or {quarter} placeholder for the %s sink to download several quarters, e.g. -output out/{year}Q{quarter}", sinkName)
+	}
+	return nil
+}
+
+// forEachPeriod calls fn with each of periods and its index, inflight of them at once. Once ctx is
+// done, the quarters yet to start are skipped.
+func forEachPeriod(ctx context.Context, periods []period, inflight int, fn func(i int, p period)) {
+	sem := make(chan struct{}, inflight)
+	var wg sync.WaitGroup
+	for i, p := range periods {
+		sem <- struct{}{}
+		if ctx.Err() != nil {
+			break
+		}
+		wg.Add(1)
+		go func(i int, p period) {
+			defer func() {
+				<-sem
+				wg.Done()
+			}()
+			fn(i, p)
+		}(i, p)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,204 @@
+//go:build cgo
+
+package main
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	_ "github.com/marcboeker/go-duckdb"
+)
+
+func runQuery(args []string) {
+	fs := flag.NewFlagSet("query", flag.ExitOnError)
+	input := fs.String("input", "form4_*.csv", "output files the form4 view reads, a path or glob of csv or parquet files")
+	outputFormat := fs.String("format", "table", "how to print results: table, csv or jsonl")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal(`Usage: query [-input glob] [-format table|csv|jsonl] "<SQL>", e.g. query "SELECT ISSUER_TICKER, count(*) FROM form4 GROUP BY 1"`)
+	}
+
+	db, err := sql.Open("duckdb", "")
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	// The view is only made when the input exists, other files can always be queried by path
+	if matches, _ := filepath.Glob(*input); len(matches) > 0 {
+		reader, err := duckdbReader(*input)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if _, err = db.Exec("CREATE VIEW form4 AS SELECT * FROM " + reader); err != nil {
+			log.Printf("Failed to read %s", *input)
+			log.Fatal(err)
+		}
+	}
+
+	// The ticker history of the runs so far links an issuer's current ticker to its former ones
+	// So are the rolling totals of net insider buying per issuer. Encrypted ones are read from a
+	// decrypted copy, which is removed once the query is done.
+	for view, path := range map[string]string{"ticker_history": tickerHistoryPath(), "rolling_net_buying": rollingPath()} {
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		plain, done, err := plainStateFile(path)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer done()
+		reader, _ := duckdbReader(plain)
+		if _, err = db.Exec("CREATE VIEW " + view + " AS SELECT * FROM " + reader); err != nil {
+			log.Printf("Failed to read %s", path)
+			log.Fatal(err)
+		}
+	}
+
+	rows, err := db.Query(fs.Arg(0))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer rows.Close()
+	columns, err := rows.Columns()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	printer, err := newResultPrinter(*outputFormat, columns)
+	if err != nil {
+		log.Fatal(err)
+	}
+	values := make([]interface{}, len(columns))
+	pointers := make([]interface{}, len(columns))
+	for i := range values {
+		pointers[i] = &values[i]
+	}
+	for rows.Next() {
+		if err = rows.Scan(pointers...); err != nil {
+			log.Fatal(err)
+		}
+		if err = printer.print(values); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if err = rows.Err(); err != nil {
+		log.Fatal(err)
+	}
+	if err = printer.flush(); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// hivePath matches paths with a key=value directory of the Hive partition layout
+var hivePath = regexp.MustCompile(`(^|/)[A-Za-z_]+=[^/]*/`)
+
+// duckdbReader is the table function that reads files like path, picked by their extension. CSV may
+// be gzip or zstd compressed. The bundled DuckDB has no JSON extension, so jsonl outputs can't be read.
+// The keys of a Hive partition layout are read from its directories as columns.
+func duckdbReader(path string) (string, error) {
+	literal := "'" + strings.ReplaceAll(path, "'", "''") + "'"
+	options := ""
+	if matches, _ := filepath.Glob(path); len(matches) > 0 && hivePath.MatchString(filepath.ToSlash(matches[0])) {
+		options = ", hive_partitioning=true"
+	}
+	name := strings.ToLower(path)
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".gz"), ".zst")
+	switch {
+	case strings.HasSuffix(name, ".parquet"):
+		return "read_parquet(" + literal + options + ")", nil
+	case strings.HasSuffix(name, ".jsonl"), strings.HasSuffix(name, ".json"):
+		return "", fmt.Errorf("%s is jsonl, only csv and parquet outputs can be queried", path)
+	}
+	return "read_csv_auto(" + literal + ", header=true" + options + ")", nil
+}
+
+// resultPrinter writes query results to stdout in one of the -format encodings
+type resultPrinter struct {
+	format  string
+	columns []string
+	table   *tabwriter.Writer
+	csv     *csv.Writer
+	json    *json.Encoder
+}
+
+func newResultPrinter(format string, columns []string) (*resultPrinter, error) {
+	p := &resultPrinter{format: format, columns: columns}
+	switch format {
+	case "table":
+		p.table = tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(p.table, strings.Join(columns, "\t"))
+	case "csv":
+		p.csv = csv.NewWriter(os.Stdout)
+		return p, p.csv.Write(columns)
+	case "jsonl":
+		p.json = json.NewEncoder(os.Stdout)
+	default:
+		return nil, fmt.Errorf("unknown format %q, expected table, csv or jsonl", format)
+	}
+	return p, nil
+}
+
+func (p *resultPrinter) print(values []interface{}) error {
+	if p.json != nil {
+		object := orderedObject{}
+		for i, column := range p.columns {
+			v := values[i]
+			if t, ok := v.(time.Time); ok {
+				v = formatValue(t)
+			}
+			object = append(object, keyValue{column, v})
+		}
+		return p.json.Encode(object)
+	}
+
+	s := make([]string, len(values))
+	for i, v := range values {
+		s[i] = formatValue(v)
+	}
+	if p.csv != nil {
+		return p.csv.Write(s)
+	}
+	_, err := fmt.Fprintln(p.table, strings.Join(s, "\t"))
+	return err
+}
+
+func (p *resultPrinter) flush() error {
+	switch {
+	case p.csv != nil:
+		p.csv.Flush()
+		return p.csv.Error()
+	case p.table != nil:
+		return p.table.Flush()
+	}
+	return nil
+}
+
+// formatValue prints a result value for the table and csv formats, with NULL as an empty value
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case time.Time:
+		if v.Hour() == 0 && v.Minute() == 0 && v.Second() == 0 && v.Nanosecond() == 0 {
+			return v.Format("2006-01-02")
+		}
+		return v.Format(time.RFC3339)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,10 @@
+//go:build !cgo
+
+package main
+
+import "log"
+
+// runQuery needs DuckDB, which is linked in through cgo
+func runQuery(args []string) {
+	log.Fatal("query is not available in this build, rebuild with CGO_ENABLED=1")
+}
@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+)
+
+// queuePriorities are the queues jobs are taken from, each emptied before the next
+var queuePriorities = []string{"high", "default", "low"}
+
+const (
+	// queueLease is how long a worker's hold on a job lasts without being renewed, after which
+	// another worker puts the job back on its queue
+	queueLease = time.Minute
+	// queuePoll is how long a worker waits before looking again when every queue is empty
+	queuePoll = time.Second
+)
+
+// queuedJob is a download or reparse run waiting on a queue in -redis, for a queue worker to run
+type queuedJob struct {
+	ID string `json:"id"`
+	// Args are the flags and command of the run, after the worker's own flags so they win
+	Args       []string  `json:"args"`
+	Priority   string    `json:"priority"`
+	Retries    int       `json:"retries"`
+	Attempts   int       `json:"attempts"`
+	EnqueuedAt time.Time `json:"enqueued_at"`
+	LastError  string    `json:"last_error,omitempty"`
+}
+
+func queueKey(name string) string {
+	return *redisPrefix + "queue:" + name
+}
+
+func runQueueCommand(ctx context.Context, args []string) {
+	if len(args) == 0 {
+		log.Println("Missing queue subcommand")
+		usage()
+		os.Exit(exitUsage)
+	}
+	if sharedCache == nil {
+		fatal(exitConfig, "The queue commands need -redis")
+	}
+
+	switch args[0] {
+	case "add":
+		runQueueAdd(args[1:])
+	case "work":
+		runQueueWork(ctx, args[1:])
+	case "list":
+		runQueueList(args[1:])
+	case "retry":
+		runQueueRetry(args[1:])
+	default:
+		log.Printf("Unknown queue subcommand %q", args[0])
+		usage()
+		os.Exit(exitUsage)
+	}
+}
+
+func runQueueAdd(args []string) {
+	fs := flag.NewFlagSet("queue add", flag.ExitOnError)
+	priority := fs.String("priority", "default", "queue to add the job to, high, default or low")
+	retries := fs.Int("retries", 3, "times the job is run again after failing, before it is left on the dead queue")
+	fs.Parse(args)
+	usageLine := "Usage: queue add [-priority high|default|low] [-retries n] -- [flags] download|reparse"
+	if fs.NArg() == 0 {
+		log.Fatal(usageLine)
+	}
+	if command := fs.Arg(fs.NArg() - 1); command != "download" && command != "reparse" {
+		fatalf(exitUsage, "Only download and reparse runs can be queued, not %q\n%s", command, usageLine)
+	}
+	if !isQueuePriority(*priority) {
+		fatalf(exitUsage, "-priority must be high, default or low, not %q", *priority)
+	}
+
+	job := queuedJob{ID: gonanoid.Must(), Args: fs.Args(), Priority: *priority, Retries: *retries, EnqueuedAt: time.Now().UTC()}
+	content, err := json.Marshal(job)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if _, err := sharedCache.do("LPUSH", queueKey(job.Priority), string(content)); err != nil {
+		log.Println("Failed to add the job")
+		log.Fatal(err)
+	}
+	fmt.Println(job.ID)
+}
+
+func isQueuePriority(priority string) bool {
+	for _, p := range queuePriorities {
+		if p == priority {
+			return true
+		}
+	}
+	return false
+}
+
+// queueWorker runs the jobs it takes off the queues, each as its own process like the daemon's runs
+type queueWorker struct {
+	executable string
+	// flags are the worker's global flags, which the runs start with
+	flags []string
+
+	mu sync.Mutex
+	// running are the raw jobs being run, as they are on the active list
+	running map[string]*queuedJob
+	// orphans are the jobs on the active list no worker held the lease of at the last look, which are
+	// put back if none holds it at the next either
+	orphans map[string]bool
+}
+
+func runQueueWork(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("queue work", flag.ExitOnError)
+	concurrency := fs.Int("concurrency", 1, "jobs to run at once, they share -redis-rate-limit if set but not the process's own rate limit")
+	fs.Parse(args)
+
+	executable, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	w := &queueWorker{executable: executable, flags: append(append([]string{}, os.Args[1:len(os.Args)-len(flag.Args())]...), "-log-file="), running: map[string]*queuedJob{}, orphans: map[string]bool{}}
+	go w.keepLeases(ctx)
+
+	var wg sync.WaitGroup
+	for i := 0; i < *concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				raw, job, err := w.take()
+				if err != nil {
+					log.Printf("Failed to take a job off the queue, %s", err)
+				}
+				if job == nil {
+					select {
+					case <-ctx.Done():
+					case <-time.After(queuePoll):
+					}
+					continue
+				}
+				w.run(ctx, raw, job)
+			}
+		}()
+	}
+	infof("Waiting for jobs on the %s queues", strings.Join(queuePriorities, ", "))
+	wg.Wait()
+}
+
+// take moves the next job onto the active list and takes a lease on it, nil if every queue is empty
+func (w *queueWorker) take() (string, *queuedJob, error) {
+	for _, priority := range queuePriorities {
+		reply, err := sharedCache.do("RPOPLPUSH", queueKey(priority), queueKey("active"))
+		if err != nil {
+			return "", nil, err
+		}
+		raw, ok := reply.(string)
+		if !ok {
+			continue
+		}
+		job := &queuedJob{}
+		if err := json.Unmarshal([]byte(raw), job); err != nil {
+			log.Printf("Moving a job that can't be read to the dead queue, %s", err)
+			w.settle(raw, "dead")
+			continue
+		}
+		w.mu.Lock()
+		w.running[raw] = job
+		w.mu.Unlock()
+		w.renew(job)
+		return raw, job, nil
+	}
+	return "", nil, nil
+}
+
+func (w *queueWorker) renew(job *queuedJob) {
+	if _, err := sharedCache.do("SET", queueKey("lease:"+job.ID), "1", "PX", strconv.FormatInt(queueLease.Milliseconds(), 10)); err != nil {
+		log.Printf("Failed to renew the lease on job %s, %s", job.ID, err)
+	}
+}
+
+// keepLeases renews the leases of the jobs running until ctx is done, and puts back the jobs of
+// workers that died holding them
+func (w *queueWorker) keepLeases(ctx context.Context) {
+	ticker := time.NewTicker(queueLease / 3)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		w.mu.Lock()
+		for _, job := range w.running {
+			w.renew(job)
+		}
+		w.mu.Unlock()
+		w.recoverOrphans()
+	}
+}
+
+// recoverOrphans puts the jobs on the active list whose lease has lapsed twice in a row back on their
+// queue. Twice, since a worker takes the lease just after moving a job onto the list.
+func (w *queueWorker) recoverOrphans() {
+	reply, err := sharedCache.do("LRANGE", queueKey("active"), "0", "-1")
+	if err != nil {
+		log.Printf("Failed to list the active jobs, %s", err)
+		return
+	}
+	items, _ := reply.([]interface{})
+	orphans := map[string]bool{}
+	for _, item := range items {
+		raw, _ := item.(string)
+		job := &queuedJob{}
+		if json.Unmarshal([]byte(raw), job) != nil {
+			continue
+		}
+		leased, err := sharedCache.do("EXISTS", queueKey("lease:"+job.ID))
+		if err != nil || leased != int64(0) {
+			continue
+		}
+		if !w.orphans[raw] {
+			orphans[raw] = true
+			continue
+		}
+		log.Printf("Putting job %s back on the %s queue, its worker stopped renewing it", job.ID, job.Priority)
+		w.settle(raw, job.Priority)
+	}
+	w.orphans = orphans
+}
+
+// run runs a job, then takes it off the active list to be retried, dropped on the dead queue or
+// forgotten once done
+func (w *queueWorker) run(ctx context.Context, raw string, job *queuedJob) {
+	defer func() {
+		w.mu.Lock()
+		delete(w.running, raw)
+		w.mu.Unlock()
+		sharedCache.do("DEL", queueKey("lease:"+job.ID))
+	}()
+
+	job.Attempts++
+	infof("Running job %s, attempt %d of %d: %s", job.ID, job.Attempts, job.Retries+1, strings.Join(job.Args, " "))
+	cmd := exec.Command(w.executable, append(append([]string{}, w.flags...), job.Args...)...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, log.Writer()
+	started := time.Now()
+	err := cmd.Start()
+	if err == nil {
+		done := make(chan error, 1)
+		go func() { done <- cmd.Wait() }()
+		select {
+		case err = <-done:
+		case <-ctx.Done():
+			cmd.Process.Signal(os.Interrupt)
+			err = <-done
+		}
+	}
+
+	code := 0
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		code = exitErr.ExitCode()
+	} else if err != nil {
+		code = exitError
+	}
+	switch {
+	case code == exitOK || code == exitPartial:
+		infof("Job %s finished in %s", job.ID, time.Since(started).Round(time.Second))
+		w.settle(raw, "")
+	case code == exitInterrupted || ctx.Err() != nil:
+		// The worker is stopping, the job goes back to the front of its queue for the next one
+		log.Printf("Job %s was interrupted, putting it back on the %s queue", job.ID, job.Priority)
+		job.Attempts--
+		w.requeue(raw, job, job.Priority, true)
+	case code == exitUsage || code == exitConfig || job.Attempts > job.Retries:
+		// A bad flag fails every time, it isn't retried
+		log.Printf("Job %s failed with exit code %d, moving it to the dead queue", job.ID, code)
+		job.LastError = fmt.Sprintf("exit code %d: %s", code, err)
+		w.requeue(raw, job, "dead", false)
+	default:
+		log.Printf("Job %s failed with exit code %d, retrying it after the others on the %s queue", job.ID, code, job.Priority)
+		job.LastError = fmt.Sprintf("exit code %d: %s", code, err)
+		w.requeue(raw, job, job.Priority, false)
+	}
+}
+
+// requeue takes a job off the active list and pushes it as it is now onto queue, at the front to be
+// taken next or at the back
+func (w *queueWorker) requeue(raw string, job *queuedJob, queue string, front bool) {
+	content, err := json.Marshal(job)
+	if err != nil {
+		log.Printf("Failed to encode job %s, %s", job.ID, err)
+		return
+	}
+	push := "LPUSH"
+	if front {
+		push = "RPUSH"
+	}
+	if _, err := sharedCache.do(push, queueKey(queue), string(content)); err != nil {
+		log.Printf("Failed to put job %s back on the %s queue, %s", job.ID, queue, err)
+		return
+	}
+	w.settle(raw, "")
+}
+
+// settle takes a raw job off the active list, pushing it onto queue unless it is empty
+func (w *queueWorker) settle(raw, queue string) {
+	removed, err := sharedCache.do("LREM", queueKey("active"), "1", raw)
+	if err != nil {
+		log.Printf("Failed to take a job off the active list, %s", err)
+		return
+	}
+	if queue == "" || removed != int64(1) {
+		return
+	}
+	if _, err := sharedCache.do("LPUSH", queueKey(queue), raw); err != nil {
+		log.Printf("Failed to put a job on the %s queue, %s", queue, err)
+	}
+}
+
+func runQueueList(args []string) {
+	fs := flag.NewFlagSet("queue list", flag.ExitOnError)
+	fs.Parse(args)
+	for _, queue := range append(append([]string{}, queuePriorities...), "active", "dead") {
+		reply, err := sharedCache.do("LRANGE", queueKey(queue), "0", "-1")
+		if err != nil {
+			log.Fatal(err)
+		}
+		items, _ := reply.([]interface{})
+		fmt.Printf("%s: %d jobs\n", queue, len(items))
+		// Lists are pushed on the left and taken from the right, so the next job is last
+		for i := len(items) - 1; i >= 0; i-- {
+			raw, _ := items[i].(string)
+			job := &queuedJob{}
+			if err := json.Unmarshal([]byte(raw), job); err != nil {
+				fmt.Printf("  %s\n", raw)
+				continue
+			}
+			fmt.Printf("  %s  attempts %d/%d  %s", job.ID, job.Attempts, job.Retries+1, strings.Join(job.Args, " "))
+			if job.LastError != "" {
+				fmt.Printf("  (%s)", job.LastError)
+			}
+			fmt.Println()
+		}
+	}
+}
+
+func runQueueRetry(args []string) {
+	fs := flag.NewFlagSet("queue retry", flag.ExitOnError)
+	fs.Parse(args)
+	retried := 0
+	for {
+		reply, err := sharedCache.do("RPOP", queueKey("dead"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		raw, ok := reply.(string)
+		if !ok {
+			break
+		}
+		job := &queuedJob{}
+		if err := json.Unmarshal([]byte(raw), job); err != nil || !isQueuePriority(job.Priority) {
+			log.Printf("Dropping a dead job that can't be read: %s", raw)
+			continue
+		}
+		job.Attempts, job.LastError = 0, ""
+		content, _ := json.Marshal(job)
+		if _, err := sharedCache.do("LPUSH", queueKey(job.Priority), string(content)); err != nil {
+			log.Fatal(err)
+		}
+		retried++
+	}
+	infof("Put %d dead jobs back on their queues", retried)
+}
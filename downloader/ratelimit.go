@@ -0,0 +1,87 @@
+package main
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// rateLimit is how many requests a client may make, each a token bucket refilled at Rate a second up to
+// Burst, and at most DailyQuota a UTC day. Zero leaves either unlimited.
+type rateLimit struct {
+	Rate       float64
+	Burst      int
+	DailyQuota int
+}
+
+// clientBucket is what a client has used of its rateLimit
+type clientBucket struct {
+	tokens float64
+	last   time.Time
+	day    string
+	used   int
+}
+
+// rateLimiter keeps a bucket per client, an API key or the address of a request without one
+type rateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*clientBucket
+	now     func() time.Time
+}
+
+func newRateLimiter() *rateLimiter {
+	return &rateLimiter{buckets: map[string]*clientBucket{}, now: time.Now}
+}
+
+// maxIdleBuckets is how many buckets are kept before those of clients idle for a day are dropped
+const maxIdleBuckets = 10000
+
+// allow takes a request from client's bucket, returning how long to wait before retrying if it is
+// empty or the client's daily quota is used up
+func (l *rateLimiter) allow(client string, limit rateLimit) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if len(l.buckets) > maxIdleBuckets {
+		for c, b := range l.buckets {
+			if now.Sub(b.last) > 24*time.Hour {
+				delete(l.buckets, c)
+			}
+		}
+	}
+
+	b := l.buckets[client]
+	if b == nil {
+		b = &clientBucket{tokens: float64(limit.Burst), last: now}
+		l.buckets[client] = b
+	}
+	if day := now.UTC().Format("2006-01-02"); day != b.day {
+		b.day, b.used = day, 0
+	}
+	if limit.DailyQuota > 0 && b.used >= limit.DailyQuota {
+		tomorrow := now.UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+		return false, tomorrow.Sub(now)
+	}
+	if limit.Rate > 0 {
+		b.tokens = math.Min(float64(limit.Burst), b.tokens+now.Sub(b.last).Seconds()*limit.Rate)
+		b.last = now
+		if b.tokens < 1 {
+			return false, time.Duration((1 - b.tokens) / limit.Rate * float64(time.Second))
+		}
+		b.tokens--
+	}
+	b.last = now
+	b.used++
+	return true, 0
+}
+
+// clientAddress is the IP address a request came from, RemoteAddr without its port
+func clientAddress(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
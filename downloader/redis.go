@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	redisURL    = flag.String("redis", "", "redis://[:password@]host:6379/db to share data.sec.gov lookups, and with -redis-rate-limit the request rate, with other instances through, rediss:// for TLS (default none)")
+	redisPrefix = flag.String("redis-prefix", "sec4:", "prefix of the keys written to -redis")
+	redisTTL    = flag.Duration("redis-ttl", 24*time.Hour, "how long lookups shared through -redis are kept, they change with every filing")
+	redisDedupe = flag.Bool("redis-dedupe", false, "skip the filings another instance sharing -redis has written, and share those this one writes")
+)
+
+// sharedCache is the Redis the reference data looked up from data.sec.gov, and the request slots of
+// -redis-rate-limit, are shared through, nil without -redis
+var sharedCache *redisCache
+
+// redisCache is a minimal Redis client for GET and SET over a single connection, redialed after an
+// error. It is only a cache, callers fall back to fetching or pacing requests on their own when it fails.
+type redisCache struct {
+	addr, host, user, password string
+	db                         int
+	tls                        bool
+
+	mu   sync.Mutex
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+// setupRedis connects to -redis, else the config's redis, if either is set
+func setupRedis() error {
+	target := cfg.Redis
+	if flagIsSet(flag.CommandLine, "redis") {
+		target = *redisURL
+	}
+	if target == "" {
+		return nil
+	}
+	c, err := openRedisCache(target)
+	if err != nil {
+		return err
+	}
+	sharedCache = c
+	return nil
+}
+
+// openRedisCache connects to the Redis at a redis:// or rediss:// URL, failing if it can't be reached
+func openRedisCache(rawURL string) (*redisCache, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid -redis URL: %w", err)
+	}
+	if u.Scheme != "redis" && u.Scheme != "rediss" {
+		return nil, fmt.Errorf("-redis must be a redis:// or rediss:// URL, not %s", rawURL)
+	}
+	c := &redisCache{addr: u.Host, host: u.Hostname(), tls: u.Scheme == "rediss"}
+	if u.Port() == "" {
+		c.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if u.User != nil {
+		c.user = u.User.Username()
+		c.password, _ = u.User.Password()
+	}
+	if db := strings.Trim(u.Path, "/"); db != "" {
+		if c.db, err = strconv.Atoi(db); err != nil {
+			return nil, fmt.Errorf("-redis database must be a number, not %q", db)
+		}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if err := c.dial(); err != nil {
+		return nil, fmt.Errorf("error connecting to redis at %s: %w", c.addr, err)
+	}
+	return c, nil
+}
+
+// dial connects, authenticates and selects the database, with c.mu held
+func (c *redisCache) dial() error {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	var conn net.Conn
+	var err error
+	if c.tls {
+		conn, err = tls.DialWithDialer(dialer, "tcp", c.addr, &tls.Config{ServerName: c.host})
+	} else {
+		conn, err = dialer.Dial("tcp", c.addr)
+	}
+	if err != nil {
+		return err
+	}
+	c.conn, c.r = conn, bufio.NewReader(conn)
+	if c.password != "" {
+		args := []string{"AUTH", c.password}
+		if c.user != "" {
+			args = []string{"AUTH", c.user, c.password}
+		}
+		if _, err := c.roundTrip(args...); err != nil {
+			c.reset()
+			return err
+		}
+	}
+	if c.db != 0 {
+		if _, err := c.roundTrip("SELECT", strconv.Itoa(c.db)); err != nil {
+			c.reset()
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *redisCache) reset() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+	c.conn, c.r = nil, nil
+}
+
+// do sends a command and reads its reply, reconnecting first if the last command failed
+func (c *redisCache) do(args ...string) (interface{}, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.conn == nil {
+		if err := c.dial(); err != nil {
+			return nil, err
+		}
+	}
+	reply, err := c.roundTrip(args...)
+	var redisErr redisError
+	if err != nil && !errors.As(err, &redisErr) {
+		// The connection is in an unknown state after a network error
+		c.reset()
+	}
+	return reply, err
+}
+
+// redisError is an error reply, which leaves the connection usable
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+func (c *redisCache) roundTrip(args ...string) (interface{}, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	c.conn.SetDeadline(time.Now().Add(10 * time.Second))
+	if _, err := io.WriteString(c.conn, b.String()); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+// readReply reads a RESP reply: a string for simple and bulk strings, nil for a nil bulk string, an
+// int64 for integers and a slice for arrays
+func (c *redisCache) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("redis: empty reply")
+	}
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, redisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return string(buf[:n]), nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				return nil, err
+			}
+		}
+		return items, nil
+	}
+	return nil, fmt.Errorf("redis: unexpected reply %q", line)
+}
+
+// get returns the value of the prefixed key, false if there is none or Redis failed, which is logged
+func (c *redisCache) get(key string) ([]byte, bool) {
+	reply, err := c.do("GET", *redisPrefix+key)
+	if err != nil {
+		log.Printf("Failed to read %s from redis, %s", key, err)
+		return nil, false
+	}
+	s, ok := reply.(string)
+	return []byte(s), ok
+}
+
+// set stores value under the prefixed key for -redis-ttl, logging if Redis failed
+func (c *redisCache) set(key string, value []byte) {
+	args := []string{"SET", *redisPrefix + key, string(value)}
+	if *redisTTL > 0 {
+		args = append(args, "PX", strconv.FormatInt(redisTTL.Milliseconds(), 10))
+	}
+	if _, err := c.do(args...); err != nil {
+		log.Printf("Failed to write %s to redis, %s", key, err)
+	}
+}
+
+// claim sets the prefixed key to value for ttl, or for good if it is 0, only if it isn't set,
+// returning whether it was
+func (c *redisCache) claim(key, value string, ttl time.Duration) (bool, error) {
+	args := []string{"SET", *redisPrefix + key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	reply, err := c.do(args...)
+	return reply == "OK", err
+}
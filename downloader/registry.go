@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/shopspring/decimal"
+)
+
+// Extractor adds output columns computed from each parsed filing. Register one from an init func in
+// its own file to add fields (enrichment, proprietary lookups, ...) without touching the parser.
+type Extractor interface {
+	// Columns are the names of the columns the extractor adds, in the order Extract returns them
+	Columns() []string
+	// Extract returns one value per column for the filing. It is called from several workers at once
+	// and must be safe for concurrent use.
+	Extract(ctx context.Context, filing *edgar.IndexEntry, doc *xmlquery.Node) ([]string, error)
+}
+
+// CorporateActionProvider supplies the stock splits the split adjusted columns are computed from.
+// Register one from an init func in its own file, like an extractor, to adjust with a vendor's data.
+// A provider that also has a Setup(ctx context.Context) error method is set up before the run starts,
+// and the run fails if that does.
+type CorporateActionProvider interface {
+	// Splits returns every split of the issuer, in any order, and none if it has had none. It is called
+	// from several workers at once and must be safe for concurrent use.
+	Splits(ctx context.Context, issuerCIK string) ([]Split, error)
+}
+
+// Split is a stock split or reverse split
+type Split struct {
+	// ExDate is the first day the shares traded split, YYYY-MM-DD
+	ExDate string
+	// Ratio is the shares after the split per share before it, 2 for a 2-for-1 split and 0.1 for a
+	// 1-for-10 reverse split
+	Ratio decimal.Decimal
+}
+
+// SinkOptions are passed to a sink when it is opened
+type SinkOptions struct {
+	// Target is the -output value, its meaning is up to the sink (a path, a DSN, ...)
+	Target string
+	// Header is the full set of column names that Row.Values line up with
+	Header []string
+	// Extra are the columns added by extractors, which end Header and ParsedFiling.Extra lines up with
+	Extra []string
+	// Year and Quarter are the quarter whose filings are written
+	Year, Quarter int
+}
+
+// SinkFactory opens a sink that rows are written to
+type SinkFactory func(ctx context.Context, opts SinkOptions) (RowWriter, error)
+
+// ParsedFiling is everything parsed from one filing
+type ParsedFiling struct {
+	Filing   *edgar.IndexEntry
+	Document *form4.OwnershipDocument
+	// SourceURL is the submission text file the filing was parsed from, SourceSHA256 its hex SHA-256
+	// and DownloadedAt when it was downloaded, RFC 3339 in UTC
+	SourceURL    string
+	SourceSHA256 string
+	DownloadedAt string
+	// Extra are the extractors' values for the filing, shared by each of its rows
+	Extra []string
+	// Issuer is what EDGAR has on the issuer beyond the document's name and ticker, nil if nothing
+	Issuer *edgar.Company
+	// Splits are the issuer's splits from the -corporate-actions provider, nil when there is none or
+	// it failed, which leaves the split adjusted columns empty
+	Splits []Split
+	// Ranks are the dollar value percentiles of the transactions by TransactionIndex, set just before the
+	// filing is written with -percentile-months
+	Ranks map[int]valueRank
+	// Rows are the flattened transactions that have every required field
+	Rows []*Row
+}
+
+// FilingWriter is implemented by sinks that want whole parsed filings rather than flattened rows,
+// like the normalized tables sink. WriteFiling is called instead of Write for them.
+type FilingWriter interface {
+	RowWriter
+	WriteFiling(ctx context.Context, parsed *ParsedFiling) error
+}
+
+var (
+	registryMu sync.RWMutex
+	extractors = map[string]Extractor{}
+	sinks      = map[string]SinkFactory{}
+	providers  = map[string]CorporateActionProvider{}
+)
+
+// RegisterExtractor makes an extractor available to -extractors under name. It panics if the name
+// is taken, like database/sql.Register.
+func RegisterExtractor(name string, e Extractor) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := extractors[name]; exists {
+		panic("extractor already registered: " + name)
+	}
+	extractors[name] = e
+}
+
+// RegisterSink makes a sink available to -sink under name. It panics if the name is taken.
+func RegisterSink(name string, f SinkFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := sinks[name]; exists {
+		panic("sink already registered: " + name)
+	}
+	sinks[name] = f
+}
+
+// RegisterCorporateActionProvider makes a provider available to -corporate-actions under name. It
+// panics if the name is taken.
+func RegisterCorporateActionProvider(name string, p CorporateActionProvider) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if _, exists := providers[name]; exists {
+		panic("corporate action provider already registered: " + name)
+	}
+	providers[name] = p
+}
+
+// LookupCorporateActionProvider returns the named provider
+func LookupCorporateActionProvider(name string) (CorporateActionProvider, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	p, ok := providers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown corporate action provider %q, registered: %s", name, strings.Join(registeredNames(providers), ", "))
+	}
+	return p, nil
+}
+
+// LookupExtractors returns the named extractors in order
+func LookupExtractors(names []string) ([]Extractor, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	found := []Extractor{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		e, ok := extractors[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown extractor %q, registered: %s", name, strings.Join(registeredNames(extractors), ", "))
+		}
+		found = append(found, e)
+	}
+	return found, nil
+}
+
+// OpenSink opens the named sink
+func OpenSink(ctx context.Context, name string, opts SinkOptions) (RowWriter, error) {
+	registryMu.RLock()
+	f, ok := sinks[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown sink %q, registered: %s", name, strings.Join(registeredNames(sinks), ", "))
+	}
+	return f(ctx, opts)
+}
+
+func registeredNames[T any](m map[string]T) []string {
+	names := make([]string, 0, len(m))
+	for name := range m {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
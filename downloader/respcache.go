@@ -0,0 +1,65 @@
+package main
+
+import (
+	"container/list"
+	"sync"
+)
+
+// responseCache keeps the most recently used API responses, encoded, up to a number of entries. Each
+// load of the outputs gets a new one, so a response is never served from older outputs.
+type responseCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+	hits    int
+	misses  int
+}
+
+type cachedResponse struct {
+	key  string
+	body []byte
+}
+
+func newResponseCache(size int) *responseCache {
+	return &responseCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *responseCache) get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.entries[key]
+	if !ok {
+		c.misses++
+		return nil, false
+	}
+	c.hits++
+	c.order.MoveToFront(e)
+	return e.Value.(*cachedResponse).body, true
+}
+
+func (c *responseCache) put(key string, body []byte) {
+	if c.size <= 0 {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*cachedResponse).body = body
+		c.order.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.order.PushFront(&cachedResponse{key: key, body: body})
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cachedResponse).key)
+	}
+}
+
+// stats returns the entries cached and the hits and misses since the outputs were loaded
+func (c *responseCache) stats() (entries, hits, misses int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.order.Len(), c.hits, c.misses
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var resume = flag.Bool("resume", false, "carry on the interrupted export to the same -output from its manifest, appending to its files rather than writing them again")
+
+// ResumableWriter is implemented by sinks whose exports -resume can carry on
+type ResumableWriter interface {
+	ManifestWriter
+	// Resume picks up the files an earlier run wrote, listed by its manifest with their paths as the
+	// sink names them, so rows are appended to them rather than written over them
+	Resume(files []ManifestFile) error
+}
+
+// exportResume skips the filings an interrupted export already finished with, those up to and
+// including its last one in the order they are processed
+type exportResume struct {
+	after ManifestFiling
+	// found is whether the last filing has been passed, every filing after it is processed
+	found bool
+}
+
+// setupResume fails on the outputs -resume can't carry on. The rollups that total the whole quarter
+// are written once it is done from what they totalled, and can't be read back to add to, their
+// distinct counts and rounded values are all that is left of the filings written before.
+func setupResume() error {
+	if !*resume {
+		return nil
+	}
+	for _, rollup := range [][2]string{{"-sector-rollup", *sectorRollupPath}, {"-insider-rollup", *insiderRollupPath}, {"-issuer-rollup", *issuerRollupPath}} {
+		if rollup[1] != "" {
+			return fmt.Errorf("%s can't be resumed, it would only total the filings after the interruption, run the export again without -resume", rollup[0])
+		}
+	}
+	return nil
+}
+
+// resumeExport reads the manifest of the export out is about to write, checks its files are as it
+// left them and hands them to out to append to. It returns nil if the export is already complete.
+func resumeExport(out RowWriter, sinkName string, p period) (*exportResume, error) {
+	w, ok := out.(ResumableWriter)
+	if !ok {
+		return nil, fmt.Errorf("the %s sink can't resume exports", sinkName)
+	}
+	path, _ := w.Manifest()
+	if path == "" {
+		return nil, fmt.Errorf("-output - has no manifest to resume from")
+	}
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("no manifest to resume from: %w", err)
+	}
+	var m ExportManifest
+	if err = json.Unmarshal(content, &m); err != nil {
+		return nil, fmt.Errorf("reading %s: %w", path, err)
+	}
+	switch {
+	case m.Year != p.Year || m.Quarter != p.Quarter:
+		return nil, fmt.Errorf("%s is of %dQ%d, not %s", path, m.Year, m.Quarter, p)
+	case m.SchemaVersion != outputSchemaVersion || m.ParserVersion != parserVersion:
+		return nil, fmt.Errorf("%s was written with schema version %d and parser version %s, run the export again without -resume", path, m.SchemaVersion, m.ParserVersion)
+	case m.Status == runStatusDone:
+		return nil, nil
+	}
+
+	files := []ManifestFile{}
+	for _, f := range m.Files {
+		f.Path = filepath.Join(filepath.Dir(path), filepath.FromSlash(f.Path))
+		size, sum, err := fileChecksum(f.Path)
+		if err != nil {
+			return nil, err
+		}
+		if size != f.Bytes || sum != f.SHA256 {
+			return nil, fmt.Errorf("%s changed since %s was written, run the export again without -resume", f.Path, path)
+		}
+		files = append(files, f)
+	}
+	if err = w.Resume(files); err != nil {
+		return nil, err
+	}
+	r := &exportResume{found: true}
+	if m.LastFiling != nil {
+		r.after, r.found = *m.LastFiling, false
+	}
+	return r, nil
+}
+
+// canResume is whether -resume can carry on the export out wrote, from the manifest it is saved with
+func canResume(out RowWriter) bool {
+	w, ok := out.(ResumableWriter)
+	if !ok || !*writeManifest {
+		return false
+	}
+	path, _ := w.Manifest()
+	return path != ""
+}
+
+// filter drops the filings up to and including the last one the export finished with. Filings
+// are processed in date order, so dated says to fail once a later date is reached without finding it.
+func (r *exportResume) filter(filings []*edgar.IndexEntry, dated bool) ([]*edgar.IndexEntry, error) {
+	if r == nil || r.found {
+		return filings, nil
+	}
+	for i, f := range filings {
+		if f.AccessionNumber == r.after.AccessionNumber {
+			r.found = true
+			return filings[i+1:], nil
+		}
+	}
+	if !dated || (len(filings) > 0 && isoDate(filings[len(filings)-1].DateFiled) >= r.after.DateFiled) {
+		return nil, fmt.Errorf("%s, the last filing the export finished with, is no longer listed, run the export again without -resume", r.after.AccessionNumber)
+	}
+	return nil, nil
+}
+
+// partSuffix ends the name of a part file before its extension
+var partSuffix = regexp.MustCompile(`-part-\d{5,}$`)
+
+// outputOf is the output a file of an export belongs to, the file itself or the output it is a
+// part of
+func outputOf(path string, format OutputFormat, limits RollLimits) string {
+	ext := format.Ext()
+	if !limits.enabled() || !strings.HasSuffix(strings.ToLower(path), ext) {
+		return filepath.Clean(path)
+	}
+	base := path[:len(path)-len(ext)]
+	return filepath.Clean(partSuffix.ReplaceAllString(base, "") + path[len(base):])
+}
+
+// resume carries on from the files of an earlier run, its parts in order, appending to the last
+func (o *outputFile) resume(files []ManifestFile) {
+	o.written = append([]ManifestFile{}, files...)
+	last := files[len(files)-1]
+	if o.limits.enabled() {
+		o.part = len(files)
+	}
+	o.rows, o.bytes, o.created = last.Rows, last.Bytes, true
+}
+
+// resumeOutputs hands each of outputs its files of an earlier run, failing on files of none of them
+func resumeOutputs(outputs []*outputFile, files []ManifestFile) error {
+	byPath := map[string][]ManifestFile{}
+	for _, f := range files {
+		found := false
+		for _, o := range outputs {
+			if outputOf(f.Path, o.format, o.limits) == filepath.Clean(o.path) {
+				byPath[o.path] = append(byPath[o.path], f)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s isn't a file of this export, resume it with the flags it was started with", f.Path)
+		}
+	}
+	for _, o := range outputs {
+		if parts := byPath[o.path]; len(parts) > 0 {
+			o.resume(parts)
+		}
+	}
+	return nil
+}
+
+func (o *outputFile) Resume(files []ManifestFile) error {
+	return resumeOutputs([]*outputFile{o}, files)
+}
+
+func (p *PartitionedWriter) Resume(files []ManifestFile) error {
+	for _, f := range files {
+		path := outputOf(f.Path, p.format, p.limits)
+		if _, ok := p.files[path]; !ok {
+			p.files[path] = newOutputFile(path, p.format, p.limits)
+		}
+	}
+	outputs := []*outputFile{}
+	for _, o := range p.files {
+		outputs = append(outputs, o)
+	}
+	return resumeOutputs(outputs, files)
+}
+
+func (t *tablesWriter) Resume(files []ManifestFile) error {
+	if err := resumeOutputs([]*outputFile{t.filings, t.issuers, t.owners, t.transactions, t.holdings, t.footnotes}, files); err != nil {
+		return err
+	}
+	// Issuers are written once, those the earlier run wrote are read back so they aren't written again
+	for _, f := range t.issuers.written {
+		err := readOutputRows(f.Path, func(row map[string]string) {
+			t.seenIssuers[row["ISSUER_CIK"]] = true
+		})
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", f.Path, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+// day is a daily index's filings, all filed on date
+func day(date string, accessions ...string) []*edgar.IndexEntry {
+	filings := []*edgar.IndexEntry{}
+	for _, accession := range accessions {
+		filings = append(filings, &edgar.IndexEntry{AccessionNumber: accession, DateFiled: date})
+	}
+	return filings
+}
+
+func accessionsOf(filings []*edgar.IndexEntry) []string {
+	accessions := []string{}
+	for _, f := range filings {
+		accessions = append(accessions, f.AccessionNumber)
+	}
+	return accessions
+}
+
+func TestExportResumeFilter(t *testing.T) {
+	r := &exportResume{after: ManifestFiling{AccessionNumber: "000000000222000002", DateFiled: "2022-04-05"}}
+
+	// The days before the last filing's were written in full
+	filings, err := r.filter(day("20220404", "000000000122000001"), true)
+	if err != nil || len(filings) != 0 {
+		t.Fatalf("filter() of an earlier day = %v, %v, want it dropped", accessionsOf(filings), err)
+	}
+	// The last filing is found mid-day, the filings after it are processed
+	filings, err = r.filter(day("20220405", "000000000122000002", "000000000222000002", "000000000322000002"), true)
+	if err != nil || len(filings) != 1 || filings[0].AccessionNumber != "000000000322000002" {
+		t.Fatalf("filter() of the last filing's day = %v, %v, want the filing after it", accessionsOf(filings), err)
+	}
+	if !r.found {
+		t.Error("filter() didn't record finding the last filing")
+	}
+	// And every filing of the days after
+	filings, err = r.filter(day("20220406", "000000000122000003", "000000000222000003"), true)
+	if err != nil || len(filings) != 2 {
+		t.Errorf("filter() of a later day = %v, %v, want both filings", accessionsOf(filings), err)
+	}
+}
+
+func TestExportResumeFilterMissing(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		filings []*edgar.IndexEntry
+		dated   bool
+	}{
+		{"the last filing's day", day("20220405", "000000000122000002"), true},
+		{"a later day", day("20220406", "000000000122000003"), true},
+		{"an accession list", day("20220404", "000000000122000001"), false},
+	} {
+		r := &exportResume{after: ManifestFiling{AccessionNumber: "000000000222000002", DateFiled: "2022-04-05"}}
+		if filings, err := r.filter(tc.filings, tc.dated); err == nil {
+			t.Errorf("filter() of %s without the last filing = %v, want an error", tc.name, accessionsOf(filings))
+		}
+	}
+}
+
+func TestResumeOutputsParts(t *testing.T) {
+	f := OutputFormat{Encoding: "csv", Compression: "gzip"}
+	limits := RollLimits{MaxRows: 100}
+	trades, holdings := newOutputFile("out/trades.csv.gz", f, limits), newOutputFile("out/holdings.csv.gz", f, limits)
+	files := []ManifestFile{
+		{Path: "out/trades-part-00001.csv.gz", Rows: 100, Bytes: 4000},
+		{Path: "out/holdings-part-00001.csv.gz", Rows: 7, Bytes: 300},
+		{Path: "out/trades-part-00002.csv.gz", Rows: 42, Bytes: 1700},
+	}
+	if err := resumeOutputs([]*outputFile{trades, holdings}, files); err != nil {
+		t.Fatal(err)
+	}
+	if len(trades.written) != 2 || trades.rows != 42 || trades.bytes != 1700 || !trades.created {
+		t.Errorf("trades resumed with %d parts, %d rows and %d bytes, want 2 parts appending to the second's 42 rows", len(trades.written), trades.rows, trades.bytes)
+	}
+	if got := trades.partPath(); got != "out/trades-part-00002.csv.gz" {
+		t.Errorf("trades appends to %s, want the second part", got)
+	}
+	if len(holdings.written) != 1 || holdings.partPath() != "out/holdings-part-00001.csv.gz" {
+		t.Errorf("holdings resumed with %d parts appending to %s, want its first part", len(holdings.written), holdings.partPath())
+	}
+
+	// Without -max-rows or -max-bytes there are no parts, so a part file is of another export
+	whole := newOutputFile("out/trades.csv.gz", f, RollLimits{})
+	if err := resumeOutputs([]*outputFile{whole}, files[:1]); err == nil {
+		t.Error("resumeOutputs() took a part file for an export without parts")
+	}
+}
+
+func TestTablesResumeSeedsIssuers(t *testing.T) {
+	root := t.TempDir()
+	out, err := openTables(context.Background(), SinkOptions{Target: root})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tables := out.(*tablesWriter)
+
+	// The issuers table the interrupted run wrote
+	path := filepath.Join(root, "issuers.csv")
+	row := make([]string, len(issuersHeader))
+	for i, column := range issuersHeader {
+		if column == "ISSUER_CIK" {
+			row[i] = "0000320193"
+		}
+	}
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := csv.NewWriter(f)
+	w.WriteAll([][]string{issuersHeader, row})
+	f.Close()
+	if err := w.Error(); err != nil {
+		t.Fatal(err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := tables.Resume([]ManifestFile{{Path: path, Rows: 1, Bytes: info.Size()}}); err != nil {
+		t.Fatal(err)
+	}
+	if !tables.seenIssuers["0000320193"] {
+		t.Error("Resume() didn't read back the issuers already written, they would be written again")
+	}
+	if !tables.issuers.created || tables.filings.created {
+		t.Error("Resume() should append to the issuers table and leave the others to be created")
+	}
+}
+
+func TestSetupResumeRefusesRollups(t *testing.T) {
+	defer func(saved bool) { *resume = saved }(*resume)
+	*resume = true
+	for _, path := range []*string{sectorRollupPath, insiderRollupPath, issuerRollupPath} {
+		*path = "rollup.csv"
+		if err := setupResume(); err == nil {
+			t.Error("setupResume() accepted a rollup that can't be resumed")
+		}
+		*path = ""
+	}
+	*filingRollupPath = "filings.csv"
+	defer func() { *filingRollupPath = "" }()
+	if err := setupResume(); err != nil {
+		t.Errorf("setupResume() = %v, the filing rollup is appended to", err)
+	}
+}
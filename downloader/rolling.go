@@ -0,0 +1,234 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/shopspring/decimal"
+)
+
+// rollingWindows are the days net insider buying is totalled over, the longest last
+var rollingWindows = []int{7, 30, 90}
+
+var (
+	netBuyingHeader = []string{"ACCESSION_NUMBER", "TRANSACTION_INDEX", "ISSUER_CIK", "ISSUER_NAME", "ISSUER_TICKER", "TRANSACTION_DATE", "NET_VALUE"}
+	rollingHeader   = []string{"ISSUER_CIK", "ISSUER_NAME", "ISSUER_TICKER", "AS_OF", "NET_VALUE_7D", "NET_VALUE_30D", "NET_VALUE_90D"}
+)
+
+// netBuying is an open market purchase (code P) or sale (code S) with a price, its dollar value
+// negative for a sale
+type netBuying struct {
+	accession               string
+	index                   int
+	issuerCIK, name, ticker string
+	date                    string
+	net                     decimal.Decimal
+}
+
+// RollingNetBuying keeps the open market purchases and sales of the trailing 90 days in the data
+// directory, so each download run adds its filings to the earlier runs' and the per issuer totals
+// over rollingWindows are brought up to date incrementally
+type RollingNetBuying struct {
+	entries map[string]netBuying
+}
+
+// netBuyingPath is where the purchases and sales are kept, and rollingPath where their totals are
+// materialized, next to the document cache
+func netBuyingPath() string {
+	return filepath.Join(*dataDir, "net_buying.csv")
+}
+
+func rollingPath() string {
+	return filepath.Join(*dataDir, "rolling_net_buying.csv")
+}
+
+// LoadRollingNetBuying reads the purchases and sales at path, none if it doesn't exist yet
+func LoadRollingNetBuying(path string) (*RollingNetBuying, error) {
+	r := &RollingNetBuying{entries: map[string]netBuying{}}
+	records, err := readCSVFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading net buying %s: %w", path, err)
+	}
+	for i, rec := range records {
+		if i == 0 || len(rec) != len(netBuyingHeader) {
+			continue
+		}
+		index, err := strconv.Atoi(rec[1])
+		if err != nil {
+			continue
+		}
+		net, err := decimal.NewFromString(rec[6])
+		if err != nil {
+			continue
+		}
+		r.add(netBuying{accession: rec[0], index: index, issuerCIK: rec[2], name: rec[3], ticker: rec[4], date: rec[5], net: net})
+	}
+	return r, nil
+}
+
+func (r *RollingNetBuying) add(e netBuying) {
+	r.entries[e.accession+"/"+strconv.Itoa(e.index)] = e
+}
+
+// Observe records the open market purchases and sales of a parsed filing
+func (r *RollingNetBuying) Observe(parsed *ParsedFiling) {
+	od := parsed.Document
+	for _, t := range form4.Flatten(od) {
+		if t.TransactionCode != "P" && t.TransactionCode != "S" {
+			continue
+		}
+		value, ok := transactionDecimalValue(t)
+		if !ok {
+			continue
+		}
+		if t.TransactionCode == "S" {
+			value = value.Neg()
+		}
+		r.add(netBuying{accession: parsed.Filing.AccessionNumber, index: t.TransactionIndex, issuerCIK: edgar.PadCIK(od.Issuer.CIK),
+			name: od.Issuer.Name, ticker: od.Issuer.TradingSymbol, date: t.TransactionDate, net: value})
+	}
+}
+
+// transactionDecimalValue is a transaction's shares times its price, false when either isn't known or
+// the price is zero
+func transactionDecimalValue(t form4.TransactionRow) (decimal.Decimal, bool) {
+	shares, err := form4.ParseDecimal(t.Shares)
+	if err != nil {
+		return decimal.Zero, false
+	}
+	price, err := form4.ParseDecimal(t.PricePerShare)
+	if err != nil || !price.IsPositive() {
+		return decimal.Zero, false
+	}
+	return shares.Mul(price), true
+}
+
+// asOf is the latest transaction date (YYYY-MM-DD) seen, leaving out dates mistyped into the future
+func (r *RollingNetBuying) asOf() string {
+	latest, today := "", time.Now().Format("2006-01-02")
+	for _, e := range r.entries {
+		if e.date > latest && e.date <= today {
+			latest = e.date
+		}
+	}
+	return latest
+}
+
+// windowStart is the first date (YYYY-MM-DD) of the window of days ending on asOf
+func windowStart(asOf string, days int) string {
+	t, err := time.Parse("2006-01-02", asOf)
+	if err != nil {
+		return asOf
+	}
+	return t.AddDate(0, 0, 1-days).Format("2006-01-02")
+}
+
+// Save writes the purchases and sales of the longest window to path and their per issuer totals as
+// of the latest transaction to totalsPath, replacing each only once it is fully written
+func (r *RollingNetBuying) Save(path, totalsPath string) error {
+	asOf := r.asOf()
+	oldest := windowStart(asOf, rollingWindows[len(rollingWindows)-1])
+	keys := make([]string, 0, len(r.entries))
+	for key, e := range r.entries {
+		if e.date >= oldest {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := r.entries[keys[i]], r.entries[keys[j]]
+		if a.accession != b.accession {
+			return a.accession < b.accession
+		}
+		return a.index < b.index
+	})
+
+	records := [][]string{netBuyingHeader}
+	type issuerTotals struct {
+		name, ticker, latest string
+		totals               []decimal.Decimal
+	}
+	issuers := map[string]*issuerTotals{}
+	for _, key := range keys {
+		e := r.entries[key]
+		records = append(records, []string{e.accession, strconv.Itoa(e.index), e.issuerCIK, e.name, e.ticker, e.date, e.net.String()})
+		if e.date > asOf {
+			continue
+		}
+		totals := issuers[e.issuerCIK]
+		if totals == nil {
+			totals = &issuerTotals{totals: make([]decimal.Decimal, len(rollingWindows))}
+			issuers[e.issuerCIK] = totals
+		}
+		// The name and ticker of the latest transaction win
+		if e.date >= totals.latest {
+			totals.name, totals.ticker, totals.latest = e.name, e.ticker, e.date
+		}
+		for i, days := range rollingWindows {
+			if e.date >= windowStart(asOf, days) {
+				totals.totals[i] = totals.totals[i].Add(e.net)
+			}
+		}
+	}
+	if err := writeCSVFile(path, records); err != nil {
+		return err
+	}
+
+	ciks := make([]string, 0, len(issuers))
+	for cik := range issuers {
+		ciks = append(ciks, cik)
+	}
+	sort.Strings(ciks)
+	records = [][]string{rollingHeader}
+	for _, cik := range ciks {
+		t := issuers[cik]
+		record := []string{cik, t.name, t.ticker, asOf}
+		for _, total := range t.totals {
+			record = append(record, total.StringFixed(2))
+		}
+		records = append(records, record)
+	}
+	return writeCSVFile(totalsPath, records)
+}
+
+// printRolling prints the issuers with the most net insider buying over each of rollingWindows, from
+// the totals the download runs so far materialized
+func printRolling(out io.Writer, n int) error {
+	records, err := readCSVFile(rollingPath())
+	if err != nil {
+		return err
+	}
+	if len(records) < 2 {
+		return errors.New("no purchases or sales in the download runs so far")
+	}
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	for i, days := range rollingWindows {
+		leaders := map[string]*leader{}
+		for _, rec := range records[1:] {
+			if len(rec) != len(rollingHeader) {
+				continue
+			}
+			value, ok := parseSigned(rec[4+i])
+			if !ok || value == 0 {
+				continue
+			}
+			leaders[rec[0]] = &leader{name: rec[1], detail: rec[2], value: value}
+		}
+		if i > 0 {
+			fmt.Fprintln(w)
+		}
+		fmt.Fprintf(w, "Top issuers by net insider buying over the %d days to %s\n", days, records[1][3])
+		for j, l := range top(leaders, n) {
+			fmt.Fprintf(w, "%d.\t%s\t%s\t%s\n", j+1, l.name, l.detail, formatDollars(l.value))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schedule is a cron expression, minute hour day-of-month month day-of-week, each field a *, a
+// number, a range like 1-5 or a list of those, optionally with a /step. Day of week is 0 (or 7) for
+// Sunday. As in cron, a time matches when both day fields do, or either when both are restricted.
+type Schedule struct {
+	spec                               string
+	minutes, hours, days, months       []bool
+	weekdays                           []bool
+	daysRestricted, weekdaysRestricted bool
+}
+
+// ParseSchedule reads a cron expression like "15 22 * * 1-5"
+func ParseSchedule(spec string) (*Schedule, error) {
+	fields := strings.Fields(spec)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("schedule %q: expected 5 fields, minute hour day-of-month month day-of-week", spec)
+	}
+	s := &Schedule{spec: spec}
+	var err error
+	for _, f := range []struct {
+		field    string
+		min, max int
+		dst      *[]bool
+	}{
+		{fields[0], 0, 59, &s.minutes},
+		{fields[1], 0, 23, &s.hours},
+		{fields[2], 1, 31, &s.days},
+		{fields[3], 1, 12, &s.months},
+		{fields[4], 0, 7, &s.weekdays},
+	} {
+		if *f.dst, err = parseScheduleField(f.field, f.min, f.max); err != nil {
+			return nil, fmt.Errorf("schedule %q: %w", spec, err)
+		}
+	}
+	// 7 is Sunday too
+	s.weekdays[0] = s.weekdays[0] || s.weekdays[7]
+	s.daysRestricted, s.weekdaysRestricted = fields[2] != "*", fields[4] != "*"
+	return s, nil
+}
+
+// parseScheduleField returns which of the values from 0 to max a field matches
+func parseScheduleField(field string, min, max int) ([]bool, error) {
+	matches := make([]bool, max+1)
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, stepped := strings.Cut(part, "/")
+		step := 1
+		if stepped {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n < 1 {
+				return nil, fmt.Errorf("invalid step in %q", part)
+			}
+			step = n
+		}
+		first, last := min, max
+		if rangePart != "*" {
+			from, to, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if first, err = strconv.Atoi(from); err != nil {
+				return nil, fmt.Errorf("invalid value in %q", part)
+			}
+			last = first
+			if isRange {
+				if last, err = strconv.Atoi(to); err != nil {
+					return nil, fmt.Errorf("invalid range in %q", part)
+				}
+			} else if stepped {
+				// 5/15 is every 15 from 5
+				last = max
+			}
+		}
+		if first < min || last > max || first > last {
+			return nil, fmt.Errorf("%q is outside %d-%d", part, min, max)
+		}
+		for v := first; v <= last; v += step {
+			matches[v] = true
+		}
+	}
+	return matches, nil
+}
+
+func (s *Schedule) String() string {
+	return s.spec
+}
+
+// dayMatches is whether the schedule fires on some minute of t's day
+func (s *Schedule) dayMatches(t time.Time) bool {
+	day, weekday := s.days[t.Day()], s.weekdays[t.Weekday()]
+	if s.daysRestricted && s.weekdaysRestricted {
+		return day || weekday
+	}
+	return day && weekday
+}
+
+// Next returns the first minute after t the schedule fires at, in t's location, or the zero time if
+// there is none in the next 5 years (e.g. for February 30th). Minutes skipped by a daylight saving
+// change never match.
+func (s *Schedule) Next(t time.Time) time.Time {
+	t = t.Truncate(time.Minute).Add(time.Minute)
+	for end := t.AddDate(5, 0, 0); t.Before(end); {
+		next := t
+		switch {
+		case !s.months[t.Month()]:
+			next = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, t.Location())
+		case !s.dayMatches(t):
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+		case !s.hours[t.Hour()]:
+			next = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+		case !s.minutes[t.Minute()]:
+			next = t.Add(time.Minute)
+		default:
+			return t
+		}
+		if !next.After(t) {
+			// time.Date may land before t for an hour skipped when the clocks go forward
+			next = t.Truncate(time.Hour).Add(time.Hour)
+		}
+		t = next
+	}
+	return time.Time{}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestScheduleNext(t *testing.T) {
+	newYork, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	at := func(loc *time.Location, value string) time.Time {
+		tm, err := time.ParseInLocation("2006-01-02 15:04", value, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return tm
+	}
+
+	for _, tc := range []struct {
+		spec, from, want string
+		loc              *time.Location
+	}{
+		// Across a month boundary, and into the next year
+		{"0 9 1 * *", "2024-01-31 10:00", "2024-02-01 09:00", time.UTC},
+		{"0 9 1 * *", "2024-12-01 09:00", "2025-01-01 09:00", time.UTC},
+		{"30 6 31 * *", "2024-04-01 00:00", "2024-05-31 06:30", time.UTC},
+		// Every 15 minutes, from the one after t rather than t itself
+		{"*/15 * * * *", "2024-03-04 10:07", "2024-03-04 10:15", time.UTC},
+		{"*/15 * * * *", "2024-03-04 10:45", "2024-03-04 11:00", time.UTC},
+		{"5/15 * * * *", "2024-03-04 10:51", "2024-03-04 11:05", time.UTC},
+		// Weekdays, over a weekend
+		{"15 22 * * 1-5", "2024-03-06 22:15", "2024-03-07 22:15", time.UTC},
+		{"15 22 * * 1-5", "2024-03-08 23:00", "2024-03-11 22:15", time.UTC},
+		// 7 is Sunday as 0 is
+		{"0 12 * * 7", "2024-03-04 00:00", "2024-03-10 12:00", time.UTC},
+		{"0 12 * * 0", "2024-03-04 00:00", "2024-03-10 12:00", time.UTC},
+		// Both day fields restricted match either, the first Friday comes before the 13th
+		{"0 0 13 * 5", "2024-09-01 00:00", "2024-09-06 00:00", time.UTC},
+		{"0 0 13 * 5", "2024-09-12 00:00", "2024-09-13 00:00", time.UTC},
+		// Lists
+		{"0 8,20 * * *", "2024-03-04 08:00", "2024-03-04 20:00", time.UTC},
+		// 2:30 doesn't exist on the day the clocks go forward in New York, and 3:00 comes right after 1:59
+		{"30 2 * * *", "2024-03-09 03:00", "2024-03-11 02:30", newYork},
+		{"*/15 * * * *", "2024-03-10 01:50", "2024-03-10 03:00", newYork},
+		{"0 3 * * *", "2024-03-10 00:00", "2024-03-10 03:00", newYork},
+	} {
+		s, err := ParseSchedule(tc.spec)
+		if err != nil {
+			t.Fatalf("ParseSchedule(%q) = %v", tc.spec, err)
+		}
+		want := at(tc.loc, tc.want)
+		if got := s.Next(at(tc.loc, tc.from)); !got.Equal(want) {
+			t.Errorf("%q.Next(%s) = %s, want %s", tc.spec, tc.from, got, want)
+		}
+	}
+}
+
+func TestScheduleNextNever(t *testing.T) {
+	s, err := ParseSchedule("0 0 30 2 *")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := s.Next(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); !got.IsZero() {
+		t.Errorf("February 30th is next at %s, want the zero time", got)
+	}
+}
+
+func TestParseScheduleInvalid(t *testing.T) {
+	for _, spec := range []string{
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"a * * * *",
+		"1-b * * * *",
+	} {
+		if _, err := ParseSchedule(spec); err == nil {
+			t.Errorf("ParseSchedule(%q) accepted an invalid schedule", spec)
+		}
+	}
+}
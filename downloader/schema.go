@@ -0,0 +1,244 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+// outputSchema is the history of the flat output's columns, version n being outputSchema[n-1].
+//
+// The compatibility policy of the output is:
+//   - a new version only adds columns, after those of the versions before it, so every column keeps
+//     its name and csv position and readers written against an older version keep working
+//   - a column is never removed or renamed, and never changes type or meaning. A change of meaning
+//     is a new column, the old one staying as it was.
+//   - a change to how values are normalized comes with a version, its Upgrade rewriting the values of
+//     older exports as this build would write them
+//   - extractor and extract rule columns come after the schema's and aren't versioned
+//
+// Each version's columns need data dictionary entries, and a migration under migrations/ adding them
+// to the tables of the database sinks. PARSER_VERSION is versioned separately: it changes when the
+// same document parses to different values, not when the columns do.
+var outputSchema = []schemaVersion{
+	{Added: []string{"ISSUER_CIK", "REPORTER_CIK", "ACCESSION_NUMBER", "NAME_OF_REPORTING_PERSON", "A_OR_D", "AMOUNT", "PRICE", "TRANSACTION_DATE", "TITLE_OF_SECURITY", "ISSUER_NAME", "ISSUER_TICKER", "IS_DIRECTOR", "IS_OFFICER", "IS_TEN_PERCENT_OWNER", "IS_OTHER_RELATIONSHIP", "NEW_AMOUNT_OWNED", "DIRECT_OR_INDIRECT_OWNERSHIP"}},
+	{Added: []string{"TRANSACTION_CODE"}},
+	// Amounts, prices and dates were written as filed before
+	{Added: []string{"DATA_QUALITY_FLAGS"}, Upgrade: upgradeNumbersAndDates},
+	// Relationship flags were written as filed before, 1 or 0 as often as true or false
+	{Added: []string{"NATURE_OF_OWNERSHIP", "INDIRECT_OWNERSHIP_TYPE"}, Upgrade: upgradeFlags},
+	{Added: []string{"DEEMED_EXECUTION_DATE"}},
+	{Added: []string{"ACCEPTANCE_DATETIME"}},
+	{Added: []string{"REPORTER_CITY", "REPORTER_STATE"}},
+	{Added: []string{"OFFICER_TITLE", "OFFICER_ROLE"}},
+	{Added: []string{"SPLIT_ADJUSTED_AMOUNT", "SPLIT_ADJUSTED_PRICE", "SPLIT_ADJUSTED_NEW_AMOUNT_OWNED"}},
+	{Added: []string{"VALUE_PERCENTILE", "ISSUER_VALUE_PERCENTILE"}},
+	{Added: []string{"SOURCE_SHA256"}},
+	{Added: []string{"SOURCE_URL", "DOWNLOADED_AT", "PARSER_VERSION"}},
+	// Every row was a non-derivative transaction before
+	{Added: []string{"ROW_TYPE", "TRANSACTION_INDEX"}, Upgrade: upgradeRowType},
+	{Added: []string{"DIRECTION"}, Upgrade: upgradeDirection},
+}
+
+// schemaVersion is a version of the flat output
+type schemaVersion struct {
+	// Added are the columns the version appended
+	Added []string
+	// Upgrade, if set, rewrites a row of the version before as this one writes it. Rows are keyed by
+	// upper case column name, and columns the row doesn't have are left out.
+	Upgrade func(row map[string]string)
+}
+
+// outputSchemaVersion is the version of the flat output this build writes
+var outputSchemaVersion = len(outputSchema)
+
+// schemaColumns are the columns of a version of the flat output, in order
+func schemaColumns(version int) []string {
+	columns := []string{}
+	for _, v := range outputSchema[:version] {
+		columns = append(columns, v.Added...)
+	}
+	return columns
+}
+
+func upgradeNumbersAndDates(row map[string]string) {
+	for _, column := range []string{"AMOUNT", "PRICE", "NEW_AMOUNT_OWNED"} {
+		if v, ok := row[column]; ok {
+			// Values that can't be read are cleared, as a download run would
+			row[column], _ = form4.NormalizeDecimal(v)
+		}
+	}
+	if v, ok := row["TRANSACTION_DATE"]; ok {
+		row["TRANSACTION_DATE"], _ = form4.NormalizeDate(v)
+	}
+}
+
+func upgradeFlags(row map[string]string) {
+	if *rawFlags {
+		return
+	}
+	for _, column := range []string{"IS_DIRECTOR", "IS_OFFICER", "IS_TEN_PERCENT_OWNER", "IS_OTHER_RELATIONSHIP"} {
+		if v, ok := row[column]; ok {
+			row[column] = form4.NormalizeFlag(v)
+		}
+	}
+}
+
+func upgradeRowType(row map[string]string) {
+	row["ROW_TYPE"] = rowTypeNonDerivativeTransaction
+}
+
+// upgradeDirection fills in DIRECTION, which is derived from columns every version has
+func upgradeDirection(row map[string]string) {
+	row["DIRECTION"] = form4.ClassifyDirection(row["TRANSACTION_CODE"], row["A_OR_D"])
+}
+
+// exportSchemaVersion is the version of the flat output an export was written with, from the schema
+// file next to it, or for an export older than those, the latest version any of its columns were
+// added in
+func exportSchemaVersion(path string, format OutputFormat, columns map[string]bool) (int, error) {
+	content, err := ioutil.ReadFile(schemaPath(path, format))
+	if err == nil {
+		var schema struct {
+			Version int `json:"x-schema-version"`
+		}
+		if err = json.Unmarshal(content, &schema); err != nil {
+			return 0, fmt.Errorf("reading the schema of %s: %w", path, err)
+		}
+		if schema.Version > 0 {
+			return schema.Version, nil
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return 0, err
+	}
+
+	version := 0
+	for i, v := range outputSchema {
+		for _, column := range v.Added {
+			if columns[column] {
+				version = i + 1
+			}
+		}
+	}
+	if version == 0 {
+		return 0, fmt.Errorf("%s has none of the output's columns", path)
+	}
+	return version, nil
+}
+
+// versionedPath inserts the schema version before a path's extension, form4_2024_q1.csv.gz becoming
+// form4_2024_q1.v12.csv.gz
+func versionedPath(path string, format OutputFormat, version int) string {
+	base, ext := path, ""
+	if strings.HasSuffix(strings.ToLower(path), format.Ext()) {
+		base, ext = path[:len(path)-len(format.Ext())], path[len(path)-len(format.Ext()):]
+	}
+	return fmt.Sprintf("%s.v%d%s", base, version, ext)
+}
+
+func runConvert(args []string) {
+	fs := flag.NewFlagSet("convert", flag.ExitOnError)
+	output := fs.String("o", "", "file to write the converted export to, its extension picking the encoding and compression (default the input's name with the schema version, e.g. form4_2024_q1.v12.csv)")
+	from := fs.Int("from", 0, "schema version the export was written with (default read from its schema file, or guessed from its columns)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: convert [-o file] [-from version] <csv or jsonl export>")
+	}
+	input := fs.Arg(0)
+	inputFormat, err := DetectOutputFormat(input, "", "")
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+
+	// The columns are read first, the csv header needs the extract rule columns before the first row
+	columns := map[string]bool{}
+	rows := 0
+	err = readOutputRows(input, func(row map[string]string) {
+		for column := range row {
+			columns[column] = true
+		}
+		rows++
+	})
+	if err != nil {
+		log.Printf("Failed to read %s", input)
+		log.Fatal(err)
+	}
+	version := *from
+	if version == 0 {
+		if version, err = exportSchemaVersion(input, inputFormat, columns); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if version < 1 || version > outputSchemaVersion {
+		fatalf(exitUsage, "%s is schema version %d, this build only knows versions 1 to %d", input, version, outputSchemaVersion)
+	}
+
+	csvHeader = schemaColumns(outputSchemaVersion)
+	known := map[string]bool{}
+	for _, column := range csvHeader {
+		known[column] = true
+	}
+	extra := []string{}
+	for column := range columns {
+		if !known[column] {
+			extra = append(extra, column)
+		}
+	}
+	sort.Strings(extra)
+	csvHeader = append(csvHeader, extra...)
+
+	path := *output
+	if path == "" {
+		path = versionedPath(input, inputFormat, outputSchemaVersion)
+	}
+	if path == input {
+		fatal(exitUsage, "convert can't overwrite the export it reads, pass another -o")
+	}
+	f, err := DetectOutputFormat(path, "", "")
+	if err != nil {
+		fatal(exitUsage, err)
+	}
+	if err = WriteSchema(schemaPath(path, f), "form4 transactions", f); err != nil {
+		fatal(exitSink, err)
+	}
+	out := newOutputFile(path, f, RollLimits{})
+
+	ctx := context.Background()
+	var writeErr error
+	err = readOutputRows(input, func(row map[string]string) {
+		if writeErr != nil {
+			return
+		}
+		for _, v := range outputSchema[version:] {
+			if v.Upgrade != nil {
+				v.Upgrade(row)
+			}
+		}
+		values := make([]string, len(csvHeader))
+		for i, column := range csvHeader {
+			values[i] = row[column]
+		}
+		writeErr = out.Write(ctx, &Row{Values: values})
+	})
+	if err != nil {
+		out.Close()
+		log.Printf("Failed to read %s", input)
+		log.Fatal(err)
+	}
+	if err = writeErr; err == nil {
+		err = out.Close()
+	}
+	if err != nil {
+		fatal(exitSink, err)
+	}
+	infof("Converted %d rows of %s from schema version %d to %d in %s", rows, input, version, outputSchemaVersion, path)
+}
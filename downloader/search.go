@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/blevesearch/bleve/v2"
+	"github.com/blevesearch/bleve/v2/analysis/lang/en"
+	"github.com/blevesearch/bleve/v2/mapping"
+)
+
+func init() {
+	RegisterSink("search", openSearchIndex)
+}
+
+// searchBatchSize is how many filings are indexed in each batch
+const searchBatchSize = 500
+
+// searchIndexPath is where the search sink and command keep the index unless told otherwise
+func searchIndexPath() string {
+	return filepath.Join(*dataDir, "search")
+}
+
+// searchMapping indexes the footnotes and remarks of each filing as English text, stemmed so a
+// search for "gift" also finds "gifted", along with enough about the filing to show in results
+func searchMapping() mapping.IndexMapping {
+	keyword := bleve.NewKeywordFieldMapping()
+	text := bleve.NewTextFieldMapping()
+	text.Analyzer = en.AnalyzerName
+
+	filing := bleve.NewDocumentStaticMapping()
+	for _, field := range []string{"accession_number", "form_type", "date_filed", "issuer_cik", "issuer_ticker"} {
+		filing.AddFieldMappingsAt(field, keyword)
+	}
+	for _, field := range []string{"issuer_name", "reporting_owners", "footnotes", "remarks"} {
+		filing.AddFieldMappingsAt(field, text)
+	}
+
+	m := bleve.NewIndexMapping()
+	m.DefaultMapping = filing
+	m.DefaultAnalyzer = en.AnalyzerName
+	return m
+}
+
+// searchIndexWriter indexes filings into a local bleve index, keyed by accession number so re-running
+// a quarter replaces its documents
+type searchIndexWriter struct {
+	index bleve.Index
+	batch *bleve.Batch
+}
+
+// openSearchIndex is the search sink, indexing into the bleve index at -output (default search/ in
+// the data directory), which is created if it doesn't exist
+func openSearchIndex(ctx context.Context, opts SinkOptions) (RowWriter, error) {
+	for _, name := range []string{"partition", "columns", "format", "compress", "max-rows", "max-bytes"} {
+		if flagIsSet(flag.CommandLine, name) {
+			return nil, fmt.Errorf("-%s does not apply to the search sink", name)
+		}
+	}
+	path := opts.Target
+	if path == "" {
+		path = searchIndexPath()
+	}
+
+	index, err := bleve.Open(path)
+	if errors.Is(err, bleve.ErrorIndexPathDoesNotExist) {
+		index, err = bleve.New(path, searchMapping())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening search index %s: %w", path, err)
+	}
+	return &searchIndexWriter{index: index, batch: index.NewBatch()}, nil
+}
+
+func (w *searchIndexWriter) Write(ctx context.Context, row *Row) error {
+	return errors.New("the search sink only accepts whole filings")
+}
+
+func (w *searchIndexWriter) WriteFiling(ctx context.Context, parsed *ParsedFiling) error {
+	filing, od := parsed.Filing, parsed.Document
+	owners := []string{}
+	for _, o := range od.ReportingOwners {
+		owners = append(owners, o.Name)
+	}
+	footnotes := []string{}
+	for _, f := range od.Footnotes {
+		footnotes = append(footnotes, f.Text)
+	}
+
+	err := w.batch.Index(filing.AccessionNumber, map[string]interface{}{
+		"accession_number": filing.AccessionNumber,
+		"form_type":        filing.FormType,
+		"date_filed":       isoDate(filing.DateFiled),
+		"issuer_cik":       od.Issuer.CIK,
+		"issuer_name":      od.Issuer.Name,
+		"issuer_ticker":    od.Issuer.TradingSymbol,
+		"reporting_owners": owners,
+		"footnotes":        footnotes,
+		"remarks":          od.Remarks,
+	})
+	if err != nil {
+		return err
+	}
+	if w.batch.Size() >= searchBatchSize {
+		return w.flush()
+	}
+	return nil
+}
+
+func (w *searchIndexWriter) flush() error {
+	if w.batch.Size() == 0 {
+		return nil
+	}
+	if err := w.index.Batch(w.batch); err != nil {
+		return err
+	}
+	w.batch.Reset()
+	return nil
+}
+
+func (w *searchIndexWriter) Close() error {
+	if err := w.flush(); err != nil {
+		w.index.Close()
+		return err
+	}
+	return w.index.Close()
+}
+
+func runSearch(args []string) {
+	fs := flag.NewFlagSet("search", flag.ExitOnError)
+	indexPath := fs.String("index", searchIndexPath(), "bleve index built by -sink search")
+	limit := fs.Int("limit", 20, "most filings to show")
+	fs.Parse(args)
+	if fs.NArg() == 0 {
+		log.Fatal(`Usage: search [-index dir] [-limit n] <query>, e.g. search '"Rule 10b5-1"' or search '+footnotes:"estate planning" +issuer_ticker:AAPL'`)
+	}
+
+	index, err := bleve.Open(*indexPath)
+	if err != nil {
+		log.Printf("Failed to open search index %s, build it with -sink search", *indexPath)
+		log.Fatal(err)
+	}
+	defer index.Close()
+
+	req := bleve.NewSearchRequestOptions(bleve.NewQueryStringQuery(strings.Join(fs.Args(), " ")), *limit, 0, false)
+	req.Fields = []string{"accession_number", "form_type", "date_filed", "issuer_name", "issuer_ticker", "reporting_owners"}
+	// Matches are highlighted in color on a terminal, and marked with <mark> tags when piped
+	style := "html"
+	if info, err := os.Stdout.Stat(); err == nil && info.Mode()&os.ModeCharDevice != 0 {
+		style = "ansi"
+	}
+	req.Highlight = bleve.NewHighlightWithStyle(style)
+	req.Highlight.Fields = []string{"footnotes", "remarks"}
+
+	result, err := index.Search(req)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for _, hit := range result.Hits {
+		fmt.Printf("%s  %s  %-4s %s (%s)  %s\n", hit.Fields["date_filed"], hit.Fields["accession_number"], hit.Fields["form_type"],
+			hit.Fields["issuer_name"], hit.Fields["issuer_ticker"], joinField(hit.Fields["reporting_owners"]))
+		for _, field := range req.Highlight.Fields {
+			// Fields are returned whether or not they matched, only show the ones that did
+			if len(hit.Locations[field]) == 0 {
+				continue
+			}
+			for _, fragment := range hit.Fragments[field] {
+				fmt.Printf("    %s: %s\n", field, strings.Join(strings.Fields(fragment), " "))
+			}
+		}
+	}
+	fmt.Printf("%d filings match, showing %d\n", result.Total, len(result.Hits))
+}
+
+// joinField formats a stored field that holds one value or several
+func joinField(v interface{}) string {
+	values, ok := v.([]interface{})
+	if !ok {
+		return fmt.Sprint(v)
+	}
+	s := make([]string, len(values))
+	for i, value := range values {
+		s[i] = fmt.Sprint(value)
+	}
+	return strings.Join(s, ", ")
+}
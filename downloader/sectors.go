@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/shopspring/decimal"
+)
+
+var sectorRollupPath = flag.String("sector-rollup", "", "write net insider buying by sector and industry (SIC) over the run to this file, needs the issuers' SIC from the SEC header or -lookup-issuers")
+
+var sectorRollupHeader = []string{"PERIOD", "SECTOR", "SIC", "INDUSTRY", "ISSUERS", "PURCHASES", "SALES", "PURCHASE_VALUE", "SALE_VALUE", "NET_VALUE"}
+
+// industryTotals is the open market buying and selling by insiders of the issuers in one industry
+type industryTotals struct {
+	sector, sic, industry string
+	issuers               map[string]bool
+	purchases, sales      int
+	bought, sold          decimal.Decimal
+}
+
+// sectorRollup totals the open market purchases (code P) and sales (code S) with a price of a run by
+// the issuers' SIC code. Issuers whose SIC isn't known are totalled under an empty one.
+type sectorRollup map[string]*industryTotals
+
+func (r sectorRollup) add(parsed *ParsedFiling) {
+	var sic string
+	if parsed.Issuer != nil {
+		sic = parsed.Issuer.SIC
+	}
+	code, industry := edgar.SplitSIC(sic)
+	totals := r[code]
+	if totals == nil {
+		totals = &industryTotals{sector: edgar.SICDivision(code), sic: code, industry: industry, issuers: map[string]bool{}}
+		r[code] = totals
+	}
+
+	for _, t := range form4.Flatten(parsed.Document) {
+		if t.TransactionCode != "P" && t.TransactionCode != "S" {
+			continue
+		}
+		value, ok := transactionDecimalValue(t)
+		if !ok {
+			continue
+		}
+		totals.issuers[edgar.PadCIK(parsed.Document.Issuer.CIK)] = true
+		if t.TransactionCode == "P" {
+			totals.purchases++
+			totals.bought = totals.bought.Add(value)
+		} else {
+			totals.sales++
+			totals.sold = totals.sold.Add(value)
+		}
+	}
+}
+
+// write writes one row per industry with any purchases or sales, ordered by sector then SIC, with a
+// data dictionary next to it like any export
+func (r sectorRollup) write(path, period string) error {
+	f, err := DetectOutputFormat(path, "", "")
+	if err != nil {
+		return err
+	}
+	f.Header = sectorRollupHeader
+	if err := WriteSchema(schemaPath(path, f), "sector_rollup", f); err != nil {
+		return err
+	}
+
+	industries := make([]*industryTotals, 0, len(r))
+	for _, totals := range r {
+		if len(totals.issuers) > 0 {
+			industries = append(industries, totals)
+		}
+	}
+	sort.Slice(industries, func(i, j int) bool {
+		if industries[i].sector != industries[j].sector {
+			return industries[i].sector < industries[j].sector
+		}
+		return industries[i].sic < industries[j].sic
+	})
+
+	out, err := openOutputFile(path, f, false)
+	if err != nil {
+		return err
+	}
+	for _, t := range industries {
+		values := []string{period, t.sector, t.sic, t.industry, strconv.Itoa(len(t.issuers)), strconv.Itoa(t.purchases), strconv.Itoa(t.sales),
+			t.bought.StringFixed(2), t.sold.StringFixed(2), t.bought.Sub(t.sold).StringFixed(2)}
+		if err := out.Write(&Row{Values: values}); err != nil {
+			out.Close()
+			return err
+		}
+	}
+	return out.Close()
+}
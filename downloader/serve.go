@@ -0,0 +1,573 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+const (
+	defaultPageSize = 100
+	maxPageSize     = 1000
+)
+
+// servedRow is a transaction the API serves, keyed by upper case column name like readOutputRows
+// gives it, with its dollar value (-1 without one) worked out for filtering and sorting
+type servedRow struct {
+	values map[string]string
+	value  float64
+}
+
+// transactionStore is the rows of the output files the API serves, held in memory with the order of
+// each sort key precomputed, so a page is a binary search and a scan
+type transactionStore struct {
+	rows []servedRow
+	// files are the output files read and when each was written, modified the newest of those
+	files    map[string]time.Time
+	modified time.Time
+	cache    *responseCache
+	metrics  *datasetMetrics
+	// orders are row indexes in ascending order of each sort key, ties by row index
+	orders map[string][]int
+	// version tells loads of different outputs apart, the same files as last written load as the same
+	// version, so cursors made before a reload only carry on over the same rows
+	version string
+}
+
+// errStaleCursor is a cursor made before the outputs were reloaded with other rows
+var errStaleCursor = errors.New("the outputs were reloaded since this cursor was made, start again from the first page")
+
+// sortKeys are what transactions can be sorted by, and how two rows compare on each
+var sortKeys = map[string]func(a, b *servedRow) int{
+	"transaction_date": func(a, b *servedRow) int {
+		return strings.Compare(a.values["TRANSACTION_DATE"], b.values["TRANSACTION_DATE"])
+	},
+	"value": func(a, b *servedRow) int {
+		switch {
+		case a.value < b.value:
+			return -1
+		case a.value > b.value:
+			return 1
+		}
+		return 0
+	},
+}
+
+// loadTransactions reads every csv or jsonl output file matching pattern
+func loadTransactions(pattern string) (*transactionStore, error) {
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no output files match %s", pattern)
+	}
+	sort.Strings(paths)
+
+	s := &transactionStore{orders: map[string][]int{}, files: map[string]time.Time{}}
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil {
+			s.files[path] = info.ModTime()
+			if info.ModTime().After(s.modified) {
+				s.modified = info.ModTime()
+			}
+		}
+		err := readOutputRows(path, func(row map[string]string) {
+			value := -1.0
+			amount, ok := parseDecimal(row["AMOUNT"])
+			price, priced := parseDecimal(row["PRICE"])
+			if ok && priced && price > 0 {
+				value = amount * price
+			}
+			s.rows = append(s.rows, servedRow{values: row, value: value})
+		})
+		if err != nil {
+			return nil, fmt.Errorf("error reading %s: %w", path, err)
+		}
+	}
+	h := sha256.New()
+	for _, path := range paths {
+		fmt.Fprintf(h, "%s\x00%d\n", path, s.files[path].UnixNano())
+	}
+	fmt.Fprintf(h, "%d", len(s.rows))
+	s.version = hex.EncodeToString(h.Sum(nil))[:16]
+	s.metrics = newDatasetMetrics(s.rows)
+	for name, compare := range sortKeys {
+		order := make([]int, len(s.rows))
+		for i := range order {
+			order[i] = i
+		}
+		sort.SliceStable(order, func(i, j int) bool { return compare(&s.rows[order[i]], &s.rows[order[j]]) < 0 })
+		s.orders[name] = order
+	}
+	return s, nil
+}
+
+// transactionQuery is what the /transactions query parameters ask for
+type transactionQuery struct {
+	from, to   string
+	ticker     string
+	insiderCIK string
+	codes      map[string]bool
+	minValue   float64
+	sort       string
+	descending bool
+	limit      int
+	// after is the row index of the last transaction of the previous page, -1 for the first page
+	after int
+}
+
+// parseTransactionQuery reads the query parameters of a /transactions request
+func parseTransactionQuery(params map[string][]string, store *transactionStore) (*transactionQuery, error) {
+	get := func(name string) string {
+		if v := params[name]; len(v) > 0 {
+			return strings.TrimSpace(v[0])
+		}
+		return ""
+	}
+	q := &transactionQuery{sort: "transaction_date", descending: true, limit: defaultPageSize, after: -1}
+	for _, date := range []struct {
+		name string
+		dst  *string
+	}{{"from", &q.from}, {"to", &q.to}} {
+		if v := get(date.name); v != "" {
+			if _, err := time.Parse("2006-01-02", v); err != nil {
+				return nil, fmt.Errorf("%s must be a date like 2024-01-31", date.name)
+			}
+			*date.dst = v
+		}
+	}
+	q.ticker = strings.ToUpper(get("ticker"))
+	if v := get("insider"); v != "" {
+		q.insiderCIK = edgar.PadCIK(v)
+	}
+	if v := get("code"); v != "" {
+		q.codes = map[string]bool{}
+		for _, code := range strings.Split(v, ",") {
+			q.codes[strings.ToUpper(strings.TrimSpace(code))] = true
+		}
+	}
+	if v := get("min_value"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return nil, errors.New("min_value must be a number of dollars")
+		}
+		q.minValue = f
+	}
+	if v := get("sort"); v != "" {
+		q.descending = strings.HasPrefix(v, "-")
+		q.sort = strings.TrimPrefix(strings.TrimPrefix(v, "-"), "+")
+		if sortKeys[q.sort] == nil {
+			return nil, fmt.Errorf("sort must be transaction_date or value, - first for descending")
+		}
+	}
+	if v := get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxPageSize {
+			return nil, fmt.Errorf("limit must be from 1 to %d", maxPageSize)
+		}
+		q.limit = n
+	}
+	if v := get("cursor"); v != "" {
+		after, err := decodeCursor(v, q, store.version)
+		if errors.Is(err, errStaleCursor) {
+			return nil, err
+		} else if err != nil || after < 0 || after >= len(store.rows) {
+			return nil, errors.New("cursor is not one this server returned for this sort")
+		}
+		q.after = after
+	}
+	return q, nil
+}
+
+// A cursor is the sort it was made for, the version of the outputs loaded and the row index of the
+// last transaction of a page, the next page starts after it. Row indexes only hold for the version
+// they were made on, a cursor of another is errStaleCursor.
+func encodeCursor(q *transactionQuery, version string, row int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%s:%t:%s:%d", q.sort, q.descending, version, row)))
+}
+
+func decodeCursor(cursor string, q *transactionQuery, version string) (int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	parts := strings.Split(string(b), ":")
+	if len(parts) != 4 || parts[0] != q.sort || parts[1] != strconv.FormatBool(q.descending) {
+		return 0, errors.New("cursor doesn't match the sort")
+	}
+	if parts[2] != version {
+		return 0, errStaleCursor
+	}
+	return strconv.Atoi(parts[3])
+}
+
+func (q *transactionQuery) matches(r *servedRow) bool {
+	date := r.values["TRANSACTION_DATE"]
+	switch {
+	case q.from != "" && date < q.from,
+		q.to != "" && date > q.to,
+		q.ticker != "" && strings.ToUpper(r.values["ISSUER_TICKER"]) != q.ticker,
+		q.insiderCIK != "" && edgar.PadCIK(r.values["REPORTER_CIK"]) != q.insiderCIK,
+		q.codes != nil && !q.codes[r.values["TRANSACTION_CODE"]],
+		q.minValue > 0 && r.value < q.minValue:
+		return false
+	}
+	return true
+}
+
+// find returns a page of the transactions matching q and the row index of its last one, -1 if there
+// are no more after it
+func (s *transactionStore) find(q *transactionQuery) ([]*servedRow, int) {
+	order, compare := s.orders[q.sort], sortKeys[q.sort]
+	// start is the position in order the page begins at when scanning up, or ends at when scanning down
+	start := 0
+	if q.descending {
+		start = len(order) - 1
+	}
+	if q.after >= 0 {
+		last := &s.rows[q.after]
+		i := sort.Search(len(order), func(i int) bool {
+			c := compare(&s.rows[order[i]], last)
+			return c > 0 || c == 0 && order[i] >= q.after
+		})
+		if q.descending {
+			start = i - 1
+		} else {
+			start = i + 1
+		}
+	}
+
+	page := []*servedRow{}
+	last, step := -1, 1
+	if q.descending {
+		step = -1
+	}
+	for i := start; i >= 0 && i < len(order); i += step {
+		r := &s.rows[order[i]]
+		if !q.matches(r) {
+			continue
+		}
+		if len(page) == q.limit {
+			return page, last
+		}
+		page = append(page, r)
+		last = order[i]
+	}
+	return page, -1
+}
+
+// rowObject is a transaction as the API returns it, its columns lower cased like the jsonl encoding
+// writes them and in the order of the csv header
+func rowObject(r *servedRow) orderedObject {
+	object := orderedObject{}
+	seen := map[string]bool{}
+	for _, column := range csvHeader {
+		if v, ok := r.values[column]; ok {
+			object = append(object, keyValue{strings.ToLower(column), v})
+			seen[column] = true
+		}
+	}
+	extra := []string{}
+	for column := range r.values {
+		if !seen[column] {
+			extra = append(extra, column)
+		}
+	}
+	sort.Strings(extra)
+	for _, column := range extra {
+		object = append(object, keyValue{strings.ToLower(column), r.values[column]})
+	}
+	return object
+}
+
+// apiServer serves the transactions of the -input outputs to the holders of the API keys, both of
+// which an admin can reload without a restart
+type apiServer struct {
+	input   string
+	limit   rateLimit
+	limiter *rateLimiter
+	// maxAge is how old the newest output may be for the server to be ready, 0 for any age
+	maxAge time.Duration
+	// cacheSize is how many responses each load of the outputs caches
+	cacheSize int
+	// loopback is whether the server listens on a loopback address, the only one it may serve on
+	// without API keys
+	loopback bool
+
+	mu    sync.RWMutex
+	store *transactionStore
+	keys  []APIKey
+}
+
+// load reads the outputs and the API keys, replacing the ones served only if both could be read. Off
+// a loopback address an empty set of keys, e.g. after every key was revoked, doesn't replace the
+// keys loaded before, so a reload can't open the server to anyone.
+func (s *apiServer) load() error {
+	store, err := loadTransactions(s.input)
+	if err != nil {
+		return err
+	}
+	store.cache = newResponseCache(s.cacheSize)
+	keys, err := LoadAPIKeys(apiKeysPath())
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	if len(keys) == 0 && !s.loopback && len(s.keys) > 0 {
+		log.Printf("%s has no API keys left, keeping the %d loaded before, serve doesn't go without keys off a loopback address", apiKeysPath(), len(s.keys))
+		keys = s.keys
+	}
+	s.store, s.keys = store, keys
+	s.mu.Unlock()
+	log.Printf("Loaded %d transactions from %s and %d API keys", len(store.rows), s.input, len(keys))
+	return nil
+}
+
+// outputsChanged is whether the output files matching -input are not the ones last loaded, or have
+// been written since
+func (s *apiServer) outputsChanged() bool {
+	store, _ := s.current()
+	paths, _ := filepath.Glob(s.input)
+	if len(paths) != len(store.files) {
+		return true
+	}
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if loaded, ok := store.files[path]; err != nil || !ok || !info.ModTime().Equal(loaded) {
+			return true
+		}
+	}
+	return false
+}
+
+// watch reloads the outputs every interval once they've changed, until ctx is done
+func (s *apiServer) watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if !s.outputsChanged() {
+			continue
+		}
+		if err := s.load(); err != nil {
+			log.Printf("Failed to reload, still serving the outputs loaded before: %s", err)
+		}
+	}
+}
+
+func (s *apiServer) current() (*transactionStore, []APIKey) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.store, s.keys
+}
+
+// requireScope wraps a handler so it needs a key with scope, or admin, once there are any keys.
+// Without keys every request is let through on a loopback address, and refused on any other. Requests
+// are rate limited per key, or per address for those without a valid one.
+func (s *apiServer) requireScope(scope string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, keys := s.current()
+		key, ok := authenticate(r, keys)
+		client, limit := "address "+clientAddress(r), s.limit
+		if ok {
+			client = "key " + key.Name
+			if key.Rate > 0 {
+				limit.Rate = key.Rate
+			}
+			if key.DailyQuota > 0 {
+				limit.DailyQuota = key.DailyQuota
+			}
+		}
+		if allowed, wait := s.limiter.allow(client, limit); !allowed {
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, fmt.Sprintf("rate limit or daily quota of %s reached, retry in %s", client, wait.Round(time.Second)))
+			return
+		}
+
+		if len(keys) == 0 && s.loopback {
+			next(w, r)
+			return
+		}
+		if !ok {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="sec4"`)
+			writeJSONError(w, http.StatusUnauthorized, "missing or unknown API key")
+			return
+		}
+		if key.Scope != scope && key.Scope != scopeAdmin {
+			writeJSONError(w, http.StatusForbidden, fmt.Sprintf("API key %s doesn't have the %s scope", key.Name, scope))
+			return
+		}
+		next(w, r)
+	}
+}
+
+// transactions serves GET /transactions, a page of the transactions the query parameters filter and
+// sort, with a next_cursor to fetch the page after it
+func (s *apiServer) transactions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, "only GET is supported")
+		return
+	}
+	store, _ := s.current()
+	// Encode sorts the parameters, so the same query is one entry however it was written
+	cacheKey := r.URL.Query().Encode()
+	if body, ok := store.cache.get(cacheKey); ok {
+		writeJSONBody(w, http.StatusOK, body)
+		return
+	}
+	q, err := parseTransactionQuery(r.URL.Query(), store)
+	if errors.Is(err, errStaleCursor) {
+		writeJSONError(w, http.StatusGone, err.Error())
+		return
+	} else if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	page, last := store.find(q)
+	transactions := make([]orderedObject, len(page))
+	for i, row := range page {
+		transactions[i] = rowObject(row)
+	}
+	response := orderedObject{{"transactions", transactions}}
+	if last >= 0 {
+		response = append(response, keyValue{"next_cursor", encodeCursor(q, store.version, last)})
+	}
+	body, err := json.Marshal(response)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	store.cache.put(cacheKey, body)
+	writeJSONBody(w, http.StatusOK, body)
+}
+
+// healthz serves GET /healthz, answering as long as the server is up
+func (s *apiServer) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, orderedObject{{"status", "ok"}})
+}
+
+// readyz serves GET /readyz, whether the outputs are loaded and the newest is no older than -max-age,
+// with how many transactions there are, how old it is and how the response cache is doing
+func (s *apiServer) readyz(w http.ResponseWriter, r *http.Request) {
+	store, keys := s.current()
+	age := time.Since(store.modified).Round(time.Second)
+	status, code := "ready", http.StatusOK
+	if len(store.rows) == 0 {
+		status, code = "no transactions loaded", http.StatusServiceUnavailable
+	} else if s.maxAge > 0 && age > s.maxAge {
+		status, code = fmt.Sprintf("newest output is older than %s", s.maxAge), http.StatusServiceUnavailable
+	}
+	entries, hits, misses := store.cache.stats()
+	writeJSON(w, code, orderedObject{
+		{"status", status},
+		{"transactions", len(store.rows)},
+		{"api_keys", len(keys)},
+		{"output_modified", store.modified.UTC().Format(time.RFC3339)},
+		{"output_age_seconds", int64(age.Seconds())},
+		{"cached_responses", entries},
+		{"cache_hits", hits},
+		{"cache_misses", misses},
+	})
+}
+
+// reload serves POST /admin/reload, reading the outputs and API keys again
+func (s *apiServer) reload(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, "only POST is supported")
+		return
+	}
+	if err := s.load(); err != nil {
+		log.Printf("Failed to reload: %s", err)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	store, keys := s.current()
+	writeJSON(w, http.StatusOK, orderedObject{{"transactions", len(store.rows)}, {"api_keys", len(keys)}})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONBody(w http.ResponseWriter, status int, body []byte) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(body)
+	w.Write([]byte("\n"))
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, orderedObject{{"error", message}})
+}
+
+func runServe(ctx context.Context, args []string) {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	listen := fs.String("listen", "localhost:8080", "address to serve the API on")
+	input := fs.String("input", "form4_*.csv", "output files to serve, a path or glob of csv or jsonl files")
+	rate := fs.Float64("rate", 10, "requests a second each API key, or address without one, may make on average, 0 for no limit")
+	burst := fs.Int("burst", 20, "requests each client may make at once before -rate applies")
+	dailyQuota := fs.Int("daily-quota", 0, "requests each client may make a UTC day, 0 for no quota")
+	cacheSize := fs.Int("cache-size", 1000, "responses to keep cached, 0 to cache none")
+	reloadInterval := fs.Duration("reload-interval", time.Minute, "how often to check the outputs for new filings and reload them, 0 to only reload through /admin/reload")
+	maxAge := fs.Duration("max-age", 0, "how old the newest output may be before /readyz reports not ready, e.g. 26h (default any age)")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		log.Fatal("Usage: serve [-listen host:port] [-input glob] [-rate n] [-burst n] [-daily-quota n] [-max-age d] [-cache-size n] [-reload-interval d]")
+	}
+	if *burst < 1 {
+		log.Fatal("-burst must be at least 1")
+	}
+
+	s := &apiServer{input: *input, limit: rateLimit{Rate: *rate, Burst: *burst, DailyQuota: *dailyQuota}, limiter: newRateLimiter(), maxAge: *maxAge, cacheSize: *cacheSize, loopback: isLoopback(*listen)}
+	if err := s.load(); err != nil {
+		log.Fatal(err)
+	}
+	if _, keys := s.current(); len(keys) == 0 && !s.loopback {
+		log.Fatalf("Refusing to serve on %s without API keys, create one with keys create", *listen)
+	}
+
+	if *reloadInterval > 0 {
+		go s.watch(ctx, *reloadInterval)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/transactions", s.requireScope(scopeRead, s.transactions))
+	mux.HandleFunc("/admin/reload", s.requireScope(scopeAdmin, s.reload))
+	mux.HandleFunc("/metrics", s.requireScope(scopeRead, s.metrics))
+	// Probes need neither a key nor a share of the rate limit
+	mux.HandleFunc("/healthz", s.healthz)
+	mux.HandleFunc("/readyz", s.readyz)
+	server := &http.Server{Addr: *listen, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	log.Printf("Serving on http://%s/transactions", *listen)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+// sharedDedupeKey is the Redis set, under -redis-prefix, of the accession numbers written by the
+// instances sharing -redis with -redis-dedupe
+const sharedDedupeKey = "accessions"
+
+// sharedDedupe is the accession set of -redis-dedupe, nil without it
+var sharedDedupe *accessionSet
+
+// accessionSet is the filings written by every instance sharing a Redis. A filing is only added once
+// the output it was written to is closed and its manifest saved, so one that failed, or whose run was
+// interrupted and can't be resumed, is still downloaded by the next instance to reach it.
+type accessionSet struct {
+	cache *redisCache
+}
+
+// setupSharedDedupe shares the filings written through -redis, with -redis-dedupe
+func setupSharedDedupe() error {
+	if !*redisDedupe {
+		return nil
+	}
+	if sharedCache == nil {
+		return fmt.Errorf("-redis-dedupe needs -redis")
+	}
+	sharedDedupe = &accessionSet{cache: sharedCache}
+	return nil
+}
+
+// filter drops the filings another instance has written. Redis is only a cache, a filing that can't
+// be looked up is kept and the error logged. Without -redis-dedupe every filing is kept.
+func (s *accessionSet) filter(ctx context.Context, filings []*edgar.IndexEntry) ([]*edgar.IndexEntry, error) {
+	if s == nil {
+		return filings, nil
+	}
+	kept := filings[:0]
+	for _, filing := range filings {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		member, err := s.cache.do("SISMEMBER", *redisPrefix+sharedDedupeKey, filing.AccessionNumber)
+		if err != nil {
+			log.Printf("Failed to look up %s in redis, %s", filing.AccessionNumber, err)
+		} else if member == int64(1) {
+			debugf("Skipping %s, another instance has written it", filing.AccessionNumber)
+			continue
+		}
+		kept = append(kept, filing)
+	}
+	return kept, nil
+}
+
+// add records accessions as written, once the output they were written to is closed
+func (s *accessionSet) add(accessions []string) {
+	if s == nil || len(accessions) == 0 {
+		return
+	}
+	// In batches, so a quarter is a few requests rather than one huge one
+	for start := 0; start < len(accessions); start += 1000 {
+		end := start + 1000
+		if end > len(accessions) {
+			end = len(accessions)
+		}
+		args := append([]string{"SADD", *redisPrefix + sharedDedupeKey}, accessions[start:end]...)
+		if _, err := s.cache.do(args...); err != nil {
+			log.Printf("Failed to share %d written filings through redis, other instances may write them again, %s", len(accessions)-start, err)
+			return
+		}
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"go.uber.org/ratelimit"
+)
+
+var (
+	requestsPerSecond = flag.Int("requests-per-second", edgar.DefaultRequestsPerSecond, "EDGAR requests to make per second, across every instance sharing -redis with -redis-rate-limit")
+	redisRateLimit    = flag.Bool("redis-rate-limit", false, "pace EDGAR requests together with the other instances using -redis, so instances behind the same IP stay under the SEC's limit between them")
+)
+
+const (
+	// sharedSlotTTL is how long a claimed slot's key is kept, long after the slot has passed
+	sharedSlotTTL = 10 * time.Second
+	// sharedLimiterRetry is how long the limiter paces requests on its own after Redis failed
+	sharedLimiterRetry = 10 * time.Second
+)
+
+// sharedLimiter paces the requests of every instance using the same Redis. Time is cut into slots of
+// 1/rate seconds, and each request claims the next slot no instance has, by setting its key only if
+// it isn't set, then waits for it to start. Instances need their clocks in sync, as NTP keeps them.
+type sharedLimiter struct {
+	cache    *redisCache
+	interval time.Duration
+	// fallback paces requests while Redis is failing, at a rate too low for a few instances on their
+	// own to add up to the SEC's limit
+	fallback ratelimit.Limiter
+
+	mu sync.Mutex
+	// next is the slot after the last one this instance tried, the slots before it are taken
+	next int64
+	// failedAt is when Redis last failed
+	failedAt time.Time
+}
+
+// newClientLimiter is the limiter of the EDGAR client, shared through -redis with -redis-rate-limit
+func newClientLimiter() (ratelimit.Limiter, error) {
+	if *requestsPerSecond < 1 {
+		return nil, fmt.Errorf("-requests-per-second must be at least 1")
+	}
+	if !*redisRateLimit {
+		return ratelimit.New(*requestsPerSecond), nil
+	}
+	if sharedCache == nil {
+		return nil, fmt.Errorf("-redis-rate-limit needs -redis")
+	}
+	return &sharedLimiter{cache: sharedCache, interval: time.Second / time.Duration(*requestsPerSecond), fallback: ratelimit.New(1)}, nil
+}
+
+// Take blocks until the instance may make its next request
+func (l *sharedLimiter) Take() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if !l.failedAt.IsZero() && time.Since(l.failedAt) < sharedLimiterRetry {
+		return l.fallback.Take()
+	}
+	for {
+		slot := time.Now().UnixNano() / int64(l.interval)
+		if slot < l.next {
+			slot = l.next
+		}
+		claimed, err := l.cache.claim(fmt.Sprintf("rate:%d", slot), "1", sharedSlotTTL)
+		if err != nil {
+			if l.failedAt.IsZero() {
+				log.Printf("Failed to claim a request slot in redis, pacing requests at 1 a second on our own: %s", err)
+			}
+			l.failedAt = time.Now()
+			return l.fallback.Take()
+		}
+		if !l.failedAt.IsZero() {
+			log.Printf("Claiming request slots in redis again")
+			l.failedAt = time.Time{}
+		}
+		l.next = slot + 1
+		if claimed {
+			start := time.Unix(0, slot*int64(l.interval))
+			time.Sleep(time.Until(start))
+			return start
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"flag"
+	"io"
+	"net"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	"github.com/lib/pq"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+var (
+	dbMaxConns     = flag.Int("db-max-conns", 4, "most connections the snowflake and redshift sinks keep open to their database")
+	dbConnLifetime = flag.Duration("db-conn-lifetime", 30*time.Minute, "reopen a snowflake or redshift sink connection once it has been open this long, so ones a proxy or failover dropped without a word don't linger")
+)
+
+// openSinkDB opens the pool of connections a database sink runs its statements on, checking the
+// database can be reached
+func openSinkDB(ctx context.Context, driverName, dsn string) (*sql.DB, error) {
+	db, err := sql.Open(driverName, dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetMaxOpenConns(*dbMaxConns)
+	db.SetMaxIdleConns(*dbMaxConns)
+	db.SetConnMaxLifetime(*dbConnLifetime)
+	err = retryDB(ctx, db, "Connecting to the "+driverName+" database", func(conn *sql.Conn) error {
+		return conn.PingContext(ctx)
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// retryDB runs fn on a connection from db's pool like retrySink, retrying only the errors
+// transientDBError says another attempt could get past. The connection of an attempt that failed on
+// one is closed rather than returned to the pool, so the next attempt reconnects.
+func retryDB(ctx context.Context, db *sql.DB, what string, fn func(conn *sql.Conn) error) error {
+	return retrySink(ctx, what, func() error {
+		conn, err := db.Conn(ctx)
+		if err == nil {
+			err = fn(conn)
+			if err != nil && transientDBError(err) {
+				conn.Raw(func(interface{}) error {
+					return driver.ErrBadConn
+				})
+			}
+			conn.Close()
+		}
+		if err != nil && !transientDBError(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	})
+}
+
+// transientDBError is whether err is a dropped or refused connection, or the database shedding load,
+// rather than something wrong with the statement or the credentials
+func transientDBError(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		switch pqErr.Code {
+		// Shutdowns, the database starting up, and transactions that lost a conflict
+		case "57P01", "57P02", "57P03", "40001", "40P01":
+			return true
+		}
+		// Connection exceptions and insufficient resources
+		return pqErr.Code.Class() == "08" || pqErr.Code.Class() == "53"
+	}
+	var sfErr *gosnowflake.SnowflakeError
+	if errors.As(err, &sfErr) {
+		switch sfErr.Number {
+		case gosnowflake.ErrCodeServiceUnavailable, gosnowflake.ErrFailedToPostQuery, gosnowflake.ErrFailedToRenewSession,
+			gosnowflake.ErrFailedToHeartbeat, gosnowflake.ErrFailedToGetChunk, gosnowflake.ErrFailedToUploadToStage,
+			gosnowflake.ErrBindUpload, gosnowflake.ErrSessionGone:
+			return true
+		}
+		return strings.HasPrefix(sfErr.SQLState, "08")
+	}
+	var netErr net.Error
+	return errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.EPIPE) ||
+		errors.As(err, &netErr)
+}
+
+// sqlMigrationDB is the migrationDB of the sinks on database/sql
+type sqlMigrationDB struct {
+	db      *sql.DB
+	dialect migrationDialect
+}
+
+func (m *sqlMigrationDB) Dialect() migrationDialect {
+	return m.dialect
+}
+
+func (m *sqlMigrationDB) Exec(ctx context.Context, statement string) error {
+	return retryDB(ctx, m.db, "Migrating "+m.dialect.Table, func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, statement)
+		return err
+	})
+}
+
+func (m *sqlMigrationDB) Query(ctx context.Context, query string) ([][]string, error) {
+	var values [][]string
+	err := retryDB(ctx, m.db, "Migrating "+m.dialect.Table, func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+		columns, err := rows.Columns()
+		if err != nil {
+			return err
+		}
+		values = nil
+		for rows.Next() {
+			row := make([]sql.NullString, len(columns))
+			dest := make([]interface{}, len(columns))
+			for i := range row {
+				dest[i] = &row[i]
+			}
+			if err = rows.Scan(dest...); err != nil {
+				return err
+			}
+			strs := make([]string, len(row))
+			for i, v := range row {
+				strs[i] = v.String
+			}
+			values = append(values, strs)
+		}
+		return rows.Err()
+	})
+	return values, err
+}
+
+func (m *sqlMigrationDB) Close() error {
+	return m.db.Close()
+}
+
+// sqlTableParts splits a table name qualified by database and schema, returning the qualifier the
+// information schema is under, the schema as a SQL expression and the table. Unquoted names are folded
+// to the database's case with fold.
+func sqlTableParts(table string, fold func(string) string) (qualifier, schema, name string) {
+	parts := strings.Split(table, ".")
+	name = fold(parts[len(parts)-1])
+	schema = "CURRENT_SCHEMA()"
+	if len(parts) > 1 {
+		schema = "'" + sqlString(fold(parts[len(parts)-2])) + "'"
+	}
+	if len(parts) > 2 {
+		qualifier = strings.Join(parts[:len(parts)-2], ".") + "."
+	}
+	return qualifier, schema, name
+}
+
+// sqlMigrationsTable is migrationsTable in the schema of table
+func sqlMigrationsTable(table string) string {
+	i := strings.LastIndex(table, ".")
+	return table[:i+1] + migrationsTable
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"strings"
+
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"github.com/snowflakedb/gosnowflake"
+)
+
+func init() {
+	RegisterSink("snowflake", openSnowflake)
+	migrationDBs["snowflake"] = openSnowflakeMigrations
+}
+
+// snowflakeBatchRows is how many rows are buffered before being inserted into the load table, unless
+// -batch-rows says otherwise. Binds of this many rows are over the driver's array binding threshold,
+// so it uploads them to a stage and loads them with COPY INTO rather than binding each value.
+const snowflakeBatchRows = 10000
+
+// snowflakeWriter loads rows into a load table of the run's own as they come in and merges them into
+// -table when closed, or every -commit-rows, updating the rows already in it in place. Re-running a
+// quarter leaves one copy of each filing's rows, and a run that fails leaves the table as it was at
+// its last commit.
+type snowflakeWriter struct {
+	db *sql.DB
+	// load is a transient table rather than a temporary one, which would be lost with the session
+	// that made it when a connection is reopened
+	table string
+	load  string
+
+	// columns are the quoted column names, batch holds the buffered values column by column
+	columns   []string
+	batch     [][]string
+	batchRows int
+	commits   commitPoint
+}
+
+// openSnowflake is the snowflake sink, connecting to the -output DSN
+// (user:password@account/database/schema?warehouse=wh) and creating -table if it doesn't exist
+func openSnowflake(ctx context.Context, opts SinkOptions) (RowWriter, error) {
+	for _, name := range []string{"partition", "columns", "format", "compress", "max-rows", "max-bytes"} {
+		if flagIsSet(flag.CommandLine, name) {
+			return nil, fmt.Errorf("-%s does not apply to the snowflake sink", name)
+		}
+	}
+	if opts.Target == "" {
+		return nil, fmt.Errorf("the snowflake sink needs a DSN as -output")
+	}
+
+	db, err := openSinkDB(ctx, "snowflake", opts.Target)
+	if err != nil {
+		return nil, err
+	}
+	w := &snowflakeWriter{
+		db:        db,
+		table:     *table,
+		load:      *table + "_SEC4_LOAD_" + gonanoid.MustGenerate("ABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789", 12),
+		batch:     make([][]string, len(opts.Header)),
+		batchRows: sinkBatchRows(snowflakeBatchRows),
+	}
+
+	definitions := []string{}
+	for _, column := range opts.Header {
+		quoted := snowflakeQuote(column)
+		w.columns = append(w.columns, quoted)
+		definitions = append(definitions, quoted+" VARCHAR")
+	}
+	migrations := &sqlMigrationDB{db: db, dialect: snowflakeDialect(w.table)}
+	err = checkTableSchema(ctx, migrations, func() error {
+		return migrations.Exec(ctx, fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (%s)", w.table, strings.Join(definitions, ", ")))
+	})
+	if err == nil {
+		err = migrations.Exec(ctx, fmt.Sprintf("CREATE TRANSIENT TABLE %s (%s) DATA_RETENTION_TIME_IN_DAYS = 0", w.load, strings.Join(definitions, ", ")))
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// openSnowflakeMigrations opens the -output DSN for db migrate of -table
+func openSnowflakeMigrations(ctx context.Context, target string) (migrationDB, error) {
+	db, err := openSinkDB(ctx, "snowflake", target)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlMigrationDB{db: db, dialect: snowflakeDialect(*table)}, nil
+}
+
+// snowflakeDialect has output columns as quoted upper case names, and unquoted table names folded
+// to upper case as Snowflake does
+func snowflakeDialect(table string) migrationDialect {
+	qualifier, schema, name := sqlTableParts(table, strings.ToUpper)
+	return migrationDialect{
+		Table:      table,
+		Migrations: sqlMigrationsTable(table),
+		Name:       func(column string) string { return column },
+		Quote:      snowflakeQuote,
+		Text:       "VARCHAR",
+		Int:        "INTEGER",
+		Bool:       "BOOLEAN",
+		Timestamp:  "TIMESTAMP_NTZ",
+		ColumnsQuery: fmt.Sprintf("SELECT column_name FROM %sinformation_schema.columns WHERE table_schema = %s AND table_name = '%s'",
+			qualifier, schema, sqlString(name)),
+	}
+}
+
+func (w *snowflakeWriter) Write(ctx context.Context, row *Row) error {
+	if w.commits.add(row) {
+		if err := w.commit(ctx); err != nil {
+			return err
+		}
+	}
+	for i := range w.batch {
+		w.batch[i] = append(w.batch[i], row.value(i))
+	}
+	if len(w.batch[0]) >= w.batchRows {
+		return w.flush(ctx)
+	}
+	return nil
+}
+
+// flush inserts the buffered rows into the load table with one array bind per column
+func (w *snowflakeWriter) flush(ctx context.Context) error {
+	if len(w.batch) == 0 || len(w.batch[0]) == 0 {
+		return nil
+	}
+	args := make([]interface{}, len(w.batch))
+	for i, values := range w.batch {
+		args[i] = gosnowflake.Array(values)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(w.columns)), ", ")
+	statement := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", w.load, strings.Join(w.columns, ", "), placeholders)
+	err := retryDB(ctx, w.db, "Inserting rows into "+w.load, func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, statement, args...)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	for i := range w.batch {
+		w.batch[i] = nil
+	}
+	return nil
+}
+
+// commit inserts the buffered rows and merges the load table into the table on upsertKey in one
+// transaction, updating the rows already in it and inserting the rest, then deleting the rows of the
+// loaded filings that weren't loaded and emptying the load table
+func (w *snowflakeWriter) commit(ctx context.Context) error {
+	if err := w.flush(ctx); err != nil {
+		return err
+	}
+	updates, values, key := []string{}, []string{}, []string{}
+	for _, column := range w.columns {
+		updates = append(updates, fmt.Sprintf("%s = l.%s", column, column))
+		values = append(values, "l."+column)
+	}
+	for _, column := range upsertKey {
+		key = append(key, snowflakeQuote(column))
+	}
+	// An insert retried after its response was lost may have loaded its rows twice, the merge only
+	// takes one of each
+	source := fmt.Sprintf("(SELECT * FROM %s QUALIFY ROW_NUMBER() OVER (PARTITION BY %s ORDER BY %s) = 1)", w.load, strings.Join(key, ", "), strings.Join(key, ", "))
+	statements := []string{
+		fmt.Sprintf("MERGE INTO %s t USING %s l ON %s WHEN MATCHED THEN UPDATE SET %s WHEN NOT MATCHED THEN INSERT (%s) VALUES (%s)",
+			w.table, source, keyMatches("t", "l", snowflakeQuote), strings.Join(updates, ", "), strings.Join(w.columns, ", "), strings.Join(values, ", ")),
+		deleteStaleRows(w.table+" t", "t", w.load, snowflakeQuote),
+		fmt.Sprintf("DELETE FROM %s", w.load),
+	}
+	return retryDB(ctx, w.db, "Merging into "+w.table, func(conn *sql.Conn) error {
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		for _, statement := range statements {
+			if _, err = tx.ExecContext(ctx, statement); err != nil {
+				tx.Rollback()
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+}
+
+// Close commits the rows loaded since the last commit and drops the load table
+func (w *snowflakeWriter) Close() error {
+	defer w.db.Close()
+	ctx := context.Background()
+	if err := w.commit(ctx); err != nil {
+		return err
+	}
+	return retryDB(ctx, w.db, "Dropping "+w.load, func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf("DROP TABLE IF EXISTS %s", w.load))
+		return err
+	})
+}
+
+// snowflakeQuote quotes a column name, keeping its case so extractor columns are valid too
+func snowflakeQuote(column string) string {
+	return `"` + strings.ReplaceAll(column, `"`, `""`) + `"`
+}
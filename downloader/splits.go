@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/shopspring/decimal"
+)
+
+var (
+	corporateActions = flag.String("corporate-actions", "", "registered corporate action provider to compute the split adjusted columns with, e.g. splits-file (default none, leaving them empty)")
+	splitsPath       = flag.String("splits", "splits.csv", "CSV of ISSUER_CIK,EX_DATE,RATIO rows the splits-file provider reads, RATIO as 2, 3:2 or 1:10")
+)
+
+// adjustedPricePlaces is how many decimal places split adjusted prices are rounded to
+const adjustedPricePlaces = 6
+
+func init() {
+	RegisterCorporateActionProvider("splits-file", &splitsFile{})
+}
+
+// provider is the -corporate-actions provider, nil when none was picked
+var provider CorporateActionProvider
+
+func setupCorporateActions(ctx context.Context) error {
+	if *corporateActions == "" {
+		return nil
+	}
+	p, err := LookupCorporateActionProvider(*corporateActions)
+	if err != nil {
+		return err
+	}
+	if s, ok := p.(interface {
+		Setup(ctx context.Context) error
+	}); ok {
+		if err := s.Setup(ctx); err != nil {
+			return fmt.Errorf("error setting up corporate action provider %s: %w", *corporateActions, err)
+		}
+	}
+	provider = p
+	return nil
+}
+
+// issuerSplits returns the issuer's splits from the provider, nil if there is no provider or it failed
+func issuerSplits(ctx context.Context, issuerCIK string) []Split {
+	if provider == nil {
+		return nil
+	}
+	splits, err := provider.Splits(ctx, issuerCIK)
+	if err != nil {
+		log.Printf("Failed to get the splits of CIK %s, leaving its transactions unadjusted: %s", issuerCIK, err)
+		return nil
+	}
+	if splits == nil {
+		splits = []Split{}
+	}
+	return splits
+}
+
+// splitAdjusted returns a transaction's shares, price and shares owned following it adjusted to today's
+// share basis, by every split with an ex date after the transaction. They are empty when the splits
+// aren't known or the value itself is.
+func splitAdjusted(splits []Split, t form4.TransactionRow) (shares, price, owned string) {
+	if splits == nil || t.TransactionDate == "" {
+		return "", "", ""
+	}
+	factor := decimal.NewFromInt(1)
+	for _, s := range splits {
+		if s.ExDate > t.TransactionDate {
+			factor = factor.Mul(s.Ratio)
+		}
+	}
+	adjust := func(v string, fn func(d decimal.Decimal) decimal.Decimal) string {
+		d, err := form4.ParseDecimal(v)
+		if err != nil {
+			return ""
+		}
+		return fn(d).String()
+	}
+	shares = adjust(t.Shares, factor.Mul)
+	price = adjust(t.PricePerShare, func(d decimal.Decimal) decimal.Decimal { return d.DivRound(factor, adjustedPricePlaces) })
+	owned = adjust(t.SharesOwnedFollowingTransaction, factor.Mul)
+	return shares, price, owned
+}
+
+// splitsFile is the splits-file provider, reading every split from the -splits CSV when set up
+type splitsFile struct {
+	splits map[string][]Split
+}
+
+func (f *splitsFile) Setup(ctx context.Context) error {
+	var err error
+	f.splits, err = readSplitsFile(*splitsPath)
+	return err
+}
+
+func (f *splitsFile) Splits(ctx context.Context, issuerCIK string) ([]Split, error) {
+	return f.splits[edgar.PadCIK(issuerCIK)], nil
+}
+
+func readSplitsFile(path string) (map[string][]Split, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	records, err := csv.NewReader(file).ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("error reading splits %s: %w", path, err)
+	}
+
+	splits := map[string][]Split{}
+	for i, r := range records {
+		if len(r) != 3 {
+			return nil, fmt.Errorf("%s line %d: expected ISSUER_CIK,EX_DATE,RATIO", path, i+1)
+		}
+		if i == 0 && strings.EqualFold(r[0], "ISSUER_CIK") {
+			continue
+		}
+		exDate, err := form4.NormalizeDate(r[1])
+		if err == nil && exDate == "" {
+			err = form4.ErrInvalidDate
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		ratio, err := parseSplitRatio(r[2])
+		if err != nil {
+			return nil, fmt.Errorf("%s line %d: %w", path, i+1, err)
+		}
+		cik := edgar.PadCIK(r[0])
+		splits[cik] = append(splits[cik], Split{ExDate: exDate, Ratio: ratio})
+	}
+	return splits, nil
+}
+
+var errInvalidSplitRatio = errors.New("ErrInvalidSplitRatio")
+
+// parseSplitRatio reads a split ratio as new shares per old share, either a decimal (2, 0.1) or
+// new:old (3:2 for a 3-for-2 split, 1:10 for a 1-for-10 reverse split)
+func parseSplitRatio(s string) (decimal.Decimal, error) {
+	newShares, oldShares, isRatio := strings.Cut(strings.TrimSpace(s), ":")
+	if !isRatio {
+		oldShares = "1"
+	}
+	n, err := form4.ParseDecimal(newShares)
+	if err != nil {
+		return decimal.Zero, fmt.Errorf("%q: %w", s, errInvalidSplitRatio)
+	}
+	d, err := form4.ParseDecimal(oldShares)
+	if err != nil || n.IsZero() || d.IsZero() {
+		return decimal.Zero, fmt.Errorf("%q: %w", s, errInvalidSplitRatio)
+	}
+	return n.Div(d), nil
+}
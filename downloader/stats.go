@@ -0,0 +1,347 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/klauspost/compress/zstd"
+	"github.com/shopspring/decimal"
+)
+
+var periodPattern = regexp.MustCompile(`^(\d{4})[Qq]([1-4])$`)
+
+// parsePeriod reads a quarter written like 2024Q1
+func parsePeriod(period string) (int, int, error) {
+	m := periodPattern.FindStringSubmatch(period)
+	if m == nil {
+		return 0, 0, fmt.Errorf("invalid period %q, expected a quarter like 2024Q1", period)
+	}
+	y, _ := strconv.Atoi(m[1])
+	q, _ := strconv.Atoi(m[2])
+	return y, q, nil
+}
+
+func runStats(args []string) {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	period := fs.String("period", fmt.Sprintf("%dQ%d", defaultYear, defaultQuarter), "quarter to report on, e.g. 2024Q1")
+	input := fs.String("input", "", "csv or jsonl output of the quarter to read (default form4_<year>_q<quarter>.csv)")
+	limit := fs.Int("limit", 10, "rows to show in each leaderboard")
+	sectors := fs.String("sectors", "", "-sector-rollup output of the quarter to add net insider buying by sector from")
+	rolling := fs.Bool("rolling", false, "print the issuers with the most net insider buying over the 7, 30 and 90 days to the latest transaction downloaded instead")
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		log.Fatal("Usage: stats [-period 2024Q1] [-input file] [-limit n] [-sectors file] [-rolling]")
+	}
+	if *rolling {
+		if err := printRolling(os.Stdout, *limit); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	y, q, err := parsePeriod(*period)
+	if err != nil {
+		log.Fatal(err)
+	}
+	path := *input
+	if path == "" {
+		path = fmt.Sprintf("form4_%d_q%d.csv", y, q)
+	}
+
+	s := newQuarterStats()
+	if err = readOutputRows(path, s.add); err != nil {
+		log.Printf("Failed to read %s", path)
+		log.Fatal(err)
+	}
+	if *sectors != "" {
+		if err = readOutputRows(*sectors, s.addIndustry); err != nil {
+			log.Printf("Failed to read %s", *sectors)
+			log.Fatal(err)
+		}
+	}
+	s.print(os.Stdout, fmt.Sprintf("%dQ%d", y, q), *limit)
+}
+
+// readOutputRows calls fn with each row of a csv or jsonl output file, keyed by upper case column
+// name. The encoding and compression are detected from the file name as they are for -output.
+func readOutputRows(path string, fn func(row map[string]string)) error {
+	format, err := DetectOutputFormat(path, "", "")
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var r io.Reader = bufio.NewReader(f)
+	switch format.Compression {
+	case "gzip":
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	case "zstd":
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer zr.Close()
+		r = zr
+	}
+
+	if format.Encoding == "jsonl" {
+		dec := json.NewDecoder(r)
+		for {
+			object := map[string]string{}
+			if err = dec.Decode(&object); errors.Is(err, io.EOF) {
+				return nil
+			} else if err != nil {
+				return err
+			}
+			row := make(map[string]string, len(object))
+			for k, v := range object {
+				row[strings.ToUpper(k)] = v
+			}
+			fn(row)
+		}
+	}
+
+	cr := csv.NewReader(r)
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for {
+		record, err := cr.Read()
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		fn(row)
+	}
+}
+
+// parseDecimal reads an amount or price, which outputs written before they were normalized may hold
+// with thousands separators
+func parseDecimal(s string) (float64, bool) {
+	d, err := form4.ParseDecimal(s)
+	if err != nil {
+		return 0, false
+	}
+	f, _ := d.Float64()
+	return f, true
+}
+
+// parseSigned reads a net value, which unlike a filed amount or price may be negative
+func parseSigned(s string) (float64, bool) {
+	d, err := decimal.NewFromString(s)
+	if err != nil {
+		return 0, false
+	}
+	f, _ := d.Float64()
+	return f, true
+}
+
+// leader is an insider or issuer on a leaderboard
+type leader struct {
+	name   string
+	detail string
+	value  float64
+	count  int
+}
+
+// quarterStats accumulates the leaderboards of the stats command from the rows of a quarter
+type quarterStats struct {
+	rows      int
+	insiders  map[string]*leader
+	issuers   map[string]*leader
+	largest   []largestTransaction
+	codes     map[string]int
+	purchases int
+	sales     int
+	// sectors is only filled in from a sector rollup
+	sectors map[string]*leader
+}
+
+// largestTransaction is a purchase or sale with its dollar value
+type largestTransaction struct {
+	row   map[string]string
+	value float64
+}
+
+func newQuarterStats() *quarterStats {
+	return &quarterStats{insiders: map[string]*leader{}, issuers: map[string]*leader{}, codes: map[string]int{}, sectors: map[string]*leader{}}
+}
+
+// addIndustry adds a row of a sector rollup to its sector's net insider buying
+func (s *quarterStats) addIndustry(row map[string]string) {
+	name := row["SECTOR"]
+	if name == "" {
+		name = "Unclassified"
+	}
+	sector := s.sectors[name]
+	if sector == nil {
+		sector = &leader{name: name}
+		s.sectors[name] = sector
+	}
+	net, _ := parseSigned(row["NET_VALUE"])
+	issuers, _ := strconv.Atoi(row["ISSUERS"])
+	sector.value += net
+	sector.count += issuers
+}
+
+func (s *quarterStats) add(row map[string]string) {
+	s.rows++
+	code := row["TRANSACTION_CODE"]
+	s.codes[code]++
+	if code != "P" && code != "S" {
+		return
+	}
+
+	amount, ok := parseDecimal(row["AMOUNT"])
+	price, priced := parseDecimal(row["PRICE"])
+	if !ok || !priced || price <= 0 {
+		return
+	}
+	value := amount * price
+
+	issuer := s.issuers[row["ISSUER_CIK"]]
+	if issuer == nil {
+		issuer = &leader{name: row["ISSUER_NAME"], detail: row["ISSUER_TICKER"]}
+		s.issuers[row["ISSUER_CIK"]] = issuer
+	}
+	issuer.count++
+	if code == "S" {
+		s.sales++
+		issuer.value -= value
+	} else {
+		s.purchases++
+		issuer.value += value
+		insider := s.insiders[row["REPORTER_CIK"]]
+		if insider == nil {
+			insider = &leader{name: row["NAME_OF_REPORTING_PERSON"], detail: row["ISSUER_TICKER"]}
+			s.insiders[row["REPORTER_CIK"]] = insider
+		}
+		insider.value += value
+		insider.count++
+	}
+	s.largest = append(s.largest, largestTransaction{row: row, value: value})
+}
+
+// top sorts leaders by value, largest first, keeping the first n
+func top(leaders map[string]*leader, n int) []*leader {
+	sorted := make([]*leader, 0, len(leaders))
+	for _, l := range leaders {
+		sorted = append(sorted, l)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].value != sorted[j].value {
+			return sorted[i].value > sorted[j].value
+		}
+		return sorted[i].name < sorted[j].name
+	})
+	if len(sorted) > n {
+		sorted = sorted[:n]
+	}
+	return sorted
+}
+
+func (s *quarterStats) print(out io.Writer, period string, n int) {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintf(w, "%s: %d transactions, %d open market purchases and %d sales with a price\n", period, s.rows, s.purchases, s.sales)
+
+	fmt.Fprintf(w, "\nTop insiders by dollars purchased\n")
+	for i, l := range top(s.insiders, n) {
+		fmt.Fprintf(w, "%d.\t%s\t%s\t%s\t%d purchases\n", i+1, l.name, l.detail, formatDollars(l.value), l.count)
+	}
+
+	fmt.Fprintf(w, "\nTop issuers by net insider buying (purchases less sales)\n")
+	for i, l := range top(s.issuers, n) {
+		fmt.Fprintf(w, "%d.\t%s\t%s\t%s\t%d transactions\n", i+1, l.name, l.detail, formatDollars(l.value), l.count)
+	}
+
+	if len(s.sectors) > 0 {
+		fmt.Fprintf(w, "\nSectors by net insider buying\n")
+		for i, l := range top(s.sectors, len(s.sectors)) {
+			fmt.Fprintf(w, "%d.\t%s\t%s\t%d issuers\n", i+1, l.name, formatDollars(l.value), l.count)
+		}
+	}
+
+	fmt.Fprintf(w, "\nLargest transactions\n")
+	sort.SliceStable(s.largest, func(i, j int) bool { return s.largest[i].value > s.largest[j].value })
+	for i, t := range s.largest {
+		if i == n {
+			break
+		}
+		fmt.Fprintf(w, "%d.\t%s\t%s\t%s\t%s\t%s\n", i+1, t.row["TRANSACTION_DATE"], t.row["TRANSACTION_CODE"],
+			t.row["ISSUER_TICKER"], t.row["NAME_OF_REPORTING_PERSON"], formatDollars(t.value))
+	}
+
+	fmt.Fprintf(w, "\nTransactions by code\n")
+	codes := make([]string, 0, len(s.codes))
+	for code := range s.codes {
+		codes = append(codes, code)
+	}
+	sort.Slice(codes, func(i, j int) bool {
+		if s.codes[codes[i]] != s.codes[codes[j]] {
+			return s.codes[codes[i]] > s.codes[codes[j]]
+		}
+		return codes[i] < codes[j]
+	})
+	for _, code := range codes {
+		fmt.Fprintf(w, "%s\t%d\t%s\n", code, s.codes[code], transactionCodeDescription(code))
+	}
+}
+
+func transactionCodeDescription(code string) string {
+	for _, c := range form4.TransactionCodes {
+		if c.Code == code {
+			return c.Description
+		}
+	}
+	return ""
+}
+
+// formatDollars prints a dollar amount rounded to whole dollars with thousands separators
+func formatDollars(v float64) string {
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	digits := strconv.FormatFloat(v, 'f', 0, 64)
+	var b strings.Builder
+	for i, d := range digits {
+		if i > 0 && (len(digits)-i)%3 == 0 {
+			b.WriteByte(',')
+		}
+		b.WriteRune(d)
+	}
+	return sign + "$" + b.String()
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+var summaryPath = flag.String("summary", "", "write a JSON summary of each download run to this file (default run_summary.json in -data-dir)")
+
+// Reasons a filing's rows aren't written, the keys of RunSummary.Skipped
+const (
+	skipFormType        = "form_type"
+	skipDuplicate       = "duplicate"
+	skipNoXMLDocument   = "no_xml_document"
+	skipNotOwnershipDoc = "not_ownership_document"
+	skipDownloadFailed  = "download_failed"
+	skipParseFailed     = "parse_failed"
+	skipExtractorFailed = "extractor_failed"
+	skipResumed         = "resumed"
+	skipIssuer          = "issuer"
+	skipNotCached       = "not_cached"
+)
+
+// How a run ended, RunSummary.Status
+const (
+	runStatusDone        = "done"
+	runStatusInterrupted = "interrupted"
+	runStatusAborted     = "aborted"
+)
+
+// errExtractorFailed is wrapped by parseFiling's error when an extractor fails
+var errExtractorFailed = errors.New("ErrExtractorFailed")
+
+// RunSummary is what a download run did, written as JSON when it ends so whatever scheduled it can
+// check the run was complete
+type RunSummary struct {
+	// Status is done, interrupted, or aborted once the failure budget was spent
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Year     int       `json:"year"`
+	Quarter  int       `json:"quarter"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Seconds  float64   `json:"duration_seconds"`
+	// SchemaVersion and ParserVersion are those of the rows written, see outputSchema and parserVersion
+	SchemaVersion int    `json:"schema_version"`
+	ParserVersion string `json:"parser_version"`
+	// FilingsScanned is every entry of the daily indexes read, FilingsSelected the ones of the
+	// selected form types left after dropping repeated entries, which are skipped as form_type and duplicate
+	FilingsScanned    int `json:"filings_scanned"`
+	FilingsSelected   int `json:"filings_selected"`
+	FilingsDownloaded int `json:"filings_downloaded"`
+	FilingsParsed     int `json:"filings_parsed"`
+	// Skipped counts the filings whose rows weren't written by why
+	Skipped      map[string]int `json:"skipped"`
+	RowsEmitted  int            `json:"rows_emitted"`
+	Requests     int64          `json:"requests"`
+	BytesFetched int64          `json:"bytes_fetched"`
+	CacheHits    int64          `json:"cache_hits"`
+
+	// resumeAfter is the last filing finished with before the first one an interruption cut short,
+	// which a resumed export carries on after
+	resumeAfter *edgar.IndexEntry
+	cutShort    bool
+}
+
+func newRunSummary(p period) *RunSummary {
+	s := &RunSummary{Year: p.Year, Quarter: p.Quarter, Started: time.Now().UTC(), SchemaVersion: outputSchemaVersion, ParserVersion: parserVersion, Skipped: map[string]int{}}
+	// Every reason is written, so a reader can tell none from a summary older than the reason
+	for _, reason := range []string{skipFormType, skipDuplicate, skipNoXMLDocument, skipNotOwnershipDoc, skipDownloadFailed, skipParseFailed, skipExtractorFailed, skipResumed, skipIssuer, skipNotCached} {
+		s.Skipped[reason] = 0
+	}
+	return s
+}
+
+// record counts a filing the pipeline finished with
+func (s *RunSummary) record(filing *edgar.IndexEntry, result filingResult) {
+	if !s.cutShort {
+		s.resumeAfter = filing
+	}
+	switch {
+	case errors.Is(result.err, edgar.ErrOffline):
+		// reparse only has the filings that were cached
+		s.Skipped[skipNotCached]++
+		return
+	case result.downloadFailed:
+		s.Skipped[skipDownloadFailed]++
+		return
+	case errors.Is(result.err, form4.ErrNoXMLDocument):
+		s.Skipped[skipNoXMLDocument]++
+	case errors.Is(result.err, form4.ErrNotOwnershipDocument):
+		s.Skipped[skipNotOwnershipDoc]++
+	case errors.Is(result.err, errIssuerExcluded):
+		s.Skipped[skipIssuer]++
+	case errors.Is(result.err, errExtractorFailed):
+		s.Skipped[skipExtractorFailed]++
+	case result.err != nil:
+		s.Skipped[skipParseFailed]++
+	default:
+		s.FilingsParsed++
+		s.RowsEmitted += len(result.parsed.Rows)
+	}
+	s.FilingsDownloaded++
+}
+
+// interrupted notes a filing the run was interrupted before finishing, which a resumed export
+// carries on from
+func (s *RunSummary) interrupted() {
+	s.cutShort = true
+}
+
+// finish fills in how the run ended and what the client fetched
+func (s *RunSummary) finish(runErr error, stats edgar.Stats) {
+	s.Status = runStatusDone
+	if errors.Is(runErr, errFailureBudget) {
+		s.Status = runStatusAborted
+	} else if runErr != nil {
+		s.Status = runStatusInterrupted
+	}
+	if runErr != nil {
+		s.Error = runErr.Error()
+	}
+	s.Finished = time.Now().UTC()
+	s.Seconds = s.Finished.Sub(s.Started).Seconds()
+	s.Requests, s.BytesFetched, s.CacheHits = stats.Requests, stats.BytesFetched, stats.CacheHits
+}
+
+// runSummaryPath is -summary, or run_summary.json in the data dir where the next run would look
+// runSummaryPath is where the summary of p goes. When a run downloads several quarters, each
+// gets its own, e.g. run_summary_2024Q1.json, unless -summary has a {year} or {quarter} placeholder.
+func runSummaryPath(p period, several bool) string {
+	path := *summaryPath
+	if path == "" {
+		path = filepath.Join(*dataDir, "run_summary.json")
+	}
+	if several && !hasPeriodPlaceholder(path) {
+		ext := filepath.Ext(path)
+		return strings.TrimSuffix(path, ext) + "_" + p.String() + ext
+	}
+	return periodTarget(path, p)
+}
+
+// Save writes the summary to path, replacing it at once so a reader never sees half of one
+func (s *RunSummary) Save(path string) error {
+	content, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err = ioutil.WriteFile(tmp, append(content, '\n'), 0644); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+)
+
+// The normalized tables, each a file under the tables sink's directory. Filings are keyed by
+// ACCESSION_NUMBER, which every other table but issuers references, and issuers by ISSUER_CIK.
+// Column names match the flat output's wherever they hold the same value.
+var (
+	filingsHeader      = []string{"ACCESSION_NUMBER", "FORM_TYPE", "DATE_FILED", "ISSUER_CIK", "SCHEMA_VERSION", "DOCUMENT_TYPE", "PERIOD_OF_REPORT", "FILE_NAME", "ACCEPTANCE_DATETIME", "SOURCE_SHA256", "SOURCE_URL", "DOWNLOADED_AT", "PARSER_VERSION"}
+	issuersHeader      = []string{"ISSUER_CIK", "ISSUER_NAME", "ISSUER_TICKER", "SIC", "INDUSTRY", "STATE_OF_INCORPORATION", "FISCAL_YEAR_END", "BUSINESS_STREET_1", "BUSINESS_STREET_2", "BUSINESS_CITY", "BUSINESS_STATE", "BUSINESS_ZIP", "BUSINESS_PHONE"}
+	ownersHeader       = []string{"ACCESSION_NUMBER", "REPORTER_CIK", "NAME_OF_REPORTING_PERSON", "IS_DIRECTOR", "IS_OFFICER", "IS_TEN_PERCENT_OWNER", "IS_OTHER_RELATIONSHIP", "REPORTER_CITY", "REPORTER_STATE", "OFFICER_TITLE", "OFFICER_ROLE"}
+	transactionsHeader = []string{"ACCESSION_NUMBER", "TRANSACTION_INDEX", "TITLE_OF_SECURITY", "TRANSACTION_DATE", "TRANSACTION_CODE", "A_OR_D", "AMOUNT", "PRICE", "NEW_AMOUNT_OWNED", "DIRECT_OR_INDIRECT_OWNERSHIP", "DATA_QUALITY_FLAGS", "NATURE_OF_OWNERSHIP", "INDIRECT_OWNERSHIP_TYPE", "DEEMED_EXECUTION_DATE", "SPLIT_ADJUSTED_AMOUNT", "SPLIT_ADJUSTED_PRICE", "SPLIT_ADJUSTED_NEW_AMOUNT_OWNED", "VALUE_PERCENTILE", "ISSUER_VALUE_PERCENTILE", "DIRECTION"}
+	holdingsHeader     = []string{"ACCESSION_NUMBER", "HOLDING_INDEX", "TITLE_OF_SECURITY", "NEW_AMOUNT_OWNED", "DIRECT_OR_INDIRECT_OWNERSHIP", "NATURE_OF_OWNERSHIP", "INDIRECT_OWNERSHIP_TYPE"}
+	footnotesHeader    = []string{"ACCESSION_NUMBER", "FOOTNOTE_ID", "TEXT"}
+)
+
+func init() {
+	RegisterSink("tables", openTables)
+}
+
+// tablesWriter writes each filing across the normalized tables rather than as denormalized rows
+type tablesWriter struct {
+	root                                                        string
+	filings, issuers, owners, transactions, holdings, footnotes *outputFile
+
+	// seenIssuers keeps the first name and ticker seen for each issuer, along with the first address,
+	// state of incorporation and fiscal year end
+	seenIssuers map[string]bool
+}
+
+// openTables is the tables sink, writing under -output (default tables/) with -format and -compress
+// picking the files' encoding
+func openTables(ctx context.Context, opts SinkOptions) (RowWriter, error) {
+	if flagIsSet(flag.CommandLine, "partition") || flagIsSet(flag.CommandLine, "columns") {
+		return nil, fmt.Errorf("-partition and -columns only apply to the file sink")
+	}
+	root := opts.Target
+	if root == "" {
+		root = "tables"
+	}
+	f, err := DetectOutputFormat("", *format, *compress)
+	if err != nil {
+		return nil, err
+	}
+	limits := RollLimits{MaxRows: *maxRows, MaxBytes: *maxBytes}
+
+	// Each table gets a data dictionary next to it, written up front so it exists even for empty tables
+	var schemaErr error
+	table := func(name string, header []string) *outputFile {
+		tf := f
+		tf.Header = header
+		path := filepath.Join(root, name+tf.Ext())
+		if err := WriteSchema(schemaPath(path, tf), name, tf); err != nil && schemaErr == nil {
+			schemaErr = err
+		}
+		return newOutputFile(path, tf, limits)
+	}
+	t := &tablesWriter{
+		root:         root,
+		filings:      table("filings", append(append([]string{}, filingsHeader...), opts.Extra...)),
+		issuers:      table("issuers", issuersHeader),
+		owners:       table("reporting_owners", ownersHeader),
+		transactions: table("transactions", transactionsHeader),
+		holdings:     table("holdings", holdingsHeader),
+		footnotes:    table("footnotes", footnotesHeader),
+		seenIssuers:  map[string]bool{},
+	}
+	if schemaErr != nil {
+		return nil, schemaErr
+	}
+	return t, nil
+}
+
+func (t *tablesWriter) Write(ctx context.Context, row *Row) error {
+	return errors.New("the tables sink only accepts whole filings")
+}
+
+func (t *tablesWriter) WriteFiling(ctx context.Context, parsed *ParsedFiling) error {
+	filing, od := parsed.Filing, parsed.Document
+	write := func(table *outputFile, values ...string) error {
+		return table.Write(ctx, &Row{Filing: filing, Values: values})
+	}
+	accession := filing.AccessionNumber
+
+	filingValues := append([]string{accession, filing.FormType, isoDate(filing.DateFiled), od.Issuer.CIK, od.SchemaVersion, od.DocumentType, od.PeriodOfReport, filing.FileName, filing.AcceptanceDateTime, parsed.SourceSHA256, parsed.SourceURL, parsed.DownloadedAt, parserVersion}, parsed.Extra...)
+	if err := write(t.filings, filingValues...); err != nil {
+		return err
+	}
+
+	if !t.seenIssuers[od.Issuer.CIK] {
+		t.seenIssuers[od.Issuer.CIK] = true
+		c := parsed.Issuer
+		if c == nil {
+			c = &edgar.Company{}
+		}
+		a := c.BusinessAddress
+		sic, industry := edgar.SplitSIC(c.SIC)
+		err := write(t.issuers, od.Issuer.CIK, od.Issuer.Name, od.Issuer.TradingSymbol, sic, industry, c.StateOfIncorporation, c.FiscalYearEnd,
+			a.Street1, a.Street2, a.City, a.StateOrCountry, a.ZipCode, c.BusinessPhone)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, o := range od.ReportingOwners {
+		err := write(t.owners, accession, o.CIK, o.Name, o.IsDirector, o.IsOfficer, o.IsTenPercentOwner, o.IsOther, o.City, o.State,
+			o.OfficerTitle, form4.NormalizeOfficerTitle(o.OfficerTitle))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, tx := range selectedTransactions(od) {
+		flags := strings.Join(validateTransaction(filing, tx), dataQualityFlagsSeparator)
+		adjustedShares, adjustedPrice, adjustedOwned := splitAdjusted(parsed.Splits, tx)
+		rank := parsed.Ranks[tx.TransactionIndex]
+		err := write(t.transactions, accession, strconv.Itoa(tx.TransactionIndex), tx.SecurityTitle, tx.TransactionDate, tx.TransactionCode, tx.AcquiredDisposedCode,
+			tx.Shares, tx.PricePerShare, tx.SharesOwnedFollowingTransaction, tx.DirectOrIndirectOwnership, flags, tx.NatureOfOwnership, form4.ClassifyNatureOfOwnership(tx.NatureOfOwnership), tx.DeemedExecutionDate,
+			adjustedShares, adjustedPrice, adjustedOwned, rank.Overall, rank.Issuer, form4.ClassifyDirection(tx.TransactionCode, tx.AcquiredDisposedCode))
+		if err != nil {
+			return err
+		}
+	}
+
+	for i, h := range od.NonDerivativeHoldings {
+		err := write(t.holdings, accession, strconv.Itoa(i), h.SecurityTitle, h.SharesOwnedFollowingTransaction, h.DirectOrIndirectOwnership,
+			h.NatureOfOwnership, form4.ClassifyNatureOfOwnership(h.NatureOfOwnership))
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, f := range od.Footnotes {
+		if err := write(t.footnotes, accession, f.ID, f.Text); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tablesWriter) Close() error {
+	var firstErr error
+	for _, table := range []*outputFile{t.filings, t.issuers, t.owners, t.transactions, t.holdings, t.footnotes} {
+		if err := table.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (t *tablesWriter) Manifest() (string, []ManifestFile) {
+	files := []ManifestFile{}
+	for _, table := range []*outputFile{t.filings, t.issuers, t.owners, t.transactions, t.holdings, t.footnotes} {
+		files = append(files, table.written...)
+	}
+	return filepath.Join(t.root, "manifest.json"), files
+}
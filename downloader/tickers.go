@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+var tickerHistoryHeader = []string{"ISSUER_CIK", "ISSUER_TICKER", "FIRST_FILED", "LAST_FILED"}
+
+// TickerSpan is a trading symbol an issuer's filings were made under, and the filing dates (YYYY-MM-DD)
+// of the first and last of them seen
+type TickerSpan struct {
+	CIK, Ticker           string
+	FirstFiled, LastFiled string
+}
+
+// TickerHistory is every trading symbol seen for each issuer CIK across runs, kept in the data
+// directory so a ticker change in one quarter still links the filings of earlier ones
+type TickerHistory struct {
+	spans map[string]map[string]*TickerSpan
+}
+
+// tickerHistoryPath is where the history is kept, next to the document cache
+func tickerHistoryPath() string {
+	return filepath.Join(*dataDir, "tickers.csv")
+}
+
+// LoadTickerHistory reads the history at path, an empty one if it doesn't exist yet
+func LoadTickerHistory(path string) (*TickerHistory, error) {
+	h := &TickerHistory{spans: map[string]map[string]*TickerSpan{}}
+	records, err := readCSVFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading ticker history %s: %w", path, err)
+	}
+	for i, r := range records {
+		if i == 0 || len(r) != len(tickerHistoryHeader) {
+			continue
+		}
+		h.observe(r[0], r[1], r[2])
+		h.observe(r[0], r[1], r[3])
+	}
+	return h, nil
+}
+
+// Observe records the ticker a parsed filing's document names for its issuer
+func (h *TickerHistory) Observe(parsed *ParsedFiling) {
+	h.observe(parsed.Document.Issuer.CIK, parsed.Document.Issuer.TradingSymbol, isoDate(parsed.Filing.DateFiled))
+}
+
+func (h *TickerHistory) observe(cik, ticker, filed string) {
+	cik, ticker = edgar.PadCIK(cik), strings.ToUpper(strings.TrimSpace(ticker))
+	// Filers without a listed security write NONE or N/A
+	if strings.Trim(cik, "0") == "" || ticker == "" || ticker == "NONE" || ticker == "N/A" {
+		return
+	}
+	tickers := h.spans[cik]
+	if tickers == nil {
+		tickers = map[string]*TickerSpan{}
+		h.spans[cik] = tickers
+	}
+	span := tickers[ticker]
+	if span == nil {
+		tickers[ticker] = &TickerSpan{CIK: cik, Ticker: ticker, FirstFiled: filed, LastFiled: filed}
+		return
+	}
+	if filed < span.FirstFiled {
+		span.FirstFiled = filed
+	}
+	if filed > span.LastFiled {
+		span.LastFiled = filed
+	}
+}
+
+// Lookup returns the spans of every issuer that has filed under ticker or has the CIK given, each
+// issuer's in the order they were used
+func (h *TickerHistory) Lookup(tickerOrCIK string) []TickerSpan {
+	key := strings.ToUpper(strings.TrimSpace(tickerOrCIK))
+	ciks := []string{}
+	for cik, tickers := range h.spans {
+		if _, ok := tickers[key]; ok || cik == edgar.PadCIK(key) {
+			ciks = append(ciks, cik)
+		}
+	}
+	sort.Strings(ciks)
+	spans := []TickerSpan{}
+	for _, cik := range ciks {
+		spans = append(spans, h.issuerSpans(cik)...)
+	}
+	return spans
+}
+
+func (h *TickerHistory) issuerSpans(cik string) []TickerSpan {
+	spans := []TickerSpan{}
+	for _, span := range h.spans[cik] {
+		spans = append(spans, *span)
+	}
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].FirstFiled != spans[j].FirstFiled {
+			return spans[i].FirstFiled < spans[j].FirstFiled
+		}
+		return spans[i].Ticker < spans[j].Ticker
+	})
+	return spans
+}
+
+// Save writes the history to path, replacing it only once it is fully written
+func (h *TickerHistory) Save(path string) error {
+	ciks := make([]string, 0, len(h.spans))
+	for cik := range h.spans {
+		ciks = append(ciks, cik)
+	}
+	sort.Strings(ciks)
+
+	records := [][]string{tickerHistoryHeader}
+	for _, cik := range ciks {
+		for _, s := range h.issuerSpans(cik) {
+			records = append(records, []string{s.CIK, s.Ticker, s.FirstFiled, s.LastFiled})
+		}
+	}
+	return writeCSVFile(path, records)
+}
+
+// runTickers prints the ticker history of the issuers that have used a ticker, or of a CIK
+func runTickers(args []string) {
+	fs := flag.NewFlagSet("tickers", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		log.Fatal("Usage: tickers <ticker or CIK>, e.g. tickers FB")
+	}
+
+	history, err := LoadTickerHistory(tickerHistoryPath())
+	if err != nil {
+		log.Fatal(err)
+	}
+	spans := history.Lookup(fs.Arg(0))
+	if len(spans) == 0 {
+		log.Fatalf("No issuer has filed under %s in the runs so far", fs.Arg(0))
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(tickerHistoryHeader, "\t"))
+	for _, s := range spans {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", s.CIK, s.Ticker, s.FirstFiled, s.LastFiled)
+	}
+	w.Flush()
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// rowTypeNonDerivativeTransaction is the ROW_TYPE of a row from the non-derivative table's
+// transactions, the only rows the flat output has so far
+const rowTypeNonDerivativeTransaction = "NON_DERIVATIVE_TRANSACTION"
+
+// upsertKey identifies a row across runs. The database sinks merge on it, so reprocessing a filing,
+// refetched or reparsed, updates its rows in place rather than adding them again.
+var upsertKey = []string{"ACCESSION_NUMBER", "REPORTER_CIK", "ROW_TYPE", "TRANSACTION_INDEX"}
+
+// keyMatches is the SQL condition of a target and source row having the same upsertKey, with quote
+// writing a column name as the database has it
+func keyMatches(target, source string, quote func(column string) string) string {
+	conditions := []string{}
+	for _, column := range upsertKey {
+		conditions = append(conditions, fmt.Sprintf("%s.%s = %s.%s", target, quote(column), source, quote(column)))
+	}
+	return strings.Join(conditions, " AND ")
+}
+
+// deleteStaleRows is the SQL statement deleting the rows of the filings in source that source no
+// longer has, such as those a fixed parser now leaves out, which a merge leaves as it only updates
+// and inserts. table is the table deleted from, with its alias if it has one, and target what its
+// columns are qualified with.
+func deleteStaleRows(table, target, source string, quote func(column string) string) string {
+	accession := quote("ACCESSION_NUMBER")
+	return fmt.Sprintf("DELETE FROM %s WHERE %s.%s IN (SELECT %s FROM %s) AND NOT EXISTS (SELECT 1 FROM %s s WHERE %s)",
+		table, target, accession, accession, source, source, keyMatches(target, "s", quote))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/form4"
+	"github.com/shopspring/decimal"
+)
+
+// Warning codes for values that were read but can't be right, written to the DATA_QUALITY_FLAGS
+// column. The codes are stable, so rows can be filtered on them across runs.
+const (
+	WarnInvalidIssuerCIK        = "INVALID_ISSUER_CIK"
+	WarnInvalidReporterCIK      = "INVALID_REPORTER_CIK"
+	WarnInvalidAcquiredDisposed = "INVALID_A_OR_D"
+	WarnInvalidOwnership        = "INVALID_OWNERSHIP"
+	WarnUnknownTransactionCode  = "UNKNOWN_TRANSACTION_CODE"
+	// WarnZeroShares is a transaction of no securities
+	WarnZeroShares = "ZERO_SHARES"
+	// WarnZeroPriceTrade is an open market purchase or sale at a price of zero
+	WarnZeroPriceTrade = "ZERO_PRICE_TRADE"
+	// WarnPriceOutOfRange is a price per security above maxPrice, usually the total value of the
+	// transaction entered as the price
+	WarnPriceOutOfRange = "PRICE_OUT_OF_RANGE"
+)
+
+// dataQualityFlagsSeparator joins the codes of a row in the DATA_QUALITY_FLAGS column
+const dataQualityFlagsSeparator = ";"
+
+// maxPrice is the highest plausible price per security, a little above the most any US listed share
+// has traded at
+var maxPrice = decimal.NewFromInt(1_000_000)
+
+var knownTransactionCodes = func() map[string]bool {
+	codes := map[string]bool{}
+	for _, c := range form4.TransactionCodes {
+		codes[c.Code] = true
+	}
+	return codes
+}()
+
+// validateTransaction returns the warning codes of a transaction, in a fixed order. Values that were
+// empty or couldn't be parsed at all are left to hasRequiredFields.
+func validateTransaction(filing *edgar.IndexEntry, t form4.TransactionRow) []string {
+	flags := []string{}
+	if t.IssuerCIK != "" && !validCIK(t.IssuerCIK) {
+		flags = append(flags, WarnInvalidIssuerCIK)
+	}
+	if t.ReporterCIK != "" && !validCIK(t.ReporterCIK) {
+		flags = append(flags, WarnInvalidReporterCIK)
+	}
+	if t.AcquiredDisposedCode != "" && t.AcquiredDisposedCode != "A" && t.AcquiredDisposedCode != "D" {
+		flags = append(flags, WarnInvalidAcquiredDisposed)
+	}
+	if t.DirectOrIndirectOwnership != "" && t.DirectOrIndirectOwnership != "D" && t.DirectOrIndirectOwnership != "I" {
+		flags = append(flags, WarnInvalidOwnership)
+	}
+	if t.TransactionCode != "" && !knownTransactionCodes[t.TransactionCode] {
+		flags = append(flags, WarnUnknownTransactionCode)
+	}
+
+	if shares, err := form4.ParseDecimal(t.Shares); err == nil && shares.IsZero() {
+		flags = append(flags, WarnZeroShares)
+	}
+	if price, err := form4.ParseDecimal(t.PricePerShare); err == nil {
+		if price.IsZero() && (t.TransactionCode == "P" || t.TransactionCode == "S") {
+			flags = append(flags, WarnZeroPriceTrade)
+		} else if price.GreaterThan(maxPrice) {
+			flags = append(flags, WarnPriceOutOfRange)
+		}
+	}
+
+	if code := transactionDateWarning(filing, t.TransactionDate); code != "" {
+		flags = append(flags, code)
+	}
+	return flags
+}
+
+// validCIK is whether a CIK is at most 10 digits and not all zeros, padded or not
+func validCIK(cik string) bool {
+	if len(cik) > 10 || strings.Trim(cik, "0") == "" {
+		return false
+	}
+	for _, c := range cik {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,76 @@
+package edgar
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+)
+
+// sealedMagic starts everything a Cipher seals, telling it apart from plaintext
+var sealedMagic = []byte("SEC4AES1")
+
+var ErrWrongKey = errors.New("ErrWrongKey")
+
+// Cipher encrypts the documents and index of a Store, and any other file, with AES-256-GCM
+type Cipher struct {
+	aead cipher.AEAD
+	id   string
+}
+
+// NewCipher makes a Cipher from a 32 byte key
+func NewCipher(key []byte) (*Cipher, error) {
+	if len(key) != 32 {
+		return nil, fmt.Errorf("encryption key is %d bytes, expected 32", len(key))
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(append([]byte("sec4 key id "), key...))
+	return &Cipher{aead: aead, id: hex.EncodeToString(sum[:8])}, nil
+}
+
+// ID identifies the key without revealing it, to tell which key something was encrypted with
+func (c *Cipher) ID() string {
+	return c.id
+}
+
+// Seal encrypts plaintext. context is authenticated along with it and must be given to Open again,
+// so sealed content can't be passed off as something else, such as one object as another.
+func (c *Cipher) Seal(plaintext []byte, context string) []byte {
+	nonce := make([]byte, c.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		panic(err)
+	}
+	sealed := append(append([]byte{}, sealedMagic...), nonce...)
+	return c.aead.Seal(sealed, nonce, plaintext, []byte(context))
+}
+
+// Open decrypts what Seal sealed with the same context, returning ErrWrongKey if it was sealed with
+// another key or has been tampered with
+func (c *Cipher) Open(sealed []byte, context string) ([]byte, error) {
+	if !IsSealed(sealed) || len(sealed) < len(sealedMagic)+c.aead.NonceSize() {
+		return nil, fmt.Errorf("not encrypted")
+	}
+	sealed = sealed[len(sealedMagic):]
+	nonce, ciphertext := sealed[:c.aead.NonceSize()], sealed[c.aead.NonceSize():]
+	plaintext, err := c.aead.Open(nil, nonce, ciphertext, []byte(context))
+	if err != nil {
+		return nil, ErrWrongKey
+	}
+	return plaintext, nil
+}
+
+// IsSealed returns whether content was sealed by a Cipher
+func IsSealed(content []byte) bool {
+	return bytes.HasPrefix(content, sealedMagic)
+}
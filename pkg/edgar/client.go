@@ -0,0 +1,302 @@
+// Package edgar is a client for the parts of SEC EDGAR the downloader uses: the daily and quarterly
+// indexes, filing archives, the submissions API and the ticker map. Requests are rate limited to stay
+// under the SEC's fair access limit, and immutable documents are cached when a Cache is configured.
+package edgar
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cenkalti/backoff/v4"
+	gonanoid "github.com/matoous/go-nanoid/v2"
+	"go.uber.org/ratelimit"
+)
+
+var (
+	ErrNotFound       = errors.New("ErrNotFound")
+	ErrRateLimited    = errors.New("ErrRateLimited")
+	ErrDoesNotExist   = errors.New("ErrDoesNotExist")
+	ErrHighStatusCode = errors.New("ErrHighStatusCode")
+	// ErrOffline is returned for requests an offline client would have to make over the network
+	ErrOffline = errors.New("ErrOffline")
+)
+
+const (
+	DefaultArchivesURL = "https://www.sec.gov/Archives"
+	DefaultDataURL     = "https://data.sec.gov"
+	DefaultFilesURL    = "https://www.sec.gov/files"
+
+	// DefaultRequestsPerSecond stays just under the SEC's limit of 10
+	DefaultRequestsPerSecond = 9
+)
+
+// Cache stores documents that never change once published, keyed by URL. Get returns ErrNotCached
+// on a miss. *Store implements it.
+type Cache interface {
+	Get(url string) ([]byte, error)
+	Put(url string, content []byte) (*StoreEntry, error)
+}
+
+// FilingCache is a Cache that finds a submission cached under the folder of any of its filers, see
+// Store.GetFiling. FetchFiling uses it when the Cache is one.
+type FilingCache interface {
+	Cache
+	GetFiling(url string) ([]byte, error)
+}
+
+// Options configure a Client, zero values get the defaults
+type Options struct {
+	// UserAgent should identify you per the SEC's fair access policy, e.g. "Company Name admin@company.com"
+	UserAgent string
+	// Limiter paces every request the client makes, defaults to DefaultRequestsPerSecond
+	Limiter ratelimit.Limiter
+	// Cache is where filings and index files are cached, nil disables caching
+	Cache      Cache
+	HTTPClient *http.Client
+	// RequestTimeout bounds each attempt of a request, defaults to 30s
+	RequestTimeout time.Duration
+	// Offline only serves what is in Cache, every request fails with ErrOffline instead. The daily
+	// master files of a quarter are those cached.
+	Offline bool
+
+	ArchivesURL string
+	DataURL     string
+	FilesURL    string
+
+	// Logf logs the client's progress, each request it completes and the master files of a quarter,
+	// defaults to log.Printf. Failed requests are always logged.
+	Logf func(format string, v ...interface{})
+}
+
+type Client struct {
+	// Updated atomically, see Stats. First so they are 64-bit aligned on 32-bit platforms.
+	requests, bytesFetched, cacheHits int64
+
+	opts Options
+}
+
+// Stats are what a client has fetched since it was created
+type Stats struct {
+	// Requests is how many documents were downloaded, not counting retries
+	Requests int64
+	// BytesFetched is the size of the documents downloaded, after decompression
+	BytesFetched int64
+	// CacheHits is how many documents GetCached found in the cache
+	CacheHits int64
+}
+
+// Stats returns what the client has fetched so far, it is safe to call concurrently with requests
+func (c *Client) Stats() Stats {
+	return Stats{
+		Requests:     atomic.LoadInt64(&c.requests),
+		BytesFetched: atomic.LoadInt64(&c.bytesFetched),
+		CacheHits:    atomic.LoadInt64(&c.cacheHits),
+	}
+}
+
+func NewClient(opts Options) *Client {
+	if opts.Limiter == nil {
+		opts.Limiter = ratelimit.New(DefaultRequestsPerSecond)
+	}
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = http.DefaultClient
+	}
+	if opts.RequestTimeout == 0 {
+		opts.RequestTimeout = time.Second * 30
+	}
+	if opts.ArchivesURL == "" {
+		opts.ArchivesURL = DefaultArchivesURL
+	}
+	if opts.DataURL == "" {
+		opts.DataURL = DefaultDataURL
+	}
+	if opts.FilesURL == "" {
+		opts.FilesURL = DefaultFilesURL
+	}
+	if opts.Logf == nil {
+		opts.Logf = log.Printf
+	}
+	return &Client{opts: opts}
+}
+
+// Cache returns the client's cache, which may be nil
+func (c *Client) Cache() Cache {
+	return c.opts.Cache
+}
+
+func (c *Client) userAgent() string {
+	if c.opts.UserAgent != "" {
+		return c.opts.UserAgent
+	}
+	return fmt.Sprintf("Sample Company Name %s@sampledomain.com", gonanoid.Must())
+}
+
+// Get downloads url, retrying transport errors, without touching the cache
+func (c *Client) Get(ctx context.Context, url string) ([]byte, error) {
+	if c.opts.Offline {
+		return nil, fmt.Errorf("%w: %s", ErrOffline, url)
+	}
+	s := time.Now()
+
+	var content []byte
+	err := backoff.RetryNotify(func() error {
+		var err error
+		content, err = c.get(ctx, url)
+		if err != nil && isStatusError(err) {
+			// The server answered, retrying will not change its mind
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(backoff.WithMaxRetries(backoff.NewConstantBackOff(time.Millisecond*100), 5), ctx), func(err error, d time.Duration) {
+		log.Printf("Failed to make request after %s: %s", d, err.Error())
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	atomic.AddInt64(&c.requests, 1)
+	atomic.AddInt64(&c.bytesFetched, int64(len(content)))
+	c.opts.Logf("Downloaded SEC file %s in %s", url, time.Since(s))
+	return content, nil
+}
+
+func isStatusError(err error) bool {
+	return errors.Is(err, ErrNotFound) || errors.Is(err, ErrRateLimited) || errors.Is(err, ErrDoesNotExist) || errors.Is(err, ErrHighStatusCode)
+}
+
+func (c *Client) get(ctx context.Context, url string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.opts.RequestTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating request: %w", err)
+	}
+
+	req.Header.Add("accept-language", "en-US,en;q=0.9")
+	req.Header.Add("accept-encoding", "gzip,deflate")
+	req.Header.Add("User-Agent", c.userAgent())
+
+	c.opts.Limiter.Take()
+	resp, err := c.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == 404 {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, url)
+	} else if resp.StatusCode == 429 {
+		return nil, fmt.Errorf("%w: %s", ErrRateLimited, url)
+	} else if resp.StatusCode == 403 {
+		// Does not exist
+		return nil, fmt.Errorf("%w: %s", ErrDoesNotExist, url)
+	} else if resp.StatusCode > 299 {
+		return nil, fmt.Errorf("%w: got status code %d for %s", ErrHighStatusCode, resp.StatusCode, url)
+	}
+
+	// We ask for gzip ourselves, so the transport leaves decompression to us
+	var body io.Reader = resp.Body
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gReader, err := getGzipReader(resp.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error creating gzip reader: %w", err)
+		}
+		defer gzipReaderPool.Put(gReader)
+		body = gReader
+	}
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+	if resp.ContentLength > 0 {
+		// The compressed length is a lower bound, it saves most of the doubling ReadAll would do
+		buf.Grow(int(resp.ContentLength))
+	}
+	if _, err := buf.ReadFrom(body); err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	// The buffer goes back to the pool, the caller gets a copy sized exactly to the document
+	return append([]byte(nil), buf.Bytes()...), nil
+}
+
+// maxPooledBuffer keeps the odd huge submission from pinning its buffer in the pool forever
+const maxPooledBuffer = 4 << 20
+
+var (
+	bufferPool     = sync.Pool{New: func() interface{} { return new(bytes.Buffer) }}
+	gzipReaderPool sync.Pool
+)
+
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() > maxPooledBuffer {
+		return
+	}
+	buf.Reset()
+	bufferPool.Put(buf)
+}
+
+func getGzipReader(r io.Reader) (*gzip.Reader, error) {
+	if gReader, ok := gzipReaderPool.Get().(*gzip.Reader); ok {
+		if err := gReader.Reset(r); err != nil {
+			return nil, err
+		}
+		return gReader, nil
+	}
+	return gzip.NewReader(r)
+}
+
+// GetCached returns url from the cache, downloading and caching it on a miss. Only use it for
+// documents that do not change once published.
+func (c *Client) GetCached(ctx context.Context, url string) ([]byte, error) {
+	if c.opts.Cache == nil {
+		return c.Get(ctx, url)
+	}
+
+	content, err := c.opts.Cache.Get(url)
+	if err == nil {
+		atomic.AddInt64(&c.cacheHits, 1)
+		return content, nil
+	} else if !errors.Is(err, ErrNotCached) {
+		return nil, fmt.Errorf("error reading %s from cache: %w", url, err)
+	}
+
+	content, err = c.Get(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err = c.opts.Cache.Put(url, content); err != nil {
+		return nil, fmt.Errorf("error writing %s to cache: %w", url, err)
+	}
+	return content, nil
+}
+
+// FilingURL is the URL of a filing's full submission text file
+func (c *Client) FilingURL(entry *IndexEntry) string {
+	return c.opts.ArchivesURL + "/" + entry.FileName
+}
+
+// FetchFiling returns the full submission text file of an index entry. A submission is cached by its
+// accession number when the cache is a FilingCache, so a joint filing is downloaded once rather than
+// once per filer.
+func (c *Client) FetchFiling(ctx context.Context, entry *IndexEntry) ([]byte, error) {
+	url := c.FilingURL(entry)
+	if cache, ok := c.opts.Cache.(FilingCache); ok {
+		content, err := cache.GetFiling(url)
+		if err == nil {
+			atomic.AddInt64(&c.cacheHits, 1)
+			return content, nil
+		} else if !errors.Is(err, ErrNotCached) {
+			return nil, fmt.Errorf("error reading %s from cache: %w", url, err)
+		}
+	}
+	return c.GetCached(ctx, url)
+}
@@ -0,0 +1,93 @@
+package edgar_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/secfake"
+)
+
+const submissionPath = "/Archives/edgar/data/1000045/0001000045-22-000005.txt"
+
+var submission = []byte("<SEC-DOCUMENT>\n<TYPE>4\n</SEC-DOCUMENT>\n")
+
+func newFake(t *testing.T) *secfake.Server {
+	t.Helper()
+	fake := secfake.NewServer()
+	t.Cleanup(fake.Close)
+	fake.Add(submissionPath, submission)
+	return fake
+}
+
+func TestGetRateLimitedIsPermanent(t *testing.T) {
+	fake := newFake(t)
+	fake.FailNext(submissionPath, 429)
+	c := edgar.NewClient(fake.Options())
+
+	_, err := c.Get(context.Background(), fake.URL+submissionPath)
+	if !errors.Is(err, edgar.ErrRateLimited) {
+		t.Fatalf("Get() = %v, want ErrRateLimited", err)
+	}
+	if requests := fake.Requests(); len(requests) != 1 {
+		t.Errorf("Get() made %d requests, a 429 shouldn't be retried", len(requests))
+	}
+}
+
+func TestGetDecodesGzip(t *testing.T) {
+	fake := newFake(t)
+	c := edgar.NewClient(fake.Options())
+
+	// The fake gzips every body of a request accepting it, as the client's do
+	content, err := c.Get(context.Background(), fake.URL+submissionPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, submission) {
+		t.Errorf("Get() = %q, want %q", content, submission)
+	}
+}
+
+func TestGetOffline(t *testing.T) {
+	fake := newFake(t)
+	opts := fake.Options()
+	opts.Offline = true
+	c := edgar.NewClient(opts)
+
+	if _, err := c.Get(context.Background(), fake.URL+submissionPath); !errors.Is(err, edgar.ErrOffline) {
+		t.Fatalf("Get() = %v, want ErrOffline", err)
+	}
+	if requests := fake.Requests(); len(requests) != 0 {
+		t.Errorf("an offline Get() made %d requests", len(requests))
+	}
+}
+
+func TestGetCachedServesFromCache(t *testing.T) {
+	fake := newFake(t)
+	store, err := edgar.OpenStore(t.TempDir(), edgar.StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	opts := fake.Options()
+	opts.Cache = store
+	c := edgar.NewClient(opts)
+
+	for i := 0; i < 2; i++ {
+		content, err := c.GetCached(context.Background(), fake.URL+submissionPath)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(content, submission) {
+			t.Errorf("GetCached() call %d = %q, want %q", i+1, content, submission)
+		}
+	}
+	if requests := fake.Requests(); len(requests) != 1 {
+		t.Errorf("GetCached() twice made %d requests, want 1", len(requests))
+	}
+	if stats := c.Stats(); stats.CacheHits != 1 {
+		t.Errorf("Stats().CacheHits = %d, want 1", stats.CacheHits)
+	}
+}
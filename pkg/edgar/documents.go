@@ -0,0 +1,103 @@
+package edgar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// FilingDocument is a document of a filing as the filing's index page lists it
+type FilingDocument struct {
+	Seq         string
+	Description string
+	// Name is the document's link text, the file name, or the name of the rendered page for the
+	// documents EDGAR renders through an XSL stylesheet
+	Name string
+	Type string
+	URL  string
+}
+
+// FilingIndexURL is the URL of the index page of an index entry's filing, which lists its documents,
+// e.g. .../edgar/data/1000045/000100004522000005/0001000045-22-000005-index.htm
+func (c *Client) FilingIndexURL(entry *IndexEntry) string {
+	accession := strings.TrimSuffix(path.Base(entry.FileName), ".txt")
+	return fmt.Sprintf("%s/%s/%s/%s-index.htm", c.opts.ArchivesURL, path.Dir(entry.FileName), strings.ReplaceAll(accession, "-", ""), accession)
+}
+
+// FilingDocuments returns the documents the index page of an index entry's filing lists. The page
+// doesn't change once the filing is published, so it is cached.
+func (c *Client) FilingDocuments(ctx context.Context, entry *IndexEntry) ([]*FilingDocument, error) {
+	indexURL := c.FilingIndexURL(entry)
+	page, err := c.GetCached(ctx, indexURL)
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(indexURL)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(page))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the filing index HTML: %w", err)
+	}
+
+	docs := []*FilingDocument{}
+	doc.Find("table.tableFile tr").Each(func(i int, row *goquery.Selection) {
+		cells := row.Find("td")
+		if cells.Length() < 4 {
+			// The header row
+			return
+		}
+		link := cells.Eq(2).Find("a")
+		href, ok := link.Attr("href")
+		if !ok {
+			return
+		}
+		ref, err := url.Parse(href)
+		if err != nil {
+			return
+		}
+		docs = append(docs, &FilingDocument{
+			Seq:         strings.TrimSpace(cells.Eq(0).Text()),
+			Description: strings.TrimSpace(cells.Eq(1).Text()),
+			Name:        strings.TrimSpace(link.Text()),
+			Type:        strings.TrimSpace(cells.Eq(3).Text()),
+			// Links are relative to the host, which resolves them against -edgar-url's too
+			URL: base.ResolveReference(ref).String(),
+		})
+	})
+	return docs, nil
+}
+
+// OwnershipXMLDocument picks the XML of a form 3, 4 or 5 out of its filing's documents: the .xml
+// document of formType, or described as it, e.g. FORM 4, leaving out the page EDGAR renders from it
+// under an xsl folder. formType can be empty to take any of the ownership forms. It returns nil if
+// none matches.
+func OwnershipXMLDocument(docs []*FilingDocument, formType string) *FilingDocument {
+	for _, d := range docs {
+		if !strings.HasSuffix(strings.ToLower(d.URL), ".xml") || strings.Contains(strings.ToLower(d.URL), "/xsl") {
+			continue
+		}
+		if formType == "" && isOwnershipForm(d.Type) {
+			return d
+		}
+		if formType != "" && (strings.EqualFold(d.Type, formType) || strings.EqualFold(d.Description, "FORM "+formType)) {
+			return d
+		}
+	}
+	return nil
+}
+
+// isOwnershipForm is whether formType is a form 3, 4 or 5 or an amendment of one
+func isOwnershipForm(formType string) bool {
+	switch strings.ToUpper(formType) {
+	case "3", "4", "5", "3/A", "4/A", "5/A":
+		return true
+	}
+	return false
+}
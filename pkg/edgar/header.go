@@ -0,0 +1,184 @@
+package edgar
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	// EDGAR's clock is Eastern time, which has to resolve on machines without a zoneinfo database
+	_ "time/tzdata"
+)
+
+// Eastern is the time zone EDGAR accepts filings in
+var Eastern = func() *time.Location {
+	loc, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}()
+
+var acceptanceTag = []byte("<ACCEPTANCE-DATETIME>")
+
+// AcceptanceDateTime reads when EDGAR accepted a submission from the <ACCEPTANCE-DATETIME> line of its
+// SEC header. ok is false when the submission has no header or the header has no acceptance time.
+func AcceptanceDateTime(submission []byte) (accepted time.Time, ok bool) {
+	header := secHeader(submission)
+	start := bytes.Index(header, acceptanceTag)
+	if start < 0 {
+		return time.Time{}, false
+	}
+	value := header[start+len(acceptanceTag):]
+	if end := bytes.IndexAny(value, "\r\n"); end >= 0 {
+		value = value[:end]
+	}
+	accepted, err := time.ParseInLocation("20060102150405", string(bytes.TrimSpace(value)), Eastern)
+	return accepted, err == nil
+}
+
+// AcceptanceDateTimeOf returns when the filing with the given accession number (dashed or not) was
+// accepted, as the submissions JSON lists it. Its times end in Z but are Eastern clock times, so they
+// are read as such.
+func (r *RecentFilings) AcceptanceDateTimeOf(accession string) (time.Time, error) {
+	for i, a := range r.AccessionNumber {
+		if !sameAccession(a, accession) {
+			continue
+		}
+		if i >= len(r.AcceptanceDateTime) {
+			break
+		}
+		value := r.AcceptanceDateTime[i]
+		if len(value) > 19 {
+			value = value[:19]
+		}
+		accepted, err := time.ParseInLocation("2006-01-02T15:04:05", value, Eastern)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid acceptance time %q for %s", r.AcceptanceDateTime[i], accession)
+		}
+		return accepted, nil
+	}
+	return time.Time{}, fmt.Errorf("%s is not among the recent filings", accession)
+}
+
+func sameAccession(a, b string) bool {
+	return strings.ReplaceAll(a, "-", "") == strings.ReplaceAll(b, "-", "")
+}
+
+// secHeader returns the SEC header at the start of a submission, so nothing is looked for in the
+// documents after it
+func secHeader(submission []byte) []byte {
+	if end := bytes.Index(submission, []byte("</SEC-HEADER>")); end >= 0 {
+		return submission[:end]
+	}
+	return submission
+}
+
+// Company is what a submission's SEC header says about one of the companies or people it names
+type Company struct {
+	Name string
+	// CIK is zero padded to 10 digits
+	CIK string
+	// SIC is the standard industrial classification as the header writes it, e.g. FINANCE SERVICES [6199]
+	SIC                  string
+	StateOfIncorporation string
+	// FiscalYearEnd is MMDD, e.g. 1231
+	FiscalYearEnd   string
+	BusinessAddress Address
+	// BusinessPhone is only given for companies
+	BusinessPhone string
+	MailAddress   Address
+}
+
+// Header is the part of a submission's SEC header that says what it is and the companies and people it
+// names
+type Header struct {
+	// SubmissionType is the form type, e.g. 4 or 4/A
+	SubmissionType string
+	// FiledAsOfDate is YYYYMMDD, as the indexes write the date filed
+	FiledAsOfDate string
+	// Issuer is nil when the header has no ISSUER section
+	Issuer          *Company
+	ReportingOwners []Company
+}
+
+// ParseHeader reads the submission type, the date filed and the ISSUER and REPORTING-OWNER sections
+// of a submission's SEC header. Each section is a tab indented outline:
+//
+//	ISSUER:
+//		COMPANY DATA:
+//			COMPANY CONFORMED NAME:	NICHOLAS FINANCIAL INC
+//			STATE OF INCORPORATION:	FL
+//		BUSINESS ADDRESS:
+//			CITY:	CLEARWATER
+//
+// Other sections, and fields not in Company, are skipped.
+func ParseHeader(submission []byte) *Header {
+	h := &Header{}
+	var company *Company
+	var address *Address
+	section := ""
+	for _, line := range strings.Split(string(secHeader(submission)), "\n") {
+		line = strings.TrimRight(line, "\r")
+		depth := len(line) - len(strings.TrimLeft(line, "\t"))
+		colon := strings.IndexByte(line, ':')
+		if colon < 0 {
+			continue
+		}
+		key, value := strings.TrimSpace(line[:colon]), strings.TrimSpace(line[colon+1:])
+
+		switch {
+		case depth == 0:
+			company, address = nil, nil
+			switch key {
+			case "CONFORMED SUBMISSION TYPE":
+				h.SubmissionType = value
+			case "FILED AS OF DATE":
+				h.FiledAsOfDate = value
+			case "ISSUER":
+				h.Issuer = &Company{}
+				company = h.Issuer
+			case "REPORTING-OWNER":
+				h.ReportingOwners = append(h.ReportingOwners, Company{})
+				company = &h.ReportingOwners[len(h.ReportingOwners)-1]
+			}
+		case company == nil:
+		case depth == 1:
+			section, address = key, nil
+			switch key {
+			case "BUSINESS ADDRESS":
+				address = &company.BusinessAddress
+			case "MAIL ADDRESS":
+				address = &company.MailAddress
+			}
+		case address != nil:
+			switch key {
+			case "STREET 1":
+				address.Street1 = value
+			case "STREET 2":
+				address.Street2 = value
+			case "CITY":
+				address.City = value
+			case "STATE":
+				address.StateOrCountry = value
+			case "ZIP":
+				address.ZipCode = value
+			case "BUSINESS PHONE":
+				company.BusinessPhone = value
+			}
+		case section == "COMPANY DATA" || section == "OWNER DATA":
+			switch key {
+			case "COMPANY CONFORMED NAME":
+				company.Name = value
+			case "CENTRAL INDEX KEY":
+				company.CIK = value
+			case "STANDARD INDUSTRIAL CLASSIFICATION":
+				company.SIC = value
+			case "STATE OF INCORPORATION":
+				company.StateOfIncorporation = value
+			case "FISCAL YEAR END":
+				company.FiscalYearEnd = value
+			}
+		}
+	}
+	return h
+}
@@ -0,0 +1,249 @@
+package edgar
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// IndexEntry is a row of a daily or quarterly master index
+type IndexEntry struct {
+	CIK         string
+	CompanyName string
+	FormType    string
+	// DateFiled is YYYYMMDD for both daily and quarterly indexes
+	DateFiled string
+	// FileName is the submission's path relative to the archives root, e.g. edgar/data/1000045/0001000045-22-000005.txt
+	FileName string
+	// AccessionNumber has its dashes removed
+	AccessionNumber string
+	// AcceptanceDateTime is when EDGAR accepted the submission, RFC 3339 in Eastern time. It isn't in
+	// the index, the downloader fills it in from the submission once fetched, and it is empty until then.
+	AcceptanceDateTime string
+}
+
+// DailyIndexURL is the directory listing the daily master files of a quarter
+func (c *Client) DailyIndexURL(year, quarter int) string {
+	return fmt.Sprintf("%s/edgar/daily-index/%d/QTR%d/", c.opts.ArchivesURL, year, quarter)
+}
+
+// QuarterlyIndexURL is the master file covering a whole quarter
+func (c *Client) QuarterlyIndexURL(year, quarter int) string {
+	return fmt.Sprintf("%s/edgar/full-index/%d/QTR%d/master.idx", c.opts.ArchivesURL, year, quarter)
+}
+
+// DailyIndex returns every entry of every daily master file published so far for the quarter. The
+// listing is always fetched fresh, the master files themselves are cached. Use ForEachDailyIndex or
+// ForEachFiling to avoid holding the whole quarter in memory.
+func (c *Client) DailyIndex(ctx context.Context, year, quarter int) ([]*IndexEntry, error) {
+	entries := []*IndexEntry{}
+	err := c.ForEachDailyIndex(ctx, year, quarter, func(masterFile string, dayEntries []*IndexEntry) error {
+		entries = append(entries, dayEntries...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// DailyMasterFiles lists the URLs of the quarter's daily master files in date order. An offline
+// client lists the ones in its cache.
+func (c *Client) DailyMasterFiles(ctx context.Context, year, quarter int) ([]string, error) {
+	if c.opts.Offline {
+		return c.cachedMasterFiles(year, quarter)
+	}
+	listing, err := c.Get(ctx, c.DailyIndexURL(year, quarter))
+	if err != nil {
+		return nil, fmt.Errorf("error getting daily index listing: %w", err)
+	}
+
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(listing))
+	if err != nil {
+		return nil, fmt.Errorf("error reading the daily index listing HTML: %w", err)
+	}
+
+	masterFiles := []string{}
+	doc.Find("a").Each(func(i int, s *goquery.Selection) {
+		if href, ok := s.Attr("href"); ok && strings.HasPrefix(strings.TrimSpace(s.Text()), "master.") {
+			masterFiles = append(masterFiles, c.DailyIndexURL(year, quarter)+href)
+		}
+	})
+	// master.YYYYMMDD.idx sorts by date
+	sort.Strings(masterFiles)
+
+	c.opts.Logf("Got %d master files", len(masterFiles))
+	return masterFiles, nil
+}
+
+// cachedMasterFiles lists the URLs of the quarter's daily master files in the cache in date order
+func (c *Client) cachedMasterFiles(year, quarter int) ([]string, error) {
+	lister, ok := c.opts.Cache.(interface{ Entries() []*StoreEntry })
+	if !ok {
+		return nil, fmt.Errorf("%w: the cache can't list the daily master files", ErrOffline)
+	}
+	prefix := c.DailyIndexURL(year, quarter) + "master."
+	masterFiles := []string{}
+	for _, entry := range lister.Entries() {
+		if strings.HasPrefix(entry.URL, prefix) {
+			masterFiles = append(masterFiles, entry.URL)
+		}
+	}
+	sort.Strings(masterFiles)
+
+	c.opts.Logf("Found %d cached master files", len(masterFiles))
+	return masterFiles, nil
+}
+
+// ForEachDailyIndex calls fn with the entries of each of the quarter's daily master files in date
+// order, so only one day is held in memory at a time. Returning an error from fn stops the iteration
+// and is returned as is.
+func (c *Client) ForEachDailyIndex(ctx context.Context, year, quarter int, fn func(masterFile string, entries []*IndexEntry) error) error {
+	masterFiles, err := c.DailyMasterFiles(ctx, year, quarter)
+	if err != nil {
+		return err
+	}
+
+	for _, masterFile := range masterFiles {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		mf, err := c.GetCached(ctx, masterFile)
+		if err != nil {
+			return fmt.Errorf("error downloading master file %s: %w", masterFile, err)
+		}
+		if err := fn(masterFile, ParseMasterIndex(mf)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AccessionSet is the accession numbers already visited, to skip the repeated index entries of a
+// filing: joint filings are listed once per filer, and now and then a filing is listed in two daily
+// master files
+type AccessionSet map[string]bool
+
+// Add records an accession number, returning false if it was already in the set
+func (s AccessionSet) Add(accession string) bool {
+	if s[accession] {
+		return false
+	}
+	s[accession] = true
+	return true
+}
+
+// Filter returns the entries whose accession number hasn't been seen, keeping the first entry of each
+// and adding them to the set
+func (s AccessionSet) Filter(entries []*IndexEntry) []*IndexEntry {
+	unique := entries[:0]
+	for _, entry := range entries {
+		if s.Add(entry.AccessionNumber) {
+			unique = append(unique, entry)
+		}
+	}
+	return unique
+}
+
+// FilingFilter narrows the entries ForEachFiling visits
+type FilingFilter struct {
+	// FormTypes to include, e.g. "4" and "4/A". Empty includes every form, unless there are
+	// FormTypePatterns.
+	FormTypes []string
+	// FormTypePatterns include the forms whose type they match, in addition to FormTypes. Anchor
+	// them with ^ and $ to match whole types.
+	FormTypePatterns []*regexp.Regexp
+}
+
+// Match is whether the filter includes entry
+func (f FilingFilter) Match(entry *IndexEntry) bool {
+	if len(f.FormTypes) == 0 && len(f.FormTypePatterns) == 0 {
+		return true
+	}
+	for _, formType := range f.FormTypes {
+		if entry.FormType == formType {
+			return true
+		}
+	}
+	for _, pattern := range f.FormTypePatterns {
+		if pattern.MatchString(entry.FormType) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForEachFiling calls fn for every daily index entry of the quarter that matches filter, in index
+// order one day at a time
+func (c *Client) ForEachFiling(ctx context.Context, year, quarter int, filter FilingFilter, fn func(entry *IndexEntry) error) error {
+	return c.ForEachDailyIndex(ctx, year, quarter, func(masterFile string, entries []*IndexEntry) error {
+		for _, entry := range entries {
+			if !filter.Match(entry) {
+				continue
+			}
+			if err := fn(entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// QuarterlyIndex returns the entries of the quarter's full-index master file. It is only complete
+// once the quarter is over, so it is not cached.
+func (c *Client) QuarterlyIndex(ctx context.Context, year, quarter int) ([]*IndexEntry, error) {
+	mf, err := c.Get(ctx, c.QuarterlyIndexURL(year, quarter))
+	if err != nil {
+		return nil, fmt.Errorf("error downloading quarterly master file: %w", err)
+	}
+	return ParseMasterIndex(mf), nil
+}
+
+// ParseMasterIndex parses a daily or quarterly master.idx file
+func ParseMasterIndex(fileContent []byte) []*IndexEntry {
+	rows := strings.Split(string(fileContent), "\n")
+	// Get rid of the description header, which ends with a line of dashes
+	for i, row := range rows {
+		if strings.HasPrefix(row, "----") {
+			rows = rows[i+1:]
+			break
+		}
+	}
+
+	resp := []*IndexEntry{}
+
+	for _, row := range rows {
+		row = strings.TrimRight(row, "\r")
+		if row == "" {
+			continue
+		}
+		parts := strings.Split(row, "|")
+		if len(parts) != 5 {
+			log.Printf("Row did not have correct amount of parts: %+v", row)
+			continue
+		}
+
+		accessionNumber := strings.Split(parts[4], ".txt")[0]
+		split := strings.Split(accessionNumber, "/")
+		accessionNumber = split[len(split)-1]
+		accessionNumber = strings.ReplaceAll(accessionNumber, "-", "")
+
+		resp = append(resp, &IndexEntry{
+			CIK:         parts[0],
+			CompanyName: parts[1],
+			FormType:    parts[2],
+			// The quarterly index uses YYYY-MM-DD
+			DateFiled:       strings.ReplaceAll(parts[3], "-", ""),
+			FileName:        parts[4],
+			AccessionNumber: accessionNumber,
+		})
+	}
+
+	return resp
+}
@@ -0,0 +1,50 @@
+package edgar
+
+import (
+	"strconv"
+	"strings"
+)
+
+// SplitSIC splits a SIC as the header writes it, e.g. FINANCE SERVICES [6199], into its code and the
+// industry it names. A SIC without a code in brackets is returned as the industry.
+func SplitSIC(sic string) (code, industry string) {
+	sic = strings.TrimSpace(sic)
+	if open := strings.LastIndex(sic, "["); open >= 0 && strings.HasSuffix(sic, "]") {
+		return strings.TrimSpace(sic[open+1 : len(sic)-1]), strings.TrimSpace(sic[:open])
+	}
+	return "", sic
+}
+
+// sicDivisions are the divisions of the SIC manual, each the major groups (the first two digits of a
+// code) from first up to last
+var sicDivisions = []struct {
+	first, last int
+	name        string
+}{
+	{1, 9, "Agriculture, Forestry and Fishing"},
+	{10, 14, "Mining"},
+	{15, 17, "Construction"},
+	{20, 39, "Manufacturing"},
+	{40, 49, "Transportation, Communications and Utilities"},
+	{50, 51, "Wholesale Trade"},
+	{52, 59, "Retail Trade"},
+	{60, 67, "Finance, Insurance and Real Estate"},
+	{70, 89, "Services"},
+	{91, 97, "Public Administration"},
+	{99, 99, "Nonclassifiable"},
+}
+
+// SICDivision returns the division of the SIC manual a 4 digit code is in, the sector it belongs to,
+// e.g. Finance, Insurance and Real Estate for 6199. It is "" when the code isn't in one.
+func SICDivision(code string) string {
+	n, err := strconv.Atoi(code)
+	if err != nil || len(code) != 4 {
+		return ""
+	}
+	for _, d := range sicDivisions {
+		if n/100 >= d.first && n/100 <= d.last {
+			return d.name
+		}
+	}
+	return ""
+}
@@ -0,0 +1,646 @@
+package edgar
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotCached         = errors.New("ErrNotCached")
+	ErrStoreEncrypted    = errors.New("ErrStoreEncrypted")
+	ErrStoreNotEncrypted = errors.New("ErrStoreNotEncrypted")
+	// ErrInvalidHash is returned for an object hash that isn't a lowercase hex SHA-256, e.g. one from
+	// a corrupt bundle
+	ErrInvalidHash = errors.New("ErrInvalidHash")
+)
+
+// keyIDName is the file in an encrypted store's root holding the ID of its key
+const keyIDName = "KEY_ID"
+
+// Store is a content-addressed cache of downloaded SEC documents. Each document is written once
+// under objects/ by its sha256, and index.jsonl maps every URL we fetched to the hash of its content,
+// so identical documents referenced from multiple index entries only take up disk once.
+//
+// With a Cipher, objects and index lines are encrypted. Objects are still named by the hash of their
+// plaintext, which only tells someone with the same public document that it is stored.
+type Store struct {
+	root   string
+	cipher *Cipher
+
+	mu    sync.RWMutex
+	index map[string]*StoreEntry
+	// filings maps the file name of each cached submission, e.g. 0001000045-22-000005.txt, to a URL
+	// it is cached under, as a joint filing has a URL under the folder of each of its filers
+	filings   map[string]string
+	indexFile *os.File
+}
+
+// submissionURLPattern matches the URL of a submission text file, capturing its file name
+var submissionURLPattern = regexp.MustCompile(`edgar/data/\d+/(\d{10}-\d{2}-\d{6}\.txt)$`)
+
+type StoreEntry struct {
+	URL       string    `json:"url"`
+	SHA256    string    `json:"sha256"`
+	Size      int64     `json:"size"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// StoreOptions configures a Store
+type StoreOptions struct {
+	// Cipher encrypts the store. A new store is encrypted with it, an existing one must have been
+	// encrypted with the same key, by EncryptStore if it was made without one.
+	Cipher *Cipher
+}
+
+// OpenStore opens (creating if needed) the store at root and loads the URL index. It returns
+// ErrStoreEncrypted for an encrypted store opened without a Cipher, ErrWrongKey for one encrypted
+// with another key, and ErrStoreNotEncrypted for an existing store that isn't encrypted opened with one.
+func OpenStore(root string, opts StoreOptions) (*Store, error) {
+	if err := os.MkdirAll(filepath.Join(root, "objects"), 0777); err != nil {
+		return nil, fmt.Errorf("error creating store dirs: %w", err)
+	}
+
+	s := &Store{
+		root:    root,
+		cipher:  opts.Cipher,
+		index:   map[string]*StoreEntry{},
+		filings: map[string]string{},
+	}
+
+	indexPath := filepath.Join(root, "index.jsonl")
+	keyID, err := readKeyID(root)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case keyID != "" && s.cipher == nil:
+		return nil, ErrStoreEncrypted
+	case keyID != "" && keyID != s.cipher.ID():
+		return nil, ErrWrongKey
+	case keyID == "" && s.cipher != nil:
+		if info, err := os.Stat(indexPath); err == nil && info.Size() > 0 {
+			return nil, ErrStoreNotEncrypted
+		}
+		if err := ioutil.WriteFile(filepath.Join(root, keyIDName), []byte(s.cipher.ID()+"\n"), 0666); err != nil {
+			return nil, fmt.Errorf("error writing store key ID: %w", err)
+		}
+	}
+
+	if err := s.loadIndex(indexPath); err != nil {
+		return nil, err
+	}
+
+	f, err := os.OpenFile(indexPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return nil, fmt.Errorf("error opening store index: %w", err)
+	}
+	s.indexFile = f
+
+	return s, nil
+}
+
+func (s *Store) loadIndex(indexPath string) error {
+	f, err := os.Open(indexPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error opening store index: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		line, err := s.openIndexLine(scanner.Bytes())
+		if err != nil {
+			return fmt.Errorf("error reading store index: %w", err)
+		}
+		var entry StoreEntry
+		if err := json.Unmarshal(line, &entry); err != nil {
+			// A crash mid-append can leave a partial last line, the object will just get fetched again
+			log.Printf("Skipping invalid store index line: %s", err)
+			continue
+		}
+		// Later lines win, so a re-fetched URL points at its newest content
+		s.add(&entry)
+	}
+	return scanner.Err()
+}
+
+// Close closes the index file
+func (s *Store) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.indexFile.Close()
+}
+
+// objectPath is where the object hash is stored, which must be a validHash
+func (s *Store) objectPath(hash string) string {
+	return filepath.Join(s.root, "objects", hash[:2], hash)
+}
+
+// validHash is whether hash is a lowercase hex SHA-256, the only names objects are stored under
+func validHash(hash string) bool {
+	if len(hash) != sha256.Size*2 {
+		return false
+	}
+	for _, c := range hash {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+func readKeyID(root string) (string, error) {
+	content, err := ioutil.ReadFile(filepath.Join(root, keyIDName))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error reading store key ID: %w", err)
+	}
+	return strings.TrimSpace(string(content)), nil
+}
+
+// indexLine is an entry as the index has it, JSON or with a cipher, the base64 of it sealed
+func (s *Store) indexLine(entry *StoreEntry) ([]byte, error) {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return nil, err
+	}
+	if s.cipher != nil {
+		line = []byte(base64.StdEncoding.EncodeToString(s.cipher.Seal(line, "index")))
+	}
+	return append(line, '\n'), nil
+}
+
+// openIndexLine is the JSON of an index line. Lines of an encrypted store may be JSON still if
+// EncryptStore was interrupted.
+func (s *Store) openIndexLine(line []byte) ([]byte, error) {
+	if bytes.HasPrefix(line, []byte("{")) || s.cipher == nil {
+		return line, nil
+	}
+	sealed, err := base64.StdEncoding.DecodeString(string(line))
+	if err != nil {
+		// A crash mid-append can leave a partial last line, which the JSON decoding skips
+		return line, nil
+	}
+	return s.cipher.Open(sealed, "index")
+}
+
+// readObject returns an object's plaintext. Objects of an encrypted store may be plaintext still if
+// EncryptStore was interrupted.
+func (s *Store) readObject(hash string) ([]byte, error) {
+	if !validHash(hash) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+	}
+	content, err := ioutil.ReadFile(s.objectPath(hash))
+	if err != nil || !IsSealed(content) {
+		return content, err
+	}
+	if s.cipher == nil {
+		return nil, ErrStoreEncrypted
+	}
+	return s.cipher.Open(content, hash)
+}
+
+func (s *Store) writeObject(hash string, content []byte) error {
+	if s.cipher != nil {
+		content = s.cipher.Seal(content, hash)
+	}
+	return writeFileAtomic(s.objectPath(hash), content)
+}
+
+// Lookup returns the index entry for a URL, if one exists
+func (s *Store) Lookup(url string) (*StoreEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entry, ok := s.index[url]
+	return entry, ok
+}
+
+// add indexes an entry, the caller holding the lock
+func (s *Store) add(entry *StoreEntry) {
+	s.index[entry.URL] = entry
+	if m := submissionURLPattern.FindStringSubmatch(entry.URL); m != nil {
+		s.filings[m[1]] = entry.URL
+	}
+}
+
+// GetFiling is Get for the submission text file at url, falling back to the same submission cached
+// under another filer's folder. A joint filing is listed once per filer, each under its own folder,
+// so this way it is only downloaded once whichever filer's URL is fetched first. A submission found
+// under another URL is indexed under url too, sharing its object and fetch time.
+func (s *Store) GetFiling(url string) ([]byte, error) {
+	content, err := s.Get(url)
+	m := submissionURLPattern.FindStringSubmatch(url)
+	if !errors.Is(err, ErrNotCached) || m == nil {
+		return content, err
+	}
+	s.mu.RLock()
+	other, ok := s.index[s.filings[m[1]]]
+	s.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotCached
+	}
+	if content, err = s.Get(other.URL); err != nil {
+		return nil, err
+	}
+	if _, err = s.AddEntry(&StoreEntry{URL: url, SHA256: other.SHA256, Size: other.Size, FetchedAt: other.FetchedAt}); err != nil {
+		return nil, err
+	}
+	return content, nil
+}
+
+// Get returns the cached content for a URL, or ErrNotCached if we have never stored it
+func (s *Store) Get(url string) ([]byte, error) {
+	entry, ok := s.Lookup(url)
+	if !ok {
+		return nil, ErrNotCached
+	}
+
+	content, err := s.readObject(entry.SHA256)
+	if errors.Is(err, os.ErrNotExist) {
+		// Index says we have it but the object is gone, treat it as a miss
+		return nil, ErrNotCached
+	} else if err != nil {
+		return nil, fmt.Errorf("error reading object %s: %w", entry.SHA256, err)
+	}
+	return content, nil
+}
+
+// Put stores content for the URL, writing the object only if no identical document is already stored
+func (s *Store) Put(url string, content []byte) (*StoreEntry, error) {
+	return s.PutAt(url, content, time.Now())
+}
+
+// PutAt is Put with an explicit fetch time, for documents that were downloaded before they were stored
+func (s *Store) PutAt(url string, content []byte, fetchedAt time.Time) (*StoreEntry, error) {
+	sum := sha256.Sum256(content)
+	hash := hex.EncodeToString(sum[:])
+
+	objectPath := s.objectPath(hash)
+	if _, err := os.Stat(objectPath); errors.Is(err, os.ErrNotExist) {
+		if err := s.writeObject(hash, content); err != nil {
+			return nil, fmt.Errorf("error writing object %s: %w", hash, err)
+		}
+	} else if err != nil {
+		return nil, fmt.Errorf("error checking object %s: %w", hash, err)
+	}
+
+	entry := &StoreEntry{
+		URL:       url,
+		SHA256:    hash,
+		Size:      int64(len(content)),
+		FetchedAt: fetchedAt.UTC(),
+	}
+	line, err := s.indexLine(entry)
+	if err != nil {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.indexFile.Write(line); err != nil {
+		return nil, fmt.Errorf("error appending to store index: %w", err)
+	}
+	s.add(entry)
+
+	return entry, nil
+}
+
+// writeFileAtomic writes to a temp file in the same directory and renames it into place, so readers
+// never observe a partially written object
+func writeFileAtomic(path string, content []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// CorruptObject is a stored object whose content no longer matches what was recorded for it
+type CorruptObject struct {
+	SHA256 string
+	Reason string
+	// URLs are the index entries that point at this object
+	URLs []string
+}
+
+// Verify re-hashes every object referenced by the index, returning the ones that are missing,
+// truncated, or whose content no longer matches their hash
+func (s *Store) Verify() (checked int, corrupt []*CorruptObject, err error) {
+	s.mu.RLock()
+	byHash := map[string][]*StoreEntry{}
+	for _, entry := range s.index {
+		byHash[entry.SHA256] = append(byHash[entry.SHA256], entry)
+	}
+	s.mu.RUnlock()
+
+	for hash, entries := range byHash {
+		urls := make([]string, 0, len(entries))
+		for _, entry := range entries {
+			urls = append(urls, entry.URL)
+		}
+
+		reason, err := s.verifyObject(hash, entries[0].Size)
+		if err != nil {
+			return checked, corrupt, err
+		}
+		checked++
+		if reason != "" {
+			corrupt = append(corrupt, &CorruptObject{
+				SHA256: hash,
+				Reason: reason,
+				URLs:   urls,
+			})
+		}
+	}
+
+	return checked, corrupt, nil
+}
+
+func (s *Store) verifyObject(hash string, size int64) (string, error) {
+	content, err := s.readObject(hash)
+	if errors.Is(err, os.ErrNotExist) {
+		return "missing", nil
+	} else if errors.Is(err, ErrInvalidHash) {
+		return "indexed under an invalid hash", nil
+	} else if errors.Is(err, ErrWrongKey) {
+		// Authenticated encryption can't tell a truncated or altered object from one sealed with another key
+		return "can't be decrypted, corrupt or tampered with", nil
+	} else if err != nil {
+		return "", fmt.Errorf("error reading object %s: %w", hash, err)
+	}
+
+	n := int64(len(content))
+	sum := sha256.Sum256(content)
+	if n < size {
+		return fmt.Sprintf("truncated, %d of %d bytes", n, size), nil
+	} else if got := hex.EncodeToString(sum[:]); got != hash {
+		return fmt.Sprintf("checksum mismatch, got %s", got), nil
+	}
+	return "", nil
+}
+
+// RemoveObject deletes a stored object so the next Put for it rewrites it from scratch
+func (s *Store) RemoveObject(hash string) error {
+	if !validHash(hash) {
+		return fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+	}
+	err := os.Remove(s.objectPath(hash))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+// Entries returns a snapshot of every index entry
+func (s *Store) Entries() []*StoreEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	entries := make([]*StoreEntry, 0, len(s.index))
+	for _, entry := range s.index {
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// HasObject returns whether an object with the given hash is stored
+func (s *Store) HasObject(hash string) bool {
+	if !validHash(hash) {
+		return false
+	}
+	_, err := os.Stat(s.objectPath(hash))
+	return err == nil
+}
+
+// ReadObject returns the content of a stored object, decrypted if the store is encrypted
+func (s *Store) ReadObject(hash string) ([]byte, error) {
+	return s.readObject(hash)
+}
+
+// PutObject stores content read from r under hash, refusing it if the content does not hash to it
+func (s *Store) PutObject(hash string, r io.Reader) error {
+	if !validHash(hash) {
+		return fmt.Errorf("%w: %q", ErrInvalidHash, hash)
+	}
+	if s.HasObject(hash) {
+		return nil
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	sum := sha256.Sum256(content)
+	if got := hex.EncodeToString(sum[:]); got != hash {
+		return fmt.Errorf("object %s has checksum %s", hash, got)
+	}
+	return s.writeObject(hash, content)
+}
+
+// AddEntry records an index entry for an object that is already stored, keeping the existing
+// entry if the URL is already indexed
+func (s *Store) AddEntry(entry *StoreEntry) (bool, error) {
+	if !validHash(entry.SHA256) {
+		return false, fmt.Errorf("%w: %q for %s", ErrInvalidHash, entry.SHA256, entry.URL)
+	}
+	if !s.HasObject(entry.SHA256) {
+		return false, fmt.Errorf("object %s for %s is not stored", entry.SHA256, entry.URL)
+	}
+	line, err := s.indexLine(entry)
+	if err != nil {
+		return false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.index[entry.URL]; exists {
+		return false, nil
+	}
+	if _, err := s.indexFile.Write(line); err != nil {
+		return false, fmt.Errorf("error appending to store index: %w", err)
+	}
+	s.add(entry)
+	return true, nil
+}
+
+// EncryptStore encrypts the unencrypted store at root with c, rewriting every object and the index.
+// It can be run again to finish the job if interrupted, the store opening with c from when it starts.
+func EncryptStore(root string, c *Cipher) (objects int, err error) {
+	keyID, err := readKeyID(root)
+	if err != nil {
+		return 0, err
+	}
+	if keyID != "" && keyID != c.ID() {
+		return 0, ErrWrongKey
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, keyIDName), []byte(c.ID()+"\n"), 0666); err != nil {
+		return 0, fmt.Errorf("error writing store key ID: %w", err)
+	}
+	s, err := OpenStore(root, StoreOptions{Cipher: c})
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	err = filepath.Walk(filepath.Join(root, "objects"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || strings.HasPrefix(info.Name(), ".") {
+			return err
+		}
+		content, err := ioutil.ReadFile(path)
+		if err != nil || IsSealed(content) {
+			return err
+		}
+		if err = s.writeObject(info.Name(), content); err != nil {
+			return fmt.Errorf("error encrypting object %s: %w", info.Name(), err)
+		}
+		objects++
+		return nil
+	})
+	if err != nil {
+		return objects, err
+	}
+
+	// The index is rewritten whole, which also drops the lines later ones replaced
+	entries := s.Entries()
+	sort.Slice(entries, func(i, j int) bool { return entries[i].URL < entries[j].URL })
+	index := []byte{}
+	for _, entry := range entries {
+		line, err := s.indexLine(entry)
+		if err != nil {
+			return objects, err
+		}
+		index = append(index, line...)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := writeFileAtomic(filepath.Join(root, "index.jsonl"), index); err != nil {
+		return objects, fmt.Errorf("error rewriting store index: %w", err)
+	}
+	return objects, nil
+}
+
+// StoreStatus is an inventory of a store, what its index lists against what is on disk
+type StoreStatus struct {
+	// Entries are the URLs indexed
+	Entries []*StoreEntry
+	// Objects is how many objects are on disk and Bytes their size there, encrypted or not
+	Objects int
+	Bytes   int64
+	// Orphaned are the files under objects/ no entry points at, objects whose index line was lost and
+	// the temp files of writes that were interrupted, with their size in OrphanedBytes
+	Orphaned      []string
+	OrphanedBytes int64
+	// Missing are the entries whose object isn't on disk, which are fetched again when requested
+	Missing []*StoreEntry
+}
+
+// Status takes an inventory of the store, listing every object on disk
+func (s *Store) Status() (*StoreStatus, error) {
+	status := &StoreStatus{Entries: s.Entries()}
+	referenced := map[string]bool{}
+	for _, entry := range status.Entries {
+		referenced[entry.SHA256] = true
+	}
+	onDisk := map[string]bool{}
+	err := filepath.Walk(filepath.Join(s.root, "objects"), func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		if !referenced[info.Name()] {
+			status.Orphaned = append(status.Orphaned, path)
+			status.OrphanedBytes += info.Size()
+			return nil
+		}
+		onDisk[info.Name()] = true
+		status.Objects++
+		status.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %w", err)
+	}
+	for _, entry := range status.Entries {
+		if !onDisk[entry.SHA256] {
+			status.Missing = append(status.Missing, entry)
+		}
+	}
+	sort.Slice(status.Missing, func(i, j int) bool { return status.Missing[i].URL < status.Missing[j].URL })
+	return status, nil
+}
+
+// Reconcile makes the index agree with the disk as status found it: the orphaned files are deleted
+// and the index is rewritten without the missing entries, which also drops the lines later ones
+// replaced. Nothing else may be writing to the store meanwhile.
+func (s *Store) Reconcile(status *StoreStatus) error {
+	for _, path := range status.Orphaned {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("error removing orphaned file: %w", err)
+		}
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, entry := range status.Missing {
+		if s.index[entry.URL] == entry {
+			delete(s.index, entry.URL)
+		}
+	}
+	urls := make([]string, 0, len(s.index))
+	for url := range s.index {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+	index := []byte{}
+	for _, url := range urls {
+		line, err := s.indexLine(s.index[url])
+		if err != nil {
+			return err
+		}
+		index = append(index, line...)
+	}
+	indexPath := filepath.Join(s.root, "index.jsonl")
+	if err := writeFileAtomic(indexPath, index); err != nil {
+		return fmt.Errorf("error rewriting store index: %w", err)
+	}
+	// The file appended to until now was replaced
+	f, err := os.OpenFile(indexPath, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0666)
+	if err != nil {
+		return fmt.Errorf("error opening store index: %w", err)
+	}
+	s.indexFile.Close()
+	s.indexFile = f
+	return nil
+}
@@ -0,0 +1,109 @@
+package edgar
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+)
+
+const (
+	firstFilerURL  = "https://www.sec.gov/Archives/edgar/data/1611111/0000921895-22-001052.txt"
+	secondFilerURL = "https://www.sec.gov/Archives/edgar/data/1622222/0000921895-22-001052.txt"
+)
+
+func TestGetFilingAcrossFilers(t *testing.T) {
+	root := t.TempDir()
+	s, err := OpenStore(root, StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	submission := []byte("<SEC-DOCUMENT>joint filing</SEC-DOCUMENT>")
+	stored, err := s.Put(firstFilerURL, submission)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	content, err := s.GetFiling(secondFilerURL)
+	if err != nil {
+		t.Fatalf("GetFiling() of the second filer's URL = %v", err)
+	}
+	if !bytes.Equal(content, submission) {
+		t.Errorf("GetFiling() = %q, want %q", content, submission)
+	}
+	alias, ok := s.Lookup(secondFilerURL)
+	if !ok || alias.SHA256 != stored.SHA256 || !alias.FetchedAt.Equal(stored.FetchedAt) {
+		t.Fatalf("Lookup() of the second filer's URL = %+v, %v, want the first filer's object and fetch time", alias, ok)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// The alias is in the index file, so it is there after reopening without another lookup
+	s, err = OpenStore(root, StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if alias, ok := s.Lookup(secondFilerURL); !ok || alias.SHA256 != stored.SHA256 {
+		t.Errorf("Lookup() after reopening = %+v, %v, want the alias", alias, ok)
+	}
+	if content, err := s.Get(secondFilerURL); err != nil || !bytes.Equal(content, submission) {
+		t.Errorf("Get() after reopening = %q, %v", content, err)
+	}
+}
+
+func TestGetFilingOnlyAliasesSubmissions(t *testing.T) {
+	s, err := OpenStore(t.TempDir(), StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	indexPage := "https://www.sec.gov/Archives/edgar/data/1611111/000092189522001052/0000921895-22-001052-index.htm"
+	if _, err := s.Put(indexPage, []byte("<html></html>")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, url := range []string{
+		// Another filer's index page of the same filing
+		"https://www.sec.gov/Archives/edgar/data/1622222/000092189522001052/0000921895-22-001052-index.htm",
+		// A submission of the same name outside of a filer folder
+		"https://www.sec.gov/Archives/edgar/0000921895-22-001052.txt",
+	} {
+		if _, err := s.GetFiling(url); !errors.Is(err, ErrNotCached) {
+			t.Errorf("GetFiling(%s) = %v, want ErrNotCached", url, err)
+		}
+		if _, ok := s.Lookup(url); ok {
+			t.Errorf("GetFiling(%s) indexed an alias", url)
+		}
+	}
+	if _, err := s.Put("https://www.sec.gov/Archives/edgar/0000921895-22-001052.txt", []byte("not a filer folder")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.GetFiling(secondFilerURL); !errors.Is(err, ErrNotCached) {
+		t.Errorf("GetFiling() found a submission cached outside of a filer folder: %v", err)
+	}
+}
+
+func TestFetchFilingFromAnotherFilersFolder(t *testing.T) {
+	s, err := OpenStore(t.TempDir(), StoreOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	submission := []byte("<SEC-DOCUMENT>joint filing</SEC-DOCUMENT>")
+	if _, err := s.Put(firstFilerURL, submission); err != nil {
+		t.Fatal(err)
+	}
+
+	// Offline, so the submission can only come from the cache
+	c := NewClient(Options{Cache: s, Offline: true})
+	entry := &IndexEntry{AccessionNumber: "000092189522001052", FileName: "edgar/data/1622222/0000921895-22-001052.txt"}
+	content, err := c.FetchFiling(context.Background(), entry)
+	if err != nil {
+		t.Fatalf("FetchFiling() = %v", err)
+	}
+	if !bytes.Equal(content, submission) {
+		t.Errorf("FetchFiling() = %q, want %q", content, submission)
+	}
+}
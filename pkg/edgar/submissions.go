@@ -0,0 +1,129 @@
+package edgar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Submissions is the subset of data.sec.gov/submissions we use, describing an entity and its recent filings
+type Submissions struct {
+	CIK                  string       `json:"cik"`
+	EntityType           string       `json:"entityType"`
+	SIC                  string       `json:"sic"`
+	SICDescription       string       `json:"sicDescription"`
+	Name                 string       `json:"name"`
+	Tickers              []string     `json:"tickers"`
+	Exchanges            []string     `json:"exchanges"`
+	StateOfIncorporation string       `json:"stateOfIncorporation"`
+	FiscalYearEnd        string       `json:"fiscalYearEnd"`
+	FormerNames          []FormerName `json:"formerNames"`
+	Addresses            struct {
+		Mailing  Address `json:"mailing"`
+		Business Address `json:"business"`
+	} `json:"addresses"`
+	Filings struct {
+		Recent RecentFilings `json:"recent"`
+	} `json:"filings"`
+}
+
+type FormerName struct {
+	Name string `json:"name"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+type Address struct {
+	Street1                   string `json:"street1"`
+	Street2                   string `json:"street2"`
+	City                      string `json:"city"`
+	StateOrCountry            string `json:"stateOrCountry"`
+	ZipCode                   string `json:"zipCode"`
+	StateOrCountryDescription string `json:"stateOrCountryDescription"`
+}
+
+// RecentFilings are parallel arrays, index i of each describes the same filing
+type RecentFilings struct {
+	AccessionNumber    []string `json:"accessionNumber"`
+	FilingDate         []string `json:"filingDate"`
+	AcceptanceDateTime []string `json:"acceptanceDateTime"`
+	Form               []string `json:"form"`
+	PrimaryDocument    []string `json:"primaryDocument"`
+}
+
+// Company returns the entity as a submission's SEC header would describe it
+func (s *Submissions) Company() Company {
+	c := Company{
+		Name:                 s.Name,
+		CIK:                  PadCIK(s.CIK),
+		StateOfIncorporation: s.StateOfIncorporation,
+		FiscalYearEnd:        s.FiscalYearEnd,
+		BusinessAddress:      s.Addresses.Business,
+		MailAddress:          s.Addresses.Mailing,
+	}
+	if s.SIC != "" {
+		c.SIC = fmt.Sprintf("%s [%s]", strings.ToUpper(s.SICDescription), s.SIC)
+	}
+	return c
+}
+
+// PadCIK returns the 10 digit zero padded form of a CIK that the data APIs use
+func PadCIK(cik string) string {
+	cik = strings.TrimLeft(strings.TrimSpace(cik), "0")
+	if len(cik) >= 10 {
+		return cik
+	}
+	return strings.Repeat("0", 10-len(cik)) + cik
+}
+
+// Submissions returns the entity metadata and recent filings for a CIK. It changes with every
+// filing, so it is not cached.
+func (c *Client) Submissions(ctx context.Context, cik string) (*Submissions, error) {
+	content, err := c.Get(ctx, fmt.Sprintf("%s/submissions/CIK%s.json", c.opts.DataURL, PadCIK(cik)))
+	if err != nil {
+		return nil, err
+	}
+	var s Submissions
+	if err := json.Unmarshal(content, &s); err != nil {
+		return nil, fmt.Errorf("error parsing submissions for %s: %w", cik, err)
+	}
+	return &s, nil
+}
+
+// Ticker is an entry of the SEC's company ticker map
+type Ticker struct {
+	CIK    string
+	Ticker string
+	Title  string
+}
+
+// Tickers returns the SEC's current ticker to CIK map. A company with several share classes has one
+// entry per ticker.
+func (c *Client) Tickers(ctx context.Context) ([]Ticker, error) {
+	content, err := c.Get(ctx, c.opts.FilesURL+"/company_tickers.json")
+	if err != nil {
+		return nil, err
+	}
+
+	// Keyed by "0", "1", ... in rank order
+	var raw map[string]struct {
+		CIK    int64  `json:"cik_str"`
+		Ticker string `json:"ticker"`
+		Title  string `json:"title"`
+	}
+	if err := json.Unmarshal(content, &raw); err != nil {
+		return nil, fmt.Errorf("error parsing company tickers: %w", err)
+	}
+
+	tickers := make([]Ticker, len(raw))
+	for key, t := range raw {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(raw) {
+			return nil, fmt.Errorf("unexpected company tickers key %q", key)
+		}
+		tickers[i] = Ticker{CIK: strconv.FormatInt(t.CIK, 10), Ticker: t.Ticker, Title: t.Title}
+	}
+	return tickers, nil
+}
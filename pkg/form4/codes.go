@@ -0,0 +1,90 @@
+package form4
+
+import "strings"
+
+// TransactionCode is a code from the Form 4 instructions describing what kind of transaction was made
+type TransactionCode struct {
+	Code        string
+	Description string
+}
+
+// TransactionCodes are the codes a transaction can be reported with, in the order the instructions
+// list them: https://www.sec.gov/about/forms/form4data.pdf
+var TransactionCodes = []TransactionCode{
+	// General transaction codes
+	{"P", "Open market or private purchase of non-derivative or derivative security"},
+	{"S", "Open market or private sale of non-derivative or derivative security"},
+	{"V", "Transaction voluntarily reported earlier than required"},
+	// Rule 16b-3 transaction codes
+	{"A", "Grant, award or other acquisition pursuant to Rule 16b-3(d)"},
+	{"D", "Disposition to the issuer of issuer equity securities pursuant to Rule 16b-3(e)"},
+	{"F", "Payment of exercise price or tax liability by delivering or withholding securities incident to the receipt, exercise or vesting of a security issued in accordance with Rule 16b-3"},
+	{"I", "Discretionary transaction in accordance with Rule 16b-3(f) resulting in acquisition or disposition of issuer securities"},
+	{"M", "Exercise or conversion of derivative security exempted pursuant to Rule 16b-3"},
+	// Derivative securities codes
+	{"C", "Conversion of derivative security"},
+	{"E", "Expiration of short derivative position"},
+	{"H", "Expiration (or cancellation) of long derivative position with value received"},
+	{"O", "Exercise of out-of-the-money derivative security"},
+	{"X", "Exercise of in-the-money or at-the-money derivative security"},
+	// Other Section 16(b) exempt transaction and small acquisition codes
+	{"G", "Bona fide gift"},
+	{"L", "Small acquisition under Rule 16a-6"},
+	{"W", "Acquisition or disposition by will or the laws of descent and distribution"},
+	{"Z", "Deposit into or withdrawal from voting trust"},
+	// Other transaction codes
+	{"J", "Other acquisition or disposition (describe transaction)"},
+	{"K", "Transaction in equity swap or instrument with similar characteristics"},
+	{"U", "Disposition pursuant to a tender of shares in a change of control transaction"},
+}
+
+// Direction is a broad class of transaction combining its code and whether shares were acquired or
+// disposed of, for consumers that only care which way a trade went
+type Direction struct {
+	Direction   string
+	Description string
+}
+
+// Directions are the classes ClassifyDirection sorts transactions into
+var Directions = []Direction{
+	{"BUY", "Open market or private purchase (code P), or a discretionary acquisition under Rule 16b-3(f) (code I)"},
+	{"SELL", "Open market or private sale (code S), a discretionary disposition under Rule 16b-3(f) (code I), or a tender in a change of control (code U)"},
+	{"GRANT", "Grant or award from the issuer (code A) acquiring shares"},
+	{"EXERCISE", "Exercise or conversion of a derivative security (codes M, X, O and C)"},
+	{"TAX", "Shares withheld or delivered to pay an exercise price or tax (code F)"},
+	{"GIFT", "Bona fide gift (code G)"},
+	{"OTHER", "Any other code, or a code whose acquired or disposed flag doesn't fit it"},
+}
+
+// ClassifyDirection sorts a transaction into one of Directions by its transaction code and its
+// acquired (A) or disposed (D) code
+func ClassifyDirection(code, acquiredDisposed string) string {
+	acquired, disposed := strings.EqualFold(acquiredDisposed, "A"), strings.EqualFold(acquiredDisposed, "D")
+	switch strings.ToUpper(code) {
+	case "P":
+		return "BUY"
+	case "S":
+		return "SELL"
+	case "I":
+		if acquired {
+			return "BUY"
+		} else if disposed {
+			return "SELL"
+		}
+	case "U":
+		if disposed {
+			return "SELL"
+		}
+	case "A":
+		if acquired {
+			return "GRANT"
+		}
+	case "M", "X", "O", "C":
+		return "EXERCISE"
+	case "F":
+		return "TAX"
+	case "G":
+		return "GIFT"
+	}
+	return "OTHER"
+}
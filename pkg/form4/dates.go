@@ -0,0 +1,56 @@
+package form4
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidDate is returned for a date that can't be read or doesn't exist, e.g. 2022-02-30
+var ErrInvalidDate = errors.New("ErrInvalidDate")
+
+// dateLayouts are the forms dates are filed in. The schema's xs:date allows a time zone after the date,
+// the others turn up from filers that don't validate against it.
+var dateLayouts = []string{"2006-01-02", "20060102", "01/02/2006", "1/2/2006"}
+
+// NormalizeDate returns a date as filed in strict YYYY-MM-DD form, dropping any time zone. Empty
+// values stay empty.
+func NormalizeDate(s string) (string, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return "", nil
+	}
+	// 2022-03-30Z, 2022-03-30-05:00 and 2022-03-30+01:00 are all March 30th
+	date := s
+	if len(date) > 10 && date[4] == '-' {
+		date = date[:10]
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, date); err == nil {
+			return t.Format("2006-01-02"), nil
+		}
+	}
+	return "", fmt.Errorf("%q: %w", s, ErrInvalidDate)
+}
+
+// NormalizeDates rewrites the document's dates with NormalizeDate. Invalid dates are cleared and
+// returned as errors naming where they were.
+func (od *OwnershipDocument) NormalizeDates() []error {
+	var errs []error
+	normalize := func(field string, value *string) {
+		normalized, err := NormalizeDate(*value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", field, err))
+		}
+		*value = normalized
+	}
+	normalize("period of report", &od.PeriodOfReport)
+	normalize("date of original submission", &od.DateOfOriginalSubmission)
+	for i := range od.NonDerivativeTransactions {
+		t := &od.NonDerivativeTransactions[i]
+		normalize(fmt.Sprintf("transaction %d date", i), &t.TransactionDate)
+		normalize(fmt.Sprintf("transaction %d deemed execution date", i), &t.DeemedExecutionDate)
+	}
+	return errs
+}
@@ -0,0 +1,234 @@
+package form4
+
+import (
+	"encoding/xml"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html/charset"
+)
+
+// decoder builds an OwnershipDocument from a stream of XML tokens, keeping only the element path and
+// the text of the field being read rather than a DOM of the whole document. It fills in the same
+// values FromNode would: the trimmed inner text of the first element matching each field's path.
+type decoder struct {
+	od    *OwnershipDocument
+	path  []string
+	root  int // depth of the <ownershipDocument> element, -1 until it is found
+	scope *scope
+
+	// capture is the field whose text is being collected, nil when between fields
+	capture      *string
+	captureDepth int
+	text         strings.Builder
+}
+
+// scope is an element fields are read relative to: the document root, a reporting owner or a
+// transaction
+type scope struct {
+	parent  *scope
+	depth   int
+	paths   []string
+	targets []*string
+	seen    uint32
+	// end runs when the scope's element closes
+	end func()
+}
+
+var (
+	documentPaths = []string{
+		"schemaVersion",
+		"documentType",
+		"periodOfReport",
+		"issuer/issuerCik",
+		"issuer/issuerName",
+		"issuer/issuerTradingSymbol",
+		"remarks",
+		"dateOfOriginalSubmission",
+	}
+	ownerPaths = []string{
+		"reportingOwnerId/rptOwnerCik",
+		"reportingOwnerId/rptOwnerName",
+		"reportingOwnerAddress/rptOwnerCity",
+		"reportingOwnerAddress/rptOwnerState",
+		"reportingOwnerRelationship/isDirector",
+		"reportingOwnerRelationship/isOfficer",
+		"reportingOwnerRelationship/isTenPercentOwner",
+		"reportingOwnerRelationship/isOther",
+		"reportingOwnerRelationship/officerTitle",
+	}
+	transactionPaths = []string{
+		"securityTitle/value",
+		"transactionDate/value",
+		"deemedExecutionDate/value",
+		"transactionCoding/transactionCode",
+		"transactionAmounts/transactionShares/value",
+		"transactionAmounts/transactionPricePerShare/value",
+		"transactionAmounts/transactionAcquiredDisposedCode/value",
+		"postTransactionAmounts/sharesOwnedFollowingTransaction/value",
+		"ownershipNature/directOrIndirectOwnership/value",
+		"ownershipNature/natureOfOwnership/value",
+	}
+	holdingPaths = []string{
+		"securityTitle/value",
+		"postTransactionAmounts/sharesOwnedFollowingTransaction/value",
+		"ownershipNature/directOrIndirectOwnership/value",
+		"ownershipNature/natureOfOwnership/value",
+	}
+)
+
+// maxFieldDepth is the most elements a field path goes below its scope
+const maxFieldDepth = 3
+
+func decode(r io.Reader) (*OwnershipDocument, error) {
+	d := xml.NewDecoder(r)
+	d.CharsetReader = charset.NewReaderLabel
+	dec := decoder{root: -1}
+
+	// Read to the end even once the document is complete, so malformed XML fails the same way it
+	// does when building a DOM
+	for {
+		tok, err := d.Token()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		switch tok := tok.(type) {
+		case xml.StartElement:
+			dec.start(tok)
+		case xml.EndElement:
+			dec.end()
+		case xml.CharData:
+			if dec.capture != nil {
+				dec.text.Write(tok)
+			}
+		}
+	}
+
+	if dec.od == nil {
+		return nil, ErrNotOwnershipDocument
+	}
+	return dec.od, nil
+}
+
+func (dec *decoder) start(tok xml.StartElement) {
+	name := tok.Name.Local
+	dec.path = append(dec.path, name)
+	depth := len(dec.path) - 1
+
+	if dec.od == nil {
+		if name == "ownershipDocument" {
+			dec.od = &OwnershipDocument{}
+			dec.root = depth
+			od := dec.od
+			dec.scope = &scope{depth: depth, paths: documentPaths, targets: []*string{
+				&od.SchemaVersion, &od.DocumentType, &od.PeriodOfReport,
+				&od.Issuer.CIK, &od.Issuer.Name, &od.Issuer.TradingSymbol, &od.Remarks,
+				&od.DateOfOriginalSubmission,
+			}}
+		}
+		return
+	}
+	if dec.scope == nil || dec.capture != nil {
+		return
+	}
+
+	// Owners, transactions and holdings open a scope of their own and footnotes are captured whole,
+	// all of them directly under the root or one of its tables
+	if dec.scope.depth == dec.root {
+		switch rel := dec.path[dec.root+1:]; {
+		case len(rel) == 1 && name == "reportingOwner":
+			dec.startOwner(depth)
+			return
+		case len(rel) == 2 && rel[0] == "nonDerivativeTable" && name == "nonDerivativeTransaction":
+			dec.startTransaction(depth)
+			return
+		case len(rel) == 2 && rel[0] == "nonDerivativeTable" && name == "nonDerivativeHolding":
+			dec.startHolding(depth)
+			return
+		case len(rel) == 2 && rel[0] == "footnotes" && name == "footnote":
+			dec.startFootnote(tok, depth)
+			return
+		}
+	}
+
+	rel := dec.path[dec.scope.depth+1:]
+	if len(rel) > maxFieldDepth {
+		return
+	}
+	relPath := strings.Join(rel, "/")
+	for i, p := range dec.scope.paths {
+		if p == relPath && dec.scope.seen&(1<<i) == 0 {
+			dec.scope.seen |= 1 << i
+			dec.capture = dec.scope.targets[i]
+			dec.captureDepth = depth
+			dec.text.Reset()
+			return
+		}
+	}
+}
+
+// startOwner and startTransaction point the scope's targets into the document's slices, which is
+// safe because nothing is appended to either while one of their elements is open
+func (dec *decoder) startOwner(depth int) {
+	dec.od.ReportingOwners = append(dec.od.ReportingOwners, ReportingOwner{})
+	owner := &dec.od.ReportingOwners[len(dec.od.ReportingOwners)-1]
+	flags := []*string{&owner.IsDirector, &owner.IsOfficer, &owner.IsTenPercentOwner, &owner.IsOther}
+	dec.scope = &scope{parent: dec.scope, depth: depth, paths: ownerPaths, targets: append(append([]*string{&owner.CIK, &owner.Name, &owner.City, &owner.State}, flags...), &owner.OfficerTitle)}
+	dec.scope.end = func() {
+		for _, f := range flags {
+			if *f == "" {
+				*f = "0"
+			}
+		}
+	}
+}
+
+func (dec *decoder) startTransaction(depth int) {
+	dec.od.NonDerivativeTransactions = append(dec.od.NonDerivativeTransactions, NonDerivativeTransaction{})
+	t := &dec.od.NonDerivativeTransactions[len(dec.od.NonDerivativeTransactions)-1]
+	dec.scope = &scope{parent: dec.scope, depth: depth, paths: transactionPaths, targets: []*string{
+		&t.SecurityTitle, &t.TransactionDate, &t.DeemedExecutionDate, &t.TransactionCode, &t.Shares, &t.PricePerShare, &t.AcquiredDisposedCode,
+		&t.SharesOwnedFollowingTransaction, &t.DirectOrIndirectOwnership, &t.NatureOfOwnership,
+	}}
+}
+
+func (dec *decoder) startHolding(depth int) {
+	dec.od.NonDerivativeHoldings = append(dec.od.NonDerivativeHoldings, NonDerivativeHolding{})
+	h := &dec.od.NonDerivativeHoldings[len(dec.od.NonDerivativeHoldings)-1]
+	dec.scope = &scope{parent: dec.scope, depth: depth, paths: holdingPaths, targets: []*string{
+		&h.SecurityTitle, &h.SharesOwnedFollowingTransaction, &h.DirectOrIndirectOwnership, &h.NatureOfOwnership,
+	}}
+}
+
+func (dec *decoder) startFootnote(tok xml.StartElement, depth int) {
+	f := Footnote{}
+	for _, attr := range tok.Attr {
+		if attr.Name.Local == "id" {
+			f.ID = attr.Value
+			break
+		}
+	}
+	dec.od.Footnotes = append(dec.od.Footnotes, f)
+	dec.capture = &dec.od.Footnotes[len(dec.od.Footnotes)-1].Text
+	dec.captureDepth = depth
+	dec.text.Reset()
+}
+
+func (dec *decoder) end() {
+	depth := len(dec.path) - 1
+	dec.path = dec.path[:depth]
+
+	if dec.capture != nil && depth == dec.captureDepth {
+		*dec.capture = strings.TrimSpace(dec.text.String())
+		dec.capture = nil
+	}
+	if dec.scope != nil && depth == dec.scope.depth {
+		if dec.scope.end != nil {
+			dec.scope.end()
+		}
+		dec.scope = dec.scope.parent
+	}
+}
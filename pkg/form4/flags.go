@@ -0,0 +1,24 @@
+package form4
+
+import "strings"
+
+// NormalizeFlag returns "true" for a relationship flag filed as "1" or "true", and "false" for anything
+// else, "0", "false" or missing alike
+func NormalizeFlag(s string) string {
+	s = strings.TrimSpace(s)
+	if s == "1" || strings.EqualFold(s, "true") {
+		return "true"
+	}
+	return "false"
+}
+
+// NormalizeFlags rewrites the relationship flags of the document's reporting owners with NormalizeFlag
+func (od *OwnershipDocument) NormalizeFlags() {
+	for i := range od.ReportingOwners {
+		o := &od.ReportingOwners[i]
+		o.IsDirector = NormalizeFlag(o.IsDirector)
+		o.IsOfficer = NormalizeFlag(o.IsOfficer)
+		o.IsTenPercentOwner = NormalizeFlag(o.IsTenPercentOwner)
+		o.IsOther = NormalizeFlag(o.IsOther)
+	}
+}
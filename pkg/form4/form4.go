@@ -0,0 +1,417 @@
+// Package form4 parses the ownership XML of SEC Form 4 filings and flattens it into one row per
+// transaction. It has no network or disk dependencies, so it can be embedded without the downloader.
+package form4
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/antchfx/xmlquery"
+	"github.com/antchfx/xpath"
+)
+
+var (
+	// ErrNoXMLDocument is returned by ExtractXML when a submission has no usable <XML> block
+	ErrNoXMLDocument = errors.New("ErrNoXMLDocument")
+	// ErrNotOwnershipDocument is returned when the XML has no <ownershipDocument> root
+	ErrNotOwnershipDocument = errors.New("ErrNotOwnershipDocument")
+)
+
+// OwnershipDocument is the <ownershipDocument> of a Form 4 submission. Values are kept as the raw
+// text found in the document, missing elements are empty strings.
+type OwnershipDocument struct {
+	SchemaVersion  string
+	DocumentType   string
+	PeriodOfReport string
+	// DateOfOriginalSubmission is the filing date of the form 4 an amendment corrects, YYYY-MM-DD, and
+	// empty for original filings
+	DateOfOriginalSubmission string
+
+	Issuer          Issuer
+	ReportingOwners []ReportingOwner
+
+	NonDerivativeTransactions []NonDerivativeTransaction
+	NonDerivativeHoldings     []NonDerivativeHolding
+
+	Footnotes []Footnote
+	// Remarks is the free text the filer adds at the end of the form, e.g. exhibits or the reason
+	// for an amendment
+	Remarks string
+}
+
+type Issuer struct {
+	CIK           string
+	Name          string
+	TradingSymbol string
+}
+
+type ReportingOwner struct {
+	CIK  string
+	Name string
+	// City and State are from the owner's address as filed, which tells apart owners of the same name
+	City  string
+	State string
+
+	// Relationship flags are "1"/"0" or "true"/"false" depending on the filer, and "0" when absent.
+	// NormalizeFlags makes them all "true" or "false".
+	IsDirector        string
+	IsOfficer         string
+	IsTenPercentOwner string
+	IsOther           string
+	// OfficerTitle is free text, e.g. "EVP, Chief Financial Officer", NormalizeOfficerTitle sorts it
+	// into one of OfficerRoles
+	OfficerTitle string
+}
+
+type NonDerivativeTransaction struct {
+	SecurityTitle   string
+	TransactionDate string
+	// DeemedExecutionDate is set for transactions under a 10b5-1 plan or similar arrangement, where it
+	// rather than TransactionDate starts the two business day reporting deadline
+	DeemedExecutionDate string
+	// TransactionCode is one of TransactionCodes, e.g. P for an open market purchase
+	TransactionCode string
+
+	Shares               string
+	PricePerShare        string
+	AcquiredDisposedCode string
+
+	SharesOwnedFollowingTransaction string
+	DirectOrIndirectOwnership       string
+	// NatureOfOwnership says how indirectly owned securities are held, e.g. "By Trust", and is
+	// usually empty for direct ownership
+	NatureOfOwnership string
+}
+
+// NonDerivativeHolding is a position reported without a transaction, typically an indirect holding
+// listed for completeness
+type NonDerivativeHolding struct {
+	SecurityTitle string
+
+	SharesOwnedFollowingTransaction string
+	DirectOrIndirectOwnership       string
+	NatureOfOwnership               string
+}
+
+// Footnote is one of the document's footnotes, referenced from values by its ID (F1, F2, ...)
+type Footnote struct {
+	ID   string
+	Text string
+}
+
+// TransactionRow is a single non-derivative transaction with the issuer and reporting owner it
+// belongs to denormalized onto it
+type TransactionRow struct {
+	// TransactionIndex is the position of the transaction in the document's non-derivative table
+	TransactionIndex int
+
+	IssuerCIK    string
+	IssuerName   string
+	IssuerTicker string
+
+	ReporterCIK   string
+	ReporterName  string
+	ReporterCity  string
+	ReporterState string
+
+	IsDirector        string
+	IsOfficer         string
+	IsTenPercentOwner string
+	IsOther           string
+	OfficerTitle      string
+
+	SecurityTitle        string
+	TransactionDate      string
+	DeemedExecutionDate  string
+	TransactionCode      string
+	Shares               string
+	PricePerShare        string
+	AcquiredDisposedCode string
+
+	SharesOwnedFollowingTransaction string
+	DirectOrIndirectOwnership       string
+	NatureOfOwnership               string
+}
+
+// ExtractXML returns the ownership XML document embedded in a full submission text file. Depending
+// on the filer agent the document is named form4.xml, primarydocument.xml, primary_doc.xml or
+// something else entirely, but it is always wrapped in <XML></XML>:
+// https://www.sec.gov/Archives/edgar/data/0001184237/000156218022003904/xslF345X03/primarydocument.xml
+// https://www.sec.gov/Archives/edgar/data/1000623/000106299322009210/xslF345X03/form4.xml
+// https://www.sec.gov/Archives/edgar/data/1775157/000154161722000010/primary_doc.xml
+// https://www.sec.gov/Archives/edgar/data/0001452857/000092189522001052/xslF345X03/form404197004_04012022.xml
+//
+// When the submission carries more than one XML document, the first with an <ownershipDocument> root
+// is returned. The returned slice points into submission rather than copying it
+func ExtractXML(submission []byte) ([]byte, error) {
+	blocks, err := XMLDocuments(submission)
+	if err != nil {
+		return nil, err
+	}
+	switch len(blocks) {
+	case 0:
+		return nil, fmt.Errorf("%w: found 0 opening tags", ErrNoXMLDocument)
+	case 1:
+		return blocks[0], nil
+	}
+	for _, block := range blocks {
+		if bytes.Contains(block, ownershipDocumentTag) {
+			return block, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: none of %d XML documents is an ownership document", ErrNoXMLDocument, len(blocks))
+}
+
+// XMLDocuments returns the contents of every <XML></XML> block in a submission in order, matching
+// the tags case insensitively. The returned slices point into submission.
+func XMLDocuments(submission []byte) ([][]byte, error) {
+	var blocks [][]byte
+	rest := submission
+	for {
+		start := indexFold(rest, xmlOpen)
+		if start < 0 {
+			return blocks, nil
+		}
+		rest = rest[start+len(xmlOpen):]
+
+		end := indexFold(rest, xmlClose)
+		if end < 0 {
+			return nil, fmt.Errorf("%w: XML document %d is not closed", ErrNoXMLDocument, len(blocks)+1)
+		}
+		if nested := indexFold(rest[:end], xmlOpen); nested >= 0 {
+			return nil, fmt.Errorf("%w: XML document %d opens again before it is closed", ErrNoXMLDocument, len(blocks)+1)
+		}
+		blocks = append(blocks, rest[:end])
+		rest = rest[end+len(xmlClose):]
+	}
+}
+
+var (
+	xmlOpen              = []byte("<XML>")
+	xmlClose             = []byte("</XML>")
+	ownershipDocumentTag = []byte("<ownershipDocument")
+)
+
+// indexFold is bytes.Index ignoring ASCII case, for tags that start with '<'. It skips between '<'
+// with IndexByte rather than lowercasing a copy of s.
+func indexFold(s, tag []byte) int {
+	for i := 0; ; {
+		j := bytes.IndexByte(s[i:], '<')
+		if j < 0 {
+			return -1
+		}
+		i += j
+		if len(s)-i < len(tag) {
+			return -1
+		}
+		if bytes.EqualFold(s[i:i+len(tag)], tag) {
+			return i
+		}
+		i++
+	}
+}
+
+// The queries FromNode runs against every document, compiled once rather than per filing
+var (
+	ownershipDocumentExpr  = xpath.MustCompile("//ownershipDocument")
+	schemaVersionExpr      = xpath.MustCompile("schemaVersion")
+	documentTypeExpr       = xpath.MustCompile("documentType")
+	periodOfReportExpr     = xpath.MustCompile("periodOfReport")
+	originalSubmissionExpr = xpath.MustCompile("dateOfOriginalSubmission")
+	issuerCIKExpr          = xpath.MustCompile("issuer/issuerCik")
+	issuerNameExpr         = xpath.MustCompile("issuer/issuerName")
+	issuerSymbolExpr       = xpath.MustCompile("issuer/issuerTradingSymbol")
+
+	reportingOwnerExpr    = xpath.MustCompile("reportingOwner")
+	ownerCIKExpr          = xpath.MustCompile("reportingOwnerId/rptOwnerCik")
+	ownerNameExpr         = xpath.MustCompile("reportingOwnerId/rptOwnerName")
+	ownerCityExpr         = xpath.MustCompile("reportingOwnerAddress/rptOwnerCity")
+	ownerStateExpr        = xpath.MustCompile("reportingOwnerAddress/rptOwnerState")
+	isDirectorExpr        = xpath.MustCompile("reportingOwnerRelationship/isDirector")
+	isOfficerExpr         = xpath.MustCompile("reportingOwnerRelationship/isOfficer")
+	isTenPercentOwnerExpr = xpath.MustCompile("reportingOwnerRelationship/isTenPercentOwner")
+	isOtherExpr           = xpath.MustCompile("reportingOwnerRelationship/isOther")
+	officerTitleExpr      = xpath.MustCompile("reportingOwnerRelationship/officerTitle")
+
+	nonDerivativeTransactionExpr = xpath.MustCompile("nonDerivativeTable/nonDerivativeTransaction")
+	securityTitleExpr            = xpath.MustCompile("securityTitle/value")
+	transactionDateExpr          = xpath.MustCompile("transactionDate/value")
+	deemedExecutionDateExpr      = xpath.MustCompile("deemedExecutionDate/value")
+	transactionCodeExpr          = xpath.MustCompile("transactionCoding/transactionCode")
+	sharesExpr                   = xpath.MustCompile("transactionAmounts/transactionShares/value")
+	pricePerShareExpr            = xpath.MustCompile("transactionAmounts/transactionPricePerShare/value")
+	acquiredDisposedCodeExpr     = xpath.MustCompile("transactionAmounts/transactionAcquiredDisposedCode/value")
+	sharesOwnedFollowingExpr     = xpath.MustCompile("postTransactionAmounts/sharesOwnedFollowingTransaction/value")
+	directOrIndirectExpr         = xpath.MustCompile("ownershipNature/directOrIndirectOwnership/value")
+	natureOfOwnershipExpr        = xpath.MustCompile("ownershipNature/natureOfOwnership/value")
+
+	nonDerivativeHoldingExpr = xpath.MustCompile("nonDerivativeTable/nonDerivativeHolding")
+	footnoteExpr             = xpath.MustCompile("footnotes/footnote")
+	remarksExpr              = xpath.MustCompile("remarks")
+)
+
+// Parse reads an ownership XML document, as returned by ExtractXML. It decodes the XML as a stream
+// of tokens rather than building a DOM, use FromNode when the DOM is needed for other queries too.
+func Parse(r io.Reader) (*OwnershipDocument, error) {
+	return decode(r)
+}
+
+// FromNode builds the document from an already parsed DOM, for callers that also run their own
+// queries against it. It returns the same document Parse does.
+func FromNode(doc *xmlquery.Node) (*OwnershipDocument, error) {
+	root := xmlquery.QuerySelector(doc, ownershipDocumentExpr)
+	if root == nil {
+		return nil, ErrNotOwnershipDocument
+	}
+
+	od := &OwnershipDocument{
+		SchemaVersion:            text(root, schemaVersionExpr),
+		DocumentType:             text(root, documentTypeExpr),
+		PeriodOfReport:           text(root, periodOfReportExpr),
+		DateOfOriginalSubmission: text(root, originalSubmissionExpr),
+		Issuer: Issuer{
+			CIK:           text(root, issuerCIKExpr),
+			Name:          text(root, issuerNameExpr),
+			TradingSymbol: text(root, issuerSymbolExpr),
+		},
+	}
+
+	for _, owner := range xmlquery.QuerySelectorAll(root, reportingOwnerExpr) {
+		od.ReportingOwners = append(od.ReportingOwners, ReportingOwner{
+			CIK:               text(owner, ownerCIKExpr),
+			Name:              text(owner, ownerNameExpr),
+			City:              text(owner, ownerCityExpr),
+			State:             text(owner, ownerStateExpr),
+			IsDirector:        flag(owner, isDirectorExpr),
+			IsOfficer:         flag(owner, isOfficerExpr),
+			IsTenPercentOwner: flag(owner, isTenPercentOwnerExpr),
+			IsOther:           flag(owner, isOtherExpr),
+			OfficerTitle:      text(owner, officerTitleExpr),
+		})
+	}
+
+	for _, t := range xmlquery.QuerySelectorAll(root, nonDerivativeTransactionExpr) {
+		od.NonDerivativeTransactions = append(od.NonDerivativeTransactions, NonDerivativeTransaction{
+			SecurityTitle:                   text(t, securityTitleExpr),
+			TransactionDate:                 text(t, transactionDateExpr),
+			DeemedExecutionDate:             text(t, deemedExecutionDateExpr),
+			TransactionCode:                 text(t, transactionCodeExpr),
+			Shares:                          text(t, sharesExpr),
+			PricePerShare:                   text(t, pricePerShareExpr),
+			AcquiredDisposedCode:            text(t, acquiredDisposedCodeExpr),
+			SharesOwnedFollowingTransaction: text(t, sharesOwnedFollowingExpr),
+			DirectOrIndirectOwnership:       text(t, directOrIndirectExpr),
+			NatureOfOwnership:               text(t, natureOfOwnershipExpr),
+		})
+	}
+
+	for _, h := range xmlquery.QuerySelectorAll(root, nonDerivativeHoldingExpr) {
+		od.NonDerivativeHoldings = append(od.NonDerivativeHoldings, NonDerivativeHolding{
+			SecurityTitle:                   text(h, securityTitleExpr),
+			SharesOwnedFollowingTransaction: text(h, sharesOwnedFollowingExpr),
+			DirectOrIndirectOwnership:       text(h, directOrIndirectExpr),
+			NatureOfOwnership:               text(h, natureOfOwnershipExpr),
+		})
+	}
+
+	for _, f := range xmlquery.QuerySelectorAll(root, footnoteExpr) {
+		od.Footnotes = append(od.Footnotes, Footnote{
+			ID:   f.SelectAttr("id"),
+			Text: strings.TrimSpace(f.InnerText()),
+		})
+	}
+	od.Remarks = text(root, remarksExpr)
+
+	return od, nil
+}
+
+// Flatten returns one row per non-derivative transaction, attributed to the first reporting owner
+func Flatten(od *OwnershipDocument) []TransactionRow {
+	rows := make([]TransactionRow, 0, len(od.NonDerivativeTransactions))
+	ForEachTransaction(od, func(row TransactionRow) error {
+		rows = append(rows, row)
+		return nil
+	})
+	return rows
+}
+
+// ForEachTransaction calls fn with each row Flatten would return without building the slice,
+// stopping at the first error
+func ForEachTransaction(od *OwnershipDocument, fn func(row TransactionRow) error) error {
+	owner := ReportingOwner{IsDirector: "0", IsOfficer: "0", IsTenPercentOwner: "0", IsOther: "0"}
+	if len(od.ReportingOwners) > 0 {
+		owner = od.ReportingOwners[0]
+	}
+
+	for i, t := range od.NonDerivativeTransactions {
+		if err := fn(transactionRow(od, owner, i, t)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// FlattenOwners returns one row per non-derivative transaction and reporting owner, so each filer of
+// a joint filing has its own rows. The rows of a transaction are together, in the order the owners
+// are listed, and a document with a single owner flattens as Flatten does.
+func FlattenOwners(od *OwnershipDocument) []TransactionRow {
+	if len(od.ReportingOwners) < 2 {
+		return Flatten(od)
+	}
+	rows := make([]TransactionRow, 0, len(od.NonDerivativeTransactions)*len(od.ReportingOwners))
+	for i, t := range od.NonDerivativeTransactions {
+		for _, owner := range od.ReportingOwners {
+			rows = append(rows, transactionRow(od, owner, i, t))
+		}
+	}
+	return rows
+}
+
+// transactionRow denormalizes the issuer and an owner onto the transaction at index i
+func transactionRow(od *OwnershipDocument, owner ReportingOwner, i int, t NonDerivativeTransaction) TransactionRow {
+	return TransactionRow{
+		TransactionIndex:                i,
+		IssuerCIK:                       od.Issuer.CIK,
+		IssuerName:                      od.Issuer.Name,
+		IssuerTicker:                    od.Issuer.TradingSymbol,
+		ReporterCIK:                     owner.CIK,
+		ReporterName:                    owner.Name,
+		ReporterCity:                    owner.City,
+		ReporterState:                   owner.State,
+		IsDirector:                      owner.IsDirector,
+		IsOfficer:                       owner.IsOfficer,
+		IsTenPercentOwner:               owner.IsTenPercentOwner,
+		IsOther:                         owner.IsOther,
+		OfficerTitle:                    owner.OfficerTitle,
+		SecurityTitle:                   t.SecurityTitle,
+		TransactionDate:                 t.TransactionDate,
+		DeemedExecutionDate:             t.DeemedExecutionDate,
+		TransactionCode:                 t.TransactionCode,
+		Shares:                          t.Shares,
+		PricePerShare:                   t.PricePerShare,
+		AcquiredDisposedCode:            t.AcquiredDisposedCode,
+		SharesOwnedFollowingTransaction: t.SharesOwnedFollowingTransaction,
+		DirectOrIndirectOwnership:       t.DirectOrIndirectOwnership,
+		NatureOfOwnership:               t.NatureOfOwnership,
+	}
+}
+
+// text returns the inner text of the first node matching expr under n, or "" if there is none
+func text(n *xmlquery.Node, expr *xpath.Expr) string {
+	found := xmlquery.QuerySelector(n, expr)
+	if found == nil {
+		return ""
+	}
+	return strings.TrimSpace(found.InnerText())
+}
+
+// flag is text for relationship flags, which filers leave out rather than setting to 0
+func flag(n *xmlquery.Node, expr *xpath.Expr) string {
+	if v := text(n, expr); v != "" {
+		return v
+	}
+	return "0"
+}
@@ -0,0 +1,383 @@
+package form4
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	goflag "flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/antchfx/xmlquery"
+)
+
+var update = goflag.Bool("update", false, "rewrite the golden files in testdata from the current parser output")
+
+// golden is what a submission in testdata is expected to parse to, stored next to it as name.golden.json
+type golden struct {
+	Error    string             `json:",omitempty"`
+	Document *OwnershipDocument `json:",omitempty"`
+	Rows     []TransactionRow   `json:",omitempty"`
+}
+
+func parseSubmission(submission []byte) golden {
+	xmlContent, err := ExtractXML(submission)
+	if err != nil {
+		return golden{Error: err.Error()}
+	}
+	od, err := Parse(bytes.NewReader(xmlContent))
+	if err != nil {
+		return golden{Error: err.Error()}
+	}
+	return golden{Document: od, Rows: Flatten(od)}
+}
+
+func corpus(t testing.TB) []string {
+	files, err := filepath.Glob(filepath.Join("testdata", "*.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no submissions in testdata")
+	}
+	return files
+}
+
+func TestGolden(t *testing.T) {
+	for _, file := range corpus(t) {
+		file := file
+		t.Run(filepath.Base(file), func(t *testing.T) {
+			submission, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.MarshalIndent(parseSubmission(submission), "", "  ")
+			if err != nil {
+				t.Fatal(err)
+			}
+			got = append(got, '\n')
+
+			goldenPath := strings.TrimSuffix(file, ".txt") + ".golden.json"
+			if *update {
+				if err := os.WriteFile(goldenPath, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatalf("%s, run go test -update to create it", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("output differs from %s, run go test -update if the change is intended\ngot:\n%s", goldenPath, got)
+			}
+		})
+	}
+}
+
+// fromDOM parses like Parse but through FromNode, which must agree with the streaming decoder
+func fromDOM(xmlContent []byte) (*OwnershipDocument, error) {
+	doc, err := xmlquery.Parse(bytes.NewReader(xmlContent))
+	if err != nil {
+		return nil, err
+	}
+	return FromNode(doc)
+}
+
+func TestParseMatchesFromNode(t *testing.T) {
+	for _, file := range corpus(t) {
+		submission, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		xmlContent, err := ExtractXML(submission)
+		if err != nil {
+			continue
+		}
+		streamed, streamErr := Parse(bytes.NewReader(xmlContent))
+		dom, domErr := fromDOM(xmlContent)
+		if (streamErr == nil) != (domErr == nil) {
+			t.Errorf("%s: Parse returned %v, FromNode %v", file, streamErr, domErr)
+		}
+		if !reflect.DeepEqual(streamed, dom) {
+			t.Errorf("%s: Parse returned %+v, FromNode %+v", file, streamed, dom)
+		}
+	}
+}
+
+func TestFlattenOwners(t *testing.T) {
+	submission, err := os.ReadFile(filepath.Join("testdata", "joint_filers_x0407.txt"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	xmlContent, err := ExtractXML(submission)
+	if err != nil {
+		t.Fatal(err)
+	}
+	od, err := Parse(bytes.NewReader(xmlContent))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rows := FlattenOwners(od)
+	if want := len(od.NonDerivativeTransactions) * len(od.ReportingOwners); len(rows) != want {
+		t.Fatalf("got %d rows for %d transactions of %d owners, want %d", len(rows), len(od.NonDerivativeTransactions), len(od.ReportingOwners), want)
+	}
+	for i, row := range rows {
+		owner := od.ReportingOwners[i%len(od.ReportingOwners)]
+		if row.ReporterCIK != owner.CIK || row.IsDirector != owner.IsDirector || row.TransactionIndex != i/len(od.ReportingOwners) {
+			t.Errorf("row %d is transaction %d of %s, want transaction %d of %s", i, row.TransactionIndex, row.ReporterCIK, i/len(od.ReportingOwners), owner.CIK)
+		}
+	}
+	if first := Flatten(od); !reflect.DeepEqual(rows[0], first[0]) {
+		t.Errorf("the first owner's row %+v differs from Flatten's %+v", rows[0], first[0])
+	}
+}
+
+func TestNormalizeDecimal(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		invalid  bool
+	}{
+		{in: "", want: ""},
+		{in: "100", want: "100"},
+		{in: "12500.5", want: "12500.5"},
+		{in: "1,000", want: "1000"},
+		{in: " 1,500.00 ", want: "1500"},
+		{in: "$12.50", want: "12.5"},
+		{in: "1.5E+3", want: "1500"},
+		{in: "2.5e-2", want: "0.025"},
+		{in: "0", want: "0"},
+		{in: "-5", invalid: true},
+		{in: "N/A", invalid: true},
+		{in: "see footnote", invalid: true},
+		{in: "1e30", want: "1000000000000000000000000000000"},
+		{in: "1e-30", want: "0.000000000000000000000000000001"},
+		{in: "1e31", invalid: true},
+		{in: "1e-31", invalid: true},
+		{in: "1e3000000", invalid: true},
+		{in: "1e300000000", invalid: true},
+		{in: "1.5E-300000000", invalid: true},
+		{in: strings.Repeat("1", 65), invalid: true},
+	} {
+		got, err := NormalizeDecimal(tc.in)
+		if tc.invalid {
+			if !errors.Is(err, ErrInvalidNumber) {
+				t.Errorf("NormalizeDecimal(%q) = %q, %v, want ErrInvalidNumber", tc.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("NormalizeDecimal(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestNormalizeDate(t *testing.T) {
+	for _, tc := range []struct {
+		in, want string
+		invalid  bool
+	}{
+		{in: "", want: ""},
+		{in: "2022-03-30", want: "2022-03-30"},
+		{in: " 2022-03-30 ", want: "2022-03-30"},
+		{in: "2022-03-30-05:00", want: "2022-03-30"},
+		{in: "2022-03-30Z", want: "2022-03-30"},
+		{in: "20220330", want: "2022-03-30"},
+		{in: "03/30/2022", want: "2022-03-30"},
+		{in: "3/5/2022", want: "2022-03-05"},
+		{in: "2022-02-30", invalid: true},
+		{in: "2022-13-01", invalid: true},
+		{in: "March 30, 2022", invalid: true},
+	} {
+		got, err := NormalizeDate(tc.in)
+		if tc.invalid {
+			if !errors.Is(err, ErrInvalidDate) {
+				t.Errorf("NormalizeDate(%q) = %q, %v, want ErrInvalidDate", tc.in, got, err)
+			}
+			continue
+		}
+		if err != nil || got != tc.want {
+			t.Errorf("NormalizeDate(%q) = %q, %v, want %q", tc.in, got, err, tc.want)
+		}
+	}
+}
+
+func TestNormalizeFlag(t *testing.T) {
+	for in, want := range map[string]string{"1": "true", "true": "true", "TRUE": "true", "0": "false", "false": "false", "": "false"} {
+		if got := NormalizeFlag(in); got != want {
+			t.Errorf("NormalizeFlag(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestClassifyNatureOfOwnership(t *testing.T) {
+	for in, want := range map[string]string{
+		"By Trust":                        "TRUST",
+		"By Family Trust":                 "TRUST",
+		"By Spouse":                       "SPOUSE",
+		"By Spouse's IRA":                 "RETIREMENT",
+		"By 401(k) Plan":                  "RETIREMENT",
+		"By Children":                     "CHILD",
+		"By Smith Family Foundation":      "FOUNDATION",
+		"By Activist Capital Partners LP": "ENTITY",
+		"By LLC":                          "ENTITY",
+		"See footnote":                    "OTHER",
+		"":                                "",
+	} {
+		if got := ClassifyNatureOfOwnership(in); got != want {
+			t.Errorf("ClassifyNatureOfOwnership(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestNormalizeOfficerTitle(t *testing.T) {
+	for in, want := range map[string]string{
+		"Chief Executive Officer":      "CEO",
+		"President and CEO":            "CEO",
+		"EVP, Chief Financial Officer": "CFO",
+		"Chairman & CEO":               "CEO",
+		"Executive Chairman":           "CHAIR",
+		"Chief Marketing Officer":      "OTHER_CHIEF",
+		"Corporate Controller":         "CAO",
+		"SVP, General Counsel":         "GENERAL_COUNSEL",
+		"Senior Vice President":        "SVP",
+		"Sr. Vice President, Sales":    "SVP",
+		"Executive Vice President":     "EVP",
+		"VP Operations":                "VP",
+		"President":                    "PRESIDENT",
+		"Secretary":                    "SECRETARY",
+		"See Remarks":                  "OTHER",
+		"":                             "",
+	} {
+		if got := NormalizeOfficerTitle(in); got != want {
+			t.Errorf("NormalizeOfficerTitle(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func addCorpus(f *testing.F) {
+	for _, file := range corpus(f) {
+		submission, err := os.ReadFile(file)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(submission)
+	}
+}
+
+func FuzzExtractXML(f *testing.F) {
+	addCorpus(f)
+	f.Fuzz(func(t *testing.T, submission []byte) {
+		xmlContent, err := ExtractXML(submission)
+		if err != nil {
+			return
+		}
+		if !bytes.Contains(submission, xmlContent) {
+			t.Fatalf("extracted XML is not part of the submission: %q", xmlContent)
+		}
+	})
+}
+
+func FuzzParse(f *testing.F) {
+	addCorpus(f)
+	f.Fuzz(func(t *testing.T, submission []byte) {
+		xmlContent, err := ExtractXML(submission)
+		if err != nil {
+			xmlContent = submission
+		}
+		od, err := Parse(bytes.NewReader(xmlContent))
+		if err != nil {
+			return
+		}
+		if dom, err := fromDOM(xmlContent); err == nil && !reflect.DeepEqual(od, dom) {
+			t.Fatalf("Parse returned %+v, FromNode %+v", od, dom)
+		}
+		rows := Flatten(od)
+		if len(rows) != len(od.NonDerivativeTransactions) {
+			t.Fatalf("got %d rows for %d transactions", len(rows), len(od.NonDerivativeTransactions))
+		}
+		for i, row := range rows {
+			if row.TransactionIndex != i {
+				t.Fatalf("row %d has transaction index %d", i, row.TransactionIndex)
+			}
+		}
+	})
+}
+
+func BenchmarkExtractXML(b *testing.B) {
+	submission, err := os.ReadFile(filepath.Join("testdata", "footnotes_x0508.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(submission)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := ExtractXML(submission); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	submission, err := os.ReadFile(filepath.Join("testdata", "footnotes_x0508.txt"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	xmlContent, err := ExtractXML(submission)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(xmlContent)))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		od, err := Parse(bytes.NewReader(xmlContent))
+		if err != nil {
+			b.Fatal(err)
+		}
+		Flatten(od)
+	}
+}
+
+func TestMentionsRule10b51Plan(t *testing.T) {
+	for text, want := range map[string]bool{
+		"Sold pursuant to a Rule 10b5-1 trading plan adopted on May 1, 2023.": true,
+		"Effected under a 10b-5-1 plan.":                                      true,
+		"Purchased under a Rule 10b5‑1 plan.":                                 true,
+		"Weighted average price.":                                             false,
+		"These sales were not made pursuant to a Rule 10b5-1 plan.":           false,
+		"Not pursuant to a 10b5-1 plan.":                                      false,
+	} {
+		od := &OwnershipDocument{Footnotes: []Footnote{{ID: "F1", Text: text}}}
+		if got := od.MentionsRule10b51Plan(); got != want {
+			t.Errorf("MentionsRule10b51Plan() with footnote %q = %v, want %v", text, got, want)
+		}
+	}
+	if od := (&OwnershipDocument{Remarks: "All sales under a Rule 10b5-1 plan."}); !od.MentionsRule10b51Plan() {
+		t.Error("MentionsRule10b51Plan() missed a plan in the remarks")
+	}
+}
+
+func TestClassifyDirection(t *testing.T) {
+	for _, c := range []struct{ code, ad, want string }{
+		{"P", "A", "BUY"},
+		{"S", "D", "SELL"},
+		{"I", "A", "BUY"},
+		{"I", "D", "SELL"},
+		{"U", "D", "SELL"},
+		{"A", "A", "GRANT"},
+		{"A", "D", "OTHER"},
+		{"M", "A", "EXERCISE"},
+		{"F", "D", "TAX"},
+		{"G", "D", "GIFT"},
+		{"J", "A", "OTHER"},
+		{"", "", "OTHER"},
+	} {
+		if got := ClassifyDirection(c.code, c.ad); got != c.want {
+			t.Errorf("ClassifyDirection(%q, %q) = %q, want %q", c.code, c.ad, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package form4
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/shopspring/decimal"
+)
+
+// ErrInvalidNumber is returned for a share count or price that isn't a non-negative number
+var ErrInvalidNumber = errors.New("ErrInvalidNumber")
+
+// Bounds of the numbers ParseDecimal accepts. No share count or price comes close, and a huge
+// exponent would take seconds and hundreds of megabytes to write out in full.
+const (
+	maxDecimalLength   = 64
+	maxDecimalExponent = 30
+)
+
+// ParseDecimal reads a share count or price as filed. Filers write them with thousands separators
+// (1,000), a dollar sign, surrounding spaces or in scientific notation (1.5E+3), all of which are
+// accepted. Negative values are not, the direction of a transaction is its acquired or disposed code,
+// and neither are values longer than 64 characters or with an exponent beyond ±30.
+func ParseDecimal(s string) (decimal.Decimal, error) {
+	cleaned := strings.TrimPrefix(strings.ReplaceAll(strings.TrimSpace(s), ",", ""), "$")
+	if len(cleaned) > maxDecimalLength {
+		return decimal.Zero, fmt.Errorf("%.20q...: %w", s, ErrInvalidNumber)
+	}
+	d, err := decimal.NewFromString(cleaned)
+	if err != nil || d.IsNegative() || d.Exponent() > maxDecimalExponent || d.Exponent() < -maxDecimalExponent {
+		return decimal.Zero, fmt.Errorf("%q: %w", s, ErrInvalidNumber)
+	}
+	return d, nil
+}
+
+// NormalizeDecimal returns a number as filed in canonical form: plain digits with no exponent, thousands
+// separators or trailing zeros, e.g. 1500 for "1,500.00" or "1.5E+3". Empty values stay empty.
+func NormalizeDecimal(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	d, err := ParseDecimal(s)
+	if err != nil {
+		return "", err
+	}
+	return d.String(), nil
+}
+
+// NormalizeNumbers rewrites the share counts and prices of the document's transactions and holdings
+// with NormalizeDecimal. Invalid values are cleared and returned as errors naming where they were.
+func (od *OwnershipDocument) NormalizeNumbers() []error {
+	var errs []error
+	normalize := func(field string, value *string) {
+		normalized, err := NormalizeDecimal(*value)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s %w", field, err))
+		}
+		*value = normalized
+	}
+	for i := range od.NonDerivativeTransactions {
+		t := &od.NonDerivativeTransactions[i]
+		normalize(fmt.Sprintf("transaction %d shares", i), &t.Shares)
+		normalize(fmt.Sprintf("transaction %d price", i), &t.PricePerShare)
+		normalize(fmt.Sprintf("transaction %d shares owned following", i), &t.SharesOwnedFollowingTransaction)
+	}
+	for i := range od.NonDerivativeHoldings {
+		normalize(fmt.Sprintf("holding %d shares owned", i), &od.NonDerivativeHoldings[i].SharesOwnedFollowingTransaction)
+	}
+	return errs
+}
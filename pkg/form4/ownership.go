@@ -0,0 +1,43 @@
+package form4
+
+import (
+	"regexp"
+	"strings"
+)
+
+// IndirectOwnershipType is a category of the free text nature of ownership filers give for indirectly
+// held securities
+type IndirectOwnershipType struct {
+	Type        string
+	Description string
+	// pattern matches the words of a nature of ownership of this type, lower cased
+	pattern *regexp.Regexp
+}
+
+// IndirectOwnershipTypes are the categories ClassifyNatureOfOwnership sorts into, in the order they are
+// tried: "By Spouse's IRA" is a retirement account and "By Family Trust" a trust
+var IndirectOwnershipTypes = []IndirectOwnershipType{
+	{"RETIREMENT", "401(k), IRA, pension, profit sharing or employee stock plan account", regexp.MustCompile(`\b(401\s*\(?k\)?|ira|roth|sep|esop|pension|retirement|profit[ -]sharing|keogh|deferred compensation)\b`)},
+	{"FOUNDATION", "Private foundation or charity", regexp.MustCompile(`\b(foundation|charitable|charity|endowment)\b`)},
+	{"TRUST", "Trust, including family, grantor retained annuity and voting trusts", regexp.MustCompile(`\b(trusts?|trustee|grat|revocable|irrevocable)\b`)},
+	{"SPOUSE", "Spouse", regexp.MustCompile(`\b(spouse|wife|husband)\b`)},
+	{"CHILD", "Children, including custodial accounts for minors", regexp.MustCompile(`\b(child|children|son|sons|daughters?|minor|utma|ugma|custodian)\b`)},
+	{"FAMILY", "Other family members or a family partnership", regexp.MustCompile(`\b(family|mother|father|parents?|sister|brother|household)\b`)},
+	{"ENTITY", "Company, partnership or fund the owner controls", regexp.MustCompile(`\b(llc|l\.l\.c|lp|l\.p|llp|partnership|partners|fund|funds|corp|corporation|inc|ltd|holdings|capital|company|co)\b`)},
+	{"OTHER", "Indirect ownership that doesn't fit another type", nil},
+}
+
+// ClassifyNatureOfOwnership returns the Type of the first of IndirectOwnershipTypes a nature of
+// ownership matches, OTHER if none do, and "" when it is empty
+func ClassifyNatureOfOwnership(nature string) string {
+	nature = strings.ToLower(strings.TrimSpace(nature))
+	if nature == "" {
+		return ""
+	}
+	for _, t := range IndirectOwnershipTypes {
+		if t.pattern != nil && t.pattern.MatchString(nature) {
+			return t.Type
+		}
+	}
+	return "OTHER"
+}
@@ -0,0 +1,32 @@
+package form4
+
+import (
+	"regexp"
+	"strings"
+)
+
+// rule10b51Expr matches a mention of Rule 10b5-1, however the filer hyphenated it
+var rule10b51Expr = regexp.MustCompile(`(?i)10b\s*[-‐‑–]?\s*5\s*[-‐‑–]\s*1`)
+
+// negatedPlanExpr matches the end of the text before a mention of Rule 10b5-1 that says the
+// transactions weren't made under a plan, e.g. "not pursuant to a Rule"
+var negatedPlanExpr = regexp.MustCompile(`(?i)\bnot\s+(\w+\s+){0,4}$`)
+
+// MentionsRule10b51Plan is whether the document's footnotes or remarks say its transactions were made
+// under a Rule 10b5-1 trading plan. Footnotes aren't tied to the transactions they annotate when
+// parsed, so this is for the whole filing. Mentions that say a transaction was not made under a plan
+// don't count.
+func (od *OwnershipDocument) MentionsRule10b51Plan() bool {
+	texts := []string{od.Remarks}
+	for _, f := range od.Footnotes {
+		texts = append(texts, f.Text)
+	}
+	for _, text := range texts {
+		for _, loc := range rule10b51Expr.FindAllStringIndex(text, -1) {
+			if !negatedPlanExpr.MatchString(strings.TrimSuffix(strings.TrimSpace(text[:loc[0]]), "Rule") + " ") {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,50 @@
+package form4
+
+import (
+	"regexp"
+	"strings"
+)
+
+// OfficerRole is a normalized category of the free text officer titles filers give
+type OfficerRole struct {
+	Role        string
+	Description string
+	// pattern matches the words of a title of this role, lower cased
+	pattern *regexp.Regexp
+}
+
+// OfficerRoles are the roles NormalizeOfficerTitle sorts titles into, in the order they are tried. The
+// most senior role a title names wins, "President and CEO" is CEO, and vice presidents are tried
+// before PRESIDENT so "Senior Vice President" isn't one.
+var OfficerRoles = []OfficerRole{
+	{"CEO", "Chief executive officer", regexp.MustCompile(`\bceo\b|chief executive|principal executive`)},
+	{"CFO", "Chief financial officer", regexp.MustCompile(`\bcfo\b|chief financial|principal financial`)},
+	{"COO", "Chief operating officer", regexp.MustCompile(`\bcoo\b|chief operating`)},
+	{"CAO", "Chief accounting officer or controller", regexp.MustCompile(`\bcao\b|chief accounting|principal accounting|controller|comptroller`)},
+	{"CTO", "Chief technology officer", regexp.MustCompile(`\bcto\b|chief technology`)},
+	{"GENERAL_COUNSEL", "General counsel or chief legal officer", regexp.MustCompile(`general counsel|\bclo\b|chief legal`)},
+	{"CHAIR", "Executive chair of the board", regexp.MustCompile(`\bchair(man|woman|person)?\b`)},
+	{"OTHER_CHIEF", "Any other chief officer, e.g. chief marketing officer", regexp.MustCompile(`\bchief\b|\bc[a-z]o\b`)},
+	{"EVP", "Executive vice president", regexp.MustCompile(`\bevp\b|\bexec(utive|\.)? vice`)},
+	{"SVP", "Senior vice president", regexp.MustCompile(`\bsvp\b|\bsenior vice|\bsr\.? vice`)},
+	{"VP", "Vice president", regexp.MustCompile(`\bvp\b|vice president|vice-president`)},
+	{"PRESIDENT", "President, of the company or a division of it", regexp.MustCompile(`\bpres(ident|\.)?\b`)},
+	{"SECRETARY", "Corporate secretary", regexp.MustCompile(`\bsecretary\b`)},
+	{"TREASURER", "Treasurer", regexp.MustCompile(`\btreasurer\b`)},
+	{"OTHER", "An officer title that doesn't fit another role, including \"See Remarks\"", nil},
+}
+
+// NormalizeOfficerTitle returns the Role of the first of OfficerRoles an officer title matches, OTHER
+// if none do, and "" when it is empty
+func NormalizeOfficerTitle(title string) string {
+	title = strings.ToLower(strings.TrimSpace(title))
+	if title == "" {
+		return ""
+	}
+	for _, r := range OfficerRoles {
+		if r.pattern != nil && r.pattern.MatchString(title) {
+			return r.Role
+		}
+	}
+	return "OTHER"
+}
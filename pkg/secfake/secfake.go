@@ -0,0 +1,231 @@
+// Package secfake serves recorded EDGAR documents from an httptest server, so code built on pkg/edgar
+// can be exercised without hitting sec.gov. Fixtures are keyed by URL path, e.g.
+// /Archives/edgar/daily-index/2022/QTR2/master.20220401.idx, and can be captured from the real site
+// with a Recorder.
+package secfake
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"html"
+	"io/fs"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/danthegoodman1/SECForm4Analysis/pkg/edgar"
+)
+
+// indexFileName is what a directory URL (ending in /) is stored as on disk
+const indexFileName = "index.html"
+
+// Server is a fake sec.gov, data.sec.gov and www.sec.gov/files on a single host
+type Server struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	files    map[string][]byte
+	faults   map[string][]int
+	requests []string
+}
+
+// NewServer starts an empty fake server, call Close when done with it
+func NewServer() *Server {
+	s := &Server{
+		files:  map[string][]byte{},
+		faults: map[string][]int{},
+	}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	return s
+}
+
+// LoadDir starts a server with every file under dir as a fixture, as written by a Recorder
+func LoadDir(dir string) (*Server, error) {
+	s := NewServer()
+	err := filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		content, err := ioutil.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		s.Add(pathFromFile(filepath.ToSlash(rel)), content)
+		return nil
+	})
+	if err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// Options returns client options pointing every EDGAR endpoint at the server
+func (s *Server) Options() edgar.Options {
+	return edgar.Options{
+		ArchivesURL: s.URL + "/Archives",
+		DataURL:     s.URL,
+		FilesURL:    s.URL + "/files",
+	}
+}
+
+// Add serves body at the URL path p
+func (s *Server) Add(p string, body []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[p] = body
+}
+
+// FailNext makes the next requests for p answer with the given status codes in order before the
+// fixture is served again, e.g. FailNext(p, 429, 500) to exercise rate limit and retry handling
+func (s *Server) FailNext(p string, statusCodes ...int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.faults[p] = append(s.faults[p], statusCodes...)
+}
+
+// Requests returns the paths requested so far, in order
+func (s *Server) Requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.requests...)
+}
+
+func (s *Server) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.URL.Path)
+	var status int
+	if faults := s.faults[r.URL.Path]; len(faults) > 0 {
+		status, s.faults[r.URL.Path] = faults[0], faults[1:]
+	}
+	body, ok := s.files[r.URL.Path]
+	if !ok && strings.HasSuffix(r.URL.Path, "/") {
+		body, ok = s.listing(r.URL.Path)
+	}
+	s.mu.Unlock()
+
+	if status != 0 {
+		w.WriteHeader(status)
+		return
+	}
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+		var b bytes.Buffer
+		gw := gzip.NewWriter(&b)
+		gw.Write(body)
+		gw.Close()
+		w.Header().Set("Content-Encoding", "gzip")
+		body = b.Bytes()
+	}
+	w.Write(body)
+}
+
+// listing generates a directory listing like the one the archives serve, linking every fixture
+// directly under dir. The caller holds s.mu.
+func (s *Server) listing(dir string) ([]byte, bool) {
+	names := []string{}
+	for p := range s.files {
+		if strings.HasPrefix(p, dir) && !strings.Contains(strings.TrimPrefix(p, dir), "/") {
+			names = append(names, strings.TrimPrefix(p, dir))
+		}
+	}
+	if len(names) == 0 {
+		return nil, false
+	}
+	sort.Strings(names)
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<html><body><table>\n")
+	for _, name := range names {
+		fmt.Fprintf(&b, "<tr><td><a href=\"%s\">%s</a></td></tr>\n", html.EscapeString(name), html.EscapeString(name))
+	}
+	fmt.Fprintf(&b, "</table></body></html>\n")
+	return b.Bytes(), true
+}
+
+// fileFromPath maps a URL path to the relative file a Recorder stores it in
+func fileFromPath(p string) string {
+	p = strings.TrimPrefix(path.Clean("/"+p), "/")
+	if p == "" {
+		return indexFileName
+	}
+	return p
+}
+
+// pathFromFile is the inverse of fileFromPath
+func pathFromFile(rel string) string {
+	if rel == indexFileName {
+		return "/"
+	}
+	if strings.HasSuffix(rel, "/"+indexFileName) {
+		return "/" + strings.TrimSuffix(rel, indexFileName)
+	}
+	return "/" + rel
+}
+
+// Recorder is an http.RoundTripper that saves every successful response body under Dir, keyed by URL
+// path, so a real session can be replayed with LoadDir. Use it as the Transport of the HTTPClient
+// in edgar.Options.
+type Recorder struct {
+	Dir string
+	// Transport makes the real requests, http.DefaultTransport if nil
+	Transport http.RoundTripper
+}
+
+func (rec *Recorder) RoundTrip(req *http.Request) (*http.Response, error) {
+	transport := rec.Transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		return resp, err
+	}
+
+	raw, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewReader(raw))
+
+	// Fixtures are stored decoded, the server compresses them again on the way out
+	content := raw
+	if resp.Header.Get("Content-Encoding") == "gzip" {
+		gr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s for recording: %w", req.URL, err)
+		}
+		content, err = ioutil.ReadAll(gr)
+		if err != nil {
+			return nil, fmt.Errorf("error decoding %s for recording: %w", req.URL, err)
+		}
+	}
+
+	p := filepath.Join(rec.Dir, filepath.FromSlash(fileFromPath(req.URL.Path)))
+	if strings.HasSuffix(req.URL.Path, "/") {
+		p = filepath.Join(p, indexFileName)
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0777); err != nil {
+		return nil, err
+	}
+	if err := ioutil.WriteFile(p, content, 0666); err != nil {
+		return nil, fmt.Errorf("error recording %s: %w", req.URL, err)
+	}
+	return resp, nil
+}